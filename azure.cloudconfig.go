@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/webdevops/go-common/azuresdk/cloudconfig"
+)
+
+// loadAzureCloudConfigFile reads a custom Azure cloud (sovereign/air-gapped clouds) from a JSON file:
+//
+//	{
+//	  "name": "AzureCustomCloud",
+//	  "activeDirectoryAuthorityHost": "https://login.example.com/",
+//	  "services": {
+//	    "resourceManager": {"audience": "https://management.example.com/", "endpoint": "https://management.example.com"}
+//	  }
+//	}
+//
+// the Active Directory authority and the endpoint and audience of the resource manager are required
+func loadAzureCloudConfigFile(path string) (cloudconfig.CloudEnvironment, error) {
+	cloudConfig := cloudconfig.CloudEnvironment{}
+
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return cloudConfig, fmt.Errorf(`unable to read Azure cloud config file "%s": %w`, path, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&cloudConfig); err != nil {
+		return cloudConfig, fmt.Errorf(`unable to parse Azure cloud config file "%s": %w`, path, err)
+	}
+
+	if cloudConfig.Name == "" {
+		cloudConfig.Name = cloudconfig.AzurePrivateCloud
+	}
+
+	if err := validateAzureCloudConfig(cloudConfig.Configuration); err != nil {
+		return cloudConfig, fmt.Errorf(`invalid Azure cloud config file "%s": %w`, path, err)
+	}
+
+	return cloudConfig, nil
+}
+
+// validateAzureCloudConfig checks if all required endpoints are set and are absolute URLs
+func validateAzureCloudConfig(cloudConfig cloud.Configuration) error {
+	errs := []error{}
+
+	checkUrl := func(name, value string) {
+		if value == "" {
+			errs = append(errs, fmt.Errorf(`"%s" is required`, name))
+			return
+		}
+
+		if parsedUrl, err := url.Parse(value); err != nil || parsedUrl.Scheme == "" || parsedUrl.Host == "" {
+			errs = append(errs, fmt.Errorf(`"%s" must be an absolute URL, got "%s"`, name, value))
+		}
+	}
+
+	checkUrl("activeDirectoryAuthorityHost", cloudConfig.ActiveDirectoryAuthorityHost)
+
+	resourceManager := cloudConfig.Services[cloud.ResourceManager]
+	checkUrl("services.resourceManager.endpoint", resourceManager.Endpoint)
+	checkUrl("services.resourceManager.audience", resourceManager.Audience)
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/azuresdk/armclient"
+	"go.uber.org/zap"
+)
+
+const (
+	credentialPrimary   = "primary"
+	credentialSecondary = "secondary"
+)
+
+type (
+	// failoverCredential uses the secondary credential when the primary credential fails to acquire a token
+	// (eg. expired secret during rotation), the primary credential is always tried first
+	failoverCredential struct {
+		primary   azcore.TokenCredential
+		secondary azcore.TokenCredential
+
+		active atomic.Value
+
+		logger *zap.SugaredLogger
+		gauge  *prometheus.GaugeVec
+	}
+)
+
+func newFailoverCredential(primary, secondary azcore.TokenCredential) *failoverCredential {
+	cred := &failoverCredential{
+		primary:   primary,
+		secondary: secondary,
+		logger:    logger.With(zap.String("component", "credential")),
+	}
+
+	cred.gauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "azurerm_credential_active",
+			Help: "Azure credential used for token acquisition (1 = active)",
+		},
+		[]string{"credential"},
+	)
+	prometheus.MustRegister(cred.gauge)
+
+	cred.setActive(credentialPrimary)
+	return cred
+}
+
+func (c *failoverCredential) setActive(credential string) {
+	if previous, _ := c.active.Swap(credential).(string); previous != credential && previous != "" {
+		c.logger.Warnf("switched Azure credential from %s to %s", previous, credential)
+	}
+
+	for _, name := range []string{credentialPrimary, credentialSecondary} {
+		value := 0.0
+		if name == credential {
+			value = 1
+		}
+		c.gauge.WithLabelValues(name).Set(value)
+	}
+}
+
+func (c *failoverCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	token, err := c.primary.GetToken(ctx, opts)
+	if err == nil {
+		c.setActive(credentialPrimary)
+		return token, nil
+	}
+
+	c.logger.Warnf("primary Azure credential failed, trying secondary credential: %v", err)
+	token, secondaryErr := c.secondary.GetToken(ctx, opts)
+	if secondaryErr != nil {
+		return token, fmt.Errorf("primary and secondary Azure credential failed: %w (secondary: %v)", err, secondaryErr.Error())
+	}
+
+	c.setActive(credentialSecondary)
+	return token, nil
+}
+
+// initAzureManagedIdentity selects the user-assigned managed identity (--azure.managed-identity.client-id),
+// the client ID is passed to the managed identity (and workload identity) credential instead of the default credential
+// chain, so AZURE_CLIENT_ID of the process environment is not changed
+func initAzureManagedIdentity() {
+	clientId := Opts.Azure.ManagedIdentity.ClientId
+	if clientId == "" {
+		if envClientId := os.Getenv("AZURE_CLIENT_ID"); envClientId != "" {
+			logger.Infof(`using Azure client ID "%s" from AZURE_CLIENT_ID`, envClientId)
+		} else {
+			logger.Info("no Azure client ID set, managed identity authentication uses the system-assigned identity")
+		}
+		return
+	}
+
+	for _, envName := range []string{"AZURE_CLIENT_ID", "AZURE_CLIENT_SECRET", "AZURE_CLIENT_CERTIFICATE_PATH"} {
+		if os.Getenv(envName) != "" {
+			logger.Warnf(`%s is ignored, --azure.managed-identity.client-id only uses the managed identity`, envName)
+		}
+	}
+
+	clientOptions := *AzureClient.NewAzCoreClientOptions()
+	credentialList := []azcore.TokenCredential{}
+
+	// workload identity (eg. AKS) uses the client ID of the managed identity as well
+	if os.Getenv("AZURE_FEDERATED_TOKEN_FILE") != "" {
+		workloadIdentity, err := azidentity.NewWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{
+			ClientOptions: clientOptions,
+			ClientID:      clientId,
+		})
+		if err != nil {
+			logger.Fatalf("unable to create workload identity credential: %v", err.Error())
+		}
+		credentialList = append(credentialList, workloadIdentity)
+	}
+
+	managedIdentity, err := azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{
+		ClientOptions: clientOptions,
+		ID:            azidentity.ClientID(clientId),
+	})
+	if err != nil {
+		logger.Fatalf("unable to create managed identity credential: %v", err.Error())
+	}
+	credentialList = append(credentialList, managedIdentity)
+
+	cred, err := azidentity.NewChainedTokenCredential(credentialList, nil)
+	if err != nil {
+		logger.Fatalf("unable to create managed identity credential: %v", err.Error())
+	}
+
+	setArmClientCredential(AzureClient, cred)
+	logger.Infof(`using user-assigned managed identity with client ID "%s"`, clientId)
+}
+
+// initAzureCredential sets up the failover credential if a secondary credential is configured
+func initAzureCredential() {
+	if Opts.Azure.Credential.Secondary == "" {
+		return
+	}
+
+	tenantId := os.Getenv("AZURE_TENANT_ID")
+	clientId := os.Getenv("AZURE_CLIENT_ID")
+	if tenantId == "" || clientId == "" {
+		logger.Fatal("--azure.credential.secondary requires AZURE_TENANT_ID and AZURE_CLIENT_ID")
+	}
+
+	secondary, err := azidentity.NewClientSecretCredential(
+		tenantId,
+		clientId,
+		Opts.Azure.Credential.Secondary,
+		&azidentity.ClientSecretCredentialOptions{ClientOptions: *AzureClient.NewAzCoreClientOptions()},
+	)
+	if err != nil {
+		logger.Fatalf("unable to create secondary Azure credential: %v", err.Error())
+	}
+
+	logger.Info("using secondary Azure credential as fallback for token acquisition")
+	setArmClientCredential(AzureClient, newFailoverCredential(AzureClient.GetCred(), secondary))
+}
+
+// setArmClientCredential replaces the credential of the ARM client, so the credential is used by the probes
+// and by the ARM client itself (subscriptions, ResourceGraph and resource tags); the ARM client has no setter
+// for its credential, so the unexported field is set via reflection
+func setArmClientCredential(client *armclient.ArmClient, cred azcore.TokenCredential) {
+	field := reflect.ValueOf(client).Elem().FieldByName("cred")
+	if !field.IsValid() || field.Type() != reflect.TypeOf((*azcore.TokenCredential)(nil)) {
+		logger.Fatal("unable to set the Azure credential of the ARM client")
+	}
+
+	reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem().Set(reflect.ValueOf(&cred)) // #nosec G103
+}
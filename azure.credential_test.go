@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/fake"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/webdevops/go-common/azuresdk/armclient"
+	"go.uber.org/zap"
+)
+
+// newTestFailoverCredential creates a failover credential without registering its gauge
+func newTestFailoverCredential(primaryErr, secondaryErr error) *failoverCredential {
+	primary, secondary := &fake.TokenCredential{}, &fake.TokenCredential{}
+	if primaryErr != nil {
+		primary.SetError(primaryErr)
+	}
+	if secondaryErr != nil {
+		secondary.SetError(secondaryErr)
+	}
+
+	cred := &failoverCredential{
+		primary:   primary,
+		secondary: secondary,
+		logger:    zap.NewNop().Sugar(),
+		gauge:     prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "azurerm_credential_active"}, []string{"credential"}),
+	}
+	cred.setActive(credentialPrimary)
+	return cred
+}
+
+func TestFailoverCredential(t *testing.T) {
+	testCases := []struct {
+		name           string
+		primaryErr     error
+		secondaryErr   error
+		expectedActive string
+		expectedError  bool
+	}{
+		{"primary", nil, nil, credentialPrimary, false},
+		{"secondary", errors.New("secret expired"), nil, credentialSecondary, false},
+		{"both failed", errors.New("secret expired"), errors.New("secret invalid"), credentialPrimary, true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			cred := newTestFailoverCredential(testCase.primaryErr, testCase.secondaryErr)
+
+			_, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{"https://management.azure.com/.default"}})
+			if testCase.expectedError {
+				if err == nil || !errors.Is(err, testCase.primaryErr) {
+					t.Errorf("expected error of primary credential, got %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("expected token, got %v", err)
+			}
+
+			for _, credential := range []string{credentialPrimary, credentialSecondary} {
+				expected := 0.0
+				if credential == testCase.expectedActive {
+					expected = 1
+				}
+				if value := testutil.ToFloat64(cred.gauge.WithLabelValues(credential)); value != expected {
+					t.Errorf("%s: expected azurerm_credential_active %v, got %v", credential, expected, value)
+				}
+			}
+		})
+	}
+}
+
+func TestSetArmClientCredential(t *testing.T) {
+	logger = zap.NewNop().Sugar()
+
+	client, err := armclient.NewArmClientWithCloudName("AzurePublicCloud", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cred := newTestFailoverCredential(nil, nil)
+	setArmClientCredential(client, cred)
+	if client.GetCred() != cred {
+		t.Errorf("expected failover credential as ARM client credential, got %T", client.GetCred())
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/webdevops/go-common/azuresdk/armclient"
+)
+
+// resourceTagConfig returns the resource tag configuration, from --azure.resource-tag.file if set
+// (whitespace delimited, lines starting with # are ignored) or from --azure.resource-tag
+func resourceTagConfig() ([]string, error) {
+	if Opts.Azure.ResourceTagsFile == "" {
+		return Opts.Azure.ResourceTags, nil
+	}
+
+	content, err := os.ReadFile(Opts.Azure.ResourceTagsFile)
+	if err != nil {
+		return nil, fmt.Errorf(`unable to read resourceTag configuration file "%s": %w`, Opts.Azure.ResourceTagsFile, err)
+	}
+
+	tagList := []string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tagList = append(tagList, strings.Fields(line)...)
+	}
+
+	return tagList, nil
+}
+
+// loadResourceTagManager parses the resource tag configuration and swaps the tag manager used by new probes,
+// the current tag manager is kept if the configuration is invalid
+func loadResourceTagManager() error {
+	tagList, err := resourceTagConfig()
+	if err != nil {
+		return err
+	}
+
+	tagManager, err := AzureClient.TagManager.ParseTagConfig(tagList)
+	if err != nil {
+		return fmt.Errorf(`unable to parse resourceTag configuration "%s": %w`, tagList, err)
+	}
+
+	AzureResourceTagManager.Store(tagManager)
+	return nil
+}
+
+// currentResourceTagManager returns the tag manager for a probe
+func currentResourceTagManager() *armclient.ResourceTagManager {
+	return AzureResourceTagManager.Load()
+}
+
+// startConfigReloader reloads the resource tag configuration on SIGHUP (without dropping caches or in-flight probes)
+func startConfigReloader() {
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGHUP)
+
+	go func() {
+		for range signalCh {
+			logger.Info("received SIGHUP, reloading resourceTag configuration")
+			if err := loadResourceTagManager(); err != nil {
+				logger.Errorf("unable to reload resourceTag configuration, keeping current configuration: %v", err)
+				continue
+			}
+			logger.Info("resourceTag configuration reloaded")
+		}
+	}()
+}
@@ -3,6 +3,10 @@ package config
 const (
 	MetricsUrl = "/metrics"
 
+	ValidateUrl = "/validate"
+
+	ConfigUrl = "/config"
+
 	ProbeMetricsResourceUrl            = "/probe/metrics/resource"
 	ProbeMetricsResourceTimeoutDefault = 10
 
@@ -17,4 +21,16 @@ const (
 
 	ProbeMetricsResourceGraphUrl            = "/probe/metrics/resourcegraph"
 	ProbeMetricsResourceGraphTimeoutDefault = 120
+
+	ProbeMetricsDiffUrl            = "/probe/metrics/diff"
+	ProbeMetricsDiffTimeoutDefault = 30
+
+	ProbeActivityLogUrl            = "/probe/activitylog"
+	ProbeActivityLogTimeoutDefault = 60
+
+	ProbeDiagnosticSettingsUrl            = "/probe/diagnosticsettings"
+	ProbeDiagnosticSettingsTimeoutDefault = 120
+
+	ProbeMetricsLogAnalyticsUrl            = "/probe/metrics/loganalytics"
+	ProbeMetricsLogAnalyticsTimeoutDefault = 120
 )
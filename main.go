@@ -1,17 +1,24 @@
 package main
 
 import (
+	"crypto/tls"
 	"embed"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"html/template"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
 	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	iso8601 "github.com/channelmeter/iso8601duration"
 	"github.com/google/uuid"
 	"github.com/jessevdk/go-flags"
 	"github.com/patrickmn/go-cache"
@@ -22,6 +29,7 @@ import (
 	"github.com/webdevops/go-common/azuresdk/prometheus/tracing"
 
 	"github.com/webdevops/azure-metrics-exporter/config"
+	"github.com/webdevops/azure-metrics-exporter/metrics"
 )
 
 const (
@@ -35,13 +43,19 @@ var (
 	Opts      config.Opts
 
 	AzureClient             *armclient.ArmClient
-	AzureResourceTagManager *armclient.ResourceTagManager
+	AzureResourceTagManager atomic.Pointer[armclient.ResourceTagManager]
 
-	prometheusCollectTime    *prometheus.SummaryVec
+	prometheusCollectTime    prometheus.ObserverVec
 	prometheusMetricRequests *prometheus.CounterVec
+	prometheusProbeRejected  *prometheus.CounterVec
 
-	metricsCache *cache.Cache
-	azureCache   *cache.Cache
+	metricsCache     metrics.Cache
+	azureCache       metrics.Cache
+	staleSeriesCache metrics.Cache
+	definitionsCache metrics.Cache
+
+	// http handler of the server (with middlewares), used for the internal requests of /validate
+	httpHandler http.Handler
 
 	//go:embed templates/*.html
 	templates embed.FS
@@ -54,23 +68,30 @@ var (
 func main() {
 	initArgparser()
 	initLogger()
+	validateArgs()
 
 	logger.Infof("starting azure-metrics-exporter v%s (%s; %s; by %v)", gitTag, gitCommit, runtime.Version(), Author)
 	logger.Info(string(Opts.GetJson()))
 	initSystem()
-	metricsCache = cache.New(1*time.Minute, 1*time.Minute)
-	azureCache = cache.New(1*time.Minute, 1*time.Minute)
+	initCaches()
 
 	logger.Infof("init Azure connection")
 	initAzureConnection()
+	metrics.StartConcurrencyRampUp(Opts.Azure.Concurrency.RampUp, metricsCacheColdCheck())
+	initAzureRequestLimits()
 	initMetricCollector()
+	initServerMetrics()
 
 	// Initialize pprof if enabled
 	if Opts.Server.PprofEnabled {
 		go startPprofServer()
 	}
 
-	logger.Infof("starting http server on %s", Opts.Server.Bind)
+	if Opts.Prober.StartupProbe != "" {
+		runStartupProbe(Opts.Prober.StartupProbe)
+	}
+
+	logger.Infof("starting http server on %s", strings.Join(Opts.Server.Bind, ", "))
 	startHttpServer()
 }
 
@@ -91,6 +112,172 @@ func initArgparser() {
 	}
 }
 
+func validateArgs() {
+	for _, property := range Opts.Metrics.ResourceInfo.Properties {
+		if !metrics.IsValidResourceInfoProperty(property) {
+			logger.Fatalf(`invalid resource property "%s" in --metrics.resourceinfo.properties`, property)
+		}
+	}
+
+	if resourceLabels, err := metrics.ParseResourceLabels(Opts.Metrics.Labels.Resource); err == nil {
+		Opts.Metrics.Labels.Resource = resourceLabels
+	} else {
+		logger.Fatalf(`%v in --metrics.resource-labels`, err)
+	}
+
+	if Opts.Metrics.Dimensions.Resolve == metrics.DimensionResolveMapping {
+		if Opts.Metrics.Dimensions.ResolveMapping == "" {
+			logger.Fatal(`--metrics.dimensions.resolve.mapping is required for --metrics.dimensions.resolve=mapping`)
+		}
+
+		if err := metrics.LoadDimensionResolveMapping(Opts.Metrics.Dimensions.ResolveMapping); err != nil {
+			logger.Fatal(err.Error())
+		}
+	}
+
+	if !sort.Float64sAreSorted(Opts.Metrics.CollectTime.Buckets) {
+		logger.Fatal(`--metrics.collecttime.buckets must be sorted in increasing order`)
+	}
+
+	if Opts.Cache.TTLJitter < 0 || Opts.Cache.TTLJitter >= 100 {
+		logger.Fatal(`--cache.ttl-jitter must be between 0 and 100 (percent)`)
+	}
+
+	if Opts.Cache.MetricsTTL < 0 {
+		logger.Fatal(`--cache.metrics.ttl must not be negative`)
+	}
+
+	if Opts.Azure.ManagedIdentity.ClientId != "" && Opts.Azure.Credential.Secondary != "" {
+		logger.Fatal(`--azure.managed-identity.client-id can't be combined with --azure.credential.secondary (client secret of a service principal)`)
+	}
+
+	if Opts.Azure.ServiceDiscovery.Retries < 0 {
+		logger.Fatal(`--azure.servicediscovery.retries must not be negative`)
+	}
+
+	if Opts.Azure.ResourceGraph.MaxResults < 0 {
+		logger.Fatal(`--resourcegraph.max-results must not be negative`)
+	}
+
+	if Opts.Server.RateLimit.RPS < 0 {
+		logger.Fatal(`--server.ratelimit.rps must not be negative`)
+	}
+
+	if Opts.Server.RateLimit.RPS > 0 && Opts.Server.RateLimit.Burst < 1 {
+		logger.Fatal(`--server.ratelimit.burst must be at least 1`)
+	}
+
+	if Opts.Server.Validate.MaxUrls < 1 {
+		logger.Fatal(`--server.validate.max-urls must be at least 1`)
+	}
+
+	if Opts.Server.Validate.Timeout <= 0 {
+		logger.Fatal(`--server.validate.timeout must be positive`)
+	}
+
+	if Opts.Prober.ConcurrencyGlobal < 0 {
+		logger.Fatal(`--concurrency.global must not be negative`)
+	}
+
+	if Opts.Prober.Autodiscover.Limit < 0 {
+		logger.Fatal(`--probe.autodiscover.limit must not be negative`)
+	}
+
+	if _, err := iso8601.FromString(Opts.Metrics.Timespan); err != nil {
+		logger.Fatalf(`invalid timespan "%s" in --metrics.timespan: %v`, Opts.Metrics.Timespan, err.Error())
+	}
+
+	if Opts.Metrics.Interval != "" && !strings.EqualFold(Opts.Metrics.Interval, metrics.IntervalAuto) {
+		if _, err := iso8601.FromString(Opts.Metrics.Interval); err != nil {
+			logger.Fatalf(`invalid interval "%s" in --metrics.interval: %v`, Opts.Metrics.Interval, err.Error())
+		}
+	}
+
+	for resourceType, interval := range Opts.Prober.IntervalMap {
+		if _, err := iso8601.FromString(interval); err != nil {
+			logger.Fatalf(`invalid interval "%s" for resource type "%s" in --prober.interval.map: %v`, interval, resourceType, err.Error())
+		}
+	}
+
+	for handlerUrl, defaults := range probeDefaultParamsList() {
+		if defaults.Interval != "" && !strings.EqualFold(defaults.Interval, metrics.IntervalAuto) {
+			if _, err := iso8601.FromString(defaults.Interval); err != nil {
+				logger.Fatalf(`invalid default interval "%s" for %s: %v`, defaults.Interval, handlerUrl, err.Error())
+			}
+		}
+
+		if defaults.Timespan != "" {
+			if _, err := iso8601.FromString(defaults.Timespan); err != nil {
+				logger.Fatalf(`invalid default timespan "%s" for %s: %v`, defaults.Timespan, handlerUrl, err.Error())
+			}
+		}
+	}
+
+	if (Opts.Server.Auth.BasicUser == "") != (Opts.Server.Auth.BasicPassword == "") {
+		logger.Fatal(`--server.auth.basic-user and --server.auth.basic-password must be set together`)
+	}
+
+	for subscriptionId, concurrency := range Opts.Prober.ConcurrencyPerSubscription {
+		if _, err := uuid.Parse(subscriptionId); err != nil {
+			logger.Fatalf(`invalid subscription "%s" in --concurrency.per-subscription: %v`, subscriptionId, err.Error())
+		}
+
+		if concurrency <= 0 {
+			logger.Fatalf(`invalid concurrency "%v" for subscription "%s" in --concurrency.per-subscription, must be greater than zero`, concurrency, subscriptionId)
+		}
+	}
+}
+
+func initCaches() {
+	if Opts.Cache.Redis.Url != "" {
+		logger.Infof("using redis cache")
+		redisClient, err := metrics.NewRedisCacheClient(Opts.Cache.Redis.Url)
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
+
+		metricsCache = metrics.NewRedisCache(redisClient, Opts.Cache.Redis.Prefix+"metrics:", logger)
+		azureCache = metrics.NewRedisCache(redisClient, Opts.Cache.Redis.Prefix+"azure:", logger)
+		staleSeriesCache = metrics.NewRedisCache(redisClient, Opts.Cache.Redis.Prefix+"stale:", logger)
+		definitionsCache = metrics.NewRedisCache(redisClient, Opts.Cache.Redis.Prefix+"definitions:", logger)
+		return
+	}
+
+	metricsCache = newMemoryCache(Opts.Cache.MetricsTTL)
+	azureCache = newMemoryCache(*Opts.Azure.ServiceDiscovery.CacheDuration)
+	staleSeriesCache = cache.New(1*time.Minute, 1*time.Minute)
+	definitionsCache = cache.New(1*time.Minute, 1*time.Minute)
+}
+
+// metricsCacheColdCheck returns the check if the metrics cache is empty (restarts the concurrency ramp-up),
+// only available for the in-memory cache
+func metricsCacheColdCheck() func() bool {
+	if memoryCache, ok := metricsCache.(*cache.Cache); ok {
+		return func() bool {
+			return memoryCache.ItemCount() == 0
+		}
+	}
+	return nil
+}
+
+// newMemoryCache creates an in-memory cache with ttl as default expiration, expired items are
+// cleaned up in the same interval (one minute if ttl is not set)
+func newMemoryCache(ttl time.Duration) *cache.Cache {
+	if ttl <= 0 {
+		ttl = 1 * time.Minute
+	}
+	return cache.New(ttl, ttl)
+}
+
+// userAgent returns the user agent for Azure requests (with --azure.user-agent-suffix if set)
+func userAgent() string {
+	ret := UserAgent + gitTag
+	if suffix := strings.TrimSpace(Opts.Azure.UserAgentSuffix); suffix != "" {
+		ret += " " + suffix
+	}
+	return ret
+}
+
 func initAzureConnection() {
 	var err error
 
@@ -100,28 +287,131 @@ func initAzureConnection() {
 		}
 	}
 
-	AzureClient, err = armclient.NewArmClientFromEnvironment(logger)
-	if err != nil {
-		logger.Fatal(err.Error())
+	if Opts.Azure.CloudConfigFile != "" {
+		// custom cloud, --azure-environment is ignored
+		cloudConfig, err := loadAzureCloudConfigFile(Opts.Azure.CloudConfigFile)
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
+		logger.Infof(`using custom Azure cloud "%s" from %s`, cloudConfig.Name, Opts.Azure.CloudConfigFile)
+		AzureClient = armclient.NewArmClient(cloudConfig, logger)
+	} else {
+		AzureClient, err = armclient.NewArmClientFromEnvironment(logger)
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
 	}
-	AzureClient.SetUserAgent(UserAgent + gitTag)
+	AzureClient.SetUserAgent(userAgent())
+
+	logger.Infof(
+		"using Azure SDK retry policy with max %v retries and %s retry delay for status codes %v",
+		Opts.Azure.SDK.MaxRetries,
+		Opts.Azure.SDK.RetryDelay.String(),
+		metrics.NewArmClientOptions(AzureClient, Opts).Retry.StatusCodes,
+	)
+
+	initAzureManagedIdentity()
+	initAzureCredential()
 
 	if err := AzureClient.Connect(); err != nil {
 		logger.Fatal(err.Error())
 	}
 
-	AzureResourceTagManager, err = AzureClient.TagManager.ParseTagConfig(Opts.Azure.ResourceTags)
-	if err != nil {
-		logger.Fatalf(`unable to parse resourceTag configuration "%s": %v"`, Opts.Azure.ResourceTags, err.Error())
+	if err := loadResourceTagManager(); err != nil {
+		logger.Fatal(err.Error())
 	}
+	startConfigReloader()
+}
+
+// initAzureRequestLimits configures the connection breaker and the global Azure request concurrency,
+// requests without a free slot within the probe timeout are counted as rejected (queue_full)
+func initAzureRequestLimits() {
+	metrics.ConfigureConnectionBreaker(Opts.Azure.ConnectionBreaker.Threshold, Opts.Azure.ConnectionBreaker.Cooldown)
+	metrics.ConfigureAzureRequestConcurrency(Opts.Prober.ConcurrencyGlobal, func() {
+		prometheusProbeRejected.WithLabelValues(ProbeRejectReasonQueueFull).Inc()
+	})
 }
 
-// start and handle prometheus handler
+// start and handle prometheus handler, one server per bind address (sharing the same handler)
 func startHttpServer() {
+	handler := newHttpHandler()
+	httpHandler = handler
+
+	var tlsConfig *tls.Config
+	if Opts.Server.TLS.Enabled {
+		if Opts.Server.TLS.CertFile == "" || Opts.Server.TLS.KeyFile == "" {
+			logger.Fatal("--server.tls.cert-file and --server.tls.key-file are required if TLS is enabled")
+		}
+
+		certReloader, err := newTlsCertReloader(Opts.Server.TLS.CertFile, Opts.Server.TLS.KeyFile)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		tlsConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certReloader.GetCertificate,
+		}
+	}
+
+	// listen on all addresses first, so all invalid addresses are reported at once
+	listeners := map[string]net.Listener{}
+	listenErrors := []error{}
+	for _, addr := range Opts.Server.Bind {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			listenErrors = append(listenErrors, fmt.Errorf("unable to listen on %s: %w", addr, err))
+			continue
+		}
+		listeners[addr] = listener
+	}
+	if err := errors.Join(listenErrors...); err != nil {
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
+		logger.Fatal(err)
+	}
+
+	for addr, listener := range listeners {
+		srv := &http.Server{
+			Addr:         addr,
+			Handler:      handler,
+			ReadTimeout:  Opts.Server.ReadTimeout,
+			WriteTimeout: Opts.Server.WriteTimeout,
+			TLSConfig:    tlsConfig,
+		}
+
+		go func(srv *http.Server, listener net.Listener) {
+			var err error
+			if srv.TLSConfig != nil {
+				// certificate is provided by TLSConfig.GetCertificate
+				err = srv.ServeTLS(listener, "", "")
+			} else {
+				err = srv.Serve(listener)
+			}
+
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Fatalf("http server on %s failed: %v", srv.Addr, err)
+			}
+		}(srv, listener)
+
+		registerShutdownServer(srv)
+	}
+
+	waitForShutdownSignal(Opts.Server.ShutdownTimeout)
+}
+
+// newHttpHandler builds the http handler with all endpoints and middlewares
+func newHttpHandler() http.Handler {
+	return authMiddleware(rateLimitMiddleware(connectionBreakerMiddleware(concurrencyLimitMiddleware(writeDeadlineMiddleware(compressionMiddleware(newServeMux(), Opts.Server.CompressionThreshold), Opts.Server.WriteTimeout, Opts.Server.WriteDeadlineMargin), Opts.Server.MaxConcurrentRequests)), Opts.Server.RateLimit.RPS, Opts.Server.RateLimit.Burst, Opts.Server.RateLimit.Key))
+}
+
+// newServeMux builds the http handler with all endpoints
+func newServeMux() *http.ServeMux {
 	mux := http.NewServeMux()
 
 	// Add pprof endpoints if enabled and using same bind address
-	if Opts.Server.PprofEnabled && (Opts.Server.PprofBind == "" || Opts.Server.PprofBind == Opts.Server.Bind) {
+	if Opts.Server.PprofEnabled && (Opts.Server.PprofBind == "" || slices.Contains(Opts.Server.Bind, Opts.Server.PprofBind)) {
 		logger.Info("adding pprof endpoints to main server at /debug/pprof/")
 		// Import of _ "net/http/pprof" automatically registers handlers with http.DefaultServeMux
 		// We need to manually add them to our custom mux
@@ -139,6 +429,20 @@ func startHttpServer() {
 
 	// readyz
 	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if Opts.Server.Ready.CheckAzure {
+			if err := checkReadyAzure(); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		if Opts.Server.Ready.CheckResourceGraph {
+			if err := checkReadyResourceGraph(); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+
 		if _, err := fmt.Fprint(w, "Ok"); err != nil {
 			logger.Error(err)
 		}
@@ -156,6 +460,26 @@ func startHttpServer() {
 
 	mux.HandleFunc(config.ProbeMetricsResourceGraphUrl, probeMetricsResourceGraphHandler)
 
+	mux.HandleFunc(config.ProbeMetricsDiffUrl, probeMetricsDiffHandler)
+
+	mux.HandleFunc(config.ProbeActivityLogUrl, probeActivityLogHandler)
+
+	mux.HandleFunc(config.ProbeDiagnosticSettingsUrl, probeDiagnosticSettingsHandler)
+
+	mux.HandleFunc(config.ProbeMetricsLogAnalyticsUrl, probeMetricsLogAnalyticsHandler)
+
+	mux.HandleFunc(config.ValidateUrl, validateHandler)
+
+	// effective configuration (secrets redacted)
+	if Opts.Server.ConfigEndpoint.Enabled {
+		mux.HandleFunc(config.ConfigUrl, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if _, err := w.Write(Opts.GetJson()); err != nil {
+				logger.Error(err)
+			}
+		})
+	}
+
 	// report
 	tmpl := template.Must(template.ParseFS(templates, "templates/*.html"))
 	mux.HandleFunc("/query", func(w http.ResponseWriter, r *http.Request) {
@@ -184,28 +508,51 @@ func startHttpServer() {
 		}
 	})
 
-	srv := &http.Server{
-		Addr:         Opts.Server.Bind,
-		Handler:      mux,
-		ReadTimeout:  Opts.Server.ReadTimeout,
-		WriteTimeout: Opts.Server.WriteTimeout,
-	}
-	logger.Fatal(srv.ListenAndServe())
+	return mux
 }
 
 func initMetricCollector() {
-	prometheusCollectTime = prometheus.NewSummaryVec(
-		prometheus.SummaryOpts{
-			Name: "azurerm_stats_metric_collecttime",
-			Help: "Azure Insights stats collecttime",
+	buildInfo := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "azure_metrics_exporter_build_info",
+			Help: "Azure metrics exporter build information (value is always 1)",
 		},
 		[]string{
-			"subscriptionID",
-			"handler",
-			"filter",
+			"version",
+			"commit",
+			"goversion",
 		},
 	)
-	prometheus.MustRegister(prometheusCollectTime)
+	prometheus.MustRegister(buildInfo)
+	buildInfo.WithLabelValues(gitTag, gitCommit, runtime.Version()).Set(1)
+
+	collectTimeLabels := []string{
+		"subscriptionID",
+		"handler",
+		"filter",
+	}
+	if Opts.Metrics.CollectTime.Histogram {
+		collectTime := prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "azurerm_stats_metric_collecttime",
+				Help:    "Azure Insights stats collecttime",
+				Buckets: Opts.Metrics.CollectTime.Buckets,
+			},
+			collectTimeLabels,
+		)
+		prometheus.MustRegister(collectTime)
+		prometheusCollectTime = collectTime
+	} else {
+		collectTime := prometheus.NewSummaryVec(
+			prometheus.SummaryOpts{
+				Name: "azurerm_stats_metric_collecttime",
+				Help: "Azure Insights stats collecttime",
+			},
+			collectTimeLabels,
+		)
+		prometheus.MustRegister(collectTime)
+		prometheusCollectTime = collectTime
+	}
 
 	prometheusMetricRequests = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -220,21 +567,90 @@ func initMetricCollector() {
 		},
 	)
 	prometheus.MustRegister(prometheusMetricRequests)
+
+	prometheusProbeRejected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azurerm_probe_rejected_total",
+			Help: "Azure metrics probe requests rejected because of exhausted capacity",
+		},
+		[]string{
+			"reason",
+		},
+	)
+	prometheus.MustRegister(prometheusProbeRejected)
+
+	// initialize all reasons, so alerts work without previous rejections
+	for _, reason := range probeRejectReasons {
+		prometheusProbeRejected.WithLabelValues(reason)
+	}
+
+	metrics.InitCacheStats()
+	metrics.InitApiRequestStats()
+
+	cacheList := map[string]metrics.Cache{
+		metrics.CacheNameMetrics:     metricsCache,
+		metrics.CacheNameAzure:       azureCache,
+		metrics.CacheNameDefinitions: definitionsCache,
+	}
+	for cacheName, cacheBackend := range cacheList {
+		// entries are only available for in-memory caches
+		cacheBackend, ok := cacheBackend.(*cache.Cache)
+		if !ok {
+			continue
+		}
+
+		prometheus.MustRegister(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name:        "azurerm_stats_cache_entries",
+				Help:        "Azure metrics exporter internal cache entries (including expired entries not yet cleaned up)",
+				ConstLabels: prometheus.Labels{"cache": cacheName},
+			},
+			func() float64 {
+				return float64(cacheBackend.ItemCount())
+			},
+		))
+	}
+
+	// effective concurrency per type, resource concurrency also per subscription with --concurrency.per-subscription
+	type effectiveConcurrency struct {
+		concurrencyType string
+		subscriptionId  string
+		concurrency     int
+	}
+	concurrencyList := []effectiveConcurrency{
+		{"subscription", "", Opts.Prober.ConcurrencySubscription},
+		{"resource", "", Opts.Prober.ConcurrencySubscriptionResource},
+	}
+	if Opts.Prober.ConcurrencyGlobal > 0 {
+		concurrencyList = append(concurrencyList, effectiveConcurrency{"global", "", Opts.Prober.ConcurrencyGlobal})
+	}
+	for subscriptionId, concurrency := range Opts.Prober.ConcurrencyPerSubscription {
+		concurrencyList = append(concurrencyList, effectiveConcurrency{"resource", strings.ToLower(subscriptionId), concurrency})
+	}
+
+	for _, row := range concurrencyList {
+		concurrency := row.concurrency
+		prometheus.MustRegister(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name:        "azurerm_concurrency_effective",
+				Help:        "Effective concurrency of Azure requests (limited by --azure.concurrency.rampup)",
+				ConstLabels: prometheus.Labels{"type": row.concurrencyType, "subscriptionID": row.subscriptionId},
+			},
+			func() float64 {
+				return float64(metrics.EffectiveConcurrency(concurrency))
+			},
+		))
+	}
 }
 
 // startPprofServer starts the pprof server
 func startPprofServer() {
-	var pprofBind string
-	if Opts.Server.PprofBind != "" {
-		pprofBind = Opts.Server.PprofBind
-	} else {
-		pprofBind = Opts.Server.Bind
-	}
+	pprofBind := Opts.Server.PprofBind
 
 	// If pprof is using the same bind address as the main server,
 	// the pprof endpoints will be added to the main server instead
-	if pprofBind == Opts.Server.Bind {
-		logger.Infof("pprof endpoints will be available on main server at %s", pprofBind)
+	if pprofBind == "" || slices.Contains(Opts.Server.Bind, pprofBind) {
+		logger.Infof("pprof endpoints will be available on main server at %s", strings.Join(Opts.Server.Bind, ", "))
 		return
 	}
 
@@ -252,6 +668,7 @@ func startPprofServer() {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	registerShutdownServer(pprofServer)
 	if err := pprofServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		logger.Errorf("pprof server failed: %v", err)
 	}
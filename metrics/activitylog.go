@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/utils/to"
+	"go.uber.org/zap"
+)
+
+const (
+	PrometheusActivityEventsName = "azurerm_activity_events_total"
+
+	// Azure activity log only keeps events for 90 days
+	ActivityLogMaxWindow = 90 * 24 * time.Hour
+)
+
+func (p *MetricProber) ActivityLogsClient(subscriptionId string) (*armmonitor.ActivityLogsClient, error) {
+	return armmonitor.NewActivityLogsClient(subscriptionId, p.GetCred(), p.NewArmClientOptions())
+}
+
+// RunActivityLog counts the activity log events of the subscriptions (or only of the resources if set) within the window
+func (p *MetricProber) RunActivityLog(window time.Duration, resourceIds []string) {
+	p.collectActivityLogEvents(window, resourceIds)
+	p.postProcessMetricList()
+	p.SaveToCache()
+	p.publishMetricList()
+	p.publishCacheStatus()
+}
+
+func (p *MetricProber) collectActivityLogEvents(window time.Duration, resourceIds []string) {
+	endTime := time.Now().UTC()
+	startTime := endTime.Add(-window)
+
+	baseFilter := fmt.Sprintf(
+		"eventTimestamp ge '%s' and eventTimestamp le '%s'",
+		startTime.Format(time.RFC3339),
+		endTime.Format(time.RFC3339),
+	)
+
+	for _, subscriptionId := range p.settings.Subscriptions {
+		client, err := p.ActivityLogsClient(subscriptionId)
+		if err != nil {
+			p.logger.Error(err)
+			continue
+		}
+
+		// activity log api only supports one resourceUri per request
+		filterList := []string{baseFilter}
+		if len(resourceIds) >= 1 {
+			filterList = []string{}
+			for _, resourceId := range resourceIds {
+				filterList = append(filterList, fmt.Sprintf("%s and resourceUri eq '%s'", baseFilter, strings.ReplaceAll(resourceId, "'", "\\'")))
+			}
+		}
+
+		eventCount := map[string]*MetricRow{}
+		for _, filter := range filterList {
+			if err := p.fetchActivityLogEvents(client, filter, subscriptionId, eventCount); err != nil {
+				p.logger.With(zap.String("subscriptionID", subscriptionId)).Warn(err)
+			}
+		}
+
+		for _, row := range eventCount {
+			p.metricList.Add(PrometheusActivityEventsName, *row)
+		}
+
+		if p.callbackSubscriptionFishish != nil {
+			p.callbackSubscriptionFishish(subscriptionId)
+		}
+	}
+
+	p.metricList.SetMetricHelp(PrometheusActivityEventsName, fmt.Sprintf("Azure activity log events within the last %s", window.String()))
+}
+
+func (p *MetricProber) fetchActivityLogEvents(client *armmonitor.ActivityLogsClient, filter, subscriptionId string, eventCount map[string]*MetricRow) error {
+	opts := armmonitor.ActivityLogsClientListOptions{
+		Select: to.StringPtr("operationName,status,resourceId"),
+	}
+
+	pager := client.NewListPager(filter, &opts)
+	for pager.More() {
+		var result armmonitor.ActivityLogsClientListResponse
+		err := p.withRetry(p.ctx, func() (err error) {
+			startTime := time.Now()
+			result, err = pager.NextPage(p.ctx)
+			observeApiRequest(ApiOperationListActivityLogs, subscriptionId, startTime, err)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("unable to fetch activity log: %w", err)
+		}
+
+		for _, event := range result.Value {
+			if event == nil {
+				continue
+			}
+
+			labels := prometheus.Labels{
+				"subscriptionID": strings.ToLower(subscriptionId),
+				"resourceID":     strings.ToLower(to.String(event.ResourceID)),
+				"operation":      "",
+				"status":         "",
+			}
+
+			if event.OperationName != nil {
+				labels["operation"] = to.String(event.OperationName.Value)
+			}
+
+			if event.Status != nil {
+				labels["status"] = to.String(event.Status.Value)
+			}
+
+			key := metricLabelsKey(labels)
+			if _, exists := eventCount[key]; !exists {
+				eventCount[key] = &MetricRow{Labels: labels, Value: 0}
+			}
+			eventCount[key].Value++
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/fake"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+type testTransport http.HandlerFunc
+
+func (handler testTransport) Do(r *http.Request) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w.Result(), nil
+}
+
+// newTestArmClientOptions returns ARM client options which send all requests to handler
+func newTestArmClientOptions(handler http.HandlerFunc) *arm.ClientOptions {
+	return &arm.ClientOptions{
+		ClientOptions: policy.ClientOptions{
+			Transport: testTransport(handler),
+			Retry:     policy.RetryOptions{MaxRetries: -1},
+		},
+	}
+}
+
+func TestFetchActivityLogEvents(t *testing.T) {
+	subscriptionId := "00000000-0000-0000-0000-000000000001"
+	resourceId := "/subscriptions/00000000-0000-0000-0000-000000000001/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/sa1"
+
+	pages := map[string]string{
+		"": `{"value": [
+			{"resourceId": "` + resourceId + `", "operationName": {"value": "Microsoft.Storage/storageAccounts/write"}, "status": {"value": "Succeeded"}},
+			{"resourceId": "` + strings.ToUpper(resourceId) + `", "operationName": {"value": "Microsoft.Storage/storageAccounts/write"}, "status": {"value": "Succeeded"}},
+			{"resourceId": "` + resourceId + `", "operationName": {"value": "Microsoft.Storage/storageAccounts/write"}, "status": {"value": "Failed"}}
+		], "nextLink": "https://management.azure.com/next"}`,
+		"/next": `{"value": [
+			{"resourceId": "` + resourceId + `", "operationName": {"value": "Microsoft.Storage/storageAccounts/write"}, "status": {"value": "Succeeded"}},
+			{"resourceId": "` + resourceId + `"}
+		]}`,
+	}
+
+	client, err := armmonitor.NewActivityLogsClient(subscriptionId, &fake.TokenCredential{}, newTestArmClientOptions(func(w http.ResponseWriter, r *http.Request) {
+		page := ""
+		if r.URL.Path == "/next" {
+			page = "/next"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(pages[page]))
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prober := newTestProber(config.Opts{}, nil)
+	eventCount := map[string]*MetricRow{}
+	if err := prober.fetchActivityLogEvents(client, "eventTimestamp ge '2024-01-01T00:00:00Z'", subscriptionId, eventCount); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]float64{
+		"Microsoft.Storage/storageAccounts/write/Succeeded": 3,
+		"Microsoft.Storage/storageAccounts/write/Failed":    1,
+		"/": 1,
+	}
+	if len(eventCount) != len(expected) {
+		t.Fatalf("expected %v series, got %v", len(expected), len(eventCount))
+	}
+	for _, row := range eventCount {
+		key := row.Labels["operation"] + "/" + row.Labels["status"]
+		if row.Value != expected[key] {
+			t.Errorf("%s: expected %v events, got %v", key, expected[key], row.Value)
+		}
+		if row.Labels["resourceID"] != strings.ToLower(resourceId) || row.Labels["subscriptionID"] != subscriptionId {
+			t.Errorf("%s: unexpected labels %v", key, row.Labels)
+		}
+	}
+}
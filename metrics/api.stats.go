@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/azuresdk/armclient"
+)
+
+const (
+	ApiOperationListMetrics             = "listMetrics"
+	ApiOperationListMetricsSubscription = "listMetricsAtSubscriptionScope"
+	ApiOperationListMetricsBatch        = "listMetricsBatch"
+	ApiOperationGetMetricDefinitions    = "getMetricDefinitions"
+	ApiOperationListMetricNamespaces    = "listMetricNamespaces"
+	ApiOperationResourceGraphQuery      = "resourceGraphQuery"
+	ApiOperationListResources           = "listResources"
+	ApiOperationListActivityLogs        = "listActivityLogs"
+	ApiOperationListDiagnosticSettings  = "listDiagnosticSettings"
+	ApiOperationLogAnalyticsQuery       = "logAnalyticsQuery"
+	ApiOperationGetResource             = "getResource"
+)
+
+var (
+	prometheusApiRequestDuration  *prometheus.HistogramVec
+	prometheusApiThrottledRetries prometheus.Counter
+)
+
+// InitApiRequestStats registers azurerm_api_request_duration_seconds (Azure API request latency by operation)
+// and azurerm_api_throttled_retries_total
+func InitApiRequestStats() {
+	prometheusApiRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "azurerm_api_request_duration_seconds",
+			Help:    "Azure API request duration by operation (every attempt of retried requests is observed)",
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		},
+		[]string{
+			"operation",
+			"subscriptionID",
+			"result",
+		},
+	)
+	prometheus.MustRegister(prometheusApiRequestDuration)
+
+	prometheusApiThrottledRetries = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "azurerm_api_throttled_retries_total",
+			Help: "Azure API requests retried because they were throttled (429)",
+		},
+	)
+	prometheus.MustRegister(prometheusApiThrottledRetries)
+}
+
+// observeApiRequest observes the duration of an Azure API request for azurerm_api_request_duration_seconds
+// (subscriptionId is empty for requests across subscriptions, eg. ResourceGraph)
+func observeApiRequest(operation, subscriptionId string, startTime time.Time, err error) {
+	if prometheusApiRequestDuration == nil {
+		return
+	}
+
+	prometheusApiRequestDuration.WithLabelValues(operation, subscriptionId, ClassifyRequestResult(err)).Observe(time.Since(startTime).Seconds())
+}
+
+// subscriptionIdFromResourceId returns the subscription of a resource id (empty if not parseable)
+func subscriptionIdFromResourceId(resourceId string) string {
+	if azureResource, err := armclient.ParseResourceId(resourceId); err == nil {
+		return azureResource.Subscription
+	}
+	return ""
+}
+
+// countThrottledRetry counts a retry of a throttled request for azurerm_api_throttled_retries_total
+func countThrottledRetry() {
+	if prometheusApiThrottledRetries == nil {
+		return
+	}
+
+	prometheusApiThrottledRetries.Inc()
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"go.uber.org/zap"
+)
+
+// autodiscoverTargetMetrics sets the metrics of targets without metrics to all available metrics of the resource
+// (from metric definitions, cached per resource type), metrics are requested with their primary aggregation
+// if no aggregation is requested and limited to --probe.autodiscover.limit metrics per resource
+func (p *MetricProber) autodiscoverTargetMetrics() {
+	limit := p.Conf.Prober.Autodiscover.Limit
+
+	for subscriptionId, targetList := range p.targets {
+		discoveredTargetList := []MetricProbeTarget{}
+		for _, target := range targetList {
+			if len(target.Metrics) >= 1 {
+				discoveredTargetList = append(discoveredTargetList, target)
+				continue
+			}
+
+			contextLogger := p.logger.With(zap.String("resourceID", target.ResourceId))
+
+			definitionList, err := p.FetchMetricDefinitions(target.ResourceId)
+			if err != nil {
+				contextLogger.Warnf("unable to autodiscover metrics: %v", err)
+				p.reportTargetError(subscriptionId, target.ResourceId, err)
+				continue
+			}
+
+			if limit > 0 && len(definitionList) > limit {
+				contextLogger.Warnf("autodiscovered %v metrics, only the first %v metrics are collected", len(definitionList), limit)
+				definitionList = definitionList[:limit]
+			}
+
+			if len(target.Aggregations) >= 1 {
+				for _, definition := range definitionList {
+					target.Metrics = append(target.Metrics, definition.Name)
+				}
+				discoveredTargetList = append(discoveredTargetList, target)
+				continue
+			}
+
+			// one target per primary aggregation (aggregations are requested per target)
+			aggregationTargets := map[string]int{}
+			for _, definition := range definitionList {
+				i, exists := aggregationTargets[definition.PrimaryAggregation]
+				if !exists {
+					aggregationTarget := target
+					aggregationTarget.Metrics = []string{}
+					if definition.PrimaryAggregation != "" {
+						aggregationTarget.Aggregations = []string{definition.PrimaryAggregation}
+					}
+					discoveredTargetList = append(discoveredTargetList, aggregationTarget)
+					i = len(discoveredTargetList) - 1
+					aggregationTargets[definition.PrimaryAggregation] = i
+				}
+				discoveredTargetList[i].Metrics = append(discoveredTargetList[i].Metrics, definition.Name)
+			}
+			contextLogger.Debugf("autodiscovered %v metrics", len(definitionList))
+		}
+		p.targets[subscriptionId] = discoveredTargetList
+	}
+}
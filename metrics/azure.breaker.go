@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+type (
+	// connectionBreaker fast-fails probes when Azure is unreachable (DNS, connection or TLS failures),
+	// it opens after threshold consecutive transport failures and lets one probe through per cooldown to check for recovery
+	connectionBreaker struct {
+		lock      sync.Mutex
+		threshold int
+		cooldown  time.Duration
+		failures  int
+		open      bool
+		openedAt  time.Time
+	}
+
+	connectionBreakerPolicy struct{}
+)
+
+var (
+	AzureConnectionBreaker = &connectionBreaker{}
+)
+
+// ConfigureConnectionBreaker sets the consecutive transport failures after which the breaker opens (0 = disabled)
+// and the cooldown until a probe is let through to check for recovery
+func ConfigureConnectionBreaker(threshold int, cooldown time.Duration) {
+	AzureConnectionBreaker.lock.Lock()
+	defer AzureConnectionBreaker.lock.Unlock()
+	AzureConnectionBreaker.threshold = threshold
+	AzureConnectionBreaker.cooldown = cooldown
+}
+
+// Allow checks if a probe is allowed, returns the remaining cooldown if the breaker is open
+// (after the cooldown one probe is allowed, the breaker closes if it reaches Azure)
+func (b *connectionBreaker) Allow() (bool, time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if !b.open {
+		return true, 0
+	}
+
+	if elapsed := time.Since(b.openedAt); elapsed < b.cooldown {
+		return false, b.cooldown - elapsed
+	}
+
+	// recovery probe, next one after another cooldown
+	b.openedAt = time.Now()
+	return true, 0
+}
+
+// IsOpen returns if the breaker is open (probes are rejected)
+func (b *connectionBreaker) IsOpen() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.open
+}
+
+// reportResult counts transport failures of Azure requests, every response from Azure closes the breaker
+func (b *connectionBreaker) reportResult(err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.threshold <= 0 {
+		return
+	}
+
+	if !isTransportError(err) {
+		if err == nil {
+			b.failures = 0
+			b.open = false
+		}
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold && !b.open {
+		b.open = true
+		b.openedAt = time.Now()
+	}
+}
+
+// isTransportError checks if the request failed before a response was received (DNS, connection or TLS failure)
+func isTransportError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	return errors.As(err, &dnsErr) ||
+		errors.As(err, &opErr) ||
+		errors.As(err, &certErr) ||
+		errors.As(err, &recordErr) ||
+		errors.As(err, &authorityErr) ||
+		errors.As(err, &hostnameErr)
+}
+
+func (p connectionBreakerPolicy) Do(req *policy.Request) (*http.Response, error) {
+	resp, err := req.Next()
+	AzureConnectionBreaker.reportResult(err)
+	return resp, err
+}
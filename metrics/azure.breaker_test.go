@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/webdevops/go-common/azuresdk/armclient"
+	"go.uber.org/zap"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+type testErrorTransport func(r *http.Request) (*http.Response, error)
+
+func (transport testErrorTransport) Do(r *http.Request) (*http.Response, error) {
+	return transport(r)
+}
+
+func TestIsTransportError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"dns", &net.DNSError{Err: "no such host", Name: "management.azure.com"}, true},
+		{"connection refused", fmt.Errorf("request failed: %w", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}), true},
+		{"tls", x509.UnknownAuthorityError{}, true},
+		{"hostname", x509.HostnameError{Certificate: &x509.Certificate{}, Host: "management.azure.com"}, true},
+		{"no error", nil, false},
+		{"timeout", fmt.Errorf("request failed: %w", context.DeadlineExceeded), false},
+		{"canceled", context.Canceled, false},
+		{"response error", newTestAzureError(http.StatusServiceUnavailable, "ServiceUnavailable", "Service unavailable"), false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if ret := isTransportError(testCase.err); ret != testCase.expected {
+				t.Errorf("expected %v, got %v", testCase.expected, ret)
+			}
+		})
+	}
+}
+
+func TestConnectionBreaker(t *testing.T) {
+	transportErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	testCases := []struct {
+		name         string
+		threshold    int
+		results      []error
+		expectedOpen bool
+	}{
+		{"below threshold", 3, []error{transportErr, transportErr}, false},
+		{"threshold reached", 3, []error{transportErr, transportErr, transportErr}, true},
+		{"response resets failures", 3, []error{transportErr, transportErr, nil, transportErr}, false},
+		{"error response doesn't reset failures", 2, []error{transportErr, newTestAzureError(http.StatusInternalServerError, "InternalServerError", "Internal error"), transportErr}, true},
+		{"response closes breaker", 1, []error{transportErr, nil}, false},
+		{"disabled", 0, []error{transportErr, transportErr, transportErr}, false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			breaker := &connectionBreaker{threshold: testCase.threshold, cooldown: time.Minute}
+			for _, err := range testCase.results {
+				breaker.reportResult(err)
+			}
+
+			if open := breaker.IsOpen(); open != testCase.expectedOpen {
+				t.Errorf("expected open %v, got %v", testCase.expectedOpen, open)
+			}
+			if allowed, cooldown := breaker.Allow(); allowed == testCase.expectedOpen || (testCase.expectedOpen && cooldown <= 0) {
+				t.Errorf("expected allowed %v, got %v (cooldown %v)", !testCase.expectedOpen, allowed, cooldown)
+			}
+		})
+	}
+}
+
+func TestConnectionBreakerRecoveryProbe(t *testing.T) {
+	breaker := &connectionBreaker{threshold: 1, cooldown: time.Minute}
+	breaker.reportResult(&net.DNSError{Err: "no such host", Name: "management.azure.com"})
+
+	// cooldown elapsed: one recovery probe is allowed
+	breaker.openedAt = time.Now().Add(-2 * time.Minute)
+	if allowed, _ := breaker.Allow(); !allowed {
+		t.Error("expected recovery probe after cooldown")
+	}
+	if allowed, _ := breaker.Allow(); allowed {
+		t.Error("expected only one recovery probe per cooldown")
+	}
+	if !breaker.IsOpen() {
+		t.Error("expected open breaker until Azure is reachable")
+	}
+}
+
+// transport failures of Azure requests (sent with the client options of the probes) open the breaker
+func TestConnectionBreakerPolicy(t *testing.T) {
+	defer ConfigureConnectionBreaker(0, 0)
+	ConfigureConnectionBreaker(2, time.Minute)
+
+	azureClient, err := armclient.NewArmClientWithCloudName("AzurePublicCloud", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sendRequest := func(transportErr error) {
+		clientOpts := NewArmClientOptions(azureClient, config.Opts{})
+		clientOpts.Transport = testErrorTransport(func(r *http.Request) (*http.Response, error) {
+			if transportErr != nil {
+				return nil, transportErr
+			}
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody, Request: r}, nil
+		})
+
+		req, err := runtime.NewRequest(context.Background(), http.MethodGet, "https://management.azure.com/subscriptions")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = runtime.NewPipeline("test", "v0.0.0", runtime.PipelineOptions{}, &clientOpts.ClientOptions).Do(req)
+	}
+
+	testCases := []struct {
+		name         string
+		err          error
+		expectedOpen bool
+	}{
+		{"first failure", &net.DNSError{Err: "no such host", Name: "management.azure.com"}, false},
+		{"second failure", &net.DNSError{Err: "no such host", Name: "management.azure.com"}, true},
+		{"recovered", nil, false},
+	}
+
+	for _, testCase := range testCases {
+		sendRequest(testCase.err)
+		if open := AzureConnectionBreaker.IsOpen(); open != testCase.expectedOpen {
+			t.Errorf("%s: expected open %v, got %v", testCase.name, testCase.expectedOpen, open)
+		}
+	}
+}
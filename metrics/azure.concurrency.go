@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+const (
+	// interval in which waiting requests check if the concurrency ramp-up freed a slot
+	azureRequestSemaphoreRampUpInterval = 100 * time.Millisecond
+)
+
+type (
+	// azureRequestSemaphore limits the concurrent Azure API requests of all probes (--concurrency.global, limited by the
+	// concurrency ramp-up), every request attempt holds one slot while it's sent (not while waiting for retries)
+	azureRequestSemaphore struct {
+		lock        sync.Mutex
+		concurrency int
+		inflight    int
+		onQueueFull func()
+
+		// closed (and replaced) when a slot is released, wakes up waiting requests
+		released chan struct{}
+	}
+
+	azureRequestSemaphorePolicy struct{}
+)
+
+var (
+	AzureRequestSemaphore = &azureRequestSemaphore{}
+)
+
+// ConfigureAzureRequestConcurrency sets the concurrent Azure API requests across all probes (0 = unlimited),
+// onQueueFull is called for every request which didn't get a free slot within its probe timeout
+func ConfigureAzureRequestConcurrency(concurrency int, onQueueFull func()) {
+	AzureRequestSemaphore.lock.Lock()
+	defer AzureRequestSemaphore.lock.Unlock()
+
+	AzureRequestSemaphore.concurrency = concurrency
+	AzureRequestSemaphore.onQueueFull = onQueueFull
+	if AzureRequestSemaphore.released == nil {
+		AzureRequestSemaphore.released = make(chan struct{})
+	}
+}
+
+// Inflight returns the number of Azure API requests currently holding a slot
+func (s *azureRequestSemaphore) Inflight() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.inflight
+}
+
+// acquire waits for a free slot until the context is done (probe timeout),
+// returns the release function of the slot
+func (s *azureRequestSemaphore) acquire(ctx context.Context) (func(), error) {
+	for {
+		s.lock.Lock()
+		if s.concurrency <= 0 {
+			s.lock.Unlock()
+			return func() {}, nil
+		}
+
+		configured := s.concurrency
+		concurrency := EffectiveConcurrency(configured)
+		if s.inflight < concurrency {
+			s.inflight++
+			s.lock.Unlock()
+			return s.release, nil
+		}
+		released, onQueueFull := s.released, s.onQueueFull
+		s.lock.Unlock()
+
+		// the ramp-up increases the concurrency without released slots
+		var rampUp <-chan time.Time
+		if concurrency < configured {
+			rampUp = time.After(azureRequestSemaphoreRampUpInterval)
+		}
+
+		select {
+		case <-released:
+		case <-rampUp:
+		case <-ctx.Done():
+			if onQueueFull != nil {
+				onQueueFull()
+			}
+			return nil, fmt.Errorf("no free slot for Azure API request (--concurrency.global %v) within the probe timeout: %w", concurrency, ctx.Err())
+		}
+	}
+}
+
+// release frees a slot and wakes up the waiting requests
+func (s *azureRequestSemaphore) release() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.inflight--
+	close(s.released)
+	s.released = make(chan struct{})
+}
+
+func (p azureRequestSemaphorePolicy) Do(req *policy.Request) (*http.Response, error) {
+	release, err := AzureRequestSemaphore.acquire(req.Raw().Context())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return req.Next()
+}
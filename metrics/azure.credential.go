@@ -0,0 +1,10 @@
+package metrics
+
+import (
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// GetCred returns the credential for the Azure clients of the probes
+func (p *MetricProber) GetCred() azcore.TokenCredential {
+	return p.AzureClient.GetCred()
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/webdevops/go-common/azuresdk/armclient"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+// sdkRetryStatusCodes returns the status codes retried by the SDK retry policy (SDK defaults), without the status codes
+// which are already retried by withRetry (--azure.ratelimit.retries for 429, --azure.retry.count for 408 and 5xx)
+// so requests are not retried twice
+func sdkRetryStatusCodes(conf config.Opts) []int {
+	statusCodes := []int{}
+	for _, statusCode := range []int{
+		http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	} {
+		switch {
+		case statusCode == http.StatusTooManyRequests && conf.Azure.RateLimit.Retries > 0:
+		case statusCode != http.StatusTooManyRequests && conf.Azure.Retry.Count > 0:
+		default:
+			statusCodes = append(statusCodes, statusCode)
+		}
+	}
+
+	// empty list (not nil) disables the status code retries of the SDK
+	return statusCodes
+}
+
+// NewArmClientOptions builds the ARM client options with the SDK retry policy (--azure.sdk.*), the global request concurrency and the connection breaker applied
+func NewArmClientOptions(azureClient *armclient.ArmClient, conf config.Opts) *arm.ClientOptions {
+	clientOpts := azureClient.NewArmClientOptions()
+
+	// SDK uses defaults for zero values, negative values disable retries/delay
+	clientOpts.Retry.MaxRetries = int32(conf.Azure.SDK.MaxRetries) // #nosec G115
+	if conf.Azure.SDK.MaxRetries <= 0 {
+		clientOpts.Retry.MaxRetries = -1
+	}
+
+	clientOpts.Retry.RetryDelay = conf.Azure.SDK.RetryDelay
+	if conf.Azure.SDK.RetryDelay <= 0 {
+		clientOpts.Retry.RetryDelay = -1
+	}
+
+	clientOpts.Retry.StatusCodes = sdkRetryStatusCodes(conf)
+
+	clientOpts.PerRetryPolicies = append(clientOpts.PerRetryPolicies, azureRequestSemaphorePolicy{}, connectionBreakerPolicy{})
+
+	return clientOpts
+}
+
+func (p *MetricProber) NewArmClientOptions() *arm.ClientOptions {
+	return NewArmClientOptions(p.AzureClient, p.Conf)
+}
+
+// NewServiceDiscoveryArmClientOptions builds the ARM client options for resource discovery, status codes are not retried
+// by the SDK retry policy if resource discovery is retried by withServiceDiscoveryRetry (--azure.servicediscovery.retries)
+func (p *MetricProber) NewServiceDiscoveryArmClientOptions() *arm.ClientOptions {
+	clientOpts := p.NewArmClientOptions()
+	if p.Conf.Azure.ServiceDiscovery.Retries > 0 {
+		// empty list (not nil) disables the status code retries of the SDK
+		clientOpts.Retry.StatusCodes = []int{}
+	}
+	return clientOpts
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/webdevops/go-common/azuresdk/armclient"
+	"go.uber.org/zap"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func TestNewArmClientOptionsRetryPolicy(t *testing.T) {
+	azureClient, err := armclient.NewArmClientWithCloudName("AzurePublicCloud", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allStatusCodes := []int{
+		http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+
+	testCases := []struct {
+		name                string
+		maxRetries          int
+		retryDelay          time.Duration
+		retryCount          int
+		rateLimitRetries    int
+		expectedMaxRetries  int32
+		expectedRetryDelay  time.Duration
+		expectedStatusCodes []int
+	}{
+		{"sdk retries", 3, 4 * time.Second, 0, 0, 3, 4 * time.Second, allStatusCodes},
+		{"sdk retries disabled", 0, 0, 0, 0, -1, -1, allStatusCodes},
+		{"throttling retried by exporter", 3, time.Second, 0, 2, 3, time.Second, []int{408, 500, 502, 503, 504}},
+		{"transient errors retried by exporter", 3, time.Second, 2, 0, 3, time.Second, []int{429}},
+		{"all retried by exporter", 3, time.Second, 2, 2, 3, time.Second, []int{}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			conf := config.Opts{}
+			conf.Azure.SDK.MaxRetries = testCase.maxRetries
+			conf.Azure.SDK.RetryDelay = testCase.retryDelay
+			conf.Azure.Retry.Count = testCase.retryCount
+			conf.Azure.RateLimit.Retries = testCase.rateLimitRetries
+
+			clientOpts := NewArmClientOptions(azureClient, conf)
+			if clientOpts.Retry.MaxRetries != testCase.expectedMaxRetries {
+				t.Errorf("expected max retries %v, got %v", testCase.expectedMaxRetries, clientOpts.Retry.MaxRetries)
+			}
+			if clientOpts.Retry.RetryDelay != testCase.expectedRetryDelay {
+				t.Errorf("expected retry delay %v, got %v", testCase.expectedRetryDelay, clientOpts.Retry.RetryDelay)
+			}
+			if !reflect.DeepEqual(clientOpts.Retry.StatusCodes, testCase.expectedStatusCodes) {
+				t.Errorf("expected retried status codes %v, got %v", testCase.expectedStatusCodes, clientOpts.Retry.StatusCodes)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package metrics
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	PrometheusProbeCacheHitName = "azurerm_probe_cache_hit"
+
+	ProbeCacheStatusHit     = "hit"
+	ProbeCacheStatusPartial = "partial"
+	ProbeCacheStatusMiss    = "miss"
+
+	// CacheModeCacheFirst serves metrics from cache if available (default)
+	CacheModeCacheFirst = "cache-first"
+	// CacheModeFresh always fetches metrics and populates the cache
+	CacheModeFresh = "fresh"
+	// CacheModeStaleOnError always fetches metrics, the last cached metrics are served if the probe failed
+	CacheModeStaleOnError = "stale-on-error"
+
+	// how long metrics are kept for CacheModeStaleOnError
+	CacheStaleOnErrorDuration = 1 * time.Hour
+
+	// key suffix of the lock of early cache entry refreshes
+	cacheRefreshLockSuffix = ":refreshing"
+)
+
+type (
+	// metricsCacheEntry is a cached metric list with information for probabilistic early expiration (XFetch)
+	metricsCacheEntry struct {
+		metricList *MetricList
+
+		// duration needed to collect the metric list
+		delta time.Duration
+
+		// time when the entry expires
+		expiry time.Time
+
+		// failure reasons of the probe (overall and per subscription), restored on cache hits for
+		// azure_metrics_probe_success and azurerm_probe_error
+		probeErrors        map[string]bool
+		subscriptionErrors map[string]map[string]bool
+
+		// distinct values per dimension label, restored on cache hits for azurerm_probe_dimension_cardinality
+		dimensionCardinality map[string]int
+	}
+)
+
+// shouldRefresh decides if the entry should be refreshed before it expires (XFetch)
+// the probability raises the closer the entry is to its expiry and the longer it took to collect it,
+// a beta of 0 disables early refreshes
+func (e *metricsCacheEntry) shouldRefresh(beta float64) bool {
+	if beta <= 0 || e.delta <= 0 {
+		return false
+	}
+
+	// 1-rand is in (0,1], log is never -Inf
+	gap := -float64(e.delta) * beta * math.Log(1-rand.Float64()) // #nosec G404
+	return time.Now().Add(time.Duration(gap)).After(e.expiry)
+}
+
+// acquireCacheRefresh takes the refresh lock of the cache entry, so only one request (of all exporter instances
+// sharing the cache) refreshes the entry early, the lock expires with the entry at the latest
+func (p *MetricProber) acquireCacheRefresh(entry *metricsCacheEntry) bool {
+	lockDuration := time.Until(entry.expiry)
+	if lockDuration < time.Second {
+		lockDuration = time.Second
+	}
+
+	if err := p.metricsCache.cache.Add(*p.metricsCache.cacheKey+cacheRefreshLockSuffix, true, lockDuration); err != nil {
+		return false
+	}
+
+	p.metricsCache.refreshLock = true
+	return true
+}
+
+// releaseCacheRefresh releases the refresh lock after the entry was refreshed or the refresh failed,
+// so the next request can refresh the entry again
+func (p *MetricProber) releaseCacheRefresh() {
+	if !p.metricsCache.refreshLock {
+		return
+	}
+
+	p.metricsCache.refreshLock = false
+	p.metricsCache.cache.Delete(*p.metricsCache.cacheKey + cacheRefreshLockSuffix)
+}
+
+// jitterCacheDuration shortens the cache duration randomly by up to jitterPercent percent, so entries created
+// at the same time don't expire at the same time; the result is never negative or zero
+func jitterCacheDuration(duration time.Duration, jitterPercent float64) time.Duration {
+	if jitterPercent <= 0 || duration <= 0 {
+		return duration
+	}
+	jitterPercent = math.Min(jitterPercent, 100)
+
+	jitter := time.Duration(float64(duration) * jitterPercent / 100 * rand.Float64()) // #nosec G404
+	if ret := duration - jitter; ret > 0 {
+		return ret
+	}
+	return duration
+}
+
+// CacheStatus returns how the probe was served: hit (metrics from cache), partial (metrics fetched,
+// but servicediscovery or metric definitions from cache) or miss (everything fetched from Azure)
+func (p *MetricProber) CacheStatus() string {
+	switch {
+	case p.metricsCache.hit:
+		return ProbeCacheStatusHit
+	case p.serviceDiscoveryCache.hit.Load():
+		return ProbeCacheStatusPartial
+	default:
+		return ProbeCacheStatusMiss
+	}
+}
+
+// publishCacheStatus publishes azurerm_probe_cache_hit (not part of the cached metrics)
+func (p *MetricProber) publishCacheStatus() {
+	if p.prometheus.registry == nil {
+		return
+	}
+
+	status := p.CacheStatus()
+
+	gauge := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: PrometheusProbeCacheHitName,
+			Help: "Azure metrics probe served from cache (1 = metrics from cache; status: hit, partial or miss)",
+		},
+		[]string{"status"},
+	)
+	p.prometheus.registry.MustRegister(gauge)
+
+	value := 0.0
+	if status == ProbeCacheStatusHit {
+		value = 1
+	}
+	gauge.WithLabelValues(status).Set(value)
+}
+
+// fetchFromStaleCache replaces the metrics of a failed probe with the last cached metrics (cacheMode=stale-on-error)
+func (p *MetricProber) fetchFromStaleCache() bool {
+	if p.metricsCache.cache == nil || p.settings.CacheMode != CacheModeStaleOnError || !p.Failed() {
+		return false
+	}
+
+	val, ok := p.metricsCache.cache.Get(*p.metricsCache.cacheKey + ":stale")
+	if !ok {
+		return false
+	}
+	entry := val.(*metricsCacheEntry)
+
+	p.logger.Warn("probe failed, serving last cached metrics (cacheMode=stale-on-error)")
+	p.metricList = entry.metricList
+	p.dimensionCardinality = entry.dimensionCardinality
+	p.metricsCache.hit = true
+	p.response.Header().Add("X-metrics-cached", "stale")
+	return true
+}
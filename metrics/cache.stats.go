@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	CacheNameMetrics     = "metrics"
+	CacheNameAzure       = "azure"
+	CacheNameDefinitions = "definitions"
+)
+
+var (
+	prometheusCacheRequests                 *prometheus.CounterVec
+	prometheusServiceDiscoveryStaleFallback *prometheus.CounterVec
+)
+
+// InitCacheStats registers azurerm_stats_cache_requests (cache lookups by cache and result)
+// and azurerm_servicediscovery_stale_fallback_total
+func InitCacheStats() {
+	prometheusCacheRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azurerm_stats_cache_requests",
+			Help: "Azure metrics exporter internal cache lookups (result: hit or miss)",
+		},
+		[]string{
+			"cache",
+			"result",
+		},
+	)
+	prometheus.MustRegister(prometheusCacheRequests)
+
+	prometheusServiceDiscoveryStaleFallback = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azurerm_servicediscovery_stale_fallback_total",
+			Help: "Resource discoveries which failed and used the last successful (stale) discovery result",
+		},
+		[]string{
+			"subscriptionID",
+		},
+	)
+	prometheus.MustRegister(prometheusServiceDiscoveryStaleFallback)
+}
+
+// countCacheRequest counts a cache lookup for azurerm_stats_cache_requests
+func countCacheRequest(cacheName string, hit bool) {
+	if prometheusCacheRequests == nil {
+		return
+	}
+
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	prometheusCacheRequests.WithLabelValues(cacheName, result).Inc()
+}
+
+// countServiceDiscoveryStaleFallback counts a failed resource discovery answered from the stale cache
+func countServiceDiscoveryStaleFallback(subscriptionId string) {
+	if prometheusServiceDiscoveryStaleFallback == nil {
+		return
+	}
+
+	prometheusServiceDiscoveryStaleFallback.WithLabelValues(subscriptionId).Inc()
+}
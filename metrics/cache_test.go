@@ -0,0 +1,273 @@
+package metrics
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func TestJitterCacheDurationRange(t *testing.T) {
+	duration := 10 * time.Minute
+
+	for _, jitterPercent := range []float64{10, 50, 100, 150} {
+		minDuration := time.Duration(float64(duration) * (1 - min(jitterPercent, 100)/100))
+		for i := 0; i < 1000; i++ {
+			ret := jitterCacheDuration(duration, jitterPercent)
+			if ret > duration || ret < minDuration || ret <= 0 {
+				t.Fatalf("jitter %v%%: expected duration between %v and %v, got %v", jitterPercent, minDuration, duration, ret)
+			}
+		}
+	}
+}
+
+func TestJitterCacheDurationDisabled(t *testing.T) {
+	for _, jitterPercent := range []float64{0, -10} {
+		if ret := jitterCacheDuration(time.Minute, jitterPercent); ret != time.Minute {
+			t.Errorf("jitter %v%%: expected unchanged duration, got %v", jitterPercent, ret)
+		}
+	}
+
+	if ret := jitterCacheDuration(0, 50); ret != 0 {
+		t.Errorf("expected zero duration to be unchanged, got %v", ret)
+	}
+}
+
+func TestMetricsCacheEntryShouldRefresh(t *testing.T) {
+	testCases := []struct {
+		name     string
+		beta     float64
+		delta    time.Duration
+		expiry   time.Duration
+		expected bool
+	}{
+		{"disabled", 0, time.Minute, time.Second, false},
+		{"unknown delta", 1, 0, time.Second, false},
+		{"expired", 1, time.Second, -time.Second, true},
+		{"close to expiry with slow probe", 100, time.Hour, time.Millisecond, true},
+		{"far from expiry with fast probe", 1, time.Nanosecond, time.Hour, false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			entry := &metricsCacheEntry{delta: testCase.delta, expiry: time.Now().Add(testCase.expiry)}
+			for i := 0; i < 100; i++ {
+				if ret := entry.shouldRefresh(testCase.beta); ret != testCase.expected {
+					t.Fatalf("expected %v, got %v", testCase.expected, ret)
+				}
+			}
+		})
+	}
+}
+
+// only one of the concurrent requests refreshes an entry early, all others are served from cache
+func TestFetchFromCacheEarlyRefreshContention(t *testing.T) {
+	cacheKey := "probe"
+	cacheDuration := time.Minute
+	metricsCache := cache.New(cacheDuration, cacheDuration)
+	metricsCache.Set(cacheKey, &metricsCacheEntry{
+		metricList: newTestDimensionMetricList(),
+		delta:      time.Hour,
+		expiry:     time.Now().Add(time.Second),
+	}, cacheDuration)
+
+	conf := config.Opts{}
+	conf.Prober.CacheXFetchBeta = 100
+
+	newCacheProber := func() *MetricProber {
+		prober := newTestProber(conf, &RequestMetricSettings{CacheMode: CacheModeCacheFirst})
+		prober.EnableMetricsCache(metricsCache, cacheKey, &cacheDuration)
+		prober.SetPrometheusRegistry(prometheus.NewRegistry())
+		return prober
+	}
+
+	proberList := make([]*MetricProber, 20)
+	for i := range proberList {
+		proberList[i] = newCacheProber()
+	}
+
+	wg := sync.WaitGroup{}
+	for _, prober := range proberList {
+		wg.Add(1)
+		go func(prober *MetricProber) {
+			defer wg.Done()
+			prober.FetchFromCache()
+		}(prober)
+	}
+	wg.Wait()
+
+	var refreshingProber *MetricProber
+	for _, prober := range proberList {
+		if prober.metricsCache.refresh {
+			if refreshingProber != nil {
+				t.Fatal("expected only one early refresh")
+			}
+			refreshingProber = prober
+		} else if !prober.metricsCache.hit {
+			t.Error("expected cache hit for requests not refreshing the entry")
+		}
+	}
+	if refreshingProber == nil {
+		t.Fatal("expected early refresh")
+	}
+
+	// the lock is released after the refresh, so the next request can refresh the entry again
+	refreshingProber.metricList = newTestDimensionMetricList()
+	refreshingProber.SaveToCache()
+	metricsCache.Set(cacheKey, &metricsCacheEntry{
+		metricList: newTestDimensionMetricList(),
+		delta:      time.Hour,
+		expiry:     time.Now().Add(time.Second),
+	}, cacheDuration)
+
+	prober := newCacheProber()
+	if prober.FetchFromCache() || !prober.metricsCache.refresh {
+		t.Error("expected early refresh after the previous refresh finished")
+	}
+}
+
+func TestPublishCacheStatus(t *testing.T) {
+	testCases := []struct {
+		name                string
+		metricsHit          bool
+		serviceDiscoveryHit bool
+		expectedStatus      string
+		expectedValue       float64
+	}{
+		{"hit", true, true, ProbeCacheStatusHit, 1},
+		{"partial", false, true, ProbeCacheStatusPartial, 0},
+		{"miss", false, false, ProbeCacheStatusMiss, 0},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			registry := prometheus.NewRegistry()
+			prober := newTestProber(config.Opts{}, nil)
+			prober.SetPrometheusRegistry(registry)
+			prober.metricsCache.hit = testCase.metricsHit
+			prober.serviceDiscoveryCache.hit.Store(testCase.serviceDiscoveryHit)
+
+			prober.publishCacheStatus()
+
+			metricFamilies, err := registry.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(metricFamilies) != 1 || metricFamilies[0].GetName() != PrometheusProbeCacheHitName || len(metricFamilies[0].GetMetric()) != 1 {
+				t.Fatalf("expected one %s series, got %v", PrometheusProbeCacheHitName, metricFamilies)
+			}
+			metric := metricFamilies[0].GetMetric()[0]
+			if status := metric.GetLabel()[0].GetValue(); status != testCase.expectedStatus {
+				t.Errorf("expected status %q, got %q", testCase.expectedStatus, status)
+			}
+			if value := metric.GetGauge().GetValue(); value != testCase.expectedValue {
+				t.Errorf("expected value %v, got %v", testCase.expectedValue, value)
+			}
+		})
+	}
+}
+
+func TestCacheMode(t *testing.T) {
+	testCases := []struct {
+		mode string
+		// second probe is served from cache
+		expectedHit bool
+		// value of the failed third probe (value of the second successful probe if stale metrics are served)
+		expectedFailedValue float64
+		expectedStale       bool
+	}{
+		{CacheModeCacheFirst, true, 1, false},
+		{CacheModeFresh, false, 3, false},
+		{CacheModeStaleOnError, false, 2, true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.mode, func(t *testing.T) {
+			cacheKey := "probe"
+			cacheDuration := time.Minute
+			metricsCache := cache.New(cacheDuration, cacheDuration)
+
+			// runProbe runs a probe, the metrics are only collected if the probe isn't served from cache
+			runProbe := func(value float64, failed bool) *MetricProber {
+				prober := newTestProber(config.Opts{}, &RequestMetricSettings{CacheMode: testCase.mode})
+				prober.EnableMetricsCache(metricsCache, cacheKey, &cacheDuration)
+				prober.SetPrometheusRegistry(prometheus.NewRegistry())
+				if prober.FetchFromCache() {
+					return prober
+				}
+
+				prober.metricList.Add("azurerm_resource_metric", MetricRow{Labels: prometheus.Labels{"resourceID": "r1"}, Value: value})
+				if failed {
+					prober.reportProbeError(ProbeErrorReasonThrottle)
+				}
+				if err := prober.finishRun(); err != nil {
+					t.Fatal(err)
+				}
+				return prober
+			}
+			probeValue := func(prober *MetricProber) float64 {
+				return prober.metricList.GetMetricList("azurerm_resource_metric")[0].Value
+			}
+
+			runProbe(1, false)
+
+			prober := runProbe(2, false)
+			if prober.metricsCache.hit != testCase.expectedHit {
+				t.Errorf("expected cache hit %v, got %v", testCase.expectedHit, prober.metricsCache.hit)
+			}
+			expectedValue := 2.0
+			if testCase.expectedHit {
+				expectedValue = 1
+			}
+			if value := probeValue(prober); value != expectedValue {
+				t.Errorf("expected value %v, got %v", expectedValue, value)
+			}
+
+			// fresh metrics populate the cache
+			val, _ := metricsCache.Get(cacheKey)
+			if value := val.(*metricsCacheEntry).metricList.GetMetricList("azurerm_resource_metric")[0].Value; value != expectedValue {
+				t.Errorf("expected cached value %v, got %v", expectedValue, value)
+			}
+
+			prober = runProbe(3, true)
+			if value := probeValue(prober); value != testCase.expectedFailedValue {
+				t.Errorf("expected value %v of failed probe, got %v", testCase.expectedFailedValue, value)
+			}
+			if stale := prober.response.Header().Get("X-metrics-cached") == "stale"; stale != testCase.expectedStale {
+				t.Errorf("expected stale metrics %v, got %v", testCase.expectedStale, stale)
+			}
+
+			// metrics of failed probes are not used as fallback
+			if val, exists := metricsCache.Get(cacheKey + ":stale"); exists {
+				if value := val.(*metricsCacheEntry).metricList.GetMetricList("azurerm_resource_metric")[0].Value; value != 2 {
+					t.Errorf("expected stale value 2, got %v", value)
+				}
+			}
+		})
+	}
+}
+
+// without successful probe there is nothing to fall back to
+func TestCacheModeStaleOnErrorWithoutCache(t *testing.T) {
+	cacheDuration := time.Minute
+	prober := newTestProber(config.Opts{}, &RequestMetricSettings{CacheMode: CacheModeStaleOnError})
+	prober.EnableMetricsCache(cache.New(cacheDuration, cacheDuration), "probe", &cacheDuration)
+	prober.SetPrometheusRegistry(prometheus.NewRegistry())
+
+	prober.metricList.Add("azurerm_resource_metric", MetricRow{Labels: prometheus.Labels{"resourceID": "r1"}, Value: 3})
+	prober.reportProbeError(ProbeErrorReasonThrottle)
+	if err := prober.finishRun(); err != nil {
+		t.Fatal(err)
+	}
+
+	if prober.metricsCache.hit {
+		t.Error("expected no cache hit")
+	}
+	if value := prober.metricList.GetMetricList("azurerm_resource_metric")[0].Value; value != 3 {
+		t.Errorf("expected value 3 of failed probe, got %v", value)
+	}
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	iso8601 "github.com/channelmeter/iso8601duration"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// MetricWindowCurrent is the window label of the requested (not shifted) timespan
+	MetricWindowCurrent = "current"
+)
+
+type (
+	// MetricCompareOffset is an additional window shifted by Offset into the past (compareOffsets parameter)
+	MetricCompareOffset struct {
+		Name   string
+		Offset time.Duration
+	}
+)
+
+// parseCompareOffsets parses the compareOffsets parameter (ISO8601 durations, eg. P7D)
+func parseCompareOffsets(values []string) (offsets []MetricCompareOffset, err error) {
+	for _, val := range values {
+		duration, err := iso8601.FromString(val)
+		if err != nil || duration.ToDuration() <= 0 {
+			return nil, fmt.Errorf(`parameter "compareOffsets" must be a list of positive ISO8601 durations (eg. P7D), got "%s"`, val)
+		}
+
+		offsets = append(offsets, MetricCompareOffset{
+			Name:   val,
+			Offset: duration.ToDuration(),
+		})
+	}
+	return
+}
+
+// metricWindows returns the windows to fetch, nil is the requested timespan followed by the compareOffsets
+func (p *MetricProber) metricWindows() []*MetricCompareOffset {
+	windows := []*MetricCompareOffset{nil}
+	for i := range p.settings.CompareOffsets {
+		windows = append(windows, &p.settings.CompareOffsets[i])
+	}
+	return windows
+}
+
+// addWindowLabel adds the window label (current or the compareOffsets name) if compareOffsets are requested
+func (p *MetricProber) addWindowLabel(labels prometheus.Labels, window *MetricCompareOffset) prometheus.Labels {
+	if len(p.settings.CompareOffsets) >= 1 {
+		labels["window"] = MetricWindowCurrent
+		if window != nil {
+			labels["window"] = window.Name
+		}
+	}
+	return labels
+}
+
+// shiftTimespan returns the timespan (duration or start/end) shifted by offset into the past as start/end timespan
+func shiftTimespan(timespan string, offset time.Duration, now time.Time) (string, error) {
+	var startTime, endTime time.Time
+
+	if start, end, found := strings.Cut(timespan, "/"); found {
+		var err error
+		if startTime, err = time.Parse(time.RFC3339, start); err != nil {
+			return "", fmt.Errorf(`unable to parse timespan "%s": %w`, timespan, err)
+		}
+		if endTime, err = time.Parse(time.RFC3339, end); err != nil {
+			return "", fmt.Errorf(`unable to parse timespan "%s": %w`, timespan, err)
+		}
+	} else {
+		duration, err := iso8601.FromString(timespan)
+		if err != nil {
+			return "", fmt.Errorf(`unable to parse timespan "%s": %w`, timespan, err)
+		}
+		endTime = now
+		startTime = now.Add(-duration.ToDuration())
+	}
+
+	return fmt.Sprintf(
+		"%s/%s",
+		startTime.Add(-offset).UTC().Format(time.RFC3339),
+		endTime.Add(-offset).UTC().Format(time.RFC3339),
+	), nil
+}
@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func TestRequestMetricSettingsCompareOffsets(t *testing.T) {
+	testCases := []struct {
+		name          string
+		query         string
+		expected      []MetricCompareOffset
+		expectedError string
+	}{
+		{"unset", "", nil, ""},
+		{"single", "compareOffsets=P7D", []MetricCompareOffset{{"P7D", 7 * 24 * time.Hour}}, ""},
+		{"list", "compareOffsets=P7D,PT12H", []MetricCompareOffset{{"P7D", 7 * 24 * time.Hour}, {"PT12H", 12 * time.Hour}}, ""},
+		{"multiple params", "compareOffsets=P1D&compareOffsets=P14D", []MetricCompareOffset{{"P1D", 24 * time.Hour}, {"P14D", 14 * 24 * time.Hour}}, ""},
+		{"invalid", "compareOffsets=7d", nil, `must be a list of positive ISO8601 durations (eg. P7D), got "7d"`},
+		{"zero", "compareOffsets=PT0S", nil, `got "PT0S"`},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			settings, err := newTestRequestMetricSettings(testCase.query, config.Opts{})
+			if testCase.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+					t.Errorf("expected error %q, got %v", testCase.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if len(settings.CompareOffsets) != len(testCase.expected) {
+				t.Fatalf("expected offsets %v, got %v", testCase.expected, settings.CompareOffsets)
+			}
+			for i, offset := range testCase.expected {
+				if settings.CompareOffsets[i] != offset {
+					t.Errorf("expected offset %v, got %v", offset, settings.CompareOffsets[i])
+				}
+			}
+		})
+	}
+}
+
+func TestShiftTimespan(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name          string
+		timespan      string
+		offset        time.Duration
+		expected      string
+		expectedError bool
+	}{
+		{"duration", "PT1H", 7 * 24 * time.Hour, "2024-01-08T11:00:00Z/2024-01-08T12:00:00Z", false},
+		{"duration without offset", "P1D", 0, "2024-01-14T12:00:00Z/2024-01-15T12:00:00Z", false},
+		{"start/end", "2024-01-10T00:00:00Z/2024-01-11T00:00:00Z", 24 * time.Hour, "2024-01-09T00:00:00Z/2024-01-10T00:00:00Z", false},
+		{"start/end with timezone", "2024-01-10T02:00:00+02:00/2024-01-10T03:00:00+02:00", time.Hour, "2024-01-09T23:00:00Z/2024-01-10T00:00:00Z", false},
+		{"invalid duration", "1h", time.Hour, "", true},
+		{"invalid start", "yesterday/2024-01-11T00:00:00Z", time.Hour, "", true},
+		{"invalid end", "2024-01-10T00:00:00Z/today", time.Hour, "", true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			timespan, err := shiftTimespan(testCase.timespan, testCase.offset, now)
+			if testCase.expectedError {
+				if err == nil {
+					t.Errorf("expected error, got %v", timespan)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if timespan != testCase.expected {
+				t.Errorf("expected %v, got %v", testCase.expected, timespan)
+			}
+		})
+	}
+}
+
+func TestMetricWindows(t *testing.T) {
+	testCases := []struct {
+		name           string
+		query          string
+		expectedLabels []string
+	}{
+		{"without compareOffsets", "", []string{""}},
+		{"single offset", "compareOffsets=P7D", []string{MetricWindowCurrent, "P7D"}},
+		{"multiple offsets", "compareOffsets=P7D,P14D", []string{MetricWindowCurrent, "P7D", "P14D"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			settings, err := newTestRequestMetricSettings(testCase.query, config.Opts{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			prober := newTestProber(config.Opts{}, &settings)
+
+			// requested timespan first, followed by the compareOffsets
+			windows := prober.metricWindows()
+			if len(windows) != len(testCase.expectedLabels) {
+				t.Fatalf("expected %v windows, got %v", len(testCase.expectedLabels), len(windows))
+			}
+			if windows[0] != nil {
+				t.Errorf("expected requested timespan as first window, got %v", windows[0])
+			}
+
+			for i, window := range windows {
+				labels := prober.addWindowLabel(prometheus.Labels{}, window)
+				if label, exists := labels["window"]; label != testCase.expectedLabels[i] || exists != (testCase.expectedLabels[i] != "") {
+					t.Errorf("expected window label %q, got %v", testCase.expectedLabels[i], labels)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+const (
+	// ConcurrencyRampUpStartFactor is the share of the configured concurrency used at the start of the ramp-up
+	ConcurrencyRampUpStartFactor = 0.1
+)
+
+var (
+	concurrencyRampUp struct {
+		lock     sync.Mutex
+		start    time.Time
+		duration time.Duration
+
+		// reports if the metrics cache is empty, the ramp-up restarts if the cache runs empty after it was filled
+		isCacheCold func() bool
+		cacheWarm   bool
+	}
+)
+
+// StartConcurrencyRampUp starts the concurrency ramp-up, concurrency starts low and increases linearly
+// to the configured concurrency within duration (0 = disabled). If isCacheCold is set, the ramp-up restarts
+// when the cache runs empty again (eg. all entries expired after a pause of the probes)
+func StartConcurrencyRampUp(duration time.Duration, isCacheCold func() bool) {
+	concurrencyRampUp.lock.Lock()
+	defer concurrencyRampUp.lock.Unlock()
+
+	concurrencyRampUp.start = time.Now()
+	concurrencyRampUp.duration = duration
+	concurrencyRampUp.isCacheCold = isCacheCold
+	concurrencyRampUp.cacheWarm = false
+}
+
+// ConcurrencyRampUpFactor returns the share of the configured concurrency which is currently allowed (1 = full concurrency)
+func ConcurrencyRampUpFactor() float64 {
+	concurrencyRampUp.lock.Lock()
+	defer concurrencyRampUp.lock.Unlock()
+
+	if concurrencyRampUp.duration <= 0 {
+		return 1
+	}
+
+	if concurrencyRampUp.isCacheCold != nil {
+		cold := concurrencyRampUp.isCacheCold()
+		if cold && concurrencyRampUp.cacheWarm {
+			// cache ran empty, requests are sent to Azure again
+			concurrencyRampUp.start = time.Now()
+		}
+		concurrencyRampUp.cacheWarm = !cold
+	}
+
+	elapsed := time.Since(concurrencyRampUp.start)
+	if elapsed >= concurrencyRampUp.duration {
+		return 1
+	}
+
+	progress := float64(elapsed) / float64(concurrencyRampUp.duration)
+	return ConcurrencyRampUpStartFactor + (1-ConcurrencyRampUpStartFactor)*progress
+}
+
+// EffectiveConcurrency returns the concurrency limited by the ramp-up (at least 1), rounded down
+// (rounding up would exceed the share because of floating point errors, eg. 20 * 0.1 = 2.0000000000000004)
+func EffectiveConcurrency(concurrency int) int {
+	effective := int(math.Floor(float64(concurrency) * ConcurrencyRampUpFactor()))
+	if effective < 1 {
+		effective = 1
+	}
+	return effective
+}
+
+// ResourceConcurrencyForSubscription returns the configured resource concurrency for a subscription
+// (--concurrency.per-subscription with fallback to --concurrency.subscription.resource), not limited by the ramp-up
+func ResourceConcurrencyForSubscription(conf config.Opts, subscriptionId string) int {
+	for overrideSubscriptionId, concurrency := range conf.Prober.ConcurrencyPerSubscription {
+		if strings.EqualFold(overrideSubscriptionId, subscriptionId) {
+			return concurrency
+		}
+	}
+
+	return conf.Prober.ConcurrencySubscriptionResource
+}
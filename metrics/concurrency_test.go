@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+// setConcurrencyRampUpElapsed starts a ramp-up of duration which already runs for elapsed
+func setConcurrencyRampUpElapsed(duration, elapsed time.Duration, isCacheCold func() bool) {
+	StartConcurrencyRampUp(duration, isCacheCold)
+	concurrencyRampUp.lock.Lock()
+	concurrencyRampUp.start = time.Now().Add(-elapsed)
+	concurrencyRampUp.lock.Unlock()
+}
+
+func TestEffectiveConcurrencyRampUp(t *testing.T) {
+	defer StartConcurrencyRampUp(0, nil)
+
+	testCases := []struct {
+		name     string
+		duration time.Duration
+		elapsed  time.Duration
+		expected int
+	}{
+		{"start", time.Hour, 0, 2},
+		{"half", time.Hour, 30 * time.Minute, 11},
+		{"finished", time.Hour, 2 * time.Hour, 20},
+		{"disabled", 0, 0, 20},
+	}
+
+	previous := 0
+	for _, testCase := range testCases[:3] {
+		setConcurrencyRampUpElapsed(testCase.duration, testCase.elapsed, nil)
+		concurrency := EffectiveConcurrency(20)
+		if concurrency <= previous {
+			t.Errorf("%s: expected concurrency to increase over the ramp-up window, got %v after %v", testCase.name, concurrency, previous)
+		}
+		previous = concurrency
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			setConcurrencyRampUpElapsed(testCase.duration, testCase.elapsed, nil)
+			if concurrency := EffectiveConcurrency(20); concurrency != testCase.expected {
+				t.Errorf("expected concurrency %v, got %v", testCase.expected, concurrency)
+			}
+
+			// at least one request
+			if concurrency := EffectiveConcurrency(1); concurrency != 1 {
+				t.Errorf("expected concurrency 1, got %v", concurrency)
+			}
+		})
+	}
+}
+
+func TestConcurrencyRampUpColdCache(t *testing.T) {
+	defer StartConcurrencyRampUp(0, nil)
+
+	cold := true
+	setConcurrencyRampUpElapsed(time.Hour, 2*time.Hour, func() bool { return cold })
+
+	// cache was never filled (eg. caching not used by the probes)
+	if concurrency := EffectiveConcurrency(20); concurrency != 20 {
+		t.Errorf("expected full concurrency without filled cache, got %v", concurrency)
+	}
+
+	cold = false
+	if concurrency := EffectiveConcurrency(20); concurrency != 20 {
+		t.Errorf("expected full concurrency with warm cache, got %v", concurrency)
+	}
+
+	// cache ran empty
+	cold = true
+	if concurrency := EffectiveConcurrency(20); concurrency != 2 {
+		t.Errorf("expected restarted ramp-up with cold cache, got %v", concurrency)
+	}
+}
+
+func TestAzureRequestSemaphoreRampUp(t *testing.T) {
+	defer StartConcurrencyRampUp(0, nil)
+	defer ConfigureAzureRequestConcurrency(0, nil)
+
+	queueFull := 0
+	ConfigureAzureRequestConcurrency(10, func() { queueFull++ })
+
+	// 10% of 10 slots at the start of the ramp-up
+	setConcurrencyRampUpElapsed(time.Hour, 0, nil)
+	release, err := AzureRequestSemaphore.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := AzureRequestSemaphore.acquire(ctx); err == nil {
+		t.Fatal("expected no free slot at the start of the ramp-up")
+	}
+	if queueFull != 1 {
+		t.Errorf("expected queue full callback, got %v calls", queueFull)
+	}
+
+	// waiting requests get a slot when the ramp-up increases the concurrency
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		setConcurrencyRampUpElapsed(time.Hour, 2*time.Hour, nil)
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	secondRelease, err := AzureRequestSemaphore.acquire(ctx)
+	if err != nil {
+		t.Fatalf("expected free slot after the ramp-up, got %v", err)
+	}
+
+	if inflight := AzureRequestSemaphore.Inflight(); inflight != 2 {
+		t.Errorf("expected 2 inflight requests, got %v", inflight)
+	}
+	release()
+	secondRelease()
+	if inflight := AzureRequestSemaphore.Inflight(); inflight != 0 {
+		t.Errorf("expected no inflight requests, got %v", inflight)
+	}
+}
+
+func TestConcurrencyForSubscription(t *testing.T) {
+	defer StartConcurrencyRampUp(0, nil)
+
+	conf := config.Opts{}
+	conf.Prober.ConcurrencySubscriptionResource = 10
+	conf.Prober.ConcurrencyPerSubscription = map[string]int{
+		"00000000-0000-0000-0000-000000000001": 2,
+		"AAAAAAAA-0000-0000-0000-000000000002": 40,
+	}
+	prober := newTestProber(conf, nil)
+
+	testCases := []struct {
+		name           string
+		subscriptionId string
+		rampUp         bool
+		expected       int
+	}{
+		{"override", "00000000-0000-0000-0000-000000000001", false, 2},
+		{"override case insensitive", "aaaaaaaa-0000-0000-0000-000000000002", false, 40},
+		{"default", "00000000-0000-0000-0000-000000000003", false, 10},
+		{"override with ramp-up", "aaaaaaaa-0000-0000-0000-000000000002", true, 4},
+		{"default with ramp-up", "00000000-0000-0000-0000-000000000003", true, 1},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if testCase.rampUp {
+				setConcurrencyRampUpElapsed(time.Hour, 0, nil)
+			} else {
+				StartConcurrencyRampUp(0, nil)
+			}
+
+			if concurrency := prober.concurrencyForSubscription(testCase.subscriptionId); concurrency != testCase.expected {
+				t.Errorf("expected concurrency %v, got %v", testCase.expected, concurrency)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/azuresdk/armclient"
+	"github.com/webdevops/go-common/utils/to"
+)
+
+const (
+	PrometheusMetricDimensionName = "azurerm_resource_metric_dimension"
+)
+
+type (
+	MetricDefinition struct {
+		Name                  string
+		Namespace             string
+		Unit                  string
+		PrimaryAggregation    string
+		SupportedAggregations []string
+		Dimensions            []string
+		Availabilities        []MetricAvailability
+	}
+
+	MetricAvailability struct {
+		TimeGrain string
+		Retention string
+	}
+)
+
+func (p *MetricProber) MetricDefinitionsClient(subscriptionId string) (*armmonitor.MetricDefinitionsClient, error) {
+	return armmonitor.NewMetricDefinitionsClient(subscriptionId, p.GetCred(), p.NewArmClientOptions())
+}
+
+// FetchMetricDefinitions fetches the metric definitions for a resource, cached by resource type
+func (p *MetricProber) FetchMetricDefinitions(resourceId string) (definitionList []MetricDefinition, err error) {
+	azureResource, err := armclient.ParseResourceId(resourceId)
+	if err != nil {
+		return definitionList, err
+	}
+
+	resourceType := azureResource.ResourceProvider()
+	cacheKey := fmt.Sprintf("definitions:%s:%s", resourceType, strings.ToLower(p.settings.MetricNamespace))
+
+	// try to fetch info from cache
+	definitionsCache, definitionsCacheDuration := p.metricDefinitionsCacheBackend()
+	if definitionsCache != nil {
+		v, ok := definitionsCache.Get(cacheKey)
+		if p.metricDefinitionsCache.cache != nil {
+			countCacheRequest(CacheNameDefinitions, ok)
+		} else {
+			countCacheRequest(CacheNameAzure, ok)
+		}
+		if ok {
+			if cacheData, ok := v.([]byte); ok {
+				if err := json.Unmarshal(cacheData, &definitionList); err == nil {
+					p.serviceDiscoveryCache.hit.Store(true)
+					return definitionList, nil
+				}
+			}
+		}
+	}
+
+	client, err := p.MetricDefinitionsClient(azureResource.Subscription)
+	if err != nil {
+		return definitionList, err
+	}
+
+	opts := armmonitor.MetricDefinitionsClientListOptions{}
+	if len(p.settings.MetricNamespace) >= 1 {
+		opts.Metricnamespace = to.StringPtr(p.settings.MetricNamespace)
+	}
+
+	pager := client.NewListPager(resourceId, &opts)
+	for pager.More() {
+		startTime := time.Now()
+		result, err := pager.NextPage(p.ctx)
+		observeApiRequest(ApiOperationGetMetricDefinitions, azureResource.Subscription, startTime, err)
+		if err != nil {
+			return definitionList, fmt.Errorf("unable to fetch metric definitions: %w", err)
+		}
+
+		for _, row := range result.Value {
+			if row.Name == nil {
+				continue
+			}
+
+			definition := MetricDefinition{
+				Name:      to.String(row.Name.Value),
+				Namespace: to.String(row.Namespace),
+			}
+
+			if row.Unit != nil {
+				definition.Unit = string(*row.Unit)
+			}
+
+			if row.PrimaryAggregationType != nil {
+				definition.PrimaryAggregation = strings.ToLower(string(*row.PrimaryAggregationType))
+			}
+
+			for _, aggregation := range row.SupportedAggregationTypes {
+				if aggregation != nil {
+					definition.SupportedAggregations = append(definition.SupportedAggregations, strings.ToLower(string(*aggregation)))
+				}
+			}
+
+			for _, availability := range row.MetricAvailabilities {
+				if availability != nil && availability.TimeGrain != nil && availability.Retention != nil {
+					definition.Availabilities = append(definition.Availabilities, MetricAvailability{
+						TimeGrain: *availability.TimeGrain,
+						Retention: *availability.Retention,
+					})
+				}
+			}
+
+			for _, dimension := range row.Dimensions {
+				if dimension != nil {
+					definition.Dimensions = append(definition.Dimensions, to.String(dimension.Value))
+				}
+			}
+
+			definitionList = append(definitionList, definition)
+		}
+	}
+
+	// store to cache (if enabled)
+	if definitionsCache != nil {
+		if cacheData, err := json.Marshal(definitionList); err == nil {
+			definitionsCache.Set(cacheKey, cacheData, definitionsCacheDuration)
+		}
+	}
+
+	return definitionList, nil
+}
+
+// metricDefinitionsCacheBackend returns the cache for metric definitions (dedicated cache or service discovery cache)
+func (p *MetricProber) metricDefinitionsCacheBackend() (Cache, time.Duration) {
+	if p.metricDefinitionsCache.cache != nil {
+		return p.metricDefinitionsCache.cache, p.metricDefinitionsCache.cacheDuration
+	}
+
+	if p.serviceDiscoveryCache.cache != nil {
+		return p.serviceDiscoveryCache.cache, *p.serviceDiscoveryCache.cacheDuration
+	}
+
+	return nil, 0
+}
+
+// collectMetricDimensionsFromTargets adds the supported dimensions of the requested metrics (one row per dimension)
+func (p *MetricProber) collectMetricDimensionsFromTargets() {
+	processedResourceTypes := map[string]bool{}
+
+	for _, targetList := range p.targets {
+		for _, target := range targetList {
+			azureResource, err := armclient.ParseResourceId(target.ResourceId)
+			if err != nil {
+				continue
+			}
+
+			resourceType := azureResource.ResourceProvider()
+			if _, exists := processedResourceTypes[resourceType]; exists {
+				continue
+			}
+			processedResourceTypes[resourceType] = true
+
+			definitionList, err := p.FetchMetricDefinitions(target.ResourceId)
+			if err != nil {
+				p.logger.Warn(err)
+				continue
+			}
+
+			for _, definition := range definitionList {
+				if len(target.Metrics) >= 1 && !stringListContainsFold(target.Metrics, definition.Name) {
+					continue
+				}
+
+				for _, dimension := range definition.Dimensions {
+					if p.settings.DimensionKeyLowercase {
+						dimension = strings.ToLower(dimension)
+					}
+
+					p.metricList.Add(PrometheusMetricDimensionName, MetricRow{
+						Labels: prometheus.Labels{
+							"resourceType": strings.TrimPrefix(resourceType, "/"),
+							"metric":       definition.Name,
+							"dimension":    dimension,
+						},
+						Value: 1,
+					})
+				}
+			}
+			p.metricList.SetMetricHelp(PrometheusMetricDimensionName, "Azure monitor metric dimensions (from metric definitions)")
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/webdevops/go-common/azuresdk/armclient"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+// newTestDefinitionsProber returns a prober with the metric definitions of resourceId in its definitions cache
+func newTestDefinitionsProber(t *testing.T, settings *RequestMetricSettings, resourceId string, definitionList []MetricDefinition) *MetricProber {
+	azureResource, err := armclient.ParseResourceId(resourceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cacheData, err := json.Marshal(definitionList)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	definitionsCache := cache.New(time.Hour, time.Hour)
+	definitionsCache.Set(fmt.Sprintf("definitions:%s:%s", azureResource.ResourceProvider(), ""), cacheData, time.Hour)
+
+	prober := newTestProber(config.Opts{}, settings)
+	prober.EnableMetricDefinitionsCache(definitionsCache, time.Hour)
+	return prober
+}
+
+func TestCollectMetricDimensionsFromTargets(t *testing.T) {
+	resourceId := "/subscriptions/00000000-0000-0000-0000-000000000001/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/sa1"
+	definitionList := []MetricDefinition{
+		{Name: "Transactions", Dimensions: []string{"ApiName", "ResponseType"}},
+		{Name: "Availability", Dimensions: []string{"ApiName"}},
+		{Name: "UsedCapacity"},
+	}
+
+	testCases := []struct {
+		name     string
+		metrics  []string
+		lower    bool
+		expected []string
+	}{
+		{"all metrics", nil, false, []string{"Transactions/ApiName", "Transactions/ResponseType", "Availability/ApiName"}},
+		{"requested metrics", []string{"transactions"}, false, []string{"Transactions/ApiName", "Transactions/ResponseType"}},
+		{"metric without dimensions", []string{"UsedCapacity"}, false, []string{}},
+		{"lowercase dimension keys", []string{"Availability"}, true, []string{"Availability/apiname"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			prober := newTestDefinitionsProber(t, &RequestMetricSettings{DimensionKeyLowercase: testCase.lower}, resourceId, definitionList)
+			prober.AddTarget(
+				MetricProbeTarget{ResourceId: resourceId, Metrics: testCase.metrics},
+				// same resource type, definitions are only added once
+				MetricProbeTarget{ResourceId: resourceId + "2", Metrics: testCase.metrics},
+			)
+			prober.collectMetricDimensionsFromTargets()
+
+			rows := prober.metricList.GetMetricList(PrometheusMetricDimensionName)
+			if len(rows) != len(testCase.expected) {
+				t.Fatalf("expected %v dimension series, got %v", len(testCase.expected), rows)
+			}
+			for i, row := range rows {
+				if ret := row.Labels["metric"] + "/" + row.Labels["dimension"]; ret != testCase.expected[i] {
+					t.Errorf("expected dimension %q, got %q", testCase.expected[i], ret)
+				}
+				if row.Labels["resourceType"] != "microsoft.storage/storageaccounts" {
+					t.Errorf("expected resource type microsoft.storage/storageaccounts, got %q", row.Labels["resourceType"])
+				}
+			}
+		})
+	}
+}
+
+func TestMetricDefinitionsCacheBackend(t *testing.T) {
+	definitionsCache := cache.New(time.Hour, time.Hour)
+	serviceDiscoveryCache := cache.New(time.Minute, time.Minute)
+	serviceDiscoveryCacheDuration := time.Minute
+
+	testCases := []struct {
+		name             string
+		definitions      bool
+		serviceDiscovery bool
+		expectedCache    Cache
+		expectedDuration time.Duration
+	}{
+		{"dedicated cache", true, true, definitionsCache, 6 * time.Hour},
+		{"service discovery cache", false, true, serviceDiscoveryCache, time.Minute},
+		{"no cache", false, false, nil, 0},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			prober := newTestProber(config.Opts{}, nil)
+			if testCase.definitions {
+				prober.EnableMetricDefinitionsCache(definitionsCache, 6*time.Hour)
+			}
+			if testCase.serviceDiscovery {
+				prober.EnableServiceDiscoveryCache(serviceDiscoveryCache, &serviceDiscoveryCacheDuration)
+			}
+
+			backend, duration := prober.metricDefinitionsCacheBackend()
+			if backend != testCase.expectedCache {
+				t.Errorf("expected cache %v, got %v", testCase.expectedCache, backend)
+			}
+			if duration != testCase.expectedDuration {
+				t.Errorf("expected duration %v, got %v", testCase.expectedDuration, duration)
+			}
+		})
+	}
+}
+
+// definitions are served from the long lived cache for every scrape, the (short lived) service discovery cache
+// of the scrapes is not used
+func TestFetchMetricDefinitionsCached(t *testing.T) {
+	resourceIds := []string{
+		"/subscriptions/00000000-0000-0000-0000-000000000001/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/sa1",
+		// same resource type
+		"/subscriptions/00000000-0000-0000-0000-000000000001/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/sa2",
+	}
+	definitionList := []MetricDefinition{{Name: "Transactions", PrimaryAggregation: "total"}}
+
+	prober := newTestDefinitionsProber(t, nil, resourceIds[0], definitionList)
+	definitionsCache, _ := prober.metricDefinitionsCacheBackend()
+
+	for scrape := 0; scrape < 3; scrape++ {
+		serviceDiscoveryCacheDuration := time.Minute
+		prober := newTestProber(config.Opts{}, &RequestMetricSettings{})
+		prober.EnableServiceDiscoveryCache(cache.New(time.Minute, time.Minute), &serviceDiscoveryCacheDuration)
+		prober.EnableMetricDefinitionsCache(definitionsCache, time.Hour)
+
+		// no Azure client is configured, a request to Azure would fail
+		for _, resourceId := range resourceIds {
+			ret, err := prober.FetchMetricDefinitions(resourceId)
+			if err != nil {
+				t.Fatalf("scrape %v: expected definitions from cache, got %v", scrape, err)
+			}
+			if len(ret) != 1 || ret[0].Name != "Transactions" || ret[0].PrimaryAggregation != "total" {
+				t.Errorf("scrape %v: expected %v, got %v", scrape, definitionList, ret)
+			}
+		}
+
+		if !prober.serviceDiscoveryCache.hit.Load() {
+			t.Errorf("scrape %v: expected cache hit", scrape)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/remeh/sizedwaitgroup"
+	"go.uber.org/zap"
+)
+
+const (
+	PrometheusDiagnosticSettingsEnabledName = "azurerm_diagnostic_settings_enabled"
+
+	diagnosticSettingsEnabled     = "enabled"
+	diagnosticSettingsDisabled    = "disabled"
+	diagnosticSettingsUnsupported = "unsupported"
+)
+
+func (p *MetricProber) DiagnosticSettingsClient() (*armmonitor.DiagnosticSettingsClient, error) {
+	return armmonitor.NewDiagnosticSettingsClient(p.GetCred(), p.NewArmClientOptions())
+}
+
+// RunDiagnosticSettings checks if diagnostic settings are configured for the targets and publishes the result
+func (p *MetricProber) RunDiagnosticSettings() {
+	p.collectDiagnosticSettingsFromTargets()
+	p.postProcessMetricList()
+	p.SaveToCache()
+	p.publishMetricList()
+	p.publishCacheStatus()
+	p.publishProbeErrors()
+}
+
+func (p *MetricProber) collectDiagnosticSettingsFromTargets() {
+	client, err := p.DiagnosticSettingsClient()
+	if err != nil {
+		p.logger.Error(err)
+		p.reportProbeError(ClassifyProbeError(err))
+		return
+	}
+
+	lock := sync.Mutex{}
+	wgSubscription := sizedwaitgroup.New(EffectiveConcurrency(p.Conf.Prober.ConcurrencySubscription))
+	for subscriptionId, targetList := range p.targets {
+		wgSubscription.Add()
+		go func(subscriptionId string, targetList []MetricProbeTarget) {
+			defer wgSubscription.Done()
+
+			wgSubscriptionResource := sizedwaitgroup.New(p.concurrencyForSubscription(subscriptionId))
+			for _, target := range targetList {
+				wgSubscriptionResource.Add()
+				go func(target MetricProbeTarget) {
+					defer wgSubscriptionResource.Done()
+
+					status, err := p.fetchDiagnosticSettingsStatus(client, subscriptionId, target.ResourceId)
+					if err != nil {
+						p.logger.With(zap.String("resourceID", target.ResourceId)).Warn(err)
+						p.reportTargetError(subscriptionId, target.ResourceId, err)
+						return
+					}
+
+					if status == diagnosticSettingsUnsupported {
+						p.logger.With(zap.String("resourceID", target.ResourceId)).Debug("diagnostic settings are not supported for resource")
+						return
+					}
+
+					value := float64(0)
+					if status == diagnosticSettingsEnabled {
+						value = 1
+					}
+
+					lock.Lock()
+					defer lock.Unlock()
+					p.metricList.Add(PrometheusDiagnosticSettingsEnabledName, MetricRow{
+						Labels: prometheus.Labels{
+							"subscriptionID": strings.ToLower(subscriptionId),
+							"resourceID":     strings.ToLower(target.ResourceId),
+						},
+						Value: value,
+					})
+				}(target)
+			}
+			wgSubscriptionResource.Wait()
+
+			if p.callbackSubscriptionFishish != nil {
+				p.callbackSubscriptionFishish(subscriptionId)
+			}
+		}(subscriptionId, targetList)
+	}
+	wgSubscription.Wait()
+
+	p.metricList.SetMetricHelp(PrometheusDiagnosticSettingsEnabledName, "Azure diagnostic settings configured for resource (1 = at least one diagnostic setting)")
+}
+
+// fetchDiagnosticSettingsStatus returns if diagnostic settings are enabled, disabled or unsupported for a resource,
+// the status is cached in the service discovery cache (if enabled)
+func (p *MetricProber) fetchDiagnosticSettingsStatus(client *armmonitor.DiagnosticSettingsClient, subscriptionId, resourceId string) (string, error) {
+	cacheKey := fmt.Sprintf("diagnosticsettings:%s", strings.ToLower(resourceId))
+	if p.serviceDiscoveryCache.cache != nil {
+		v, ok := p.serviceDiscoveryCache.cache.Get(cacheKey)
+		countCacheRequest(CacheNameAzure, ok)
+		if ok {
+			if status, ok := v.(string); ok {
+				p.serviceDiscoveryCache.hit.Store(true)
+				return status, nil
+			}
+		}
+	}
+
+	status := diagnosticSettingsDisabled
+	pager := client.NewListPager(resourceId, nil)
+	for pager.More() {
+		var result armmonitor.DiagnosticSettingsClientListResponse
+		err := p.withRetry(p.ctx, func() (err error) {
+			startTime := time.Now()
+			result, err = pager.NextPage(p.ctx)
+			observeApiRequest(ApiOperationListDiagnosticSettings, subscriptionId, startTime, err)
+			return err
+		})
+		if err != nil && isDiagnosticSettingsUnsupportedError(err) {
+			status = diagnosticSettingsUnsupported
+			break
+		}
+
+		p.reportRequestResult(subscriptionId, err)
+		if err != nil {
+			return "", fmt.Errorf("unable to fetch diagnostic settings: %w", err)
+		}
+
+		if len(result.Value) >= 1 {
+			status = diagnosticSettingsEnabled
+			break
+		}
+	}
+
+	if p.serviceDiscoveryCache.cache != nil {
+		p.serviceDiscoveryCache.cache.Set(cacheKey, status, *p.serviceDiscoveryCache.cacheDuration)
+	}
+
+	return status, nil
+}
+
+// isDiagnosticSettingsUnsupportedError checks if the diagnostic settings API isn't available for the resource type
+// (Azure responds with BadRequest for resource types without diagnostic settings support)
+func isDiagnosticSettingsUnsupportedError(err error) bool {
+	var responseErr *azcore.ResponseError
+	if !errors.As(err, &responseErr) {
+		return false
+	}
+
+	switch responseErr.StatusCode {
+	case http.StatusBadRequest, http.StatusMethodNotAllowed:
+		return true
+	}
+
+	return strings.EqualFold(responseErr.ErrorCode, "ResourceTypeNotSupported")
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/fake"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/patrickmn/go-cache"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func TestFetchDiagnosticSettingsStatus(t *testing.T) {
+	resourceGroupId := "/subscriptions/00000000-0000-0000-0000-000000000001/resourceGroups/rg/providers"
+
+	// responses by resource name
+	responses := map[string]struct {
+		statusCode int
+		body       string
+	}{
+		"enabled":     {http.StatusOK, `{"value": [{"name": "setting1", "properties": {"workspaceId": "workspace1"}}]}`},
+		"disabled":    {http.StatusOK, `{"value": []}`},
+		"badrequest":  {http.StatusBadRequest, `{"error": {"code": "BadRequest", "message": "diagnostic settings are not supported"}}`},
+		"unsupported": {http.StatusNotFound, `{"error": {"code": "ResourceTypeNotSupported", "message": "The resource type is not supported"}}`},
+		"failed":      {http.StatusInternalServerError, `{"error": {"code": "InternalServerError", "message": "Internal error"}}`},
+	}
+
+	requests := map[string]int{}
+	client, err := armmonitor.NewDiagnosticSettingsClient(&fake.TokenCredential{}, newTestArmClientOptions(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimSuffix(r.URL.Path, "/providers/Microsoft.Insights/diagnosticSettings")
+		name := path[strings.LastIndex(path, "/")+1:]
+		requests[name]++
+
+		response := responses[name]
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(response.statusCode)
+		_, _ = w.Write([]byte(response.body))
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name           string
+		expectedStatus string
+		expectedError  bool
+	}{
+		{"enabled", diagnosticSettingsEnabled, false},
+		{"disabled", diagnosticSettingsDisabled, false},
+		{"badrequest", diagnosticSettingsUnsupported, false},
+		{"unsupported", diagnosticSettingsUnsupported, false},
+		{"failed", "", true},
+	}
+
+	cacheDuration := time.Minute
+	serviceDiscoveryCache := cache.New(cacheDuration, cacheDuration)
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			resourceId := resourceGroupId + "/Microsoft.Storage/storageAccounts/" + testCase.name
+
+			// second probe is served from cache (except failed requests)
+			for probe := 0; probe < 2; probe++ {
+				prober := newTestProber(config.Opts{}, nil)
+				prober.EnableServiceDiscoveryCache(serviceDiscoveryCache, &cacheDuration)
+
+				status, err := prober.fetchDiagnosticSettingsStatus(client, "00000000-0000-0000-0000-000000000001", resourceId)
+				if testCase.expectedError {
+					if err == nil {
+						t.Errorf("expected error, got status %q", status)
+					}
+				} else if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+
+				if status != testCase.expectedStatus {
+					t.Errorf("expected status %q, got %q", testCase.expectedStatus, status)
+				}
+			}
+
+			expectedRequests := 1
+			if testCase.expectedError {
+				expectedRequests = 2
+			}
+			if requests[testCase.name] != expectedRequests {
+				t.Errorf("expected %v requests, got %v", expectedRequests, requests[testCase.name])
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	PrometheusProbeDimensionCardinalityName = "azurerm_probe_dimension_cardinality"
+)
+
+type (
+	// DimensionCardinalityError is returned by the prober if the dimension series of a probe exceed
+	// --metrics.dimensions.max-split-cardinality
+	DimensionCardinalityError struct {
+		Series int
+		Limit  int
+	}
+)
+
+func (e *DimensionCardinalityError) Error() string {
+	return fmt.Sprintf(
+		"probe exceeds the dimension split cardinality limit (%d dimension series, limit %d), narrow the query (eg. metricFilter or fewer dimensions) or use dimensionTopN",
+		e.Series,
+		e.Limit,
+	)
+}
+
+// checkDimensionCardinality returns a DimensionCardinalityError if the number of series split by dimension
+// exceeds the configured limit
+func (p *MetricProber) checkDimensionCardinality() error {
+	limit := p.Conf.Metrics.Dimensions.MaxSplitCardinality
+	if limit <= 0 {
+		return nil
+	}
+
+	// rows are one per datapoint, so count distinct label sets (series) per metric
+	seriesKeys := map[string]bool{}
+	for _, metricName := range p.metricList.GetMetricNames() {
+		if metricName == PrometheusMetricDimensionName || metricName == PrometheusMetricTimestampName {
+			continue
+		}
+
+		for _, row := range p.metricList.GetMetricList(metricName) {
+			for labelName := range row.Labels {
+				if isDimensionLabel(labelName) {
+					seriesKeys[metricName+"\xff"+metricLabelsKey(row.Labels)] = true
+					break
+				}
+			}
+		}
+	}
+
+	if series := len(seriesKeys); series > limit {
+		return &DimensionCardinalityError{Series: series, Limit: limit}
+	}
+
+	return nil
+}
+
+// DimensionCardinality returns the number of distinct values per dimension label of the fetched series
+func (p *MetricProber) DimensionCardinality() map[string]int {
+	values := map[string]map[string]bool{}
+	for _, metricName := range p.metricList.GetMetricNames() {
+		if metricName == PrometheusMetricDimensionName || metricName == PrometheusMetricTimestampName {
+			continue
+		}
+
+		for _, row := range p.metricList.GetMetricList(metricName) {
+			for labelName, labelValue := range row.Labels {
+				if !isDimensionLabel(labelName) {
+					continue
+				}
+
+				if _, exists := values[labelName]; !exists {
+					values[labelName] = map[string]bool{}
+				}
+				values[labelName][labelValue] = true
+			}
+		}
+	}
+
+	cardinality := map[string]int{}
+	for labelName, valueList := range values {
+		cardinality[labelName] = len(valueList)
+	}
+	return cardinality
+}
+
+// publishDimensionCardinality publishes azurerm_probe_dimension_cardinality with one series per dimension label
+// (only if series are split by dimension), cache hits publish the cardinality of the cached probe
+func (p *MetricProber) publishDimensionCardinality() {
+	cardinality := p.dimensionCardinality
+	if p.prometheus.registry == nil || len(cardinality) == 0 {
+		return
+	}
+
+	gauge := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: PrometheusProbeDimensionCardinalityName,
+			Help: "Azure metrics probe distinct values per dimension (before dimensionTopN)",
+		},
+		[]string{"dimension"},
+	)
+	p.prometheus.registry.MustRegister(gauge)
+
+	for dimension, count := range cardinality {
+		gauge.WithLabelValues(dimension).Set(float64(count))
+	}
+}
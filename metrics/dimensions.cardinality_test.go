@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func newTestDimensionMetricList() *MetricList {
+	metricList := NewMetricList()
+	for _, row := range []prometheus.Labels{
+		{"resourceID": "r1", "dimensionApiName": "GetBlob", "dimensionResponseType": "Success"},
+		{"resourceID": "r1", "dimensionApiName": "PutBlob", "dimensionResponseType": "Success"},
+		{"resourceID": "r1", "dimensionApiName": "PutBlob", "dimensionResponseType": "ClientError"},
+		{"resourceID": "r1", "dimensionApiName": "ListBlobs", "dimensionResponseType": "Success"},
+	} {
+		metricList.Add("azurerm_storage_transactions", MetricRow{Labels: row, Value: 1})
+	}
+	return metricList
+}
+
+// cache hits have to publish the dimension cardinality of the probe which populated the cache
+func TestDimensionCardinalityCached(t *testing.T) {
+	expected := map[string]float64{
+		"dimensionApiName":      3,
+		"dimensionResponseType": 2,
+	}
+
+	cacheDuration := time.Minute
+	metricsCache := cache.New(cacheDuration, cacheDuration)
+
+	testCases := []struct {
+		name string
+		// gob roundtrip of the cache entry (like RedisCache)
+		gob bool
+	}{
+		{"in-memory cache", false},
+		{"redis cache", true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			cacheKey := "probe:" + testCase.name
+
+			prober := newTestProber(config.Opts{}, &RequestMetricSettings{})
+			prober.EnableMetricsCache(metricsCache, cacheKey, &cacheDuration)
+			prober.metricList = newTestDimensionMetricList()
+			prober.SetPrometheusRegistry(prometheus.NewRegistry())
+			if err := prober.finishRun(); err != nil {
+				t.Fatal(err)
+			}
+
+			if testCase.gob {
+				val, _ := metricsCache.Get(cacheKey)
+				buf := bytes.Buffer{}
+				if err := gob.NewEncoder(&buf).Encode(val.(*metricsCacheEntry)); err != nil {
+					t.Fatal(err)
+				}
+				entry := &metricsCacheEntry{}
+				if err := gob.NewDecoder(&buf).Decode(entry); err != nil {
+					t.Fatal(err)
+				}
+				metricsCache.Set(cacheKey, entry, cacheDuration)
+			}
+
+			registry := prometheus.NewRegistry()
+			cachedProber := newTestProber(config.Opts{}, &RequestMetricSettings{})
+			cachedProber.EnableMetricsCache(metricsCache, cacheKey, &cacheDuration)
+			cachedProber.SetPrometheusRegistry(registry)
+			if !cachedProber.FetchFromCache() {
+				t.Fatal("expected cache hit")
+			}
+
+			metricFamilies, err := registry.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			found := false
+			for _, metricFamily := range metricFamilies {
+				if metricFamily.GetName() != PrometheusProbeDimensionCardinalityName {
+					continue
+				}
+				found = true
+				for _, metric := range metricFamily.GetMetric() {
+					dimension := metric.GetLabel()[0].GetValue()
+					if value := metric.GetGauge().GetValue(); value != expected[dimension] {
+						t.Errorf("%s: expected cardinality %v, got %v", dimension, expected[dimension], value)
+					}
+				}
+				if len(metricFamily.GetMetric()) != len(expected) {
+					t.Errorf("expected %v dimensions, got %v", len(expected), len(metricFamily.GetMetric()))
+				}
+			}
+			if !found {
+				t.Errorf("expected %s on cache hit", PrometheusProbeDimensionCardinalityName)
+			}
+		})
+	}
+}
+
+func TestCheckDimensionCardinality(t *testing.T) {
+	testCases := []struct {
+		name          string
+		limit         int
+		expectedError bool
+	}{
+		{"unlimited", 0, false},
+		{"below limit", 5, false},
+		{"at limit", 4, false},
+		{"exceeds limit", 3, true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			conf := config.Opts{}
+			conf.Metrics.Dimensions.MaxSplitCardinality = testCase.limit
+
+			cacheDuration := time.Minute
+			metricsCache := cache.New(cacheDuration, cacheDuration)
+			registry := prometheus.NewRegistry()
+
+			prober := newTestProber(conf, &RequestMetricSettings{})
+			prober.EnableMetricsCache(metricsCache, "probe", &cacheDuration)
+			prober.SetPrometheusRegistry(registry)
+			prober.metricList = newTestDimensionMetricList()
+			// multiple datapoints of the same series and series without dimension are not counted
+			prober.metricList.Add("azurerm_storage_transactions", MetricRow{Labels: prometheus.Labels{"resourceID": "r1", "dimensionApiName": "GetBlob", "dimensionResponseType": "Success"}, Value: 2})
+			prober.metricList.Add("azurerm_storage_availability", MetricRow{Labels: prometheus.Labels{"resourceID": "r1"}, Value: 100})
+
+			err := prober.finishRun()
+			if !testCase.expectedError {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			var cardinalityErr *DimensionCardinalityError
+			if !errors.As(err, &cardinalityErr) {
+				t.Fatalf("expected DimensionCardinalityError, got %v", err)
+			}
+			if cardinalityErr.Series != 4 || cardinalityErr.Limit != testCase.limit {
+				t.Errorf("expected 4 series with limit %v, got %v series with limit %v", testCase.limit, cardinalityErr.Series, cardinalityErr.Limit)
+			}
+
+			// rejected probes are neither cached nor published
+			if _, exists := metricsCache.Get("probe"); exists {
+				t.Error("expected rejected probe not to be cached")
+			}
+			if metricFamilies, _ := registry.Gather(); len(metricFamilies) != 0 {
+				t.Errorf("expected no published metrics, got %v metrics", len(metricFamilies))
+			}
+		})
+	}
+}
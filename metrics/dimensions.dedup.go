@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/webdevops/go-common/utils/to"
+)
+
+const (
+	DimensionDedupAuto = "auto"
+	DimensionDedupSum  = "sum"
+	DimensionDedupMin  = "min"
+	DimensionDedupMax  = "max"
+	DimensionDedupLast = "last"
+)
+
+// timeseriesDimensionKey builds an unique key of the original dimension values of a timeseries
+func timeseriesDimensionKey(metadataValues []*armmonitor.MetadataValue) string {
+	parts := make([]string, 0, len(metadataValues))
+	for _, metadataValue := range metadataValues {
+		if metadataValue == nil || metadataValue.Name == nil {
+			continue
+		}
+		parts = append(parts, to.String(metadataValue.Name.Value)+"\xff"+to.String(metadataValue.Value))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "\xff")
+}
+
+// deduplicateDimensionValues merges series whose dimension values only differ in case (collide after lowercasing),
+// the values are merged based on --metrics.dimensions.lowercase.dedup
+func (p *MetricProber) deduplicateDimensionValues() {
+	mode := p.Conf.Metrics.Dimensions.LowercaseDedup
+	if mode == "" || mode == DimensionDedupLast {
+		// same behaviour as without deduplication, last series wins
+		return
+	}
+
+	type dedupSeries struct {
+		row        MetricRow
+		seriesList []string
+		values     map[string]float64
+	}
+
+	for _, metricName := range p.metricList.GetMetricNames() {
+		rows := p.metricList.GetMetricList(metricName)
+
+		seriesList := []*dedupSeries{}
+		seriesIndex := map[string]*dedupSeries{}
+		collision := false
+		for _, row := range rows {
+			key := metricLabelsKey(row.Labels)
+			series, exists := seriesIndex[key]
+			if !exists {
+				series = &dedupSeries{values: map[string]float64{}}
+				seriesIndex[key] = series
+				seriesList = append(seriesList, series)
+			}
+			series.row = row
+
+			// multiple datapoints of the same timeseries: last datapoint wins
+			if _, exists := series.values[row.seriesKey]; !exists {
+				series.seriesList = append(series.seriesList, row.seriesKey)
+				collision = collision || len(series.seriesList) >= 2
+			}
+			series.values[row.seriesKey] = row.Value
+		}
+
+		if !collision {
+			continue
+		}
+
+		ret := make([]MetricRow, 0, len(seriesList))
+		for _, series := range seriesList {
+			row := series.row
+			if len(series.seriesList) >= 2 {
+				values := make([]float64, 0, len(series.seriesList))
+				for _, seriesKey := range series.seriesList {
+					values = append(values, series.values[seriesKey])
+				}
+				row.Value = mergeDimensionDedupValues(values, mode, row.Labels["aggregation"])
+
+				p.logger.Infof(
+					`merged %v series of metric "%s" with dimension values which only differ in case (%s): %s`,
+					len(series.seriesList),
+					row.Labels["metric"],
+					mode,
+					strings.ReplaceAll(strings.Join(series.seriesList, ", "), "\xff", "="),
+				)
+			}
+			ret = append(ret, row)
+		}
+		p.metricList.List[metricName] = ret
+	}
+}
+
+// mergeDimensionDedupValues merges the values of colliding series, auto uses the aggregation of the series
+// (minimum: min, maximum: max, average: mean, others: sum)
+func mergeDimensionDedupValues(values []float64, mode, aggregation string) float64 {
+	if mode == DimensionDedupAuto {
+		switch strings.ToLower(aggregation) {
+		case "minimum":
+			mode = DimensionDedupMin
+		case "maximum":
+			mode = DimensionDedupMax
+		case "average":
+			sum := 0.0
+			for _, value := range values {
+				sum += value
+			}
+			return sum / float64(len(values))
+		default:
+			mode = DimensionDedupSum
+		}
+	}
+
+	ret := values[0]
+	for _, value := range values[1:] {
+		switch mode {
+		case DimensionDedupMin:
+			ret = math.Min(ret, value)
+		case DimensionDedupMax:
+			ret = math.Max(ret, value)
+		default:
+			ret += value
+		}
+	}
+	return ret
+}
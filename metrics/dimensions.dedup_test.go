@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/utils/to"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func TestMergeDimensionDedupValues(t *testing.T) {
+	testCases := []struct {
+		mode        string
+		aggregation string
+		expected    float64
+	}{
+		{DimensionDedupSum, "average", 12},
+		{DimensionDedupMin, "total", 2},
+		{DimensionDedupMax, "total", 6},
+		{DimensionDedupAuto, "total", 12},
+		{DimensionDedupAuto, "count", 12},
+		{DimensionDedupAuto, "average", 4},
+		{DimensionDedupAuto, "Average", 4},
+		{DimensionDedupAuto, "minimum", 2},
+		{DimensionDedupAuto, "maximum", 6},
+	}
+
+	for _, testCase := range testCases {
+		if value := mergeDimensionDedupValues([]float64{4, 2, 6}, testCase.mode, testCase.aggregation); value != testCase.expected {
+			t.Errorf("%s/%s: expected %v, got %v", testCase.mode, testCase.aggregation, testCase.expected, value)
+		}
+	}
+}
+
+func TestDeduplicateDimensionValues(t *testing.T) {
+	testCases := []struct {
+		name        string
+		mode        string
+		aggregation string
+		lowercase   bool
+		expected    []float64
+	}{
+		{"auto total", DimensionDedupAuto, "total", true, []float64{15, 1}},
+		{"auto average", DimensionDedupAuto, "average", true, []float64{7.5, 1}},
+		{"min", DimensionDedupMin, "total", true, []float64{5, 1}},
+		{"max", DimensionDedupMax, "total", true, []float64{10, 1}},
+		// same behaviour as without deduplication
+		{"last", DimensionDedupLast, "total", true, []float64{7, 10, 5, 1}},
+		{"without lowercasing", DimensionDedupAuto, "total", false, []float64{7, 10, 5, 1}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			conf := config.Opts{}
+			conf.Metrics.Dimensions.LowercaseDedup = testCase.mode
+			prober := newTestProber(conf, &RequestMetricSettings{DimensionLowercase: testCase.lowercase})
+
+			for _, row := range []struct {
+				region string
+				value  float64
+			}{
+				// multiple datapoints of the same timeseries, last datapoint wins
+				{"East US", 7},
+				{"East US", 10},
+				{"east us", 5},
+				{"West Europe", 1},
+			} {
+				seriesKey := timeseriesDimensionKey([]*armmonitor.MetadataValue{{Name: &armmonitor.LocalizableString{Value: to.StringPtr("Region")}, Value: to.StringPtr(row.region)}})
+				region := row.region
+				if testCase.lowercase {
+					region = strings.ToLower(region)
+				}
+				prober.metricList.Add("azurerm_resource_metric", MetricRow{
+					Labels:    prometheus.Labels{"resourceID": "r1", "metric": "Transactions", "aggregation": testCase.aggregation, "dimension": region},
+					Value:     row.value,
+					seriesKey: seriesKey,
+				})
+			}
+
+			prober.postProcessMetricList()
+
+			rows := prober.metricList.GetMetricList("azurerm_resource_metric")
+			if len(rows) != len(testCase.expected) {
+				t.Fatalf("expected %v rows, got %v", len(testCase.expected), rows)
+			}
+			for i, row := range rows {
+				if row.Value != testCase.expected[i] {
+					t.Errorf("%s: expected %v, got %v", row.Labels["dimension"], testCase.expected[i], row.Value)
+				}
+			}
+		})
+	}
+}
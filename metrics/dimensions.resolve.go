@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/webdevops/go-common/azuresdk/armclient"
+)
+
+const (
+	DimensionResolveNone          = "none"
+	DimensionResolveMapping       = "mapping"
+	DimensionResolveResourceGraph = "resourcegraph"
+
+	// number of values resolved with one ResourceGraph query
+	dimensionResolveChunkSize = 100
+)
+
+var (
+	dimensionGuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+	// static dimension value mapping (lowercase guid -> name)
+	dimensionResolveMapping = map[string]string{}
+)
+
+// LoadDimensionResolveMapping loads the static dimension value mapping from a JSON file ({"guid": "name"})
+func LoadDimensionResolveMapping(path string) error {
+	content, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("unable to read dimension mapping: %w", err)
+	}
+
+	mapping := map[string]string{}
+	if err := json.Unmarshal(content, &mapping); err != nil {
+		return fmt.Errorf("unable to parse dimension mapping: %w", err)
+	}
+
+	dimensionResolveMapping = map[string]string{}
+	for key, value := range mapping {
+		dimensionResolveMapping[strings.ToLower(key)] = value
+	}
+
+	return nil
+}
+
+// resolveDimensionValues replaces GUID dimension values with friendly names, unresolvable values are kept
+func (p *MetricProber) resolveDimensionValues() {
+	mode := p.Conf.Metrics.Dimensions.Resolve
+	if mode == "" || mode == DimensionResolveNone {
+		return
+	}
+
+	// collect guid values
+	valueList := []string{}
+	valueMap := map[string]string{}
+	for _, rows := range p.metricList.List {
+		for _, row := range rows {
+			for labelName, labelValue := range row.Labels {
+				if isDimensionLabel(labelName) && dimensionGuidRegexp.MatchString(labelValue) {
+					key := strings.ToLower(labelValue)
+					if _, exists := valueMap[key]; !exists {
+						valueMap[key] = ""
+						valueList = append(valueList, key)
+					}
+				}
+			}
+		}
+	}
+
+	if len(valueList) == 0 {
+		return
+	}
+
+	switch mode {
+	case DimensionResolveMapping:
+		for _, value := range valueList {
+			valueMap[value] = dimensionResolveMapping[value]
+		}
+	case DimensionResolveResourceGraph:
+		p.resolveDimensionValuesWithResourceGraph(valueList, valueMap)
+	}
+
+	for _, rows := range p.metricList.List {
+		for _, row := range rows {
+			for labelName, labelValue := range row.Labels {
+				if !isDimensionLabel(labelName) {
+					continue
+				}
+
+				if resolvedValue := valueMap[strings.ToLower(labelValue)]; resolvedValue != "" {
+					row.Labels[labelName] = resolvedValue
+				}
+			}
+		}
+	}
+}
+
+// resolveDimensionValuesWithResourceGraph resolves virtual machine ids and subscription ids to their names
+// results (also unresolvable values) are cached in the servicediscovery cache
+func (p *MetricProber) resolveDimensionValuesWithResourceGraph(valueList []string, valueMap map[string]string) {
+	cache := p.serviceDiscoveryCache.cache
+
+	unresolvedList := []string{}
+	for _, value := range valueList {
+		if cache != nil {
+			cachedValue, ok := cache.Get("dimension:" + value)
+			countCacheRequest(CacheNameAzure, ok)
+			if ok {
+				valueMap[value] = cachedValue.(string)
+				continue
+			}
+		}
+		unresolvedList = append(unresolvedList, value)
+	}
+
+	opts := armclient.ResourceGraphOptions{
+		Subscriptions: p.settings.Subscriptions,
+	}
+	if len(opts.Subscriptions) == 0 {
+		for subscriptionId := range p.targets {
+			opts.Subscriptions = append(opts.Subscriptions, subscriptionId)
+		}
+	}
+
+	for i := 0; i < len(unresolvedList); i += dimensionResolveChunkSize {
+		end := i + dimensionResolveChunkSize
+		if end > len(unresolvedList) {
+			end = len(unresolvedList)
+		}
+		chunk := unresolvedList[i:end]
+
+		// values are validated as guid, no escaping needed
+		valueFilter := "'" + strings.Join(chunk, "','") + "'"
+		query := fmt.Sprintf(
+			`Resources | where tolower(tostring(properties.vmId)) in (%[1]s) | project key = tolower(tostring(properties.vmId)), name `+
+				`| union (ResourceContainers | where type =~ "microsoft.resources/subscriptions" and tolower(subscriptionId) in (%[1]s) | project key = tolower(subscriptionId), name)`,
+			valueFilter,
+		)
+
+		startTime := time.Now()
+		results, err := p.AzureClient.ExecuteResourceGraphQuery(p.ctx, query, opts)
+		observeApiRequest(ApiOperationResourceGraphQuery, "", startTime, err)
+		if err != nil {
+			p.logger.Warnf("unable to resolve dimension values: %v", err)
+			return
+		}
+
+		for _, row := range results {
+			key, _ := row["key"].(string)
+			name, _ := row["name"].(string)
+			if _, exists := valueMap[key]; exists && name != "" {
+				valueMap[key] = name
+			}
+		}
+
+		if cache != nil {
+			for _, value := range chunk {
+				cache.Set("dimension:"+value, valueMap[value], *p.serviceDiscoveryCache.cacheDuration)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func TestResolveDimensionValues(t *testing.T) {
+	vmId := "6F3C5E2A-1B2C-4D5E-8F90-A1B2C3D4E5F6"
+	subscriptionId := "00000000-0000-0000-0000-000000000001"
+	unknownId := "99999999-0000-0000-0000-000000000009"
+
+	mappingFile := filepath.Join(t.TempDir(), "mapping.json")
+	if err := os.WriteFile(mappingFile, []byte(`{"6f3c5e2a-1b2c-4d5e-8f90-a1b2c3d4e5f6": "vm1", "00000000-0000-0000-0000-000000000001": "production"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadDimensionResolveMapping(mappingFile); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { dimensionResolveMapping = map[string]string{} }()
+
+	testCases := []struct {
+		mode     string
+		expected []string
+	}{
+		{DimensionResolveNone, []string{vmId, subscriptionId, unknownId, "not-a-guid"}},
+		{DimensionResolveMapping, []string{"vm1", "production", unknownId, "not-a-guid"}},
+		// values resolved by previous ResourceGraph queries (cached)
+		{DimensionResolveResourceGraph, []string{"vm1-graph", "production-graph", unknownId, "not-a-guid"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.mode, func(t *testing.T) {
+			conf := config.Opts{}
+			conf.Metrics.Dimensions.Resolve = testCase.mode
+			prober := newTestProber(conf, nil)
+
+			cacheDuration := time.Hour
+			serviceDiscoveryCache := cache.New(cacheDuration, cacheDuration)
+			serviceDiscoveryCache.Set("dimension:6f3c5e2a-1b2c-4d5e-8f90-a1b2c3d4e5f6", "vm1-graph", cacheDuration)
+			serviceDiscoveryCache.Set("dimension:"+subscriptionId, "production-graph", cacheDuration)
+			serviceDiscoveryCache.Set("dimension:"+unknownId, "", cacheDuration)
+			prober.EnableServiceDiscoveryCache(serviceDiscoveryCache, &cacheDuration)
+
+			for _, value := range []string{vmId, subscriptionId, unknownId, "not-a-guid"} {
+				prober.metricList.Add("azurerm_resource_metric", MetricRow{
+					Labels: prometheus.Labels{"resourceID": vmId, "dimensionVMName": value},
+					Value:  1,
+				})
+			}
+
+			prober.resolveDimensionValues()
+
+			for i, row := range prober.metricList.GetMetricList("azurerm_resource_metric") {
+				if row.Labels["dimensionVMName"] != testCase.expected[i] {
+					t.Errorf("expected dimension value %q, got %q", testCase.expected[i], row.Labels["dimensionVMName"])
+				}
+				// only dimension labels are resolved
+				if row.Labels["resourceID"] != vmId {
+					t.Errorf("expected unchanged resourceID, got %q", row.Labels["resourceID"])
+				}
+			}
+		})
+	}
+}
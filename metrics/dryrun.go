@@ -0,0 +1,179 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/webdevops/go-common/azuresdk/armclient"
+)
+
+type (
+	// DryRunResult is the diagnostic of a probe with dryrun=true: the requests which would be sent to Azure Monitor
+	// or the first invalid parameter
+	DryRunResult struct {
+		Valid     bool   `json:"valid"`
+		Parameter string `json:"parameter,omitempty"`
+		Error     string `json:"error,omitempty"`
+
+		Timespan        string          `json:"timespan"`
+		MetricNamespace string          `json:"metricNamespace,omitempty"`
+		Subscriptions   []string        `json:"subscriptions"`
+		Requests        []DryRunRequest `json:"requests"`
+		ApiRequests     int             `json:"apiRequests"`
+	}
+
+	// DryRunRequest is one metric request of a target (metrics are split into chunks of 20 metrics per API request)
+	DryRunRequest struct {
+		ResourceID          string   `json:"resourceID"`
+		SubscriptionID      string   `json:"subscriptionID"`
+		Metrics             []string `json:"metrics"`
+		Aggregations        []string `json:"aggregations"`
+		Interval            string   `json:"interval,omitempty"`
+		FallbackAggregation bool     `json:"fallbackAggregation,omitempty"`
+		ApiRequests         int      `json:"apiRequests"`
+	}
+
+	// dryRunError is a validation error of a parameter
+	dryRunError struct {
+		parameter string
+		message   string
+	}
+)
+
+// DryRun validates the subscriptions, targets, metric namespace, metrics and aggregations of the probe
+// and returns the requests which would be sent, no metric values are fetched
+func (p *MetricProber) DryRun(targets []MetricProbeTarget) DryRunResult {
+	result := DryRunResult{
+		Timespan:        p.settings.Timespan,
+		MetricNamespace: p.settings.MetricNamespace,
+		Subscriptions:   p.settings.Subscriptions,
+		Requests:        []DryRunRequest{},
+	}
+
+	invalid := func(parameter string, err error) DryRunResult {
+		result.Parameter = parameter
+		result.Error = err.Error()
+		result.Requests = []DryRunRequest{}
+		result.ApiRequests = 0
+		return result
+	}
+
+	for _, subscriptionId := range p.settings.Subscriptions {
+		if _, err := p.AzureClient.GetCachedSubscription(p.ctx, subscriptionId); err != nil {
+			return invalid("subscription", err)
+		}
+	}
+
+	for _, target := range targets {
+		azureResource, err := armclient.ParseResourceId(target.ResourceId)
+		if err != nil {
+			return invalid("target", fmt.Errorf(`invalid resource id "%s": %w`, target.ResourceId, err))
+		}
+
+		if _, err := p.AzureClient.GetCachedSubscription(p.ctx, azureResource.Subscription); err != nil {
+			return invalid("target", fmt.Errorf(`subscription of resource "%s" not found: %w`, target.ResourceId, err))
+		}
+	}
+	p.AddTarget(targets...)
+
+	if p.settings.ValidateMetricNamespace && p.settings.MetricNamespace != "" {
+		if err := p.validateMetricNamespace(); err != nil {
+			return invalid("metricNamespace", err)
+		}
+	}
+
+	for _, targetList := range p.targets {
+		for _, target := range targetList {
+			definitionList, err := p.FetchMetricDefinitions(target.ResourceId)
+			if err != nil {
+				return invalid("target", fmt.Errorf(`unable to resolve resource "%s": %w`, target.ResourceId, err))
+			}
+
+			if err := p.validateTargetMetrics(target, definitionList); err != nil {
+				return invalid(err.parameter, err)
+			}
+		}
+	}
+
+	if p.settings.Autodiscover {
+		p.autodiscoverTargetMetrics()
+	}
+
+	for subscriptionId, targetList := range p.targets {
+		for _, target := range targetList {
+			for _, request := range p.buildTargetMetricRequests(target) {
+				interval := p.intervalForTarget(target)
+				if p.settings.IntervalAuto {
+					interval = p.autoIntervalForTarget(target, request.Metrics)
+				}
+
+				chunks := (len(request.Metrics) + AzureMetricApiMaxMetricNumber - 1) / AzureMetricApiMaxMetricNumber
+				if chunks == 0 {
+					// no metrics: default metrics of the resource
+					chunks = 1
+				}
+
+				dryRunRequest := DryRunRequest{
+					ResourceID:          target.ResourceId,
+					SubscriptionID:      subscriptionId,
+					Metrics:             request.Metrics,
+					Aggregations:        request.Aggregations,
+					FallbackAggregation: request.FallbackAggregation,
+					ApiRequests:         chunks * len(p.metricWindows()),
+				}
+				if interval != nil {
+					dryRunRequest.Interval = *interval
+				}
+
+				result.Requests = append(result.Requests, dryRunRequest)
+				result.ApiRequests += dryRunRequest.ApiRequests
+			}
+		}
+	}
+
+	result.Valid = true
+	return result
+}
+
+func (e *dryRunError) Error() string {
+	return e.message
+}
+
+// validateTargetMetrics checks the requested metrics and aggregations of a target against its metric definitions,
+// unsupported aggregations are accepted if aggregation fallback is enabled
+func (p *MetricProber) validateTargetMetrics(target MetricProbeTarget, definitionList []MetricDefinition) *dryRunError {
+	definitionMap := map[string]MetricDefinition{}
+	for _, definition := range definitionList {
+		definitionMap[strings.ToLower(definition.Name)] = definition
+	}
+
+	for _, metricName := range target.Metrics {
+		definition, exists := definitionMap[strings.ToLower(metricName)]
+		if !exists {
+			return &dryRunError{
+				parameter: "metric",
+				message:   fmt.Sprintf(`metric "%s" is not available for resource "%s"`, metricName, target.ResourceId),
+			}
+		}
+
+		if p.Conf.Prober.AggregationFallback || len(definition.SupportedAggregations) == 0 {
+			continue
+		}
+
+		for _, aggregation := range target.Aggregations {
+			if !stringListContainsFold(definition.SupportedAggregations, aggregation) {
+				return &dryRunError{
+					parameter: "aggregation",
+					message: fmt.Sprintf(
+						`metric "%s" doesn't support aggregation "%s" (supported: %s)`,
+						metricName,
+						aggregation,
+						strings.Join(definition.SupportedAggregations, ", "),
+					),
+				}
+			}
+		}
+	}
+
+	return nil
+}
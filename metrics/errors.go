@@ -0,0 +1,307 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	RequestResultSuccess          = "success"
+	RequestResultError            = "error"
+	RequestResultMetricNotFound   = "metric_not_found"
+	RequestResultResourceNotFound = "resource_not_found"
+	RequestResultThrottled        = "throttled"
+	RequestResultTimeout          = "timeout"
+
+	PrometheusProbeErrorName             = "azurerm_probe_error"
+	PrometheusProbeSubscriptionErrorName = "azurerm_probe_subscription_error"
+	PrometheusProbeSuccessName           = "azure_metrics_probe_success"
+	PrometheusProbeDurationName          = "azure_metrics_probe_duration_seconds"
+
+	ProbeErrorReasonAuth       = "auth"
+	ProbeErrorReasonThrottle   = "throttle"
+	ProbeErrorReasonTimeout    = "timeout"
+	ProbeErrorReasonNotFound   = "not_found"
+	ProbeErrorReasonGraphError = "graph_error"
+	ProbeErrorReasonBadRequest = "bad_request"
+	ProbeErrorReasonOther      = "other"
+)
+
+var (
+	// Azure error codes for deleted or not existing resources
+	resourceNotFoundErrorCodes = []string{
+		"ResourceNotFound",
+		"ResourceGroupNotFound",
+		"SubscriptionNotFound",
+		"ParentResourceNotFound",
+	}
+
+	// Azure Monitor doesn't have a dedicated error code for unknown metrics (returns BadRequest)
+	metricNotFoundErrorMessages = []string{
+		"failed to find metric configuration",
+		"metric not found",
+		"metricnotfound",
+	}
+)
+
+// ClassifyRequestResult returns the result of an Azure API request (success, error, throttled, timeout, metric_not_found or resource_not_found)
+func ClassifyRequestResult(err error) string {
+	if err == nil {
+		return RequestResultSuccess
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return RequestResultTimeout
+	}
+
+	var responseErr *azcore.ResponseError
+	if !errors.As(err, &responseErr) {
+		return RequestResultError
+	}
+
+	if responseErr.StatusCode == http.StatusTooManyRequests {
+		return RequestResultThrottled
+	}
+
+	if stringListContainsFold(resourceNotFoundErrorCodes, responseErr.ErrorCode) {
+		return RequestResultResourceNotFound
+	}
+
+	if responseErr.StatusCode == http.StatusBadRequest || responseErr.StatusCode == http.StatusNotFound {
+		errorMessage := strings.ToLower(responseErr.Error())
+		for _, message := range metricNotFoundErrorMessages {
+			if strings.Contains(errorMessage, message) {
+				return RequestResultMetricNotFound
+			}
+		}
+	}
+
+	if responseErr.StatusCode == http.StatusNotFound {
+		return RequestResultResourceNotFound
+	}
+
+	return RequestResultError
+}
+
+func (p *MetricProber) RegisterRequestResultCallback(callback func(subscriptionId, result string)) {
+	p.callbackRequestResult = callback
+}
+
+// reportRequestResult reports the result of an Azure API request to the registered callback
+func (p *MetricProber) reportRequestResult(subscriptionId string, err error) {
+	if p.callbackRequestResult != nil {
+		p.callbackRequestResult(subscriptionId, ClassifyRequestResult(err))
+	}
+}
+
+// ClassifyProbeError returns the failure class of a probe error (auth, throttle, timeout, not_found or other),
+// the set of reasons is fixed to limit the cardinality of azurerm_probe_error
+func ClassifyProbeError(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return ProbeErrorReasonTimeout
+	}
+
+	var authErr *azidentity.AuthenticationFailedError
+	if errors.As(err, &authErr) {
+		return ProbeErrorReasonAuth
+	}
+
+	var responseErr *azcore.ResponseError
+	if errors.As(err, &responseErr) {
+		switch responseErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return ProbeErrorReasonAuth
+		case http.StatusTooManyRequests:
+			return ProbeErrorReasonThrottle
+		case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+			return ProbeErrorReasonTimeout
+		}
+	}
+
+	switch ClassifyRequestResult(err) {
+	case RequestResultMetricNotFound, RequestResultResourceNotFound:
+		return ProbeErrorReasonNotFound
+	}
+
+	return ProbeErrorReasonOther
+}
+
+// ClassifyGraphError returns the failure class of a failed ResourceGraph query (timeout or graph_error)
+func ClassifyGraphError(err error) string {
+	if reason := ClassifyProbeError(err); reason == ProbeErrorReasonTimeout {
+		return reason
+	}
+	return ProbeErrorReasonGraphError
+}
+
+// reportProbeError marks the probe as failed and remembers the reason for azurerm_probe_error
+func (p *MetricProber) reportProbeError(reason string) {
+	p.failedRequests.Add(1)
+
+	p.probeErrors.lock.Lock()
+	defer p.probeErrors.lock.Unlock()
+	if p.probeErrors.reasons == nil {
+		p.probeErrors.reasons = map[string]bool{}
+	}
+	p.probeErrors.reasons[reason] = true
+}
+
+// reportSubscriptionError marks the probe as failed and remembers the failed subscription (and reason)
+// for azurerm_probe_subscription_error, metrics of the other subscriptions are still published
+func (p *MetricProber) reportSubscriptionError(subscriptionId string, err error) {
+	p.addSubscriptionError(subscriptionId, err)
+	p.markSubscriptionsFailed(subscriptionId)
+}
+
+// reportTargetError reports a failed request of a single target like reportSubscriptionError,
+// but only the series of the target are marked stale
+func (p *MetricProber) reportTargetError(subscriptionId, resourceId string, err error) {
+	p.addSubscriptionError(subscriptionId, err)
+	p.markTargetFailed(resourceId)
+}
+
+func (p *MetricProber) addSubscriptionError(subscriptionId string, err error) {
+	reason := ClassifyProbeError(err)
+	p.reportProbeError(reason)
+
+	p.probeErrors.lock.Lock()
+	defer p.probeErrors.lock.Unlock()
+	if p.probeErrors.subscriptions == nil {
+		p.probeErrors.subscriptions = map[string]map[string]bool{}
+	}
+
+	subscriptionId = strings.ToLower(subscriptionId)
+	if _, exists := p.probeErrors.subscriptions[subscriptionId]; !exists {
+		p.probeErrors.subscriptions[subscriptionId] = map[string]bool{}
+	}
+	p.probeErrors.subscriptions[subscriptionId][reason] = true
+}
+
+// ProbeErrorReasons returns the (sorted) reasons of the failed requests of the probe
+func (p *MetricProber) ProbeErrorReasons() []string {
+	p.probeErrors.lock.Lock()
+	defer p.probeErrors.lock.Unlock()
+
+	reasons := make([]string, 0, len(p.probeErrors.reasons))
+	for reason := range p.probeErrors.reasons {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	return reasons
+}
+
+// saveProbeErrors copies the failure reasons of the probe into the cache entry
+func (p *MetricProber) saveProbeErrors(entry *metricsCacheEntry) {
+	p.probeErrors.lock.Lock()
+	defer p.probeErrors.lock.Unlock()
+
+	entry.probeErrors = maps.Clone(p.probeErrors.reasons)
+	entry.subscriptionErrors = map[string]map[string]bool{}
+	for subscriptionId, reasons := range p.probeErrors.subscriptions {
+		entry.subscriptionErrors[subscriptionId] = maps.Clone(reasons)
+	}
+}
+
+// restoreProbeErrors restores the failure reasons of the cached probe, so cache hits report the same probe status
+// as the probe which populated the cache
+func (p *MetricProber) restoreProbeErrors(entry *metricsCacheEntry) {
+	p.probeErrors.lock.Lock()
+	defer p.probeErrors.lock.Unlock()
+
+	p.probeErrors.reasons = maps.Clone(entry.probeErrors)
+	p.probeErrors.subscriptions = map[string]map[string]bool{}
+	for subscriptionId, reasons := range entry.subscriptionErrors {
+		p.probeErrors.subscriptions[subscriptionId] = maps.Clone(reasons)
+	}
+}
+
+// publishProbeErrors publishes azurerm_probe_error with one series per failure reason (only if the probe failed)
+func (p *MetricProber) publishProbeErrors() {
+	reasons := p.ProbeErrorReasons()
+	if p.prometheus.registry == nil || len(reasons) == 0 {
+		return
+	}
+
+	gauge := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: PrometheusProbeErrorName,
+			Help: "Azure metrics probe failed (reason: auth, throttle, timeout, not_found, graph_error, bad_request or other)",
+		},
+		[]string{"reason"},
+	)
+	p.prometheus.registry.MustRegister(gauge)
+
+	for _, reason := range reasons {
+		gauge.WithLabelValues(reason).Set(1)
+	}
+
+	p.probeErrors.lock.Lock()
+	defer p.probeErrors.lock.Unlock()
+	if len(p.probeErrors.subscriptions) == 0 {
+		return
+	}
+
+	subscriptionGauge := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: PrometheusProbeSubscriptionErrorName,
+			Help: "Azure metrics probe failed for subscription (reason: auth, throttle, timeout, not_found or other)",
+		},
+		[]string{"subscriptionID", "reason"},
+	)
+	p.prometheus.registry.MustRegister(subscriptionGauge)
+
+	for subscriptionId, subscriptionReasons := range p.probeErrors.subscriptions {
+		for reason := range subscriptionReasons {
+			subscriptionGauge.WithLabelValues(subscriptionId, reason).Set(1)
+		}
+	}
+}
+
+// PublishProbeFailure publishes the failure of a probe which didn't publish metrics (see --prober.failure-response=metrics)
+func (p *MetricProber) PublishProbeFailure(err error) {
+	p.PublishProbeFailureReason(ClassifyProbeError(err))
+}
+
+// PublishProbeFailureReason publishes the failure of a probe which didn't publish metrics with the failure reason
+// (eg. graph_error for failed ResourceGraph queries or bad_request for invalid probe parameters)
+func (p *MetricProber) PublishProbeFailureReason(reason string) {
+	p.reportProbeError(reason)
+	p.publishProbeErrors()
+}
+
+// PublishProbeStatus publishes azure_metrics_probe_success (0 if any request of the probe failed, like blackbox_exporter's probe_success)
+// and azure_metrics_probe_duration_seconds
+func (p *MetricProber) PublishProbeStatus(startTime time.Time) {
+	if p.prometheus.registry == nil {
+		return
+	}
+
+	successGauge := prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: PrometheusProbeSuccessName,
+			Help: "Azure metrics probe succeeded (0 = at least one request failed, see azurerm_probe_error)",
+		},
+	)
+	p.prometheus.registry.MustRegister(successGauge)
+	if len(p.ProbeErrorReasons()) == 0 {
+		successGauge.Set(1)
+	}
+
+	durationGauge := prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: PrometheusProbeDurationName,
+			Help: "Azure metrics probe duration in seconds",
+		},
+	)
+	p.prometheus.registry.MustRegister(durationGauge)
+	durationGauge.Set(time.Since(startTime).Seconds())
+}
@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+// newTestAzureError returns an Azure API error response with the error code and message in the body
+func newTestAzureError(statusCode int, errorCode, message string) error {
+	body := fmt.Sprintf(`{"error": {"code": %q, "message": %q}}`, errorCode, message)
+	return runtime.NewResponseError(&http.Response{
+		StatusCode: statusCode,
+		Status:     http.StatusText(statusCode),
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    httptest.NewRequest("GET", "https://management.azure.com/subscriptions/xxx/providers/Microsoft.Insights/metrics", nil),
+	})
+}
+
+func TestClassifyProbeError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"deadline exceeded", fmt.Errorf("request failed: %w", context.DeadlineExceeded), ProbeErrorReasonTimeout},
+		{"canceled", fmt.Errorf("request failed: %w", context.Canceled), ProbeErrorReasonTimeout},
+		{"request timeout", newTestAzureError(http.StatusRequestTimeout, "RequestTimeout", "Request timed out"), ProbeErrorReasonTimeout},
+		{"gateway timeout", newTestAzureError(http.StatusGatewayTimeout, "GatewayTimeout", "Gateway timeout"), ProbeErrorReasonTimeout},
+		{"authentication failed", fmt.Errorf("unable to get token: %w", &azidentity.AuthenticationFailedError{}), ProbeErrorReasonAuth},
+		{"unauthorized", newTestAzureError(http.StatusUnauthorized, "InvalidAuthenticationToken", "The access token is invalid"), ProbeErrorReasonAuth},
+		{"forbidden", newTestAzureError(http.StatusForbidden, "AuthorizationFailed", "The client does not have authorization"), ProbeErrorReasonAuth},
+		{"throttled", newTestAzureError(http.StatusTooManyRequests, "TooManyRequests", "Rate limit exceeded"), ProbeErrorReasonThrottle},
+		{"resource not found", newTestAzureError(http.StatusNotFound, "ResourceNotFound", "The Resource 'sa1' was not found"), ProbeErrorReasonNotFound},
+		{"metric not found", newTestAzureError(http.StatusBadRequest, "BadRequest", "Failed to find metric configuration for provider: Microsoft.Storage, resource Type: storageAccounts, metric: Foo"), ProbeErrorReasonNotFound},
+		{"bad request", newTestAzureError(http.StatusBadRequest, "BadRequest", "Invalid aggregation"), ProbeErrorReasonOther},
+		{"server error", newTestAzureError(http.StatusInternalServerError, "InternalServerError", "Internal error"), ProbeErrorReasonOther},
+		{"non Azure error", errors.New("connection refused"), ProbeErrorReasonOther},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if reason := ClassifyProbeError(testCase.err); reason != testCase.expected {
+				t.Errorf("expected reason %q, got %q", testCase.expected, reason)
+			}
+		})
+	}
+}
+
+func TestPublishProbeErrors(t *testing.T) {
+	prober := newTestProber(config.Opts{}, nil)
+	registry := prometheus.NewRegistry()
+	prober.SetPrometheusRegistry(registry)
+
+	prober.reportSubscriptionError("00000000-0000-0000-0000-000000000001", newTestAzureError(http.StatusTooManyRequests, "TooManyRequests", "Rate limit exceeded"))
+	prober.reportSubscriptionError("00000000-0000-0000-0000-000000000002", newTestAzureError(http.StatusTooManyRequests, "TooManyRequests", "Rate limit exceeded"))
+	prober.reportProbeError(ClassifyGraphError(errors.New("unexpected")))
+	prober.publishProbeErrors()
+
+	if failed := prober.failedRequests.Load(); failed != 3 {
+		t.Errorf("expected 3 failed requests, got %v", failed)
+	}
+
+	metricFamilies, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reasons := []string{}
+	for _, metricFamily := range metricFamilies {
+		if metricFamily.GetName() != PrometheusProbeErrorName {
+			continue
+		}
+		for _, metric := range metricFamily.GetMetric() {
+			if value := metric.GetGauge().GetValue(); value != 1 {
+				t.Errorf("expected value 1, got %v", value)
+			}
+			reasons = append(reasons, metric.GetLabel()[0].GetValue())
+		}
+	}
+
+	// each reason is published once
+	if strings.Join(reasons, ",") != "graph_error,throttle" {
+		t.Errorf("expected reasons graph_error and throttle, got %v", reasons)
+	}
+}
+
+func TestClassifyGraphError(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected string
+	}{
+		{fmt.Errorf("query failed: %w", context.DeadlineExceeded), ProbeErrorReasonTimeout},
+		{&azcore.ResponseError{StatusCode: http.StatusGatewayTimeout}, ProbeErrorReasonTimeout},
+		{&azcore.ResponseError{StatusCode: http.StatusBadRequest, ErrorCode: "BadRequest"}, ProbeErrorReasonGraphError},
+		{errors.New("unexpected"), ProbeErrorReasonGraphError},
+	}
+
+	for _, testCase := range testCases {
+		if reason := ClassifyGraphError(testCase.err); reason != testCase.expected {
+			t.Errorf("%v: expected reason %q, got %q", testCase.err, testCase.expected, reason)
+		}
+	}
+}
+
+func TestClassifyRequestResult(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"success", nil, RequestResultSuccess},
+		{"timeout", fmt.Errorf("request failed: %w", context.DeadlineExceeded), RequestResultTimeout},
+		{"non Azure error", errors.New("connection refused"), RequestResultError},
+		{"throttled", newTestAzureError(http.StatusTooManyRequests, "TooManyRequests", "Rate limit exceeded"), RequestResultThrottled},
+		{"ResourceNotFound", newTestAzureError(http.StatusNotFound, "ResourceNotFound", "The Resource 'sa1' was not found"), RequestResultResourceNotFound},
+		{"ResourceGroupNotFound", newTestAzureError(http.StatusNotFound, "ResourceGroupNotFound", "Resource group 'rg' could not be found"), RequestResultResourceNotFound},
+		{"SubscriptionNotFound", newTestAzureError(http.StatusNotFound, "SubscriptionNotFound", "The subscription could not be found"), RequestResultResourceNotFound},
+		{"ParentResourceNotFound", newTestAzureError(http.StatusNotFound, "ParentResourceNotFound", "Can not perform requested operation on nested resource"), RequestResultResourceNotFound},
+		{"not found without error code", newTestAzureError(http.StatusNotFound, "", ""), RequestResultResourceNotFound},
+		{"metric configuration not found", newTestAzureError(http.StatusBadRequest, "BadRequest", "Failed to find metric configuration for provider: Microsoft.Storage, resource Type: storageAccounts, metric: Foo"), RequestResultMetricNotFound},
+		{"MetricNotFound", newTestAzureError(http.StatusNotFound, "MetricNotFound", "Metric foo is not available"), RequestResultMetricNotFound},
+		{"bad request", newTestAzureError(http.StatusBadRequest, "BadRequest", "Invalid aggregation"), RequestResultError},
+		{"forbidden", newTestAzureError(http.StatusForbidden, "AuthorizationFailed", "The client does not have authorization"), RequestResultError},
+		{"server error", newTestAzureError(http.StatusInternalServerError, "InternalServerError", "Internal error"), RequestResultError},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if result := ClassifyRequestResult(testCase.err); result != testCase.expected {
+				t.Errorf("expected result %q, got %q", testCase.expected, result)
+			}
+		})
+	}
+}
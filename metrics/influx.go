@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// WriteInfluxLineProtocol writes the metric list in InfluxDB line protocol
+//
+// metric name is used as measurement, labels are used as tags (empty labels are omitted)
+// and the metric value is written as field "value" (NaN values are omitted, not supported by the line protocol)
+func (l *MetricList) WriteInfluxLineProtocol(w io.Writer, timestamp time.Time) error {
+	buf := bufio.NewWriter(w)
+
+	metricNames := l.GetMetricNames()
+	sort.Strings(metricNames)
+
+	for _, metricName := range metricNames {
+		for _, row := range l.GetMetricList(metricName) {
+			if math.IsNaN(row.Value) || math.IsInf(row.Value, 0) {
+				continue
+			}
+
+			labelNames := make([]string, 0, len(row.Labels))
+			for labelName, labelValue := range row.Labels {
+				if labelValue != "" {
+					labelNames = append(labelNames, labelName)
+				}
+			}
+			sort.Strings(labelNames)
+
+			line := influxMeasurementEscaper.Replace(metricName)
+			for _, labelName := range labelNames {
+				line += "," + influxTagEscaper.Replace(labelName) + "=" + influxTagEscaper.Replace(row.Labels[labelName])
+			}
+			line += " value=" + strconv.FormatFloat(row.Value, 'g', -1, 64)
+			line += " " + strconv.FormatInt(timestamp.UnixNano(), 10) + "\n"
+
+			if _, err := buf.WriteString(line); err != nil {
+				return err
+			}
+		}
+	}
+
+	return buf.Flush()
+}
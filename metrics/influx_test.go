@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWriteInfluxLineProtocol(t *testing.T) {
+	timestamp := time.Unix(1700000000, 0)
+
+	testCases := []struct {
+		name     string
+		metric   string
+		labels   prometheus.Labels
+		value    float64
+		expected string
+	}{
+		{
+			name:     "sorted tags",
+			metric:   "azurerm_resource_metric",
+			labels:   prometheus.Labels{"resourceID": "r1", "metric": "Transactions", "aggregation": "total"},
+			value:    42,
+			expected: "azurerm_resource_metric,aggregation=total,metric=Transactions,resourceID=r1 value=42 1700000000000000000\n",
+		},
+		{
+			name:     "escaped characters",
+			metric:   "azurerm resource,metric",
+			labels:   prometheus.Labels{"metric": "Percentage CPU", "dimension": "a=b,c"},
+			value:    0.5,
+			expected: `azurerm\ resource\,metric,dimension=a\=b\,c,metric=Percentage\ CPU value=0.5 1700000000000000000` + "\n",
+		},
+		{
+			name:     "empty labels omitted",
+			metric:   "azurerm_resource_metric",
+			labels:   prometheus.Labels{"metric": "Transactions", "unit": ""},
+			value:    1,
+			expected: "azurerm_resource_metric,metric=Transactions value=1 1700000000000000000\n",
+		},
+		{
+			name:     "NaN omitted",
+			metric:   "azurerm_resource_metric",
+			labels:   prometheus.Labels{"metric": "Transactions"},
+			value:    math.NaN(),
+			expected: "",
+		},
+		{
+			name:     "Inf omitted",
+			metric:   "azurerm_resource_metric",
+			labels:   prometheus.Labels{"metric": "Transactions"},
+			value:    math.Inf(1),
+			expected: "",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			metricList := NewMetricList()
+			metricList.Add(testCase.metric, MetricRow{Labels: testCase.labels, Value: testCase.value})
+
+			buf := bytes.Buffer{}
+			if err := metricList.WriteInfluxLineProtocol(&buf, timestamp); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != testCase.expected {
+				t.Errorf("expected %q, got %q", testCase.expected, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/remeh/sizedwaitgroup"
+	"github.com/webdevops/go-common/azuresdk/armclient"
+	"github.com/webdevops/go-common/azuresdk/cloudconfig"
+	"github.com/webdevops/go-common/utils/to"
+	"go.uber.org/zap"
+)
+
+const (
+	AzureMetricBatchApiVersion = "2024-02-01"
+
+	// resources per batch request (azure metric batch api limitation)
+	AzureMetricBatchApiMaxResources = 50
+)
+
+var (
+	// data plane domains of the metrics batch API (regional endpoints, eg. https://westeurope.metrics.monitor.azure.com)
+	metricBatchDomains = map[cloudconfig.CloudName]string{
+		cloudconfig.AzurePublicCloud:     "metrics.monitor.azure.com",
+		cloudconfig.AzureChinaCloud:      "metrics.monitor.azure.cn",
+		cloudconfig.AzureGovernmentCloud: "metrics.monitor.azure.us",
+	}
+)
+
+type (
+	// metricBatchGroup is a metric request for resources which can be queried together by the metrics batch API
+	// (same subscription, region, namespace and request)
+	metricBatchGroup struct {
+		region    string
+		namespace string
+		request   MetricProbeRequest
+		targets   []MetricProbeTarget
+	}
+
+	metricBatchRequest struct {
+		ResourceIds []string `json:"resourceids"`
+	}
+
+	metricBatchResponse struct {
+		Values []metricBatchResult `json:"values"`
+	}
+
+	metricBatchResult struct {
+		StartTime      string               `json:"starttime"`
+		EndTime        string               `json:"endtime"`
+		Interval       *string              `json:"interval"`
+		Namespace      *string              `json:"namespace"`
+		ResourceRegion *string              `json:"resourceregion"`
+		ResourceId     string               `json:"resourceid"`
+		Value          []*armmonitor.Metric `json:"value"`
+	}
+)
+
+// collectMetricsBatch fetches the metrics of the targets of a subscription using the metrics batch API (--metrics.batch.enabled)
+// and returns the requests (batchRequestKey) which were handled, all other requests (targets without known region,
+// groups with failed batch requests) have to be fetched per resource
+func (p *MetricProber) collectMetricsBatch(subscriptionId string, targetList []MetricProbeTarget, metricsChannel chan<- PrometheusMetricResult) map[string]bool {
+	handled := map[string]bool{}
+
+	domain, exists := metricBatchDomains[p.AzureClient.GetCloudName()]
+	if !exists {
+		p.logger.Debugf("metrics batch API is not available for Azure cloud %s, using per resource requests", p.AzureClient.GetCloudName())
+		return handled
+	}
+
+	if p.rawResponses.enabled {
+		// raw responses are captured per resource
+		return handled
+	}
+
+	clientOpts := p.NewArmClientOptions()
+	clientOpts.PerCallPolicies = append(clientOpts.PerCallPolicies, noCachePolicy{})
+	pipeline := runtime.NewPipeline(
+		"azure-metrics-exporter",
+		"",
+		runtime.PipelineOptions{
+			PerRetry: []policy.Policy{
+				runtime.NewBearerTokenPolicy(p.GetCred(), []string{fmt.Sprintf("https://%s/.default", domain)}, nil),
+			},
+		},
+		&clientOpts.ClientOptions,
+	)
+
+	handledLock := sync.Mutex{}
+	wgBatch := sizedwaitgroup.New(p.concurrencyForSubscription(subscriptionId))
+	for _, group := range p.buildMetricBatchGroups(targetList) {
+		wgBatch.Add()
+		go func(group metricBatchGroup) {
+			defer wgBatch.Done()
+
+			resultList, err := p.fetchMetricBatchGroup(pipeline, domain, subscriptionId, group)
+			if err != nil {
+				p.logger.With(zap.String("region", group.region), zap.String("namespace", group.namespace)).Warnf(
+					"metrics batch request for %v resources failed, using per resource requests: %v",
+					len(group.targets),
+					err,
+				)
+				return
+			}
+
+			for _, result := range resultList {
+				result.SendMetricToChannel(metricsChannel)
+			}
+
+			handledLock.Lock()
+			for _, target := range group.targets {
+				handled[batchRequestKey(target, group.request)] = true
+			}
+			handledLock.Unlock()
+		}(group)
+	}
+	wgBatch.Wait()
+
+	return handled
+}
+
+// buildMetricBatchGroups groups the metric requests of the targets by region, namespace and request,
+// requests of targets without known region (not discovered), without metrics or aggregations or with a metric namespace
+// different from the resource type (eg. storage account services) are not supported by the batch API
+func (p *MetricProber) buildMetricBatchGroups(targetList []MetricProbeTarget) []metricBatchGroup {
+	groupMap := map[string]*metricBatchGroup{}
+	groupKeys := []string{}
+
+	for _, target := range targetList {
+		if target.Location == "" {
+			continue
+		}
+
+		azureResource, err := armclient.ParseResourceId(target.ResourceId)
+		if err != nil || azureResource.ResourceProviderNamespace == "" || azureResource.ResourceProviderName == "" || azureResource.ResourceSubPath != "" {
+			continue
+		}
+
+		namespace := strings.ToLower(azureResource.ResourceProviderNamespace + "/" + azureResource.ResourceProviderName)
+		if p.settings.MetricNamespace != "" && !strings.EqualFold(p.settings.MetricNamespace, namespace) {
+			continue
+		}
+
+		region := strings.ToLower(strings.ReplaceAll(target.Location, " ", ""))
+
+		for _, request := range p.buildTargetMetricRequests(target) {
+			if len(request.Metrics) == 0 || len(request.Aggregations) == 0 {
+				continue
+			}
+
+			groupKey := strings.Join([]string{
+				region,
+				namespace,
+				strings.Join(request.Metrics, ","),
+				strings.Join(request.Aggregations, ","),
+				strconv.FormatBool(request.FallbackAggregation),
+			}, "|")
+
+			group, exists := groupMap[groupKey]
+			if !exists {
+				group = &metricBatchGroup{
+					region:    region,
+					namespace: namespace,
+					request:   request,
+				}
+				groupMap[groupKey] = group
+				groupKeys = append(groupKeys, groupKey)
+			}
+			group.targets = append(group.targets, target)
+		}
+	}
+
+	// split groups into batches of 50 resources
+	groupList := []metricBatchGroup{}
+	for _, groupKey := range groupKeys {
+		group := groupMap[groupKey]
+		for i := 0; i < len(group.targets); i += AzureMetricBatchApiMaxResources {
+			end := i + AzureMetricBatchApiMaxResources
+			if end > len(group.targets) {
+				end = len(group.targets)
+			}
+
+			batch := *group
+			batch.targets = group.targets[i:end]
+			groupList = append(groupList, batch)
+		}
+	}
+
+	return groupList
+}
+
+// fetchMetricBatchGroup fetches all metric chunks and windows of a batch group, results are only returned if all
+// batch requests succeeded and returned all resources of the group
+func (p *MetricProber) fetchMetricBatchGroup(pipeline runtime.Pipeline, domain, subscriptionId string, group metricBatchGroup) ([]AzureInsightMetricsResult, error) {
+	resultList := []AzureInsightMetricsResult{}
+
+	targetMap := map[string]MetricProbeTarget{}
+	resourceIds := make([]string, 0, len(group.targets))
+	for _, target := range group.targets {
+		targetMap[strings.ToLower(target.ResourceId)] = target
+		resourceIds = append(resourceIds, target.ResourceId)
+	}
+
+	// request metrics in 20 metrics chunks (azure metric api limitation)
+	for i := 0; i < len(group.request.Metrics); i += AzureMetricApiMaxMetricNumber {
+		end := i + AzureMetricApiMaxMetricNumber
+		if end > len(group.request.Metrics) {
+			end = len(group.request.Metrics)
+		}
+		metricList := group.request.Metrics[i:end]
+
+		// all targets of the group have the same resource type and metrics, so the interval is the same
+		interval := p.intervalForTarget(group.targets[0])
+		if p.settings.IntervalAuto {
+			interval = p.autoIntervalForTarget(group.targets[0], metricList)
+		}
+
+		// one request per window (requested timespan and compareOffsets)
+		for _, window := range p.metricWindows() {
+			offset := time.Duration(0)
+			if window != nil {
+				offset = window.Offset
+			}
+
+			timespan, err := shiftTimespan(p.settings.Timespan, offset, time.Now())
+			if err != nil {
+				return nil, err
+			}
+
+			var response metricBatchResponse
+			err = p.withRetry(p.ctx, func() error {
+				startTime := time.Now()
+				err := p.sendMetricBatchRequest(pipeline, domain, subscriptionId, group, metricList, interval, timespan, resourceIds, &response)
+				observeApiRequest(ApiOperationListMetricsBatch, subscriptionId, startTime, err)
+				return err
+			})
+			p.reportRequestResult(subscriptionId, err)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(response.Values) != len(resourceIds) {
+				return nil, fmt.Errorf("metrics batch response contains %v of %v resources", len(response.Values), len(resourceIds))
+			}
+
+			for _, value := range response.Values {
+				target, exists := targetMap[strings.ToLower(value.ResourceId)]
+				if !exists {
+					return nil, fmt.Errorf(`metrics batch response contains unexpected resource "%s"`, value.ResourceId)
+				}
+
+				resultList = append(resultList, AzureInsightMetricsResult{
+					AzureInsightBaseMetricsResult: AzureInsightBaseMetricsResult{
+						prober: p,
+					},
+					target:              &target,
+					interval:            interval,
+					window:              window,
+					aggregations:        group.request.Aggregations,
+					fallbackAggregation: group.request.FallbackAggregation,
+					Result: &armmonitor.MetricsClientListResponse{
+						Response: armmonitor.Response{
+							Timespan:       to.StringPtr(value.StartTime + "/" + value.EndTime),
+							Interval:       value.Interval,
+							Namespace:      value.Namespace,
+							Resourceregion: value.ResourceRegion,
+							Value:          value.Value,
+						},
+					},
+				})
+			}
+		}
+	}
+
+	return resultList, nil
+}
+
+// metricBatchQuery builds the query of a metrics batch request with the same parameters as per resource requests (see metricsListOptions),
+// timespan has to be a start/end timespan
+func (p *MetricProber) metricBatchQuery(group metricBatchGroup, metrics []string, interval *string, timespan string) url.Values {
+	startTime, endTime, _ := strings.Cut(timespan, "/")
+
+	query := url.Values{}
+	query.Set("api-version", AzureMetricBatchApiVersion)
+	query.Set("metricnamespace", group.namespace)
+	query.Set("metricnames", strings.Join(metrics, ","))
+	query.Set("aggregation", strings.Join(group.request.Aggregations, ","))
+	query.Set("starttime", startTime)
+	query.Set("endtime", endTime)
+	query.Set("autoadjusttimegrain", strconv.FormatBool(p.settings.AutoAdjustTimegrain))
+	query.Set("validatedimensions", strconv.FormatBool(p.settings.ValidateDimensions))
+
+	if interval != nil {
+		query.Set("interval", *interval)
+	}
+
+	if p.settings.MetricTop != nil {
+		query.Set("top", strconv.Itoa(int(*p.settings.MetricTop)))
+	}
+
+	if len(p.settings.MetricFilter) >= 1 {
+		query.Set("filter", p.settings.MetricFilter)
+	}
+
+	if len(p.settings.MetricOrderBy) >= 1 {
+		query.Set("orderby", p.settings.MetricOrderBy)
+	}
+
+	return query
+}
+
+func (p *MetricProber) sendMetricBatchRequest(pipeline runtime.Pipeline, domain, subscriptionId string, group metricBatchGroup, metrics []string, interval *string, timespan string, resourceIds []string, result *metricBatchResponse) error {
+	batchUrl := fmt.Sprintf(
+		"https://%s.%s/subscriptions/%s/metrics:getBatch?%s",
+		group.region,
+		domain,
+		url.PathEscape(subscriptionId),
+		p.metricBatchQuery(group, metrics, interval, timespan).Encode(),
+	)
+
+	req, err := runtime.NewRequest(p.ctx, http.MethodPost, batchUrl)
+	if err != nil {
+		return err
+	}
+
+	if err := runtime.MarshalAsJSON(req, metricBatchRequest{ResourceIds: resourceIds}); err != nil {
+		return err
+	}
+
+	resp, err := pipeline.Do(req)
+	if err != nil {
+		return err
+	}
+
+	if !runtime.HasStatusCode(resp, http.StatusOK) {
+		return runtime.NewResponseError(resp)
+	}
+
+	return runtime.UnmarshalAsJSON(resp, result)
+}
+
+// batchRequestKey identifies a metric request of a target (requests of a target are built in random order)
+func batchRequestKey(target MetricProbeTarget, request MetricProbeRequest) string {
+	return strings.Join([]string{
+		strings.ToLower(target.ResourceId),
+		strings.Join(request.Metrics, ","),
+		strings.Join(request.Aggregations, ","),
+		strconv.FormatBool(request.FallbackAggregation),
+	}, "|")
+}
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/webdevops/go-common/utils/to"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func newTestBatchTargets(location string, resourceNames ...string) []MetricProbeTarget {
+	targetList := []MetricProbeTarget{}
+	for _, resourceName := range resourceNames {
+		targetList = append(targetList, MetricProbeTarget{
+			ResourceId:   "/subscriptions/00000000-0000-0000-0000-000000000001/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/" + resourceName,
+			Metrics:      []string{"Transactions", "Availability"},
+			Aggregations: []string{"total", "average"},
+			Location:     location,
+		})
+	}
+	return targetList
+}
+
+// batch requests have to return the same metrics as per resource requests, so they have to be sent with the same parameters
+func TestMetricBatchQueryMatchesPerResourceRequest(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		settings := &RequestMetricSettings{
+			Timespan:            "2024-01-01T00:00:00Z/2024-01-01T01:00:00Z",
+			Interval:            to.StringPtr("PT5M"),
+			MetricTop:           to.Int32Ptr(10),
+			MetricFilter:        "ApiName eq '*'",
+			MetricOrderBy:       "total desc",
+			AutoAdjustTimegrain: enabled,
+			ValidateDimensions:  enabled,
+		}
+		conf := config.Opts{}
+		conf.Metrics.Batch.Enabled = true
+		prober := newTestProber(conf, settings)
+
+		groupList := prober.buildMetricBatchGroups(newTestBatchTargets("West Europe", "sa1", "sa2"))
+		if len(groupList) != 1 || len(groupList[0].targets) != 2 {
+			t.Fatalf("expected one batch group with 2 targets, got %+v", groupList)
+		}
+		group := groupList[0]
+
+		query := prober.metricBatchQuery(group, group.request.Metrics, prober.intervalForTarget(group.targets[0]), settings.Timespan)
+
+		for _, target := range group.targets {
+			opts := prober.metricsListOptions(group.request.Metrics, group.request.Aggregations, prober.intervalForTarget(target), settings.Timespan)
+
+			startTime, endTime, _ := strings.Cut(to.String(opts.Timespan), "/")
+			expected := map[string]string{
+				"metricnames":         to.String(opts.Metricnames),
+				"aggregation":         to.String(opts.Aggregation),
+				"interval":            to.String(opts.Interval),
+				"starttime":           startTime,
+				"endtime":             endTime,
+				"top":                 strconv.Itoa(int(*opts.Top)),
+				"filter":              to.String(opts.Filter),
+				"orderby":             to.String(opts.Orderby),
+				"autoadjusttimegrain": strconv.FormatBool(*opts.AutoAdjustTimegrain),
+				"validatedimensions":  strconv.FormatBool(*opts.ValidateDimensions),
+			}
+			for name, value := range expected {
+				if query.Get(name) != value {
+					t.Errorf("%s: expected batch parameter %q (like per resource request), got %q", name, value, query.Get(name))
+				}
+			}
+
+			if query.Get("metricnamespace") != "microsoft.storage/storageaccounts" {
+				t.Errorf("expected metric namespace of the resource type, got %q", query.Get("metricnamespace"))
+			}
+		}
+	}
+}
+
+func TestBuildMetricBatchGroups(t *testing.T) {
+	prober := newTestProber(config.Opts{}, &RequestMetricSettings{})
+
+	targetList := newTestBatchTargets("westeurope", "sa1", "sa2")
+	targetList = append(targetList, newTestBatchTargets("northeurope", "sa3")...)
+	// without location the target is requested per resource
+	targetList = append(targetList, newTestBatchTargets("", "sa4")...)
+
+	groupList := prober.buildMetricBatchGroups(targetList)
+	if len(groupList) != 2 {
+		t.Fatalf("expected 2 batch groups, got %v", len(groupList))
+	}
+
+	if groupList[0].region != "westeurope" || len(groupList[0].targets) != 2 {
+		t.Errorf("unexpected batch group: %+v", groupList[0])
+	}
+	if groupList[1].region != "northeurope" || len(groupList[1].targets) != 1 {
+		t.Errorf("unexpected batch group: %+v", groupList[1])
+	}
+}
+
+func TestResourceGraphProjectionLocationForBatch(t *testing.T) {
+	conf := config.Opts{}
+	if projection := newTestProber(conf, nil).ServiceDiscovery.resourceGraphProjection(); projection != "id, tags" {
+		t.Errorf("expected projection without location, got %q", projection)
+	}
+
+	conf.Metrics.Batch.Enabled = true
+	if projection := newTestProber(conf, nil).ServiceDiscovery.resourceGraphProjection(); projection != "id, tags, location" {
+		t.Errorf("expected location projected for metrics batch API, got %q", projection)
+	}
+}
@@ -1,17 +1,55 @@
 package metrics
 
 import (
-	"strings"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+const (
+	PrometheusMetricTimestampName = "azurerm_metric_timestamp"
+)
+
 type (
 	AzureInsightBaseMetricsResult struct {
 		prober *MetricProber
+
+		// metric namespace of the Azure response (eg. Microsoft.Cache/redis)
+		namespace string
 	}
 )
 
+// sendMetric builds the metric and sends it to the channel,
+// with --metrics.emit-timestamp the timestamp of the datapoint is sent as separate metric
+func (r *AzureInsightBaseMetricsResult) sendMetric(channel chan<- PrometheusMetricResult, labels prometheus.Labels, value float64, timestamp *time.Time, seriesKey string) {
+	metric := r.buildMetric(labels, value)
+	metric.Timestamp = timestamp
+	metric.seriesKey = seriesKey
+	channel <- metric
+
+	// do not mix up timestamps with series if the metric template uses the same name
+	if r.prober.Conf.Metrics.EmitTimestamp && timestamp != nil && metric.Name != PrometheusMetricTimestampName {
+		channel <- r.buildTimestampMetric(metric, *timestamp)
+	}
+}
+
+// buildTimestampMetric builds the timestamp metric (unix seconds) for a metric, the labels are the same as the metric
+// with the additional label metricName
+func (r *AzureInsightBaseMetricsResult) buildTimestampMetric(metric PrometheusMetricResult, timestamp time.Time) PrometheusMetricResult {
+	metricLabels := prometheus.Labels{}
+	for labelName, labelValue := range metric.Labels {
+		metricLabels[labelName] = labelValue
+	}
+	metricLabels["metricName"] = metric.Name
+
+	return PrometheusMetricResult{
+		Name:   PrometheusMetricTimestampName,
+		Labels: metricLabels,
+		Value:  float64(timestamp.Unix()),
+		Help:   "Azure monitor insight metric datapoint timestamp (unix seconds)",
+	}
+}
+
 func (r *AzureInsightBaseMetricsResult) buildMetric(labels prometheus.Labels, value float64) (metric PrometheusMetricResult) {
 	// copy map to ensure we don't keep references
 	metricLabels := prometheus.Labels{}
@@ -36,21 +74,29 @@ func (r *AzureInsightBaseMetricsResult) buildMetric(labels prometheus.Labels, va
 		resourceType = r.prober.settings.MetricNamespace
 	}
 
+	// namespace of the response, requested MetricNamespace as fallback
+	namespace := r.namespace
+	if namespace == "" {
+		namespace = r.prober.settings.MetricNamespace
+	}
+
 	// set help
 	metric.Help = r.prober.settings.HelpTemplate
 	if metricNamePlaceholders.MatchString(metric.Help) {
 		metric.Help = metricNamePlaceholders.ReplaceAllStringFunc(
 			metric.Help,
-			func(fieldName string) string {
-				fieldName = strings.Trim(fieldName, "{}")
+			func(placeholder string) string {
+				fieldName, transforms := parseTemplatePlaceholder(placeholder)
 				switch fieldName {
 				case "name":
-					return r.prober.settings.Name
+					return applyTemplateTransforms(r.prober.settings.Name, transforms)
 				case "type":
-					return resourceType
+					return applyTemplateTransforms(resourceType, transforms)
+				case "namespace":
+					return applyTemplateTransforms(namespace, transforms)
 				default:
 					if fieldValue, exists := metric.Labels[fieldName]; exists {
-						return fieldValue
+						return applyTemplateTransforms(fieldValue, transforms)
 					}
 				}
 				return ""
@@ -58,21 +104,28 @@ func (r *AzureInsightBaseMetricsResult) buildMetric(labels prometheus.Labels, va
 		)
 	}
 
+	// metric names are lowercased, except values of placeholders with transforms (eg. {metric|camel})
+	metric.Name = lowercaseTemplateLiterals(metric.Name)
 	if metricNamePlaceholders.MatchString(metric.Name) {
 		metric.Name = metricNamePlaceholders.ReplaceAllStringFunc(
 			metric.Name,
-			func(fieldName string) string {
-				fieldName = strings.Trim(fieldName, "{}")
+			func(placeholder string) string {
+				fieldName, transforms := parseTemplatePlaceholder(placeholder)
+				if len(transforms) == 0 {
+					transforms = []string{"lower"}
+				}
 				switch fieldName {
 				case "name":
-					return r.prober.settings.Name
+					return applyTemplateTransforms(r.prober.settings.Name, transforms)
 				case "type":
-					return resourceType
+					return applyTemplateTransforms(resourceType, transforms)
+				case "namespace":
+					return applyTemplateTransforms(namespace, transforms)
 				default:
 					if fieldValue, exists := metric.Labels[fieldName]; exists {
 						// remove label, when we add it to metric name
 						delete(metric.Labels, fieldName)
-						return fieldValue
+						return applyTemplateTransforms(fieldValue, transforms)
 					}
 				}
 				return ""
@@ -81,9 +134,7 @@ func (r *AzureInsightBaseMetricsResult) buildMetric(labels prometheus.Labels, va
 	}
 
 	// sanitize metric name
-	metric.Name = metricNameReplacer.Replace(metric.Name)
-	metric.Name = strings.ToLower(metric.Name)
-	metric.Name = metricNameNotAllowedChars.ReplaceAllString(metric.Name, "")
+	metric.Name = SanitizeMetricName(metric.Name)
 
 	return
 }
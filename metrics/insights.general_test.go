@@ -0,0 +1,204 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/utils/to"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func TestBuildMetricTemplate(t *testing.T) {
+	testCases := []struct {
+		name           string
+		template       string
+		namespace      string
+		metric         string
+		expectedName   string
+		expectedLabels []string
+	}{
+		{
+			name:           "name",
+			template:       "{name}",
+			namespace:      "Microsoft.Cache/redis",
+			metric:         "connectedclients",
+			expectedName:   "azurerm_resource_metric",
+			expectedLabels: []string{"metric", "aggregation", "unit"},
+		},
+		{
+			name:           "multiple placeholders",
+			template:       "azure_{namespace}_{metric}_{aggregation}",
+			namespace:      "Microsoft.Cache/redis",
+			metric:         "connectedclients",
+			expectedName:   "azure_microsoft_cache_redis_connectedclients_maximum",
+			expectedLabels: []string{"unit"},
+		},
+		{
+			name:           "unit",
+			template:       "azure_{metric}_{unit}",
+			namespace:      "Microsoft.Cache/redis",
+			metric:         "usedmemory",
+			expectedName:   "azure_usedmemory_bytes",
+			expectedLabels: []string{"aggregation"},
+		},
+		{
+			name:           "invalid characters",
+			template:       "azure_{namespace}_{metric}",
+			namespace:      "Microsoft.Compute/virtualMachines",
+			metric:         "Percentage CPU (avg)",
+			expectedName:   "azure_microsoft_compute_virtualmachines_percentage_cpu_avg",
+			expectedLabels: []string{"aggregation", "unit"},
+		},
+		{
+			name:           "invalid characters in template",
+			template:       "azure-{metric}.{aggregation}",
+			namespace:      "Microsoft.Cache/redis",
+			metric:         "Cache Hits",
+			expectedName:   "azure_cache_hits_maximum",
+			expectedLabels: []string{"unit"},
+		},
+		{
+			name:           "collapsed invalid characters",
+			template:       "azure_{metric}",
+			namespace:      "Microsoft.Storage/storageAccounts",
+			metric:         "Blob / Container -- Count",
+			expectedName:   "azure_blob_container_count",
+			expectedLabels: []string{"aggregation", "unit"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			prober := newTestProber(config.Opts{}, &RequestMetricSettings{Name: "azurerm_resource_metric", MetricTemplate: testCase.template})
+			result := AzureInsightBaseMetricsResult{prober: prober, namespace: testCase.namespace}
+
+			labels := prometheus.Labels{
+				"metric":      testCase.metric,
+				"aggregation": "maximum",
+				"unit":        "Bytes",
+			}
+			metric := result.buildMetric(labels, 1)
+
+			if metric.Name != testCase.expectedName {
+				t.Errorf("expected metric name %q, got %q", testCase.expectedName, metric.Name)
+			}
+
+			// labels used in the metric name are removed
+			if len(metric.Labels) != len(testCase.expectedLabels) {
+				t.Errorf("expected labels %v, got %v", testCase.expectedLabels, metric.Labels)
+			}
+			for _, labelName := range testCase.expectedLabels {
+				if _, exists := metric.Labels[labelName]; !exists {
+					t.Errorf("expected label %q, got %v", labelName, metric.Labels)
+				}
+			}
+
+			// source labels are not modified
+			if len(labels) != 3 {
+				t.Errorf("expected unchanged source labels, got %v", labels)
+			}
+		})
+	}
+}
+
+func TestSendMetricTimestamp(t *testing.T) {
+	timestamp := time.Date(2024, 1, 1, 0, 5, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name              string
+		emitTimestamp     bool
+		template          string
+		timestamp         *time.Time
+		expectedTimestamp bool
+	}{
+		{"enabled", true, "azurerm_resource_metric", &timestamp, true},
+		{"disabled", false, "azurerm_resource_metric", &timestamp, false},
+		{"without timestamp", true, "azurerm_resource_metric", nil, false},
+		{"template with timestamp name", true, PrometheusMetricTimestampName, &timestamp, false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			conf := config.Opts{}
+			conf.Metrics.EmitTimestamp = testCase.emitTimestamp
+			prober := newTestProber(conf, &RequestMetricSettings{Name: "azurerm_resource_metric", MetricTemplate: testCase.template})
+
+			channel := make(chan PrometheusMetricResult, 10)
+			result := AzureInsightBaseMetricsResult{prober: prober}
+			result.sendMetric(channel, prometheus.Labels{"resourceID": "r1", "aggregation": "average"}, 42, testCase.timestamp, "")
+			close(channel)
+
+			metrics := []PrometheusMetricResult{}
+			for metric := range channel {
+				metrics = append(metrics, metric)
+			}
+
+			if metrics[0].Name != testCase.template || metrics[0].Value != 42 {
+				t.Errorf("expected metric %s with value 42, got %v", testCase.template, metrics[0])
+			}
+
+			if !testCase.expectedTimestamp {
+				if len(metrics) != 1 {
+					t.Errorf("expected no timestamp metric, got %v", metrics[1:])
+				}
+				return
+			}
+
+			if len(metrics) != 2 {
+				t.Fatalf("expected timestamp metric, got %v", metrics)
+			}
+			timestampMetric := metrics[1]
+			if timestampMetric.Name != PrometheusMetricTimestampName {
+				t.Errorf("expected metric name %s, got %s", PrometheusMetricTimestampName, timestampMetric.Name)
+			}
+			if timestampMetric.Value != float64(timestamp.Unix()) {
+				t.Errorf("expected timestamp %v, got %v", float64(timestamp.Unix()), timestampMetric.Value)
+			}
+			if timestampMetric.Labels["metricName"] != testCase.template || timestampMetric.Labels["resourceID"] != "r1" {
+				t.Errorf("expected labels of the metric with metricName, got %v", timestampMetric.Labels)
+			}
+		})
+	}
+}
+
+// aggregations with different latest datapoints have different timestamps
+func TestSendDatapointsTimestampPerAggregation(t *testing.T) {
+	timestamps := []time.Time{
+		time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC),
+	}
+	data := []*armmonitor.MetricValue{
+		{TimeStamp: &timestamps[0], Average: to.Float64Ptr(1), Total: to.Float64Ptr(5)},
+		{TimeStamp: &timestamps[1], Average: to.Float64Ptr(2)},
+	}
+
+	conf := config.Opts{}
+	conf.Metrics.EmitTimestamp = true
+	prober := newTestProber(conf, &RequestMetricSettings{Name: "azurerm_resource_metric"})
+
+	channel := make(chan PrometheusMetricResult, 100)
+	result := AzureInsightBaseMetricsResult{prober: prober}
+	result.sendDatapoints(channel, prometheus.Labels{}, data, nil, nil, []string{"average", "total"}, testNullHandlingResourceId, "Transactions", "")
+	close(channel)
+
+	// last timestamp of a series wins
+	values := map[string]float64{}
+	for metric := range channel {
+		if metric.Name == PrometheusMetricTimestampName {
+			values[metric.Labels["aggregation"]] = metric.Value
+		}
+	}
+
+	expected := map[string]float64{
+		"average": float64(timestamps[1].Unix()),
+		"total":   float64(timestamps[0].Unix()),
+	}
+	for aggregation, expectedValue := range expected {
+		if values[aggregation] != expectedValue {
+			t.Errorf("%s: expected timestamp %v, got %v", aggregation, expectedValue, values[aggregation])
+		}
+	}
+}
@@ -2,19 +2,19 @@ package metrics
 
 import (
 	"fmt"
+	"net/http"
 	"regexp"
 	"strings"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/webdevops/go-common/utils/to"
 )
 
 var (
-	metricNamePlaceholders     = regexp.MustCompile(`{([^}]+)}`)
-	metricNameNotAllowedChars  = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
-	metricLabelNotAllowedChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
-	metricNameReplacer         = strings.NewReplacer("-", "_", " ", "_", "/", "_", ".", "_")
+	metricNamePlaceholders = regexp.MustCompile(`{([^}]+)}`)
 )
 
 type (
@@ -23,34 +23,34 @@ type (
 		Labels prometheus.Labels
 		Value  float64
 		Help   string
+
+		// timestamp of the datapoint (if available)
+		Timestamp *time.Time
+
+		// original (not lowercased) dimension values of the timeseries
+		seriesKey string
 	}
 )
 
 func (p *MetricProber) MetricsClient(subscriptionId string) (*armmonitor.MetricsClient, error) {
-	clientOpts := p.AzureClient.NewArmClientOptions()
+	clientOpts := p.NewArmClientOptions()
 	clientOpts.PerCallPolicies = append(
 		clientOpts.PerCallPolicies,
 		noCachePolicy{},
 	)
-	return armmonitor.NewMetricsClient(subscriptionId, p.AzureClient.GetCred(), clientOpts)
+	return armmonitor.NewMetricsClient(subscriptionId, p.GetCred(), clientOpts)
 }
 
-func (p *MetricProber) FetchMetricsFromTarget(client *armmonitor.MetricsClient, target MetricProbeTarget, metrics, aggregations []string) (AzureInsightMetricsResult, error) {
-	ret := AzureInsightMetricsResult{
-		AzureInsightBaseMetricsResult: AzureInsightBaseMetricsResult{
-			prober: p,
-		},
-		target: &target,
-	}
-
+// metricsListOptions builds the options of a metrics request, the metrics batch API uses the same parameters (see metricBatchQuery)
+func (p *MetricProber) metricsListOptions(metrics, aggregations []string, interval *string, timespan string) armmonitor.MetricsClientListOptions {
 	resultType := armmonitor.ResultTypeData
 	opts := armmonitor.MetricsClientListOptions{
-		Interval:            p.settings.Interval,
+		Interval:            interval,
 		ResultType:          &resultType,
-		Timespan:            to.StringPtr(p.settings.Timespan),
+		Timespan:            to.StringPtr(timespan),
 		Metricnames:         to.StringPtr(strings.Join(metrics, ",")),
 		Top:                 p.settings.MetricTop,
-		AutoAdjustTimegrain: to.BoolPtr(true),
+		AutoAdjustTimegrain: to.BoolPtr(p.settings.AutoAdjustTimegrain),
 		ValidateDimensions:  to.BoolPtr(p.settings.ValidateDimensions),
 	}
 
@@ -70,6 +70,35 @@ func (p *MetricProber) FetchMetricsFromTarget(client *armmonitor.MetricsClient,
 		opts.Orderby = to.StringPtr(p.settings.MetricOrderBy)
 	}
 
+	return opts
+}
+
+// FetchMetricsFromTarget fetches the metrics of a target for the requested timespan or (if window is set) the timespan shifted by the window offset
+func (p *MetricProber) FetchMetricsFromTarget(client *armmonitor.MetricsClient, target MetricProbeTarget, metrics, aggregations []string, window *MetricCompareOffset) (AzureInsightMetricsResult, error) {
+	ret := AzureInsightMetricsResult{
+		AzureInsightBaseMetricsResult: AzureInsightBaseMetricsResult{
+			prober: p,
+		},
+		target:       &target,
+		interval:     p.intervalForTarget(target),
+		window:       window,
+		aggregations: aggregations,
+	}
+
+	timespan := p.settings.Timespan
+	if window != nil {
+		var err error
+		if timespan, err = shiftTimespan(timespan, window.Offset, time.Now()); err != nil {
+			return ret, err
+		}
+	}
+
+	if p.settings.IntervalAuto {
+		ret.interval = p.autoIntervalForTarget(target, metrics)
+	}
+
+	opts := p.metricsListOptions(metrics, aggregations, ret.interval, timespan)
+
 	resourceURI := target.ResourceId
 	if strings.HasPrefix(strings.ToLower(p.settings.MetricNamespace), "microsoft.storage/storageaccounts/") {
 		splitNamespace := strings.Split(p.settings.MetricNamespace, "/")
@@ -78,14 +107,29 @@ func (p *MetricProber) FetchMetricsFromTarget(client *armmonitor.MetricsClient,
 		resourceURI = resourceURI + fmt.Sprintf("/%s/default", storageAccountType)
 	}
 
-	result, err := client.List(
-		p.ctx,
-		resourceURI,
-		&opts,
-	)
+	// capture raw response for debugging
+	ctx := p.ctx
+	var rawResponse *http.Response
+	if p.rawResponses.enabled {
+		ctx = runtime.WithCaptureResponse(ctx, &rawResponse)
+	}
+
+	err := p.withRetry(p.ctx, func() error {
+		startTime := time.Now()
+		result, err := client.List(
+			ctx,
+			resourceURI,
+			&opts,
+		)
+		observeApiRequest(ApiOperationListMetrics, subscriptionIdFromResourceId(target.ResourceId), startTime, err)
+		if err == nil {
+			ret.Result = &result
+		}
+		return err
+	})
 
-	if err == nil {
-		ret.Result = &result
+	if p.rawResponses.enabled {
+		p.captureRawResponse(target.ResourceId, metrics, rawResponse)
 	}
 
 	return ret, err
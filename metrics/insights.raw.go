@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+type (
+	// RawMetricsResponse is the unprocessed Azure Monitor response for a resource (debugging)
+	RawMetricsResponse struct {
+		ResourceID string          `json:"resourceID"`
+		Metrics    []string        `json:"metrics"`
+		StatusCode int             `json:"statusCode"`
+		Response   json.RawMessage `json:"response"`
+	}
+
+	rawMetricsResponseCapture struct {
+		enabled bool
+		lock    sync.Mutex
+		list    []RawMetricsResponse
+	}
+)
+
+// RunRaw requests the metrics of all targets and returns the raw Azure Monitor responses instead of publishing metrics
+func (p *MetricProber) RunRaw() []RawMetricsResponse {
+	p.rawResponses.enabled = true
+	if p.settings.Autodiscover {
+		p.autodiscoverTargetMetrics()
+	}
+	p.collectMetricsFromTargets()
+	return p.rawResponses.list
+}
+
+func (p *MetricProber) captureRawResponse(resourceId string, metrics []string, response *http.Response) {
+	if response == nil {
+		return
+	}
+
+	payload, err := runtime.Payload(response)
+	if err != nil {
+		p.logger.Warnf("unable to read raw response: %v", err)
+		return
+	}
+
+	// non JSON responses (should not happen) are returned as JSON string
+	if !json.Valid(payload) {
+		payload, _ = json.Marshal(string(payload))
+	}
+
+	p.rawResponses.lock.Lock()
+	defer p.rawResponses.lock.Unlock()
+	p.rawResponses.list = append(p.rawResponses.list, RawMetricsResponse{
+		ResourceID: resourceId,
+		Metrics:    metrics,
+		StatusCode: response.StatusCode,
+		Response:   payload,
+	})
+}
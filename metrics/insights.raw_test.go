@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func TestCaptureRawResponse(t *testing.T) {
+	testCases := []struct {
+		name       string
+		statusCode int
+		body       string
+		expected   string
+	}{
+		{"json", http.StatusOK, `{"value": []}`, `{"value": []}`},
+		{"error", http.StatusNotFound, `{"code": "ResourceNotFound"}`, `{"code": "ResourceNotFound"}`},
+		{"non json", http.StatusBadGateway, "bad gateway", `"bad gateway"`},
+	}
+
+	prober := newTestProber(config.Opts{}, nil)
+	prober.captureRawResponse("r0", []string{"Transactions"}, nil)
+
+	for i, testCase := range testCases {
+		prober.captureRawResponse(testCase.name, []string{"Transactions"}, &http.Response{
+			StatusCode: testCase.statusCode,
+			Body:       io.NopCloser(strings.NewReader(testCase.body)),
+		})
+
+		if len(prober.rawResponses.list) != i+1 {
+			t.Fatalf("%s: expected %v raw responses, got %v", testCase.name, i+1, len(prober.rawResponses.list))
+		}
+		response := prober.rawResponses.list[i]
+		if response.ResourceID != testCase.name || response.StatusCode != testCase.statusCode || string(response.Response) != testCase.expected {
+			t.Errorf("%s: expected response %q (status %v), got %q (status %v)", testCase.name, testCase.expected, testCase.statusCode, response.Response, response.StatusCode)
+		}
+	}
+}
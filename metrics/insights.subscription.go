@@ -16,11 +16,15 @@ type (
 		AzureInsightBaseMetricsResult
 
 		subscription *armsubscriptions.Subscription
+		region       string
+		interval     *string
 		Result       *armmonitor.MetricsClientListAtSubscriptionScopeResponse
 	}
 )
 
 func (r *AzureInsightSubscriptionMetricsResult) SendMetricToChannel(channel chan<- PrometheusMetricResult) {
+	r.namespace = to.String(r.Result.Namespace)
+
 	if r.Result.Value != nil {
 		// DEBUGGING
 		// data, _ := json.Marshal(r.Result)
@@ -32,12 +36,17 @@ func (r *AzureInsightSubscriptionMetricsResult) SendMetricToChannel(channel chan
 					if timeseries.Data != nil {
 						// get dimension name (optional)
 						dimensions := map[string]string{}
+						seriesKey := timeseriesDimensionKey(timeseries.Metadatavalues)
 						resourceId := ""
 						if timeseries.Metadatavalues != nil {
 							for _, dimensionRow := range timeseries.Metadatavalues {
 								dimensionRowName := to.String(dimensionRow.Name.Value)
 								dimensionRowValue := to.String(dimensionRow.Value)
 
+								if r.prober.settings.DimensionKeyLowercase {
+									dimensionRowName = strings.ToLower(dimensionRowName)
+								}
+
 								if r.prober.settings.DimensionLowercase {
 									dimensionRowValue = strings.ToLower(dimensionRowValue)
 								}
@@ -65,13 +74,20 @@ func (r *AzureInsightSubscriptionMetricsResult) SendMetricToChannel(channel chan
 							"resourceName":     azureResource.ResourceName,
 							"metric":           to.String(metric.Name.Value),
 							"unit":             metricUnit,
-							"interval":         to.String(r.prober.settings.Interval),
+							"interval":         to.String(r.interval),
 							"timespan":         r.prober.settings.Timespan,
 							"aggregation":      "",
 						}
 
-						// add resource tags as labels
+						// interval was adjusted by Azure (autoAdjustTimegrain)
+						if effectiveInterval := adjustedInterval(r.interval, r.Result.Interval); effectiveInterval != "" {
+							metricLabels["effectiveInterval"] = effectiveInterval
+						}
+
+						// add resource metadata, resource and subscription tags as labels
+						metricLabels = r.prober.addResourceLabels(metricLabels, azureResource, r.region)
 						metricLabels = r.prober.AzureResourceTagManager.AddResourceTagsToPrometheusLabels(r.prober.ctx, metricLabels, resourceId)
+						metricLabels = r.prober.addSubscriptionTagLabels(metricLabels, r.subscription)
 
 						if len(dimensions) == 1 {
 							// we have only one dimension
@@ -84,52 +100,12 @@ func (r *AzureInsightSubscriptionMetricsResult) SendMetricToChannel(channel chan
 							// add each dimension as dimensionXzy="foobar" label
 							for dimensionName, dimensionValue := range dimensions {
 								labelName := "dimension" + stringsCommon.UppercaseFirst(dimensionName)
-								labelName = metricLabelNotAllowedChars.ReplaceAllString(labelName, "")
+								labelName = SanitizeLabelName(labelName)
 								metricLabels[labelName] = dimensionValue
 							}
 						}
 
-						for _, timeseriesData := range timeseries.Data {
-							if timeseriesData.Total != nil {
-								metricLabels["aggregation"] = "total"
-								channel <- r.buildMetric(
-									metricLabels,
-									*timeseriesData.Total,
-								)
-							}
-
-							if timeseriesData.Minimum != nil {
-								metricLabels["aggregation"] = "minimum"
-								channel <- r.buildMetric(
-									metricLabels,
-									*timeseriesData.Minimum,
-								)
-							}
-
-							if timeseriesData.Maximum != nil {
-								metricLabels["aggregation"] = "maximum"
-								channel <- r.buildMetric(
-									metricLabels,
-									*timeseriesData.Maximum,
-								)
-							}
-
-							if timeseriesData.Average != nil {
-								metricLabels["aggregation"] = "average"
-								channel <- r.buildMetric(
-									metricLabels,
-									*timeseriesData.Average,
-								)
-							}
-
-							if timeseriesData.Count != nil {
-								metricLabels["aggregation"] = "count"
-								channel <- r.buildMetric(
-									metricLabels,
-									*timeseriesData.Count,
-								)
-							}
-						}
+						r.sendDatapoints(channel, metricLabels, timeseries.Data, r.Result.Timespan, r.Result.Interval, r.prober.settings.Aggregations, resourceId, to.String(metric.Name.Value), seriesKey)
 					}
 				}
 			}
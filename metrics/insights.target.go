@@ -14,12 +14,21 @@ type (
 	AzureInsightMetricsResult struct {
 		AzureInsightBaseMetricsResult
 
-		target *MetricProbeTarget
-		Result *armmonitor.MetricsClientListResponse
+		target   *MetricProbeTarget
+		interval *string
+		window   *MetricCompareOffset
+		Result   *armmonitor.MetricsClientListResponse
+
+		// requested aggregations (empty = primary aggregation)
+		aggregations []string
+
+		fallbackAggregation bool
 	}
 )
 
 func (r *AzureInsightMetricsResult) SendMetricToChannel(channel chan<- PrometheusMetricResult) {
+	r.namespace = to.String(r.Result.Namespace)
+
 	if r.Result.Value != nil {
 		// DEBUGGING
 		// data, _ := json.Marshal(r.Result)
@@ -31,13 +40,19 @@ func (r *AzureInsightMetricsResult) SendMetricToChannel(channel chan<- Prometheu
 					if timeseries.Data != nil {
 						// get dimension name (optional)
 						dimensions := map[string]string{}
+						seriesKey := timeseriesDimensionKey(timeseries.Metadatavalues)
 						if timeseries.Metadatavalues != nil {
 							for _, dimensionRow := range timeseries.Metadatavalues {
+								dimensionName := to.String(dimensionRow.Name.Value)
+								if r.prober.settings.DimensionKeyLowercase {
+									dimensionName = strings.ToLower(dimensionName)
+								}
+
 								dimensionValue := to.String(dimensionRow.Value)
 								if r.prober.settings.DimensionLowercase {
 									dimensionValue = strings.ToLower(dimensionValue)
 								}
-								dimensions[to.String(dimensionRow.Name.Value)] = dimensionValue
+								dimensions[dimensionName] = dimensionValue
 							}
 						}
 
@@ -50,7 +65,8 @@ func (r *AzureInsightMetricsResult) SendMetricToChannel(channel chan<- Prometheu
 						}
 
 						subscriptionName := ""
-						if subscription, err := r.prober.AzureClient.GetCachedSubscription(r.prober.ctx, azureResource.Subscription); err == nil && subscription != nil {
+						subscription, err := r.prober.AzureClient.GetCachedSubscription(r.prober.ctx, azureResource.Subscription)
+						if err == nil && subscription != nil {
 							subscriptionName = to.String(subscription.DisplayName)
 						}
 
@@ -62,13 +78,27 @@ func (r *AzureInsightMetricsResult) SendMetricToChannel(channel chan<- Prometheu
 							"resourceName":     azureResource.ResourceName,
 							"metric":           to.String(metric.Name.Value),
 							"unit":             metricUnit,
-							"interval":         to.String(r.prober.settings.Interval),
+							"interval":         to.String(r.interval),
 							"timespan":         r.prober.settings.Timespan,
 							"aggregation":      "",
 						}
 
-						// add resource tags as labels
+						if r.fallbackAggregation {
+							metricLabels["fallbackAggregation"] = "true"
+						}
+
+						// window of the series (only with compareOffsets)
+						metricLabels = r.prober.addWindowLabel(metricLabels, r.window)
+
+						// interval was adjusted by Azure (autoAdjustTimegrain)
+						if effectiveInterval := adjustedInterval(r.interval, r.Result.Interval); effectiveInterval != "" {
+							metricLabels["effectiveInterval"] = effectiveInterval
+						}
+
+						// add resource metadata, resource and subscription tags as labels
+						metricLabels = r.prober.addResourceLabels(metricLabels, azureResource, r.target.Location)
 						metricLabels = r.prober.AzureResourceTagManager.AddResourceTagsToPrometheusLabels(r.prober.ctx, metricLabels, resourceId)
+						metricLabels = r.prober.addSubscriptionTagLabels(metricLabels, subscription)
 
 						if len(dimensions) == 1 {
 							// we have only one dimension
@@ -81,52 +111,12 @@ func (r *AzureInsightMetricsResult) SendMetricToChannel(channel chan<- Prometheu
 							// add each dimension as dimensionXzy="foobar" label
 							for dimensionName, dimensionValue := range dimensions {
 								labelName := "dimension" + stringsCommon.UppercaseFirst(dimensionName)
-								labelName = metricLabelNotAllowedChars.ReplaceAllString(labelName, "")
+								labelName = SanitizeLabelName(labelName)
 								metricLabels[labelName] = dimensionValue
 							}
 						}
 
-						for _, timeseriesData := range timeseries.Data {
-							if timeseriesData.Total != nil {
-								metricLabels["aggregation"] = "total"
-								channel <- r.buildMetric(
-									metricLabels,
-									*timeseriesData.Total,
-								)
-							}
-
-							if timeseriesData.Minimum != nil {
-								metricLabels["aggregation"] = "minimum"
-								channel <- r.buildMetric(
-									metricLabels,
-									*timeseriesData.Minimum,
-								)
-							}
-
-							if timeseriesData.Maximum != nil {
-								metricLabels["aggregation"] = "maximum"
-								channel <- r.buildMetric(
-									metricLabels,
-									*timeseriesData.Maximum,
-								)
-							}
-
-							if timeseriesData.Average != nil {
-								metricLabels["aggregation"] = "average"
-								channel <- r.buildMetric(
-									metricLabels,
-									*timeseriesData.Average,
-								)
-							}
-
-							if timeseriesData.Count != nil {
-								metricLabels["aggregation"] = "count"
-								channel <- r.buildMetric(
-									metricLabels,
-									*timeseriesData.Count,
-								)
-							}
-						}
+						r.sendDatapoints(channel, metricLabels, timeseries.Data, r.Result.Timespan, r.Result.Interval, r.aggregations, resourceId, to.String(metric.Name.Value), seriesKey)
 					}
 				}
 			}
@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"strings"
+	"time"
+
+	iso8601 "github.com/channelmeter/iso8601duration"
+	"github.com/webdevops/go-common/azuresdk/armclient"
+	"github.com/webdevops/go-common/utils/to"
+	"go.uber.org/zap"
+)
+
+const (
+	// IntervalAuto selects the finest interval which is available for the timespan (based on metric definitions)
+	IntervalAuto = "auto"
+)
+
+// intervalForResourceType returns the requested interval or (if not set) the default interval of the resource type (see --prober.interval.map)
+func (p *MetricProber) intervalForResourceType(resourceType string) *string {
+	if p.settings.Interval != nil {
+		return p.settings.Interval
+	}
+
+	resourceType = strings.Trim(resourceType, "/")
+	for mapResourceType, interval := range p.Conf.Prober.IntervalMap {
+		if strings.EqualFold(mapResourceType, resourceType) {
+			return &interval
+		}
+	}
+
+	return p.defaultInterval()
+}
+
+// defaultInterval returns the default interval (--metrics.interval), nil for the default interval of Azure
+func (p *MetricProber) defaultInterval() *string {
+	if p.Conf.Metrics.Interval == "" || strings.EqualFold(p.Conf.Metrics.Interval, IntervalAuto) {
+		return nil
+	}
+	return &p.Conf.Metrics.Interval
+}
+
+// adjustedInterval returns the interval of the Azure response if Azure used another interval than the requested one
+// (autoAdjustTimegrain), empty if the requested interval was used or no interval was requested
+func adjustedInterval(requestedInterval, responseInterval *string) string {
+	effectiveInterval := to.String(responseInterval)
+	if requestedInterval == nil || effectiveInterval == "" || strings.EqualFold(effectiveInterval, *requestedInterval) {
+		return ""
+	}
+	return effectiveInterval
+}
+
+// intervalForTarget returns the requested interval or (if not set) the default interval of the resource type of the target
+func (p *MetricProber) intervalForTarget(target MetricProbeTarget) *string {
+	if p.settings.Interval != nil {
+		return p.settings.Interval
+	}
+
+	if len(p.Conf.Prober.IntervalMap) == 0 {
+		return p.defaultInterval()
+	}
+
+	azureResource, err := armclient.ParseResourceId(target.ResourceId)
+	if err != nil {
+		return p.intervalForResourceType(p.settings.ResourceType)
+	}
+
+	return p.intervalForResourceType(azureResource.ResourceProvider())
+}
+
+// autoIntervalForTarget returns the finest interval (timegrain) of the metric definitions whose retention covers the timespan
+// for all requested metrics (interval=auto), nil (default interval of Azure) if no interval can be determined
+func (p *MetricProber) autoIntervalForTarget(target MetricProbeTarget, metrics []string) *string {
+	contextLogger := p.logger.With(zap.String("resourceID", target.ResourceId))
+
+	lookback, ok := timespanLookback(p.settings.Timespan, time.Now())
+	if !ok {
+		contextLogger.Debugf(`unable to parse timespan "%s" for interval=auto, using default interval`, p.settings.Timespan)
+		return nil
+	}
+
+	definitionList, err := p.FetchMetricDefinitions(target.ResourceId)
+	if err != nil {
+		contextLogger.Warnf("unable to determine interval for interval=auto: %v", err)
+		return nil
+	}
+
+	var selectedTimeGrain string
+	var selectedTimeGrainDuration time.Duration
+	for _, definition := range definitionList {
+		if len(metrics) >= 1 && !stringListContainsFold(metrics, definition.Name) {
+			continue
+		}
+
+		// finest timegrain of the metric which is available for the timespan
+		var metricTimeGrain string
+		var metricTimeGrainDuration time.Duration
+		for _, availability := range definition.Availabilities {
+			timeGrain, err := iso8601.FromString(availability.TimeGrain)
+			if err != nil {
+				continue
+			}
+			retention, err := iso8601.FromString(availability.Retention)
+			if err != nil || retention.ToDuration() < lookback {
+				continue
+			}
+
+			if metricTimeGrain == "" || timeGrain.ToDuration() < metricTimeGrainDuration {
+				metricTimeGrain = availability.TimeGrain
+				metricTimeGrainDuration = timeGrain.ToDuration()
+			}
+		}
+
+		// the interval is used for all metrics of the request, use the coarsest one
+		if metricTimeGrain != "" && metricTimeGrainDuration > selectedTimeGrainDuration {
+			selectedTimeGrain = metricTimeGrain
+			selectedTimeGrainDuration = metricTimeGrainDuration
+		}
+	}
+
+	if selectedTimeGrain == "" {
+		contextLogger.Debug("no interval available for timespan with interval=auto, using default interval")
+		return nil
+	}
+
+	contextLogger.Debugf(`using interval "%s" for timespan "%s" (interval=auto)`, selectedTimeGrain, p.settings.Timespan)
+	return &selectedTimeGrain
+}
+
+// timespanLookback returns how far back the timespan reaches (ISO8601 duration, eg. PT1H, or start/end, eg. 2024-01-01T00:00:00Z/2024-01-02T00:00:00Z)
+func timespanLookback(timespan string, now time.Time) (time.Duration, bool) {
+	if start, ok := parseTimespanStart(timespan); ok {
+		return now.Sub(start), true
+	}
+
+	duration, err := iso8601.FromString(timespan)
+	if err != nil {
+		return 0, false
+	}
+	return duration.ToDuration(), true
+}
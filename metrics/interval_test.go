@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/webdevops/go-common/utils/to"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func TestIntervalForTarget(t *testing.T) {
+	storageAccount := MetricProbeTarget{ResourceId: "/subscriptions/00000000-0000-0000-0000-000000000001/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/sa1"}
+	virtualMachine := MetricProbeTarget{ResourceId: "/subscriptions/00000000-0000-0000-0000-000000000001/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm1"}
+
+	testCases := []struct {
+		name            string
+		interval        *string
+		intervalMap     map[string]string
+		defaultInterval string
+		target          MetricProbeTarget
+		expected        string
+	}{
+		{"azure default", nil, nil, "", storageAccount, ""},
+		{"default interval", nil, nil, "PT5M", storageAccount, "PT5M"},
+		{"auto default interval", nil, nil, IntervalAuto, storageAccount, ""},
+		{"resource type interval", nil, map[string]string{"microsoft.storage/storageaccounts": "PT1H"}, "PT5M", storageAccount, "PT1H"},
+		{"resource type not in map", nil, map[string]string{"Microsoft.Storage/storageAccounts": "PT1H"}, "PT5M", virtualMachine, "PT5M"},
+		{"requested interval", to.StringPtr("PT15M"), map[string]string{"Microsoft.Storage/storageAccounts": "PT1H"}, "PT5M", storageAccount, "PT15M"},
+		{"invalid resource id", nil, map[string]string{"Microsoft.Storage/storageAccounts": "PT1H"}, "PT5M", MetricProbeTarget{ResourceId: "invalid"}, "PT5M"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			conf := config.Opts{}
+			conf.Prober.IntervalMap = testCase.intervalMap
+			conf.Metrics.Interval = testCase.defaultInterval
+			prober := newTestProber(conf, &RequestMetricSettings{Interval: testCase.interval})
+
+			if interval := to.String(prober.intervalForTarget(testCase.target)); interval != testCase.expected {
+				t.Errorf("expected interval %q, got %q", testCase.expected, interval)
+			}
+		})
+	}
+}
+
+func TestAdjustedInterval(t *testing.T) {
+	testCases := []struct {
+		name              string
+		requestedInterval *string
+		responseInterval  *string
+		expected          string
+	}{
+		{"same interval", to.StringPtr("PT1M"), to.StringPtr("PT1M"), ""},
+		{"same interval different case", to.StringPtr("pt1m"), to.StringPtr("PT1M"), ""},
+		{"adjusted interval", to.StringPtr("PT1M"), to.StringPtr("PT5M"), "PT5M"},
+		{"no requested interval", nil, to.StringPtr("PT5M"), ""},
+		{"no response interval", to.StringPtr("PT1M"), nil, ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if ret := adjustedInterval(testCase.requestedInterval, testCase.responseInterval); ret != testCase.expected {
+				t.Errorf("expected %q, got %q", testCase.expected, ret)
+			}
+		})
+	}
+}
+
+func TestAutoAdjustTimegrain(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected bool
+	}{
+		{"", true},
+		{"autoAdjustTimegrain=true", true},
+		{"autoAdjustTimegrain=false", false},
+	}
+
+	for _, testCase := range testCases {
+		settings, err := newTestRequestMetricSettings(testCase.query, config.Opts{})
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.query, err)
+		}
+
+		prober := newTestProber(config.Opts{}, &settings)
+		opts := prober.metricsListOptions([]string{"Transactions"}, nil, to.StringPtr("PT1M"), settings.Timespan)
+		if opts.AutoAdjustTimegrain == nil || *opts.AutoAdjustTimegrain != testCase.expected {
+			t.Errorf("%s: expected autoAdjustTimegrain %v, got %v", testCase.query, testCase.expected, opts.AutoAdjustTimegrain)
+		}
+	}
+
+	if _, err := newTestRequestMetricSettings("autoAdjustTimegrain=maybe", config.Opts{}); err == nil {
+		t.Error("expected error for invalid autoAdjustTimegrain")
+	}
+}
+
+func TestAutoIntervalForTarget(t *testing.T) {
+	target := MetricProbeTarget{ResourceId: "/subscriptions/00000000-0000-0000-0000-000000000001/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/sa1"}
+	definitionList := []MetricDefinition{
+		{
+			Name: "Transactions",
+			Availabilities: []MetricAvailability{
+				{TimeGrain: "PT1H", Retention: "P93D"},
+				{TimeGrain: "PT1M", Retention: "P30D"},
+				{TimeGrain: "P1D", Retention: "P366D"},
+			},
+		},
+		{
+			Name: "Availability",
+			Availabilities: []MetricAvailability{
+				{TimeGrain: "PT5M", Retention: "P60D"},
+				{TimeGrain: "PT1H", Retention: "P93D"},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		timespan string
+		metrics  []string
+		expected string
+	}{
+		{"finest interval", "PT1H", []string{"Transactions"}, "PT1M"},
+		{"at retention of finest interval", "P30D", []string{"Transactions"}, "PT1M"},
+		{"beyond retention of finest interval", "P31D", []string{"Transactions"}, "PT1H"},
+		{"beyond retention of hourly interval", "P100D", []string{"Transactions"}, "P1D"},
+		{"beyond retention of all intervals", "P400D", []string{"Transactions"}, ""},
+		{"case insensitive metric name", "PT1H", []string{"transactions"}, "PT1M"},
+		{"coarsest interval of all metrics", "PT1H", nil, "PT5M"},
+		{"coarsest interval of requested metrics", "P40D", []string{"Transactions", "Availability"}, "PT1H"},
+		{"metric without definition", "PT1H", []string{"Egress"}, ""},
+		{"start/end timespan", time.Now().Add(-45*24*time.Hour).UTC().Format(time.RFC3339) + "/" + time.Now().UTC().Format(time.RFC3339), []string{"Transactions"}, "PT1H"},
+		{"invalid timespan", "yesterday", []string{"Transactions"}, ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			prober := newTestDefinitionsProber(t, &RequestMetricSettings{Timespan: testCase.timespan, IntervalAuto: true}, target.ResourceId, definitionList)
+
+			if interval := to.String(prober.autoIntervalForTarget(target, testCase.metrics)); interval != testCase.expected {
+				t.Errorf("expected interval %q, got %q", testCase.expected, interval)
+			}
+		})
+	}
+}
+
+func TestRequestMetricSettingsIntervalAuto(t *testing.T) {
+	testCases := []struct {
+		query           string
+		defaultInterval string
+		expectedAuto    bool
+	}{
+		{"interval=auto", "", true},
+		{"interval=AUTO", "", true},
+		{"", IntervalAuto, true},
+		{"interval=PT5M", IntervalAuto, false},
+		{"interval=PT5M", "", false},
+		{"", "", false},
+	}
+
+	for _, testCase := range testCases {
+		opts := config.Opts{}
+		opts.Metrics.Interval = testCase.defaultInterval
+		settings, err := newTestRequestMetricSettings(testCase.query, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.query, err)
+		}
+
+		if settings.IntervalAuto != testCase.expectedAuto {
+			t.Errorf("%s (default %q): expected interval auto %v, got %v", testCase.query, testCase.defaultInterval, testCase.expectedAuto, settings.IntervalAuto)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+type (
+	// MetricJsonRow is one datapoint of the JSON output format
+	MetricJsonRow struct {
+		Name        string            `json:"name"`
+		ResourceID  string            `json:"resourceID"`
+		Metric      string            `json:"metric"`
+		Aggregation string            `json:"aggregation"`
+		Dimensions  map[string]string `json:"dimensions"`
+		Timestamp   *time.Time        `json:"timestamp"`
+		Value       *float64          `json:"value"`
+	}
+)
+
+// WriteJson writes the metric rows as JSON array
+//
+// dimension labels are written as dimensions (by label name), NaN values (eg. stale series) are written as null;
+// metric dimension and timestamp rows are omitted
+func (l *MetricList) WriteJson(w io.Writer) error {
+	metricNames := l.GetMetricNames()
+	sort.Strings(metricNames)
+
+	rowList := []MetricJsonRow{}
+	for _, metricName := range metricNames {
+		if metricName == PrometheusMetricDimensionName || metricName == PrometheusMetricTimestampName {
+			continue
+		}
+
+		for _, row := range l.GetMetricList(metricName) {
+			jsonRow := MetricJsonRow{
+				Name:        metricName,
+				ResourceID:  row.Labels["resourceID"],
+				Metric:      row.Labels["metric"],
+				Aggregation: row.Labels["aggregation"],
+				Dimensions:  map[string]string{},
+				Timestamp:   row.Timestamp,
+			}
+
+			for labelName, labelValue := range row.Labels {
+				if isDimensionLabel(labelName) {
+					jsonRow.Dimensions[labelName] = labelValue
+				}
+			}
+
+			if !math.IsNaN(row.Value) && !math.IsInf(row.Value, 0) {
+				value := row.Value
+				jsonRow.Value = &value
+			}
+
+			rowList = append(rowList, jsonRow)
+		}
+	}
+
+	return json.NewEncoder(w).Encode(rowList)
+}
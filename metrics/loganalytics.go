@@ -0,0 +1,332 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/azuresdk/armclient"
+	"github.com/webdevops/go-common/azuresdk/cloudconfig"
+)
+
+const (
+	PrometheusLogAnalyticsNameDefault = "azurerm_loganalytics_result"
+
+	// api version used to resolve the workspace id (customerId) of workspace resources
+	logAnalyticsWorkspaceApiVersion = "2022-10-01"
+
+	// label of the workspace, result columns can't use it
+	logAnalyticsWorkspaceLabel = "workspace"
+)
+
+var (
+	logAnalyticsWorkspaceIdRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+	// numeric column types of Log Analytics results, all other columns are used as labels
+	logAnalyticsNumericColumnTypes = map[string]bool{
+		"int":     true,
+		"long":    true,
+		"real":    true,
+		"decimal": true,
+	}
+)
+
+type (
+	logAnalyticsQueryRequest struct {
+		Query    string `json:"query"`
+		Timespan string `json:"timespan,omitempty"`
+	}
+
+	logAnalyticsQueryResponse struct {
+		Tables []logAnalyticsTable `json:"tables"`
+	}
+
+	logAnalyticsTable struct {
+		Name    string               `json:"name"`
+		Columns []logAnalyticsColumn `json:"columns"`
+		Rows    [][]interface{}      `json:"rows"`
+	}
+
+	logAnalyticsColumn struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	}
+)
+
+// RunLogAnalyticsQuery runs the KQL query on the workspace (workspace id or workspace resource id) and publishes
+// the numeric result columns as gauges with the other columns as labels
+func (p *MetricProber) RunLogAnalyticsQuery(workspace, query string) error {
+	defer p.releaseCacheRefresh()
+
+	if err := p.collectLogAnalyticsQuery(workspace, query); err != nil {
+		p.reportProbeError(ClassifyProbeError(err))
+		return err
+	}
+
+	p.postProcessMetricList()
+	p.SaveToCache()
+	p.publishMetricList()
+	p.publishCacheStatus()
+	p.publishProbeErrors()
+	return nil
+}
+
+func (p *MetricProber) collectLogAnalyticsQuery(workspace, query string) error {
+	workspaceId, err := p.resolveLogAnalyticsWorkspaceId(workspace)
+	if err != nil {
+		return err
+	}
+
+	result, err := p.queryLogAnalytics(workspaceId, query)
+	if err != nil {
+		return err
+	}
+
+	if len(result.Tables) == 0 {
+		return nil
+	}
+
+	// only the primary result is used
+	return p.addLogAnalyticsTable(workspace, result.Tables[0])
+}
+
+// addLogAnalyticsTable adds the rows of the result table, every numeric column is a metric
+// (name of the request, suffixed with the column name if there are multiple numeric columns)
+func (p *MetricProber) addLogAnalyticsTable(workspace string, table logAnalyticsTable) error {
+	labelColumns := map[int]string{}
+	valueColumns := map[int]string{}
+	metricColumns := map[string]string{}
+	numericColumnCount := 0
+	for _, column := range table.Columns {
+		if logAnalyticsNumericColumnTypes[strings.ToLower(column.Type)] {
+			numericColumnCount++
+		}
+	}
+
+	labelNameColumns := map[string]string{}
+	for i, column := range table.Columns {
+		if !logAnalyticsNumericColumnTypes[strings.ToLower(column.Type)] {
+			labelName := SanitizeLabelName(column.Name)
+			if strings.HasPrefix(labelName, "__") {
+				return fmt.Errorf(`query returns column "%s", label names starting with "__" are reserved by Prometheus`, column.Name)
+			}
+			if labelName == logAnalyticsWorkspaceLabel {
+				return fmt.Errorf(`query returns column "%s", label "%s" is reserved for the workspace (rename the column)`, column.Name, labelName)
+			}
+			if otherColumn, exists := labelNameColumns[labelName]; exists {
+				return fmt.Errorf(`query returns multiple columns for label "%s" ("%s" and "%s"), rename the columns`, labelName, otherColumn, column.Name)
+			}
+			labelNameColumns[labelName] = column.Name
+			labelColumns[i] = labelName
+			continue
+		}
+
+		metricName := SanitizeMetricName(p.settings.Name)
+		if numericColumnCount >= 2 {
+			metricName = SanitizeMetricName(strings.ToLower(p.settings.Name + "_" + column.Name))
+		}
+
+		if otherColumn, exists := metricColumns[metricName]; exists {
+			return fmt.Errorf(`query returns multiple numeric columns for metric "%s" ("%s" and "%s")`, metricName, otherColumn, column.Name)
+		}
+		metricColumns[metricName] = column.Name
+		valueColumns[i] = metricName
+	}
+
+	if len(valueColumns) == 0 {
+		return fmt.Errorf("query doesn't return a numeric column")
+	}
+
+	for _, row := range table.Rows {
+		labels := prometheus.Labels{
+			logAnalyticsWorkspaceLabel: strings.ToLower(workspace),
+		}
+		for i, labelName := range labelColumns {
+			if i < len(row) {
+				labels[labelName] = logAnalyticsValueToString(row[i])
+			}
+		}
+
+		for i, metricName := range valueColumns {
+			if i >= len(row) {
+				continue
+			}
+
+			value, ok := logAnalyticsValueToFloat(row[i])
+			if !ok {
+				// null values are skipped
+				continue
+			}
+
+			metricLabels := prometheus.Labels{}
+			for labelName, labelValue := range labels {
+				metricLabels[labelName] = labelValue
+			}
+
+			p.metricList.Add(metricName, MetricRow{
+				Labels: metricLabels,
+				Value:  value,
+			})
+		}
+	}
+
+	for metricName, columnName := range metricColumns {
+		p.metricList.SetMetricHelp(metricName, fmt.Sprintf("Azure Log Analytics query result (column %s)", columnName))
+	}
+
+	return nil
+}
+
+// resolveLogAnalyticsWorkspaceId returns the workspace id (customerId) of a workspace resource id,
+// workspace ids are returned as is. The workspace id is cached in the service discovery cache (if enabled)
+func (p *MetricProber) resolveLogAnalyticsWorkspaceId(workspace string) (string, error) {
+	if logAnalyticsWorkspaceIdRegexp.MatchString(workspace) {
+		return workspace, nil
+	}
+
+	azureResource, err := armclient.ParseResourceId(workspace)
+	if err != nil {
+		return "", fmt.Errorf(`parameter "workspace" must be a workspace id or a workspace resource id: %w`, err)
+	}
+
+	cacheKey := fmt.Sprintf("loganalytics:workspace:%s", strings.ToLower(workspace))
+	if p.serviceDiscoveryCache.cache != nil {
+		v, ok := p.serviceDiscoveryCache.cache.Get(cacheKey)
+		countCacheRequest(CacheNameAzure, ok)
+		if ok {
+			if workspaceId, ok := v.(string); ok {
+				p.serviceDiscoveryCache.hit.Store(true)
+				return workspaceId, nil
+			}
+		}
+	}
+
+	client, err := armresources.NewClient(azureResource.Subscription, p.GetCred(), p.NewArmClientOptions())
+	if err != nil {
+		return "", err
+	}
+
+	var result armresources.ClientGetByIDResponse
+	err = p.withRetry(p.ctx, func() (err error) {
+		startTime := time.Now()
+		result, err = client.GetByID(p.ctx, workspace, logAnalyticsWorkspaceApiVersion, nil)
+		observeApiRequest(ApiOperationGetResource, azureResource.Subscription, startTime, err)
+		return err
+	})
+	p.reportRequestResult(azureResource.Subscription, err)
+	if err != nil {
+		return "", fmt.Errorf("unable to fetch Log Analytics workspace: %w", err)
+	}
+
+	workspaceId := ""
+	if properties, ok := result.Properties.(map[string]interface{}); ok {
+		workspaceId, _ = properties["customerId"].(string)
+	}
+	if workspaceId == "" {
+		return "", fmt.Errorf(`unable to find workspace id (customerId) of Log Analytics workspace "%s"`, workspace)
+	}
+
+	if p.serviceDiscoveryCache.cache != nil {
+		p.serviceDiscoveryCache.cache.Set(cacheKey, workspaceId, *p.serviceDiscoveryCache.cacheDuration)
+	}
+
+	return workspaceId, nil
+}
+
+// queryLogAnalytics runs the query using the Log Analytics query API of the configured Azure cloud
+func (p *MetricProber) queryLogAnalytics(workspaceId, query string) (*logAnalyticsQueryResponse, error) {
+	service, exists := p.AzureClient.GetCloudConfig().Services[cloudconfig.ServiceNameLogAnalyticsWorkspace]
+	if !exists {
+		return nil, fmt.Errorf("log analytics is not available for Azure cloud %s", p.AzureClient.GetCloudName())
+	}
+
+	clientOpts := p.NewArmClientOptions()
+	pipeline := runtime.NewPipeline(
+		"azure-metrics-exporter",
+		"",
+		runtime.PipelineOptions{
+			PerRetry: []policy.Policy{
+				runtime.NewBearerTokenPolicy(p.GetCred(), []string{strings.TrimSuffix(service.Audience, "/") + "/.default"}, nil),
+			},
+		},
+		&clientOpts.ClientOptions,
+	)
+
+	queryUrl := fmt.Sprintf("%s/v1/workspaces/%s/query", strings.TrimSuffix(service.Endpoint, "/"), workspaceId)
+
+	var result logAnalyticsQueryResponse
+	err := p.withRetry(p.ctx, func() error {
+		startTime := time.Now()
+		err := p.sendLogAnalyticsQuery(pipeline, queryUrl, query, &result)
+		observeApiRequest(ApiOperationLogAnalyticsQuery, "", startTime, err)
+		return err
+	})
+	p.reportRequestResult("", err)
+	if err != nil {
+		return nil, fmt.Errorf("unable to run Log Analytics query: %w", err)
+	}
+
+	return &result, nil
+}
+
+func (p *MetricProber) sendLogAnalyticsQuery(pipeline runtime.Pipeline, queryUrl, query string, result *logAnalyticsQueryResponse) error {
+	req, err := runtime.NewRequest(p.ctx, http.MethodPost, queryUrl)
+	if err != nil {
+		return err
+	}
+
+	if err := runtime.MarshalAsJSON(req, logAnalyticsQueryRequest{Query: query, Timespan: p.settings.Timespan}); err != nil {
+		return err
+	}
+
+	resp, err := pipeline.Do(req)
+	if err != nil {
+		return err
+	}
+
+	if !runtime.HasStatusCode(resp, http.StatusOK) {
+		return runtime.NewResponseError(resp)
+	}
+
+	return runtime.UnmarshalAsJSON(resp, result)
+}
+
+// logAnalyticsValueToFloat converts a numeric result value (decimals are returned as string), null is not a value
+func logAnalyticsValueToFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		if val, err := strconv.ParseFloat(v, 64); err == nil {
+			return val, true
+		}
+	}
+	return 0, false
+}
+
+// logAnalyticsValueToString converts a result value to a label value (dynamic values are JSON encoded)
+func logAnalyticsValueToString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		if data, err := json.Marshal(v); err == nil {
+			return string(data)
+		}
+		return fmt.Sprintf("%v", v)
+	}
+}
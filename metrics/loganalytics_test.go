@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func TestAddLogAnalyticsTable(t *testing.T) {
+	testCases := []struct {
+		name          string
+		columns       []logAnalyticsColumn
+		expectedError string
+	}{
+		{
+			name:    "valid",
+			columns: []logAnalyticsColumn{{Name: "Computer", Type: "string"}, {Name: "cpu", Type: "real"}},
+		},
+		{
+			name:          "workspace column",
+			columns:       []logAnalyticsColumn{{Name: "workspace", Type: "string"}, {Name: "cpu", Type: "real"}},
+			expectedError: `label "workspace" is reserved`,
+		},
+		{
+			name:          "columns with same label name",
+			columns:       []logAnalyticsColumn{{Name: "Computer Name", Type: "string"}, {Name: "Computer/Name", Type: "string"}, {Name: "cpu", Type: "real"}},
+			expectedError: `multiple columns for label "Computer_Name"`,
+		},
+		{
+			name:          "reserved label name",
+			columns:       []logAnalyticsColumn{{Name: "__name__", Type: "string"}, {Name: "cpu", Type: "real"}},
+			expectedError: "reserved by Prometheus",
+		},
+		{
+			name:          "columns with same metric name",
+			columns:       []logAnalyticsColumn{{Name: "cpu avg", Type: "real"}, {Name: "cpu/avg", Type: "real"}},
+			expectedError: "multiple numeric columns",
+		},
+		{
+			name:          "no numeric column",
+			columns:       []logAnalyticsColumn{{Name: "Computer", Type: "string"}},
+			expectedError: "doesn't return a numeric column",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			prober := newTestProber(config.Opts{}, &RequestMetricSettings{Name: PrometheusLogAnalyticsNameDefault})
+
+			row := []interface{}{}
+			for _, column := range testCase.columns {
+				if logAnalyticsNumericColumnTypes[column.Type] {
+					row = append(row, float64(1))
+				} else {
+					row = append(row, "value")
+				}
+			}
+
+			err := prober.addLogAnalyticsTable("xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx", logAnalyticsTable{Columns: testCase.columns, Rows: [][]interface{}{row}})
+			switch {
+			case testCase.expectedError == "" && err != nil:
+				t.Errorf("expected no error, got %v", err)
+			case testCase.expectedError != "" && (err == nil || !strings.Contains(err.Error(), testCase.expectedError)):
+				t.Errorf("expected error %q, got %v", testCase.expectedError, err)
+			}
+		})
+	}
+}
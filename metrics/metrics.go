@@ -1,11 +1,26 @@
 package metrics
 
 import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
 	MetricHelpDefault = "Azure monitor insight metric"
+
+	DimensionOtherValue = "__other__"
+
+	LabelValueSanitizeStrip   = "strip"
+	LabelValueSanitizeReplace = "replace"
+	LabelValueSanitizeNone    = "none"
+
+	// LabelValueSanitizeReplacement is used for control characters with LabelValueSanitizeReplace
+	LabelValueSanitizeReplacement = " "
 )
 
 type (
@@ -17,6 +32,12 @@ type (
 	MetricRow struct {
 		Labels prometheus.Labels
 		Value  float64
+
+		// timestamp of the datapoint (if available)
+		Timestamp *time.Time
+
+		// original (not lowercased) dimension values of the timeseries, used for deduplication
+		seriesKey string
 	}
 )
 
@@ -73,3 +94,235 @@ func (l *MetricList) GetMetricLabelNames(name string) []string {
 
 	return list
 }
+
+// FilterLabels removes labels not on the keep list (if set) and labels on the drop list,
+// rows with identical labels afterwards are collapsed (see CollapseRows)
+func (l *MetricList) FilterLabels(keep, drop []string) {
+	if len(keep) == 0 && len(drop) == 0 {
+		return
+	}
+
+	for name, rows := range l.List {
+		filteredRows := make([]MetricRow, 0, len(rows))
+		aggregations := make([]string, 0, len(rows))
+		seriesKeys := make([]string, 0, len(rows))
+		for _, row := range rows {
+			labels := prometheus.Labels{}
+			for labelName, labelValue := range row.Labels {
+				if len(keep) >= 1 && !stringListContainsFold(keep, labelName) {
+					continue
+				}
+				if stringListContainsFold(drop, labelName) {
+					continue
+				}
+				labels[labelName] = labelValue
+			}
+			filteredRows = append(filteredRows, MetricRow{Labels: labels, Value: row.Value, Timestamp: row.Timestamp, seriesKey: row.seriesKey})
+			seriesKeys = append(seriesKeys, metricLabelsKey(row.Labels))
+			if name == PrometheusMetricTimestampName {
+				// timestamps are collapsed to the latest timestamp
+				aggregations = append(aggregations, "maximum")
+			} else {
+				aggregations = append(aggregations, row.Labels["aggregation"])
+			}
+		}
+
+		l.List[name] = collapseMetricRows(filteredRows, aggregations, seriesKeys)
+	}
+}
+
+// SanitizeLabelValues strips or replaces control characters (eg. newlines) in label values, unicode characters are preserved
+func (l *MetricList) SanitizeLabelValues(mode string) {
+	if mode == "" || mode == LabelValueSanitizeNone {
+		return
+	}
+
+	for _, rows := range l.List {
+		for _, row := range rows {
+			for labelName, labelValue := range row.Labels {
+				if sanitizedValue := sanitizeLabelValue(labelValue, mode); sanitizedValue != labelValue {
+					row.Labels[labelName] = sanitizedValue
+				}
+			}
+		}
+	}
+}
+
+// sanitizeLabelValue strips or replaces control characters and invalid UTF-8 sequences
+func sanitizeLabelValue(value, mode string) string {
+	replacement := ""
+	if mode == LabelValueSanitizeReplace {
+		replacement = LabelValueSanitizeReplacement
+	}
+
+	value = strings.ToValidUTF8(value, replacement)
+	if strings.IndexFunc(value, unicode.IsControl) == -1 {
+		return value
+	}
+
+	var ret strings.Builder
+	ret.Grow(len(value))
+	for _, char := range value {
+		if unicode.IsControl(char) {
+			ret.WriteString(replacement)
+			continue
+		}
+		ret.WriteRune(char)
+	}
+	return ret.String()
+}
+
+// collapseMetricRows merges rows of different series (seriesKeys: label set before filtering) with identical labels
+//
+// multiple datapoints of the same series are not merged, the last datapoint of each series wins (like without filtering),
+// the series are merged based on the (original) aggregation of the row:
+// minimum uses the minimum, maximum the maximum, average the mean and all others (total, count, ...) the sum
+func collapseMetricRows(rows []MetricRow, aggregations, seriesKeys []string) []MetricRow {
+	type collapsedRow struct {
+		row         MetricRow
+		aggregation string
+		seriesList  []string
+		values      map[string]float64
+	}
+
+	collapsedRows := []*collapsedRow{}
+	collapsedRowIndex := map[string]*collapsedRow{}
+	for i, row := range rows {
+		key := metricLabelsKey(row.Labels)
+		collapsed, exists := collapsedRowIndex[key]
+		if !exists {
+			collapsed = &collapsedRow{aggregation: strings.ToLower(aggregations[i]), values: map[string]float64{}}
+			collapsedRowIndex[key] = collapsed
+			collapsedRows = append(collapsedRows, collapsed)
+		}
+		collapsed.row = row
+
+		// multiple datapoints of the same series: last datapoint wins
+		if _, exists := collapsed.values[seriesKeys[i]]; !exists {
+			collapsed.seriesList = append(collapsed.seriesList, seriesKeys[i])
+		}
+		collapsed.values[seriesKeys[i]] = row.Value
+	}
+
+	ret := make([]MetricRow, 0, len(collapsedRows))
+	for _, collapsed := range collapsedRows {
+		value := collapsed.values[collapsed.seriesList[0]]
+		for _, seriesKey := range collapsed.seriesList[1:] {
+			switch collapsed.aggregation {
+			case "minimum":
+				value = math.Min(value, collapsed.values[seriesKey])
+			case "maximum":
+				value = math.Max(value, collapsed.values[seriesKey])
+			default:
+				value += collapsed.values[seriesKey]
+			}
+		}
+		if collapsed.aggregation == "average" {
+			value = value / float64(len(collapsed.seriesList))
+		}
+
+		collapsed.row.Value = value
+		ret = append(ret, collapsed.row)
+	}
+	return ret
+}
+
+// metricLabelsKey builds an unique key for a label set
+func metricLabelsKey(labels prometheus.Labels) string {
+	labelNames := make([]string, 0, len(labels))
+	for labelName := range labels {
+		labelNames = append(labelNames, labelName)
+	}
+	sort.Strings(labelNames)
+
+	key := ""
+	for _, labelName := range labelNames {
+		key += labelName + "\xff" + labels[labelName] + "\xff"
+	}
+	return key
+}
+
+// LimitDimensionSeries keeps only the topN dimension series (by value) of a metric per resource, metric and aggregation,
+// the remaining series are summed up into one series with all dimension labels set to DimensionOtherValue
+func (l *MetricList) LimitDimensionSeries(name string, topN int) {
+	type seriesGroup struct {
+		rows  []MetricRow
+		index map[string]int
+	}
+
+	rows, exists := l.List[name]
+	if !exists || topN <= 0 {
+		return
+	}
+
+	groupList := []*seriesGroup{}
+	groupIndex := map[string]*seriesGroup{}
+	for _, row := range rows {
+		groupLabels := prometheus.Labels{}
+		hasDimension := false
+		for labelName, labelValue := range row.Labels {
+			if isDimensionLabel(labelName) {
+				hasDimension = true
+				continue
+			}
+			groupLabels[labelName] = labelValue
+		}
+
+		if !hasDimension {
+			// not split by dimension, keep group of one row
+			groupLabels = row.Labels
+		}
+
+		groupKey := metricLabelsKey(groupLabels)
+		group, exists := groupIndex[groupKey]
+		if !exists {
+			group = &seriesGroup{index: map[string]int{}}
+			groupIndex[groupKey] = group
+			groupList = append(groupList, group)
+		}
+
+		// same series multiple times (multiple datapoints), last value wins (same as gauge)
+		seriesKey := metricLabelsKey(row.Labels)
+		if i, exists := group.index[seriesKey]; exists {
+			group.rows[i] = row
+		} else {
+			group.index[seriesKey] = len(group.rows)
+			group.rows = append(group.rows, row)
+		}
+	}
+
+	ret := make([]MetricRow, 0, len(rows))
+	for _, group := range groupList {
+		if len(group.rows) <= topN {
+			ret = append(ret, group.rows...)
+			continue
+		}
+
+		sort.SliceStable(group.rows, func(i, j int) bool {
+			return group.rows[i].Value > group.rows[j].Value
+		})
+		ret = append(ret, group.rows[:topN]...)
+
+		otherRow := MetricRow{Labels: prometheus.Labels{}, Value: 0}
+		for labelName, labelValue := range group.rows[topN].Labels {
+			if isDimensionLabel(labelName) {
+				labelValue = DimensionOtherValue
+			}
+			otherRow.Labels[labelName] = labelValue
+		}
+		for _, row := range group.rows[topN:] {
+			if !math.IsNaN(row.Value) {
+				otherRow.Value += row.Value
+			}
+		}
+		ret = append(ret, otherRow)
+	}
+
+	l.List[name] = ret
+}
+
+// isDimensionLabel checks if the label is a dimension label (dimension or dimensionXyz)
+func isDimensionLabel(labelName string) bool {
+	suffix, found := strings.CutPrefix(labelName, "dimension")
+	return found && (suffix == "" || unicode.IsUpper(rune(suffix[0])))
+}
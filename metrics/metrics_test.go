@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestFilterLabels(t *testing.T) {
+	testCases := []struct {
+		name        string
+		keep        []string
+		drop        []string
+		aggregation string
+		// values of the remaining series (by resourceID label, "" if dropped)
+		expected map[string]float64
+		// number of labels of the remaining series
+		expectedLabels int
+	}{
+		{"no filter", nil, nil, "total", nil, 4},
+		{"keep", []string{"ResourceID", "aggregation"}, nil, "total", map[string]float64{"r1": 6, "r2": 4}, 2},
+		{"drop", nil, []string{"dimensionApiName"}, "total", map[string]float64{"r1": 6, "r2": 4}, 3},
+		{"keep and drop", []string{"resourceID", "aggregation"}, []string{"resourceID"}, "total", map[string]float64{"": 10}, 1},
+		{"collapse minimum", nil, []string{"dimensionApiName"}, "minimum", map[string]float64{"r1": 1, "r2": 4}, 3},
+		{"collapse maximum", nil, []string{"dimensionApiName"}, "maximum", map[string]float64{"r1": 5, "r2": 4}, 3},
+		{"collapse average", nil, []string{"dimensionApiName"}, "average", map[string]float64{"r1": 3, "r2": 4}, 3},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			metricList := NewMetricList()
+			for _, row := range []MetricRow{
+				{Labels: prometheus.Labels{"resourceID": "r1", "dimensionApiName": "GetBlob"}, Value: 1},
+				{Labels: prometheus.Labels{"resourceID": "r1", "dimensionApiName": "PutBlob"}, Value: 2},
+				// multiple datapoints of the same series: last datapoint wins
+				{Labels: prometheus.Labels{"resourceID": "r1", "dimensionApiName": "PutBlob"}, Value: 5},
+				{Labels: prometheus.Labels{"resourceID": "r2", "dimensionApiName": "GetBlob"}, Value: 4},
+			} {
+				row.Labels["aggregation"] = testCase.aggregation
+				row.Labels["metric"] = "Transactions"
+				metricList.Add("azurerm_resource_metric", row)
+			}
+
+			metricList.FilterLabels(testCase.keep, testCase.drop)
+
+			rows := metricList.GetMetricList("azurerm_resource_metric")
+			if testCase.expected == nil {
+				// nothing filtered, nothing collapsed
+				if len(rows) != 4 {
+					t.Errorf("expected unchanged rows, got %v", rows)
+				}
+				return
+			}
+
+			if len(rows) != len(testCase.expected) {
+				t.Fatalf("expected %v series, got %v", len(testCase.expected), rows)
+			}
+			for _, row := range rows {
+				if expected := testCase.expected[row.Labels["resourceID"]]; row.Value != expected {
+					t.Errorf("%s: expected value %v, got %v", row.Labels["resourceID"], expected, row.Value)
+				}
+				if len(row.Labels) != testCase.expectedLabels {
+					t.Errorf("expected %v labels, got %v", testCase.expectedLabels, row.Labels)
+				}
+			}
+		})
+	}
+}
+
+func TestLimitDimensionSeries(t *testing.T) {
+	testCases := []struct {
+		name string
+		topN int
+		// values by resourceID/dimensionApiName
+		expected map[string]float64
+	}{
+		{"disabled", 0, nil},
+		{"below limit", 4, map[string]float64{"r1/GetBlob": 5, "r1/PutBlob": 3, "r1/ListBlobs": 1, "r1/DeleteBlob": 2, "r2/GetBlob": 4, "r3/": 7}},
+		{"top 2", 2, map[string]float64{"r1/GetBlob": 5, "r1/PutBlob": 3, "r1/" + DimensionOtherValue: 3, "r2/GetBlob": 4, "r3/": 7}},
+		{"top 1", 1, map[string]float64{"r1/GetBlob": 5, "r1/" + DimensionOtherValue: 6, "r2/GetBlob": 4, "r3/": 7}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			metricList := NewMetricList()
+			for _, row := range []MetricRow{
+				{Labels: prometheus.Labels{"resourceID": "r1", "dimensionApiName": "GetBlob"}, Value: 5},
+				{Labels: prometheus.Labels{"resourceID": "r1", "dimensionApiName": "PutBlob"}, Value: 10},
+				// same series multiple times (multiple datapoints), last value wins
+				{Labels: prometheus.Labels{"resourceID": "r1", "dimensionApiName": "PutBlob"}, Value: 3},
+				{Labels: prometheus.Labels{"resourceID": "r1", "dimensionApiName": "ListBlobs"}, Value: 1},
+				{Labels: prometheus.Labels{"resourceID": "r1", "dimensionApiName": "DeleteBlob"}, Value: 2},
+				{Labels: prometheus.Labels{"resourceID": "r2", "dimensionApiName": "GetBlob"}, Value: 4},
+				// not split by dimension
+				{Labels: prometheus.Labels{"resourceID": "r3"}, Value: 7},
+			} {
+				metricList.Add("azurerm_storage_transactions", row)
+			}
+
+			metricList.LimitDimensionSeries("azurerm_storage_transactions", testCase.topN)
+
+			rows := metricList.GetMetricList("azurerm_storage_transactions")
+			if testCase.expected == nil {
+				// nothing limited, multiple datapoints are kept
+				if len(rows) != 7 {
+					t.Errorf("expected unchanged rows, got %v", rows)
+				}
+				return
+			}
+
+			if len(rows) != len(testCase.expected) {
+				t.Fatalf("expected %v series, got %v", len(testCase.expected), rows)
+			}
+			for _, row := range rows {
+				key := row.Labels["resourceID"] + "/" + row.Labels["dimensionApiName"]
+				if expected, exists := testCase.expected[key]; !exists || row.Value != expected {
+					t.Errorf("%s: expected value %v, got %v", key, expected, row.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestSanitizeLabelValues(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mode     string
+		value    string
+		expected string
+	}{
+		{"strip newline", LabelValueSanitizeStrip, "line1\nline2", "line1line2"},
+		{"strip control characters", LabelValueSanitizeStrip, "a\tb\x00c\x1bd", "abcd"},
+		{"replace newline", LabelValueSanitizeReplace, "line1\r\nline2", "line1  line2"},
+		{"strip multibyte", LabelValueSanitizeStrip, "Zürich 東京 🚀", "Zürich 東京 🚀"},
+		{"strip multibyte with control character", LabelValueSanitizeStrip, "東京\n大阪", "東京大阪"},
+		{"strip invalid utf-8", LabelValueSanitizeStrip, "a\xffb", "ab"},
+		{"replace invalid utf-8", LabelValueSanitizeReplace, "a\xffb", "a b"},
+		{"none", LabelValueSanitizeNone, "line1\nline2", "line1\nline2"},
+		{"default", "", "line1\nline2", "line1\nline2"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			metricList := NewMetricList()
+			metricList.Add("azurerm_resource_metric", MetricRow{Labels: prometheus.Labels{"resourceID": "r1", "dimensionName": testCase.value}, Value: 1})
+
+			metricList.SanitizeLabelValues(testCase.mode)
+
+			row := metricList.GetMetricList("azurerm_resource_metric")[0]
+			if value := row.Labels["dimensionName"]; value != testCase.expected {
+				t.Errorf("expected %q, got %q", testCase.expected, value)
+			}
+			if value := row.Labels["resourceID"]; value != "r1" {
+				t.Errorf("expected unchanged label %q, got %q", "r1", value)
+			}
+		})
+	}
+}
@@ -14,6 +14,20 @@ func paramsGetWithDefault(params url.Values, name, defaultValue string) (value s
 	return
 }
 
+// paramsGetAlias returns the value of the parameter name or its alias (and the used parameter name),
+// setting both is an error
+func paramsGetAlias(params url.Values, name, alias string) (paramName, value string, err error) {
+	value, aliasValue := params.Get(name), params.Get(alias)
+	switch {
+	case value != "" && aliasValue != "":
+		return name, "", fmt.Errorf(`parameters "%s" and "%s" can't be combined`, name, alias)
+	case aliasValue != "":
+		return alias, aliasValue, nil
+	default:
+		return name, value, nil
+	}
+}
+
 func paramsGetList(params url.Values, name string) (list []string, err error) {
 	for _, v := range params[name] {
 		list = append(list, stringToStringList(v, ",")...)
@@ -38,3 +52,12 @@ func stringToStringList(v string, sep string) (list []string) {
 	}
 	return
 }
+
+func stringListContainsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
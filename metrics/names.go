@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// runs of characters not allowed in metric and label names (including adjacent underscores)
+	prometheusNameInvalidChars = regexp.MustCompile(`_*[^a-zA-Z0-9_]+_*`)
+)
+
+// SanitizeMetricName converts name to a valid Prometheus metric name ([a-zA-Z_][a-zA-Z0-9_]*),
+// invalid characters are replaced by a single underscore (eg. "Percentage CPU" -> "Percentage_CPU")
+func SanitizeMetricName(name string) string {
+	return sanitizePrometheusName(name)
+}
+
+// SanitizeLabelName converts name to a valid Prometheus label name ([a-zA-Z_][a-zA-Z0-9_]*),
+// invalid characters are replaced by a single underscore (eg. "dimensionApi/Name" -> "dimensionApi_Name")
+func SanitizeLabelName(name string) string {
+	return sanitizePrometheusName(name)
+}
+
+func sanitizePrometheusName(name string) string {
+	sanitized := prometheusNameInvalidChars.ReplaceAllString(name, "_")
+	if sanitized != name && len(name) > 0 && !isPrometheusNameChar(name[len(name)-1]) {
+		// no trailing underscore for removed suffixes (eg. "Foo (avg)" -> "Foo_avg")
+		sanitized = strings.TrimSuffix(sanitized, "_")
+	}
+	name = sanitized
+
+	// names must not start with a digit
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+
+	return name
+}
+
+func isPrometheusNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
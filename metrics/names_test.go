@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"testing"
+)
+
+func TestSanitizePrometheusNames(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{"Percentage CPU", "Percentage_CPU"},
+		{"Percentage CPU (avg)", "Percentage_CPU_avg"},
+		{"dimensionApi/Name", "dimensionApi_Name"},
+		{"dimensionMicrosoft.ResourceId/Type", "dimensionMicrosoft_ResourceId_Type"},
+		{"Blob  --  Count", "Blob_Count"},
+		{"foo_/_bar", "foo_bar"},
+		{"foo__bar", "foo__bar"},
+		{"1xx Responses", "_1xx_Responses"},
+		{"5xx", "_5xx"},
+		{"already_valid", "already_valid"},
+		{"", "_"},
+	}
+
+	for _, testCase := range testCases {
+		if ret := SanitizeMetricName(testCase.name); ret != testCase.expected {
+			t.Errorf("SanitizeMetricName(%q): expected %q, got %q", testCase.name, testCase.expected, ret)
+		}
+		if ret := SanitizeLabelName(testCase.name); ret != testCase.expected {
+			t.Errorf("SanitizeLabelName(%q): expected %q, got %q", testCase.name, testCase.expected, ret)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/webdevops/go-common/azuresdk/armclient"
+	"github.com/webdevops/go-common/utils/to"
+)
+
+// FetchMetricNamespaces fetches the metric namespaces of a resource, cached in the service discovery cache (if enabled)
+func (p *MetricProber) FetchMetricNamespaces(resourceId string) (namespaceList []string, err error) {
+	azureResource, err := armclient.ParseResourceId(resourceId)
+	if err != nil {
+		return namespaceList, err
+	}
+
+	cacheKey := fmt.Sprintf("namespaces:%s", strings.ToLower(resourceId))
+	if p.serviceDiscoveryCache.cache != nil {
+		v, ok := p.serviceDiscoveryCache.cache.Get(cacheKey)
+		countCacheRequest(CacheNameAzure, ok)
+		if ok {
+			if cacheData, ok := v.([]byte); ok {
+				if err := json.Unmarshal(cacheData, &namespaceList); err == nil {
+					p.serviceDiscoveryCache.hit.Store(true)
+					return namespaceList, nil
+				}
+			}
+		}
+	}
+
+	client, err := armmonitor.NewMetricNamespacesClient(p.GetCred(), p.NewArmClientOptions())
+	if err != nil {
+		return namespaceList, err
+	}
+
+	pager := client.NewListPager(resourceId, nil)
+	for pager.More() {
+		startTime := time.Now()
+		result, err := pager.NextPage(p.ctx)
+		observeApiRequest(ApiOperationListMetricNamespaces, azureResource.Subscription, startTime, err)
+		if err != nil {
+			return namespaceList, fmt.Errorf("unable to fetch metric namespaces: %w", err)
+		}
+
+		for _, row := range result.Value {
+			if row.Properties != nil && row.Properties.MetricNamespaceName != nil {
+				namespaceList = append(namespaceList, to.String(row.Properties.MetricNamespaceName))
+			}
+		}
+	}
+
+	if p.serviceDiscoveryCache.cache != nil {
+		if cacheData, err := json.Marshal(namespaceList); err == nil {
+			p.serviceDiscoveryCache.cache.Set(cacheKey, cacheData, *p.serviceDiscoveryCache.cacheDuration)
+		}
+	}
+
+	return namespaceList, nil
+}
+
+// validateMetricNamespace checks if the requested metric namespace is available for all targets
+func (p *MetricProber) validateMetricNamespace() error {
+	for _, targetList := range p.targets {
+		for _, target := range targetList {
+			namespaceList, err := p.FetchMetricNamespaces(target.ResourceId)
+			if err != nil {
+				return err
+			}
+
+			if !stringListContainsFold(namespaceList, p.settings.MetricNamespace) {
+				return fmt.Errorf(
+					`parameter "metricNamespace" contains invalid namespace "%s" for resource "%s", available: %s`,
+					p.settings.MetricNamespace,
+					target.ResourceId,
+					strings.Join(namespaceList, ", "),
+				)
+			}
+		}
+	}
+
+	return nil
+}
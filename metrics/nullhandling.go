@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/azuresdk/armclient"
+	"go.uber.org/zap"
+)
+
+const (
+	// MetricNullHandlingSkip omits aggregations without value (null buckets)
+	MetricNullHandlingSkip = "skip"
+	// MetricNullHandlingZero emits 0 for aggregations without value
+	MetricNullHandlingZero = "zero"
+	// MetricNullHandlingNaN emits NaN for aggregations without value (missing data in PromQL)
+	MetricNullHandlingNaN = "nan"
+)
+
+type (
+	metricAggregationValue struct {
+		name  string
+		value *float64
+	}
+)
+
+// datapointAggregationValues returns the aggregations of a datapoint (value is nil for null buckets)
+func datapointAggregationValues(datapoint *armmonitor.MetricValue) []metricAggregationValue {
+	return []metricAggregationValue{
+		{name: "total", value: datapoint.Total},
+		{name: "minimum", value: datapoint.Minimum},
+		{name: "maximum", value: datapoint.Maximum},
+		{name: "average", value: datapoint.Average},
+		{name: "count", value: datapoint.Count},
+	}
+}
+
+// sendDatapoints sends the aggregations of the selected datapoints of a timeseries, expected aggregations without
+// value (null buckets) are handled per datapoint based on --metrics.null-handling, so an empty trailing bucket
+// isn't hidden by the value of a previous bucket
+func (r *AzureInsightBaseMetricsResult) sendDatapoints(channel chan<- PrometheusMetricResult, labels prometheus.Labels, data []*armmonitor.MetricValue, timespan, interval *string, aggregations []string, resourceId, metricName, seriesKey string) {
+	nullValue, handleNulls := r.prober.nullHandlingValue()
+
+	var expectedAggregations []string
+	if handleNulls {
+		expectedAggregations = r.prober.nullHandlingAggregations(data, aggregations, resourceId, metricName)
+	}
+
+	sentDatapoints := 0
+	for _, datapoint := range r.selectDatapoints(data, timespan, interval) {
+		if datapoint == nil {
+			continue
+		}
+		sentDatapoints++
+
+		values := map[string]bool{}
+		for _, aggregation := range datapointAggregationValues(datapoint) {
+			if aggregation.value != nil {
+				labels["aggregation"] = aggregation.name
+				r.sendMetric(channel, labels, *aggregation.value, datapoint.TimeStamp, seriesKey)
+				values[aggregation.name] = true
+			}
+		}
+
+		for _, aggregation := range expectedAggregations {
+			if !values[aggregation] {
+				labels["aggregation"] = aggregation
+				r.sendMetric(channel, labels, nullValue, datapoint.TimeStamp, seriesKey)
+			}
+		}
+	}
+
+	// timeseries without any datapoint
+	if sentDatapoints == 0 {
+		for _, aggregation := range expectedAggregations {
+			labels["aggregation"] = aggregation
+			r.sendMetric(channel, labels, nullValue, nil, seriesKey)
+		}
+	}
+}
+
+// nullHandlingValue returns the value of aggregations without value (false if they are skipped)
+func (p *MetricProber) nullHandlingValue() (float64, bool) {
+	switch p.Conf.Metrics.NullHandling {
+	case MetricNullHandlingZero:
+		return 0, true
+	case MetricNullHandlingNaN:
+		return math.NaN(), true
+	default:
+		return 0, false
+	}
+}
+
+// nullHandlingAggregations returns the aggregations which are expected for a timeseries: the requested aggregations
+// or (if not set, Azure returns the primary aggregation) the primary aggregation of the metric definition,
+// if the definition is not available the aggregations with values in any datapoint of the timeseries
+func (p *MetricProber) nullHandlingAggregations(data []*armmonitor.MetricValue, aggregations []string, resourceId, metricName string) (ret []string) {
+	if len(aggregations) >= 1 {
+		for _, aggregation := range aggregations {
+			ret = append(ret, strings.ToLower(aggregation))
+		}
+		return ret
+	}
+
+	if aggregation := p.primaryAggregation(resourceId, metricName); aggregation != "" {
+		return []string{aggregation}
+	}
+
+	found := map[string]bool{}
+	for _, datapoint := range data {
+		if datapoint == nil {
+			continue
+		}
+
+		for _, aggregation := range datapointAggregationValues(datapoint) {
+			if aggregation.value != nil && !found[aggregation.name] {
+				found[aggregation.name] = true
+				ret = append(ret, aggregation.name)
+			}
+		}
+	}
+	return ret
+}
+
+// primaryAggregation returns the primary aggregation of a metric from the metric definitions of the resource type
+// (empty if unknown), definitions are fetched once per resource type and probe
+func (p *MetricProber) primaryAggregation(resourceId, metricName string) string {
+	azureResource, err := armclient.ParseResourceId(resourceId)
+	if err != nil || azureResource.ResourceProviderNamespace == "" || azureResource.ResourceProviderName == "" {
+		return ""
+	}
+	resourceType := strings.ToLower(azureResource.ResourceProviderNamespace + "/" + azureResource.ResourceProviderName)
+
+	p.primaryAggregations.lock.Lock()
+	defer p.primaryAggregations.lock.Unlock()
+
+	if p.primaryAggregations.byResourceType == nil {
+		p.primaryAggregations.byResourceType = map[string]map[string]string{}
+	}
+
+	aggregationMap, exists := p.primaryAggregations.byResourceType[resourceType]
+	if !exists {
+		aggregationMap = map[string]string{}
+		if definitionList, err := p.FetchMetricDefinitions(resourceId); err == nil {
+			for _, definition := range definitionList {
+				aggregationMap[strings.ToLower(definition.Name)] = definition.PrimaryAggregation
+			}
+		} else {
+			p.logger.With(zap.String("resourceID", resourceId)).Debugf("unable to fetch primary aggregations for null handling: %v", err)
+		}
+		p.primaryAggregations.byResourceType[resourceType] = aggregationMap
+	}
+
+	return aggregationMap[strings.ToLower(metricName)]
+}
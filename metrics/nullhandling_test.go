@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/utils/to"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+const (
+	testNullHandlingResourceId = "/subscriptions/00000000-0000-0000-0000-000000000001/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/sa1"
+)
+
+// testNullBuckets returns datapoints with average values and an empty (null) trailing bucket
+func testNullBuckets() []*armmonitor.MetricValue {
+	timestamps := []time.Time{}
+	for i := 0; i < 3; i++ {
+		timestamps = append(timestamps, time.Date(2024, 1, 1, 0, i, 0, 0, time.UTC))
+	}
+
+	return []*armmonitor.MetricValue{
+		{TimeStamp: &timestamps[0], Average: to.Float64Ptr(1)},
+		{TimeStamp: &timestamps[1], Average: to.Float64Ptr(2)},
+		{TimeStamp: &timestamps[2]},
+	}
+}
+
+// sendTestDatapoints sends the datapoints with the null handling mode and returns the last value per aggregation
+// (like the published metric, the last value of a series wins)
+func sendTestDatapoints(t *testing.T, nullHandling string, data []*armmonitor.MetricValue, aggregations []string, primaryAggregations map[string]string) map[string]float64 {
+	t.Helper()
+
+	conf := config.Opts{}
+	conf.Metrics.NullHandling = nullHandling
+	prober := newTestProber(conf, &RequestMetricSettings{Name: "azurerm_resource_metric"})
+
+	// metric definitions are not fetched from Azure
+	prober.primaryAggregations.byResourceType = map[string]map[string]string{
+		"microsoft.storage/storageaccounts": primaryAggregations,
+	}
+
+	channel := make(chan PrometheusMetricResult, 100)
+	result := AzureInsightBaseMetricsResult{prober: prober}
+	result.sendDatapoints(channel, prometheus.Labels{}, data, nil, nil, aggregations, testNullHandlingResourceId, "Transactions", "")
+	close(channel)
+
+	values := map[string]float64{}
+	for metric := range channel {
+		values[metric.Labels["aggregation"]] = metric.Value
+	}
+	return values
+}
+
+func TestNullHandlingSkip(t *testing.T) {
+	values := sendTestDatapoints(t, MetricNullHandlingSkip, testNullBuckets(), []string{"average"}, nil)
+
+	if len(values) != 1 || values["average"] != 2 {
+		t.Errorf("expected last non-null average 2, got %v", values)
+	}
+}
+
+func TestNullHandlingZero(t *testing.T) {
+	values := sendTestDatapoints(t, MetricNullHandlingZero, testNullBuckets(), []string{"Average"}, nil)
+
+	if len(values) != 1 || values["average"] != 0 {
+		t.Errorf("expected average 0 for the empty trailing bucket, got %v", values)
+	}
+}
+
+func TestNullHandlingNaN(t *testing.T) {
+	values := sendTestDatapoints(t, MetricNullHandlingNaN, testNullBuckets(), []string{"average"}, nil)
+
+	if len(values) != 1 || !math.IsNaN(values["average"]) {
+		t.Errorf("expected average NaN for the empty trailing bucket, got %v", values)
+	}
+}
+
+func TestNullHandlingTrailingValue(t *testing.T) {
+	// null buckets followed by a value keep the value
+	data := testNullBuckets()
+	data = append(data[2:], data[:2]...)
+
+	values := sendTestDatapoints(t, MetricNullHandlingZero, data, []string{"average"}, nil)
+	if values["average"] != 2 {
+		t.Errorf("expected average 2, got %v", values)
+	}
+}
+
+func TestNullHandlingPrimaryAggregation(t *testing.T) {
+	// no aggregation requested and no values at all: the primary aggregation of the definition is expected
+	timestamp := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	data := []*armmonitor.MetricValue{
+		{TimeStamp: &timestamp},
+	}
+
+	values := sendTestDatapoints(t, MetricNullHandlingZero, data, nil, map[string]string{"transactions": "total"})
+	if len(values) != 1 || values["total"] != 0 {
+		t.Errorf("expected primary aggregation total 0, got %v", values)
+	}
+}
+
+func TestNullHandlingWithoutDefinition(t *testing.T) {
+	// without definition the aggregations with values in other datapoints are expected
+	values := sendTestDatapoints(t, MetricNullHandlingNaN, testNullBuckets(), nil, map[string]string{})
+	if len(values) != 1 || !math.IsNaN(values["average"]) {
+		t.Errorf("expected average NaN, got %v", values)
+	}
+}
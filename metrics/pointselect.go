@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	iso8601 "github.com/channelmeter/iso8601duration"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/webdevops/go-common/utils/to"
+)
+
+const (
+	// PointSelectLastNonNull uses the last datapoint with a value per aggregation (default)
+	PointSelectLastNonNull = "lastNonNull"
+	// PointSelectLast uses the last datapoint of the timeseries (aggregations without value are skipped)
+	PointSelectLast = "last"
+	// PointSelectFirst uses the first datapoint of the timeseries (aggregations without value are skipped)
+	PointSelectFirst = "first"
+	// PointSelectAtOffset uses the datapoint nearest to window start + offset (atOffset:PT30M)
+	PointSelectAtOffset = "atOffset"
+)
+
+// parsePointSelect parses the pointSelect parameter (first, last, lastNonNull or atOffset:<ISO8601 duration>),
+// the offset is validated against the timespan (if the timespan is a duration)
+func parsePointSelect(val, timespan string) (mode string, offset time.Duration, err error) {
+	mode, offsetString, hasOffset := strings.Cut(val, ":")
+	switch mode {
+	case PointSelectLastNonNull, PointSelectLast, PointSelectFirst:
+		if hasOffset {
+			return mode, offset, fmt.Errorf(`parameter "pointSelect" with "%s" doesn't support an offset`, mode)
+		}
+	case PointSelectAtOffset:
+		offsetDuration, err := iso8601.FromString(offsetString)
+		if err != nil {
+			return mode, offset, fmt.Errorf(`parameter "pointSelect" has an invalid offset "%s" (must be an ISO8601 duration, eg. atOffset:PT30M): %w`, offsetString, err)
+		}
+		offset = offsetDuration.ToDuration()
+
+		if timespanDuration, err := iso8601.FromString(timespan); err == nil && offset > timespanDuration.ToDuration() {
+			return mode, offset, fmt.Errorf(`parameter "pointSelect" offset "%s" exceeds the timespan "%s"`, offsetString, timespan)
+		}
+	default:
+		return mode, offset, fmt.Errorf(`parameter "pointSelect" must be "first", "last", "lastNonNull" or "atOffset:<duration>", got "%s"`, val)
+	}
+
+	return mode, offset, nil
+}
+
+// selectDatapoints returns the datapoints of a timeseries which are exported based on the pointSelect parameter,
+// the timespan (start/end) of the response is used as window for atOffset
+func (r *AzureInsightBaseMetricsResult) selectDatapoints(data []*armmonitor.MetricValue, timespan, interval *string) []*armmonitor.MetricValue {
+	if r.prober.Conf.Prober.DropIncompleteInterval {
+		data = dropIncompleteInterval(data, to.String(interval), time.Now())
+	}
+
+	if len(data) == 0 {
+		return data
+	}
+
+	switch r.prober.settings.PointSelect {
+	case PointSelectFirst:
+		return data[:1]
+	case PointSelectLast:
+		return data[len(data)-1:]
+	case PointSelectAtOffset:
+		windowStart, ok := parseTimespanStart(to.String(timespan))
+		if !ok {
+			return nil
+		}
+		target := windowStart.Add(r.prober.settings.PointSelectOffset)
+
+		var selected *armmonitor.MetricValue
+		var selectedDistance time.Duration
+		for _, datapoint := range data {
+			if datapoint == nil || datapoint.TimeStamp == nil {
+				continue
+			}
+
+			distance := datapoint.TimeStamp.Sub(target).Abs()
+			if selected == nil || distance < selectedDistance {
+				selected = datapoint
+				selectedDistance = distance
+			}
+		}
+		if selected == nil {
+			return nil
+		}
+		return []*armmonitor.MetricValue{selected}
+	default:
+		// all datapoints are exported, last value wins (lastNonNull)
+		return data
+	}
+}
+
+// parseTimespanStart parses the start of a response timespan (eg. 2024-01-01T00:00:00Z/2024-01-01T01:00:00Z)
+func parseTimespanStart(timespan string) (time.Time, bool) {
+	start, _, found := strings.Cut(timespan, "/")
+	if !found {
+		return time.Time{}, false
+	}
+
+	startTime, err := time.Parse(time.RFC3339, start)
+	return startTime, err == nil
+}
+
+// dropIncompleteInterval removes the datapoints of intervals which are not finished yet (timestamp + interval after now),
+// data is unchanged if the interval (grain) is unknown
+func dropIncompleteInterval(data []*armmonitor.MetricValue, interval string, now time.Time) []*armmonitor.MetricValue {
+	grain, err := iso8601.FromString(interval)
+	if err != nil || grain.ToDuration() <= 0 {
+		return data
+	}
+
+	for len(data) >= 1 {
+		datapoint := data[len(data)-1]
+		if datapoint == nil || datapoint.TimeStamp == nil || !datapoint.TimeStamp.Add(grain.ToDuration()).After(now) {
+			break
+		}
+		data = data[:len(data)-1]
+	}
+
+	return data
+}
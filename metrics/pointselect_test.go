@@ -0,0 +1,202 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/utils/to"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func TestParsePointSelect(t *testing.T) {
+	testCases := []struct {
+		query          string
+		expectedMode   string
+		expectedOffset time.Duration
+		expectedError  string
+	}{
+		{"", "", 0, ""},
+		{"pointSelect=first", PointSelectFirst, 0, ""},
+		{"pointSelect=last", PointSelectLast, 0, ""},
+		{"pointSelect=lastNonNull", PointSelectLastNonNull, 0, ""},
+		{"pointSelect=atOffset:PT30M", PointSelectAtOffset, 30 * time.Minute, ""},
+		{"pointSelect=atOffset:PT1H", PointSelectAtOffset, time.Hour, ""},
+		{"pointSelect=atOffset:PT2H", "", 0, `offset "PT2H" exceeds the timespan "PT1H"`},
+		{"pointSelect=atOffset:30m", "", 0, `invalid offset "30m"`},
+		{"pointSelect=last:PT30M", "", 0, `with "last" doesn't support an offset`},
+		{"pointSelect=nearest", "", 0, `parameter "pointSelect" must be`},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.query, func(t *testing.T) {
+			settings, err := newTestRequestMetricSettings(testCase.query, config.Opts{})
+			if testCase.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+					t.Errorf("expected error %q, got %v", testCase.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if settings.PointSelect != testCase.expectedMode {
+				t.Errorf("expected mode %q, got %q", testCase.expectedMode, settings.PointSelect)
+			}
+			if settings.PointSelectOffset != testCase.expectedOffset {
+				t.Errorf("expected offset %v, got %v", testCase.expectedOffset, settings.PointSelectOffset)
+			}
+		})
+	}
+}
+
+func TestSelectDatapoints(t *testing.T) {
+	// gapped timeseries: values at minute 0 and 2, empty buckets at minute 1 and 3
+	timestamps := []time.Time{}
+	for i := 0; i < 4; i++ {
+		timestamps = append(timestamps, time.Date(2024, 1, 1, 0, i, 0, 0, time.UTC))
+	}
+	data := []*armmonitor.MetricValue{
+		{TimeStamp: &timestamps[0], Average: to.Float64Ptr(1)},
+		{TimeStamp: &timestamps[1]},
+		{TimeStamp: &timestamps[2], Average: to.Float64Ptr(3)},
+		{TimeStamp: &timestamps[3]},
+	}
+	timespan := "2024-01-01T00:00:00Z/2024-01-01T00:04:00Z"
+
+	testCases := []struct {
+		name      string
+		mode      string
+		offset    time.Duration
+		timespan  string
+		expected  float64
+		noValue   bool
+		timestamp time.Time
+	}{
+		{name: "lastNonNull", mode: PointSelectLastNonNull, timespan: timespan, expected: 3, timestamp: timestamps[2]},
+		{name: "default", mode: "", timespan: timespan, expected: 3, timestamp: timestamps[2]},
+		{name: "first", mode: PointSelectFirst, timespan: timespan, expected: 1, timestamp: timestamps[0]},
+		{name: "last", mode: PointSelectLast, timespan: timespan, noValue: true},
+		{name: "atOffset", mode: PointSelectAtOffset, offset: 2 * time.Minute, timespan: timespan, expected: 3, timestamp: timestamps[2]},
+		{name: "atOffset nearest", mode: PointSelectAtOffset, offset: 10 * time.Second, timespan: timespan, expected: 1, timestamp: timestamps[0]},
+		{name: "atOffset gap", mode: PointSelectAtOffset, offset: 70 * time.Second, timespan: timespan, noValue: true},
+		{name: "atOffset without timespan", mode: PointSelectAtOffset, offset: 2 * time.Minute, noValue: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			settings := &RequestMetricSettings{Name: "azurerm_resource_metric", PointSelect: testCase.mode, PointSelectOffset: testCase.offset}
+			prober := newTestProber(config.Opts{}, settings)
+
+			channel := make(chan PrometheusMetricResult, 100)
+			result := AzureInsightBaseMetricsResult{prober: prober}
+			result.sendDatapoints(channel, prometheus.Labels{}, data, to.StringPtr(testCase.timespan), to.StringPtr("PT1M"), []string{"average"}, testNullHandlingResourceId, "Transactions", "")
+			close(channel)
+
+			// last value of the series wins
+			var metric *PrometheusMetricResult
+			for row := range channel {
+				metric = &row
+			}
+
+			if testCase.noValue {
+				if metric != nil {
+					t.Errorf("expected no value, got %v", metric.Value)
+				}
+				return
+			}
+
+			if metric == nil {
+				t.Fatalf("expected value %v, got none", testCase.expected)
+			}
+			if metric.Value != testCase.expected {
+				t.Errorf("expected value %v, got %v", testCase.expected, metric.Value)
+			}
+			if !metric.Timestamp.Equal(testCase.timestamp) {
+				t.Errorf("expected timestamp %v, got %v", testCase.timestamp, metric.Timestamp)
+			}
+		})
+	}
+}
+
+func TestDropIncompleteInterval(t *testing.T) {
+	now := time.Date(2024, 1, 1, 1, 0, 30, 0, time.UTC)
+
+	timestamps := []time.Time{}
+	for i := 0; i < 3; i++ {
+		timestamps = append(timestamps, time.Date(2024, 1, 1, 0, 58+i, 0, 0, time.UTC))
+	}
+	data := []*armmonitor.MetricValue{
+		{TimeStamp: &timestamps[0], Average: to.Float64Ptr(1)},
+		{TimeStamp: &timestamps[1], Average: to.Float64Ptr(2)},
+		{TimeStamp: &timestamps[2], Average: to.Float64Ptr(3)},
+	}
+
+	testCases := []struct {
+		name     string
+		data     []*armmonitor.MetricValue
+		interval string
+		expected int
+	}{
+		{"latest interval not finished", data, "PT1M", 2},
+		{"larger interval", data, "PT5M", 0},
+		{"finished intervals", data[:2], "PT1M", 2},
+		{"unknown interval", data, "", 3},
+		{"invalid interval", data, "1m", 3},
+		{"without timestamp", append(data[:2:2], &armmonitor.MetricValue{Average: to.Float64Ptr(3)}), "PT1M", 3},
+		{"empty", []*armmonitor.MetricValue{}, "PT1M", 0},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ret := dropIncompleteInterval(testCase.data, testCase.interval, now)
+			if len(ret) != testCase.expected {
+				t.Errorf("expected %v datapoints, got %v", testCase.expected, len(ret))
+			}
+		})
+	}
+}
+
+func TestSelectDatapointsDropIncompleteInterval(t *testing.T) {
+	// latest datapoint is still within its interval
+	now := time.Now().UTC().Truncate(time.Minute)
+	timestamps := []time.Time{now.Add(-2 * time.Minute), now.Add(-time.Minute), now}
+	data := []*armmonitor.MetricValue{
+		{TimeStamp: &timestamps[0], Average: to.Float64Ptr(1)},
+		{TimeStamp: &timestamps[1], Average: to.Float64Ptr(2)},
+		{TimeStamp: &timestamps[2], Average: to.Float64Ptr(3)},
+	}
+
+	testCases := []struct {
+		name     string
+		enabled  bool
+		mode     string
+		expected float64
+	}{
+		{"disabled", false, PointSelectLast, 3},
+		{"enabled", true, PointSelectLast, 2},
+		{"enabled lastNonNull", true, PointSelectLastNonNull, 2},
+		{"enabled first", true, PointSelectFirst, 1},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			conf := config.Opts{}
+			conf.Prober.DropIncompleteInterval = testCase.enabled
+			prober := newTestProber(conf, &RequestMetricSettings{Name: "azurerm_resource_metric", PointSelect: testCase.mode})
+
+			result := AzureInsightBaseMetricsResult{prober: prober}
+			selected := result.selectDatapoints(data, nil, to.StringPtr("PT1M"))
+			if len(selected) == 0 {
+				t.Fatalf("expected value %v, got none", testCase.expected)
+			}
+			if value := *selected[len(selected)-1].Average; value != testCase.expected {
+				t.Errorf("expected value %v, got %v", testCase.expected, value)
+			}
+		})
+	}
+}
@@ -2,15 +2,17 @@ package metrics
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armsubscriptions"
 	"github.com/Azure/go-autorest/autorest/azure"
-	"github.com/patrickmn/go-cache"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/remeh/sizedwaitgroup"
 	"github.com/webdevops/go-common/azuresdk/armclient"
@@ -42,14 +44,24 @@ type (
 		logger *zap.SugaredLogger
 
 		metricsCache struct {
-			cache         *cache.Cache
+			cache         Cache
 			cacheKey      *string
 			cacheDuration *time.Duration
+			fetchStart    time.Time
+			refresh       bool
+			refreshLock   bool
+			hit           bool
 		}
 
 		serviceDiscoveryCache struct {
-			cache         *cache.Cache
+			cache         Cache
 			cacheDuration *time.Duration
+			hit           atomic.Bool
+		}
+
+		metricDefinitionsCache struct {
+			cache         Cache
+			cacheDuration time.Duration
 		}
 
 		targets map[string][]MetricProbeTarget
@@ -61,6 +73,35 @@ type (
 		}
 
 		callbackSubscriptionFishish func(subscriptionId string)
+		callbackRequestResult       func(subscriptionId, result string)
+
+		rawResponses rawMetricsResponseCapture
+
+		staleSeries struct {
+			cache    Cache
+			cacheKey string
+
+			// failed targets (lowercased resource ids) and subscriptions, only their series are marked stale
+			lock                sync.Mutex
+			failedTargets       map[string]bool
+			failedSubscriptions map[string]bool
+		}
+
+		// distinct values per dimension label of the fetched series (before dimensionTopN), cached with the metrics
+		dimensionCardinality map[string]int
+
+		failedRequests atomic.Int64
+		probeErrors    struct {
+			lock          sync.Mutex
+			reasons       map[string]bool
+			subscriptions map[string]map[string]bool
+		}
+
+		// primary aggregations of the metrics by resource type (null handling without requested aggregations)
+		primaryAggregations struct {
+			lock           sync.Mutex
+			byResourceType map[string]map[string]string
+		}
 
 		ServiceDiscovery AzureServiceDiscovery
 	}
@@ -70,6 +111,15 @@ type (
 		Metrics      []string
 		Aggregations []string
 		Tags         map[string]string
+
+		// location of the resource (only known for discovered resources)
+		Location string
+	}
+
+	MetricProbeRequest struct {
+		Metrics             []string
+		Aggregations        []string
+		FallbackAggregation bool
 	}
 )
 
@@ -110,17 +160,28 @@ func (p *MetricProber) SetAzureResourceTagManager(client *armclient.ResourceTagM
 	p.AzureResourceTagManager = client
 }
 
-func (p *MetricProber) EnableMetricsCache(cache *cache.Cache, cacheKey string, cacheDuration *time.Duration) {
+func (p *MetricProber) GetMetricList() *MetricList {
+	return p.metricList
+}
+
+func (p *MetricProber) EnableMetricsCache(cache Cache, cacheKey string, cacheDuration *time.Duration) {
 	p.metricsCache.cache = cache
 	p.metricsCache.cacheKey = &cacheKey
 	p.metricsCache.cacheDuration = cacheDuration
 }
 
-func (p *MetricProber) EnableServiceDiscoveryCache(cache *cache.Cache, cacheDuration *time.Duration) {
+func (p *MetricProber) EnableServiceDiscoveryCache(cache Cache, cacheDuration *time.Duration) {
 	p.serviceDiscoveryCache.cache = cache
 	p.serviceDiscoveryCache.cacheDuration = cacheDuration
 }
 
+// EnableMetricDefinitionsCache enables a dedicated (long lived) cache for metric definitions,
+// otherwise metric definitions are cached in the service discovery cache
+func (p *MetricProber) EnableMetricDefinitionsCache(cache Cache, cacheDuration time.Duration) {
+	p.metricDefinitionsCache.cache = cache
+	p.metricDefinitionsCache.cacheDuration = cacheDuration
+}
+
 func (p *MetricProber) AddTarget(targets ...MetricProbeTarget) {
 	for _, target := range targets {
 		resourceInfo, err := azure.ParseResourceID(target.ResourceId)
@@ -143,9 +204,35 @@ func (p *MetricProber) FetchFromCache() bool {
 		return false
 	}
 
-	if val, ok := p.metricsCache.cache.Get(*p.metricsCache.cacheKey); ok {
-		p.metricList = val.(*MetricList)
+	p.metricsCache.fetchStart = time.Now()
+
+	switch p.settings.CacheMode {
+	case CacheModeFresh, CacheModeStaleOnError:
+		// always fetch metrics, cache is only populated (or used on errors)
+		p.metricsCache.refresh = true
+		return false
+	}
+
+	val, ok := p.metricsCache.cache.Get(*p.metricsCache.cacheKey)
+	countCacheRequest(CacheNameMetrics, ok)
+	if ok {
+		entry := val.(*metricsCacheEntry)
+
+		// only one request refreshes the entry early, all others still use the cached metrics
+		if entry.shouldRefresh(p.Conf.Prober.CacheXFetchBeta) && p.acquireCacheRefresh(entry) {
+			p.logger.Debugf("refreshing cache entry before expiry (expires %s)", entry.expiry.Format(time.RFC3339))
+			p.metricsCache.refresh = true
+			return false
+		}
+
+		p.metricList = entry.metricList
+		p.metricsCache.hit = true
+		p.restoreProbeErrors(entry)
+		p.dimensionCardinality = entry.dimensionCardinality
 		p.publishMetricList()
+		p.publishCacheStatus()
+		p.publishProbeErrors()
+		p.publishDimensionCardinality()
 		return true
 	}
 
@@ -157,34 +244,130 @@ func (p *MetricProber) SaveToCache() {
 		return
 	}
 
+	// metrics of a cancelled probe (eg. after the write deadline response) are incomplete
+	if p.ctx.Err() != nil {
+		p.releaseCacheRefresh()
+		return
+	}
+
 	if p.metricsCache.cacheDuration != nil {
-		_ = p.metricsCache.cache.Add(*p.metricsCache.cacheKey, p.metricList, *p.metricsCache.cacheDuration)
-		p.response.Header().Add("X-metrics-cached-until", time.Now().Add(*p.metricsCache.cacheDuration).Format(time.RFC3339))
+		// spread expiry of entries created at the same time
+		cacheDuration := jitterCacheDuration(*p.metricsCache.cacheDuration, p.Conf.Cache.TTLJitter)
+
+		entry := &metricsCacheEntry{
+			metricList:           p.metricList,
+			delta:                time.Since(p.metricsCache.fetchStart),
+			expiry:               time.Now().Add(cacheDuration),
+			dimensionCardinality: p.dimensionCardinality,
+		}
+		p.saveProbeErrors(entry)
+
+		if p.metricsCache.refresh {
+			p.metricsCache.cache.Set(*p.metricsCache.cacheKey, entry, cacheDuration)
+		} else {
+			_ = p.metricsCache.cache.Add(*p.metricsCache.cacheKey, entry, cacheDuration)
+		}
+
+		// only successful probes are used as fallback
+		if p.settings.CacheMode == CacheModeStaleOnError && !p.Failed() {
+			p.metricsCache.cache.Set(*p.metricsCache.cacheKey+":stale", entry, CacheStaleOnErrorDuration)
+		}
+		p.response.Header().Add("X-metrics-cached-until", entry.expiry.Format(time.RFC3339))
 	}
+
+	p.releaseCacheRefresh()
 }
 
-func (p *MetricProber) Run() {
+// Run collects the metrics of the targets and publishes them, nothing is published if an error is returned
+func (p *MetricProber) Run() error {
+	defer p.releaseCacheRefresh()
+
+	if p.settings.ValidateMetricNamespace && p.settings.MetricNamespace != "" {
+		if err := p.validateMetricNamespace(); err != nil {
+			return err
+		}
+	}
+
+	if p.settings.Autodiscover {
+		p.autodiscoverTargetMetrics()
+	}
 	p.collectMetricsFromTargets()
-	p.SaveToCache()
-	p.publishMetricList()
+	if p.settings.IncludeDimensions {
+		p.collectMetricDimensionsFromTargets()
+	}
+	return p.finishRun()
 }
 
-func (p *MetricProber) RunOnSubscriptionScope() {
+// RunOnSubscriptionScope collects the metrics of the subscriptions and publishes them, nothing is published if an error is returned
+func (p *MetricProber) RunOnSubscriptionScope() error {
+	defer p.releaseCacheRefresh()
+
 	p.collectMetricsFromSubscriptions()
-	p.SaveToCache()
+	return p.finishRun()
+}
+
+// finishRun processes, caches and publishes the collected metrics
+func (p *MetricProber) finishRun() error {
+	p.dimensionCardinality = p.DimensionCardinality()
+	p.postProcessMetricList()
+	if err := p.checkDimensionCardinality(); err != nil {
+		return err
+	}
+	if !p.fetchFromStaleCache() {
+		// metrics of a timed out probe are incomplete and must not be cached
+		if err := p.ctx.Err(); errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("probe exceeded its timeout: %w", err)
+		}
+		p.applyStaleSeries()
+		p.SaveToCache()
+	}
 	p.publishMetricList()
+	p.publishCacheStatus()
+	p.publishProbeErrors()
+	p.publishDimensionCardinality()
+	return nil
+}
+
+// postProcessMetricList processes the collected metrics before they are cached and published
+func (p *MetricProber) postProcessMetricList() {
+	if p.settings.DimensionLowercase {
+		p.deduplicateDimensionValues()
+	}
+	p.resolveDimensionValues()
+
+	if p.settings.DimensionTopN > 0 {
+		for _, metricName := range p.metricList.GetMetricNames() {
+			if metricName == PrometheusMetricDimensionName || metricName == PrometheusMetricTimestampName {
+				continue
+			}
+			p.metricList.LimitDimensionSeries(metricName, p.settings.DimensionTopN)
+		}
+	}
+
+	p.metricList.SanitizeLabelValues(p.Conf.Metrics.Labels.SanitizeValues)
+	p.metricList.FilterLabels(p.Conf.Metrics.Labels.Keep, p.Conf.Metrics.Labels.Drop)
 }
 
 func (p *MetricProber) collectMetricsFromSubscriptions() {
 	metricsChannel := make(chan PrometheusMetricResult)
 
 	subscriptionIterator := armclient.NewSubscriptionIterator(p.AzureClient, p.settings.Subscriptions...)
-	subscriptionIterator.SetConcurrency(p.Conf.Prober.ConcurrencySubscription)
+	subscriptionIterator.SetConcurrency(EffectiveConcurrency(p.Conf.Prober.ConcurrencySubscription))
 
 	go func() {
-		regions, err := p.discoverResourceRegions()
+		var regions map[string][]string
+		var taggedResourceIds map[string]map[string][]string
+		var err error
+		if len(p.settings.TagFilters) >= 1 {
+			// only query resources matching the tag filters
+			regions, taggedResourceIds, err = p.discoverTaggedResources()
+		} else {
+			regions, err = p.discoverResourceRegions()
+		}
 		if err != nil {
 			p.logger.Error(fmt.Errorf("error getting subscription locations: %w", err))
+			p.reportProbeError(ClassifyGraphError(err))
+			p.markSubscriptionsFailed(p.settings.Subscriptions...)
 			return
 		}
 
@@ -196,60 +379,79 @@ func (p *MetricProber) collectMetricsFromSubscriptions() {
 				if err != nil {
 					// FIXME: find a better way to report errors
 					p.logger.Error(err)
+					p.reportSubscriptionError(*subscription.SubscriptionID, err)
 					return
 				}
 
-				// request metrics in 20 metrics chunks (azure metric api limitation)
-				for i := 0; i < len(p.settings.Metrics); i += AzureMetricApiMaxMetricNumber {
-					end := i + AzureMetricApiMaxMetricNumber
-					if end > len(p.settings.Metrics) {
-						end = len(p.settings.Metrics)
-					}
-					metricList := p.settings.Metrics[i:end]
-
-					resultType := armmonitor.MetricResultTypeData
-					opts := armmonitor.MetricsClientListAtSubscriptionScopeOptions{
-						Interval:            p.settings.Interval,
-						Timespan:            to.StringPtr(p.settings.Timespan),
-						Metricnames:         to.StringPtr(strings.Join(metricList, ",")),
-						Metricnamespace:     to.StringPtr(p.settings.ResourceType),
-						Top:                 p.settings.MetricTop,
-						AutoAdjustTimegrain: to.BoolPtr(true),
-						ResultType:          &resultType,
-						ValidateDimensions:  to.BoolPtr(p.settings.ValidateDimensions),
-						Filter:              to.StringPtr(`Microsoft.ResourceId eq '*'`),
-					}
+				resourceFilterList := []string{`Microsoft.ResourceId eq '*'`}
+				if taggedResourceIds != nil {
+					resourceFilterList = resourceIdFilters(taggedResourceIds[*subscription.SubscriptionID][region])
+				}
 
-					if len(p.settings.Aggregations) >= 1 {
-						opts.Aggregation = to.StringPtr(strings.Join(p.settings.Aggregations, ","))
-					}
+				for _, resourceFilter := range resourceFilterList {
+					// request metrics in 20 metrics chunks (azure metric api limitation)
+					for i := 0; i < len(p.settings.Metrics); i += AzureMetricApiMaxMetricNumber {
+						end := i + AzureMetricApiMaxMetricNumber
+						if end > len(p.settings.Metrics) {
+							end = len(p.settings.Metrics)
+						}
+						metricList := p.settings.Metrics[i:end]
+
+						resultType := armmonitor.MetricResultTypeData
+						opts := armmonitor.MetricsClientListAtSubscriptionScopeOptions{
+							Interval:            p.intervalForResourceType(p.settings.ResourceType),
+							Timespan:            to.StringPtr(p.settings.Timespan),
+							Metricnames:         to.StringPtr(strings.Join(metricList, ",")),
+							Metricnamespace:     to.StringPtr(p.settings.ResourceType),
+							Top:                 p.settings.MetricTop,
+							AutoAdjustTimegrain: to.BoolPtr(p.settings.AutoAdjustTimegrain),
+							ResultType:          &resultType,
+							ValidateDimensions:  to.BoolPtr(p.settings.ValidateDimensions),
+							Filter:              to.StringPtr(resourceFilter),
+						}
 
-					if len(p.settings.MetricFilter) >= 1 {
-						opts.Filter = to.StringPtr(*opts.Filter + " and " + p.settings.MetricFilter)
-					}
+						if len(p.settings.Aggregations) >= 1 {
+							opts.Aggregation = to.StringPtr(strings.Join(p.settings.Aggregations, ","))
+						}
 
-					if len(p.settings.MetricOrderBy) >= 1 {
-						opts.Orderby = to.StringPtr(p.settings.MetricOrderBy)
-					}
+						if len(p.settings.MetricFilter) >= 1 {
+							// resource filter of tagged resources is a list of "or" conditions
+							opts.Filter = to.StringPtr("(" + *opts.Filter + ") and (" + p.settings.MetricFilter + ")")
+						}
 
-					if len(p.settings.MetricNamespace) >= 1 {
-						opts.Metricnamespace = to.StringPtr(p.settings.MetricNamespace)
-					}
+						if len(p.settings.MetricOrderBy) >= 1 {
+							opts.Orderby = to.StringPtr(p.settings.MetricOrderBy)
+						}
 
-					response, err := client.ListAtSubscriptionScope(p.ctx, region, &opts)
-					if err != nil {
-						// FIXME: find a better way to report errors
-						p.logger.Error(err)
-						return
-					}
+						if len(p.settings.MetricNamespace) >= 1 {
+							opts.Metricnamespace = to.StringPtr(p.settings.MetricNamespace)
+						}
 
-					result := AzureInsightSubscriptionMetricsResult{
-						AzureInsightBaseMetricsResult: AzureInsightBaseMetricsResult{
-							prober: p,
-						},
-						subscription: subscription,
-						Result:       &response}
-					result.SendMetricToChannel(metricsChannel)
+						var response armmonitor.MetricsClientListAtSubscriptionScopeResponse
+						err = p.withRetry(p.ctx, func() (err error) {
+							startTime := time.Now()
+							response, err = client.ListAtSubscriptionScope(p.ctx, region, &opts)
+							observeApiRequest(ApiOperationListMetricsSubscription, *subscription.SubscriptionID, startTime, err)
+							return err
+						})
+						p.reportRequestResult(*subscription.SubscriptionID, err)
+						if err != nil {
+							// FIXME: find a better way to report errors
+							p.logger.Error(err)
+							p.reportSubscriptionError(*subscription.SubscriptionID, err)
+							return
+						}
+
+						result := AzureInsightSubscriptionMetricsResult{
+							AzureInsightBaseMetricsResult: AzureInsightBaseMetricsResult{
+								prober: p,
+							},
+							subscription: subscription,
+							region:       region,
+							interval:     opts.Interval,
+							Result:       &response}
+						result.SendMetricToChannel(metricsChannel)
+					}
 				}
 
 				if p.callbackSubscriptionFishish != nil {
@@ -260,6 +462,7 @@ func (p *MetricProber) collectMetricsFromSubscriptions() {
 		if err != nil {
 			// FIXME: find a better way to report errors
 			p.logger.Error(err)
+			p.reportProbeError(ClassifyProbeError(err))
 		}
 
 		close(metricsChannel)
@@ -267,8 +470,10 @@ func (p *MetricProber) collectMetricsFromSubscriptions() {
 
 	for result := range metricsChannel {
 		metric := MetricRow{
-			Labels: result.Labels,
-			Value:  result.Value,
+			Labels:    result.Labels,
+			Value:     result.Value,
+			Timestamp: result.Timestamp,
+			seriesKey: result.seriesKey,
 		}
 		p.metricList.Add(result.Name, metric)
 		p.metricList.SetMetricHelp(result.Name, result.Help)
@@ -292,10 +497,7 @@ func (p *MetricProber) discoverResourceRegions() (map[string][]string, error) {
 
 	query := fmt.Sprintf(`Resources | where type == "%s" | summarize count() by subscriptionId, location`, strings.ToLower(p.settings.ResourceType))
 
-	opts := armclient.ResourceGraphOptions{
-		Subscriptions: p.settings.Subscriptions,
-	}
-	results, err := p.AzureClient.ExecuteResourceGraphQuery(p.ctx, query, opts)
+	results, err := p.ServiceDiscovery.QueryResourceGraph(query, p.settings.Subscriptions)
 	if err != nil {
 		return nil, err
 	}
@@ -313,7 +515,7 @@ func (p *MetricProber) discoverResourceRegions() (map[string][]string, error) {
 func (p *MetricProber) collectMetricsFromTargets() {
 	metricsChannel := make(chan PrometheusMetricResult)
 
-	wgSubscription := sizedwaitgroup.New(p.Conf.Prober.ConcurrencySubscription)
+	wgSubscription := sizedwaitgroup.New(EffectiveConcurrency(p.Conf.Prober.ConcurrencySubscription))
 
 	go func() {
 		for subscriptionId, resourceList := range p.targets {
@@ -321,31 +523,51 @@ func (p *MetricProber) collectMetricsFromTargets() {
 			go func(subscriptionId string, targetList []MetricProbeTarget) {
 				defer wgSubscription.Done()
 
-				wgSubscriptionResource := sizedwaitgroup.New(p.Conf.Prober.ConcurrencySubscriptionResource)
+				wgSubscriptionResource := sizedwaitgroup.New(p.concurrencyForSubscription(subscriptionId))
 				client, err := p.MetricsClient(subscriptionId)
 				if err != nil {
 					// FIXME: find a better way to report errors
 					p.logger.Error(err)
+					p.reportSubscriptionError(subscriptionId, err)
 					return
 				}
 
+				// requests fetched by the metrics batch API
+				batchRequests := map[string]bool{}
+				if p.Conf.Metrics.Batch.Enabled {
+					batchRequests = p.collectMetricsBatch(subscriptionId, targetList, metricsChannel)
+				}
+
 				for _, target := range targetList {
 					wgSubscriptionResource.Add()
 					go func(target MetricProbeTarget) {
 						defer wgSubscriptionResource.Done()
 
-						// request metrics in 20 metrics chunks (azure metric api limitation)
-						for i := 0; i < len(target.Metrics); i += AzureMetricApiMaxMetricNumber {
-							end := i + AzureMetricApiMaxMetricNumber
-							if end > len(target.Metrics) {
-								end = len(target.Metrics)
+						for _, request := range p.buildTargetMetricRequests(target) {
+							if batchRequests[batchRequestKey(target, request)] {
+								continue
 							}
-							metricList := target.Metrics[i:end]
 
-							if result, err := p.FetchMetricsFromTarget(client, target, metricList, target.Aggregations); err == nil {
-								result.SendMetricToChannel(metricsChannel)
-							} else {
-								p.logger.With(zap.String("resourceID", target.ResourceId)).Warn(err)
+							// request metrics in 20 metrics chunks (azure metric api limitation)
+							for i := 0; i < len(request.Metrics); i += AzureMetricApiMaxMetricNumber {
+								end := i + AzureMetricApiMaxMetricNumber
+								if end > len(request.Metrics) {
+									end = len(request.Metrics)
+								}
+								metricList := request.Metrics[i:end]
+
+								// one request per window (requested timespan and compareOffsets)
+								for _, window := range p.metricWindows() {
+									result, err := p.FetchMetricsFromTarget(client, target, metricList, request.Aggregations, window)
+									p.reportRequestResult(subscriptionId, err)
+									if err == nil {
+										result.fallbackAggregation = request.FallbackAggregation
+										result.SendMetricToChannel(metricsChannel)
+									} else {
+										p.logger.With(zap.String("resourceID", target.ResourceId)).Warn(err)
+										p.reportTargetError(subscriptionId, target.ResourceId, err)
+									}
+								}
 							}
 						}
 					}(target)
@@ -363,14 +585,95 @@ func (p *MetricProber) collectMetricsFromTargets() {
 
 	for result := range metricsChannel {
 		metric := MetricRow{
-			Labels: result.Labels,
-			Value:  result.Value,
+			Labels:    result.Labels,
+			Value:     result.Value,
+			Timestamp: result.Timestamp,
+			seriesKey: result.seriesKey,
 		}
 		p.metricList.Add(result.Name, metric)
 		p.metricList.SetMetricHelp(result.Name, result.Help)
 	}
 }
 
+// buildTargetMetricRequests groups the metrics of a target by aggregation
+// if aggregation fallback is enabled, metrics not supporting the requested aggregations are requested
+// with their primary aggregation instead of failing the whole request
+func (p *MetricProber) buildTargetMetricRequests(target MetricProbeTarget) []MetricProbeRequest {
+	request := MetricProbeRequest{
+		Metrics:      target.Metrics,
+		Aggregations: target.Aggregations,
+	}
+
+	if !p.Conf.Prober.AggregationFallback || len(target.Aggregations) == 0 || len(target.Metrics) == 0 {
+		return []MetricProbeRequest{request}
+	}
+
+	definitionList, err := p.FetchMetricDefinitions(target.ResourceId)
+	if err != nil {
+		p.logger.With(zap.String("resourceID", target.ResourceId)).Warnf("unable to check supported aggregations: %v", err)
+		return []MetricProbeRequest{request}
+	}
+
+	definitionMap := map[string]MetricDefinition{}
+	for _, definition := range definitionList {
+		definitionMap[strings.ToLower(definition.Name)] = definition
+	}
+
+	requestList := []MetricProbeRequest{}
+	request.Metrics = []string{}
+	fallbackRequests := map[string]*MetricProbeRequest{}
+	for _, metricName := range target.Metrics {
+		definition, exists := definitionMap[strings.ToLower(metricName)]
+		if !exists || definition.PrimaryAggregation == "" {
+			request.Metrics = append(request.Metrics, metricName)
+			continue
+		}
+
+		supported := true
+		for _, aggregation := range target.Aggregations {
+			if !stringListContainsFold(definition.SupportedAggregations, aggregation) {
+				supported = false
+				break
+			}
+		}
+
+		if supported {
+			request.Metrics = append(request.Metrics, metricName)
+		} else {
+			p.logger.With(zap.String("resourceID", target.ResourceId)).Debugf(
+				`metric "%s" doesn't support aggregation "%s", using "%s" instead`,
+				metricName,
+				strings.Join(target.Aggregations, ","),
+				definition.PrimaryAggregation,
+			)
+
+			if _, exists := fallbackRequests[definition.PrimaryAggregation]; !exists {
+				fallbackRequests[definition.PrimaryAggregation] = &MetricProbeRequest{
+					Aggregations:        []string{definition.PrimaryAggregation},
+					FallbackAggregation: true,
+				}
+			}
+			fallbackRequests[definition.PrimaryAggregation].Metrics = append(fallbackRequests[definition.PrimaryAggregation].Metrics, metricName)
+		}
+	}
+
+	if len(request.Metrics) >= 1 {
+		requestList = append(requestList, request)
+	}
+
+	for _, fallbackRequest := range fallbackRequests {
+		requestList = append(requestList, *fallbackRequest)
+	}
+
+	return requestList
+}
+
+// concurrencyForSubscription returns the resource concurrency for a subscription (with fallback to global default),
+// limited by the concurrency ramp-up
+func (p *MetricProber) concurrencyForSubscription(subscriptionId string) int {
+	return EffectiveConcurrency(ResourceConcurrencyForSubscription(p.Conf, subscriptionId))
+}
+
 func (p *MetricProber) publishMetricList() {
 	if p.metricList == nil {
 		return
@@ -378,17 +681,27 @@ func (p *MetricProber) publishMetricList() {
 
 	// create prometheus metrics and set rows
 	for _, metricName := range p.metricList.GetMetricNames() {
+		labelNames := p.metricList.GetMetricLabelNames(metricName)
 		gauge := prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: metricName,
 				Help: p.metricList.GetMetricHelp(metricName),
 			},
-			p.metricList.GetMetricLabelNames(metricName),
+			labelNames,
 		)
 		p.prometheus.registry.MustRegister(gauge)
 
 		for _, row := range p.metricList.GetMetricList(metricName) {
-			gauge.With(row.Labels).Set(row.Value)
+			labels := row.Labels
+			if len(labels) != len(labelNames) {
+				// ensure all rows have the same labels, otherwise the gauge will panic
+				// (copy labels as rows might be shared via cache)
+				labels = prometheus.Labels{}
+				for _, labelName := range labelNames {
+					labels[labelName] = row.Labels[labelName]
+				}
+			}
+			gauge.With(labels).Set(row.Value)
 		}
 	}
 }
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildTargetMetricRequests(t *testing.T) {
+	resourceId := "/subscriptions/00000000-0000-0000-0000-000000000001/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/sa1"
+	definitionList := []MetricDefinition{
+		{Name: "Transactions", PrimaryAggregation: "total", SupportedAggregations: []string{"total", "average", "minimum", "maximum"}},
+		{Name: "Availability", PrimaryAggregation: "average", SupportedAggregations: []string{"average", "minimum", "maximum"}},
+		{Name: "UsedCapacity", PrimaryAggregation: "average", SupportedAggregations: []string{"average"}},
+	}
+
+	testCases := []struct {
+		name         string
+		fallback     bool
+		metrics      []string
+		aggregations []string
+		// requested metrics by aggregations (fallback requests are marked with "*")
+		expected map[string]string
+	}{
+		{
+			name:         "supported",
+			fallback:     true,
+			metrics:      []string{"Transactions", "Availability"},
+			aggregations: []string{"Average"},
+			expected:     map[string]string{"Average": "Transactions,Availability"},
+		},
+		{
+			name:         "unsupported with fallback",
+			fallback:     true,
+			metrics:      []string{"Transactions", "Availability", "UsedCapacity", "Unknown"},
+			aggregations: []string{"Total"},
+			expected:     map[string]string{"Total": "Transactions,Unknown", "average*": "Availability,UsedCapacity"},
+		},
+		{
+			name:         "unsupported with fallback, no supported metric",
+			fallback:     true,
+			metrics:      []string{"UsedCapacity"},
+			aggregations: []string{"Maximum"},
+			expected:     map[string]string{"average*": "UsedCapacity"},
+		},
+		{
+			name:         "unsupported strict",
+			fallback:     false,
+			metrics:      []string{"Transactions", "UsedCapacity"},
+			aggregations: []string{"Total"},
+			expected:     map[string]string{"Total": "Transactions,UsedCapacity"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			prober := newTestDefinitionsProber(t, nil, resourceId, definitionList)
+			prober.Conf.Prober.AggregationFallback = testCase.fallback
+
+			requestList := prober.buildTargetMetricRequests(MetricProbeTarget{
+				ResourceId:   resourceId,
+				Metrics:      testCase.metrics,
+				Aggregations: testCase.aggregations,
+			})
+
+			ret := map[string]string{}
+			for _, request := range requestList {
+				key := strings.Join(request.Aggregations, ",")
+				if request.FallbackAggregation {
+					key += "*"
+				}
+				ret[key] = strings.Join(request.Metrics, ",")
+			}
+
+			if len(ret) != len(testCase.expected) {
+				t.Errorf("expected requests %v, got %v", testCase.expected, ret)
+			}
+			for aggregation, metrics := range testCase.expected {
+				if ret[aggregation] != metrics {
+					t.Errorf("%s: expected metrics %q, got %q", aggregation, metrics, ret[aggregation])
+				}
+			}
+		})
+	}
+}
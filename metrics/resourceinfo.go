@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/utils/to"
+)
+
+const (
+	PrometheusResourceInfoName = "azurerm_resource_info"
+)
+
+var (
+	resourceInfoProperties = []string{"name", "location", "resourceGroup", "type", "sku", "tags"}
+)
+
+// IsValidResourceInfoProperty checks if the property is supported for azurerm_resource_info
+func IsValidResourceInfoProperty(property string) bool {
+	return stringListContainsFold(resourceInfoProperties, property)
+}
+
+// addResourceInfo adds azurerm_resource_info row for a ResourceGraph result row
+func (sd *AzureServiceDiscovery) addResourceInfo(resourceId string, resultRow map[string]interface{}) {
+	labels := prometheus.Labels{
+		"resourceID": strings.ToLower(resourceId),
+	}
+
+	for _, property := range sd.prober.Conf.Metrics.ResourceInfo.Properties {
+		switch strings.ToLower(property) {
+		case "tags":
+			for tagName, tagValue := range sd.resourceTagsToStringMap(resultRow["tags"]) {
+				labelName := SanitizeLabelName("tag_" + strings.ToLower(tagName))
+				labels[labelName] = tagValue
+			}
+		case "sku":
+			labels["sku"] = ""
+			if sku, ok := resultRow["sku"].(map[string]interface{}); ok {
+				if skuName, ok := sku["name"].(string); ok {
+					labels["sku"] = skuName
+				}
+			}
+		case "resourcegroup":
+			labels["resourceGroup"] = resourceInfoValueToString(resultRow["resourceGroup"])
+		case "type":
+			labels["resourceType"] = resourceInfoValueToString(resultRow["type"])
+		default:
+			labels[strings.ToLower(property)] = resourceInfoValueToString(resultRow[strings.ToLower(property)])
+		}
+	}
+
+	sd.prober.metricList.Add(PrometheusResourceInfoName, MetricRow{Labels: labels, Value: 1})
+	sd.prober.metricList.SetMetricHelp(PrometheusResourceInfoName, "Azure resource information")
+}
+
+func resourceInfoValueToString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case *string:
+		return to.String(v)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
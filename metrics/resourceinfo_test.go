@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func TestAddResourceInfo(t *testing.T) {
+	resourceId := "/subscriptions/00000000-0000-0000-0000-000000000001/resourceGroups/RG/providers/Microsoft.Storage/storageAccounts/SA1"
+	resultRow := map[string]interface{}{
+		"id":            resourceId,
+		"name":          "SA1",
+		"location":      "westeurope",
+		"resourceGroup": "RG",
+		"type":          "microsoft.storage/storageaccounts",
+		"sku":           map[string]interface{}{"name": "Standard_LRS", "tier": "Standard"},
+		"tags":          map[string]interface{}{"Owner": "team", "cost-center": "42"},
+	}
+
+	testCases := []struct {
+		name       string
+		properties []string
+		row        map[string]interface{}
+		expected   prometheus.Labels
+	}{
+		{
+			name:       "no properties",
+			properties: nil,
+			row:        resultRow,
+			expected:   prometheus.Labels{"resourceID": "/subscriptions/00000000-0000-0000-0000-000000000001/resourcegroups/rg/providers/microsoft.storage/storageaccounts/sa1"},
+		},
+		{
+			name:       "all properties",
+			properties: []string{"name", "Location", "resourceGroup", "type", "sku", "tags"},
+			row:        resultRow,
+			expected: prometheus.Labels{
+				"resourceID":      "/subscriptions/00000000-0000-0000-0000-000000000001/resourcegroups/rg/providers/microsoft.storage/storageaccounts/sa1",
+				"name":            "SA1",
+				"location":        "westeurope",
+				"resourceGroup":   "RG",
+				"resourceType":    "microsoft.storage/storageaccounts",
+				"sku":             "Standard_LRS",
+				"tag_owner":       "team",
+				"tag_cost_center": "42",
+			},
+		},
+		{
+			name:       "missing properties",
+			properties: []string{"location", "sku"},
+			row:        map[string]interface{}{"id": resourceId},
+			expected: prometheus.Labels{
+				"resourceID": "/subscriptions/00000000-0000-0000-0000-000000000001/resourcegroups/rg/providers/microsoft.storage/storageaccounts/sa1",
+				"location":   "",
+				"sku":        "",
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			conf := config.Opts{}
+			conf.Metrics.ResourceInfo.Properties = testCase.properties
+			prober := newTestProber(conf, nil)
+
+			prober.ServiceDiscovery.addResourceInfo(resourceId, testCase.row)
+
+			rows := prober.metricList.GetMetricList(PrometheusResourceInfoName)
+			if len(rows) != 1 {
+				t.Fatalf("expected 1 series, got %v", rows)
+			}
+			if !reflect.DeepEqual(rows[0].Labels, testCase.expected) || rows[0].Value != 1 {
+				t.Errorf("expected labels %v, got %v (value %v)", testCase.expected, rows[0].Labels, rows[0].Value)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/azuresdk/armclient"
+)
+
+const (
+	ResourceLabelLocation      = "location"
+	ResourceLabelResourceGroup = "resourceGroup"
+	ResourceLabelResourceType  = "resourceType"
+)
+
+var (
+	resourceLabelFields = []string{ResourceLabelLocation, ResourceLabelResourceGroup, ResourceLabelResourceType}
+)
+
+// ParseResourceLabels parses the resource metadata fields of --metrics.resource-labels (comma or space delimiter)
+// and returns them with their label names
+func ParseResourceLabels(values []string) ([]string, error) {
+	fields := []string{}
+	for _, value := range values {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+
+			i := slices.IndexFunc(resourceLabelFields, func(name string) bool {
+				return strings.EqualFold(name, field)
+			})
+			if i < 0 {
+				return nil, fmt.Errorf(`invalid resource label "%s" (supported: %s)`, field, strings.Join(resourceLabelFields, ", "))
+			}
+
+			if !slices.Contains(fields, resourceLabelFields[i]) {
+				fields = append(fields, resourceLabelFields[i])
+			}
+		}
+	}
+
+	return fields, nil
+}
+
+// addResourceLabels adds the resource metadata of --metrics.resource-labels as labels, the resource type is taken
+// from the resource id and the location from the service discovery (no additional API requests),
+// unknown fields (eg. location of resources which were not discovered) are added as empty labels
+func (p *MetricProber) addResourceLabels(labels prometheus.Labels, azureResource *armclient.AzureResourceInfo, location string) prometheus.Labels {
+	for _, field := range p.Conf.Metrics.Labels.Resource {
+		value := ""
+		switch field {
+		case ResourceLabelLocation:
+			value = strings.ToLower(strings.ReplaceAll(location, " ", ""))
+		case ResourceLabelResourceGroup:
+			value = azureResource.ResourceGroup
+		case ResourceLabelResourceType:
+			if azureResource.ResourceProviderNamespace != "" && azureResource.ResourceProviderName != "" {
+				value = strings.ToLower(azureResource.ResourceProviderNamespace + "/" + azureResource.ResourceProviderName)
+			}
+		}
+
+		labels[SanitizeLabelName(field)] = value
+	}
+
+	return labels
+}
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"go.uber.org/zap"
+)
+
+// retryBackoff calculates the exponential backoff for a retry attempt (starting with 0)
+//
+// jitter defines the randomized part of the delay (0 = no jitter, 1 = full jitter),
+// with jitter the delay is between (1-jitter)*backoff and backoff
+func retryBackoff(attempt int, base time.Duration, jitter float64) time.Duration {
+	backoff := float64(base) * math.Pow(2, float64(attempt))
+
+	jitter = math.Min(math.Max(jitter, 0), 1)
+	if jitter > 0 {
+		backoff = backoff*(1-jitter) + backoff*jitter*rand.Float64() // #nosec G404
+	}
+
+	return time.Duration(backoff)
+}
+
+// isTransientError checks if the Azure API error is transient and the request can be retried
+func isTransientError(err error) bool {
+	var responseErr *azcore.ResponseError
+	if errors.As(err, &responseErr) {
+		return responseErr.StatusCode >= http.StatusInternalServerError || responseErr.StatusCode == http.StatusRequestTimeout
+	}
+	return false
+}
+
+// isThrottledError checks if the Azure API request was throttled (429)
+func isThrottledError(err error) bool {
+	var responseErr *azcore.ResponseError
+	if errors.As(err, &responseErr) {
+		return responseErr.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// retryAfterDuration returns the delay requested by Azure for a throttled request (0 if not set)
+func retryAfterDuration(err error) time.Duration {
+	var responseErr *azcore.ResponseError
+	if !errors.As(err, &responseErr) || responseErr.RawResponse == nil {
+		return 0
+	}
+	header := responseErr.RawResponse.Header
+
+	for _, headerName := range []string{"retry-after-ms", "x-ms-retry-after-ms"} {
+		if val, err := strconv.ParseInt(header.Get(headerName), 10, 64); err == nil && val > 0 {
+			return time.Duration(val) * time.Millisecond
+		}
+	}
+
+	if val := header.Get("Retry-After"); val != "" {
+		if seconds, err := strconv.ParseInt(val, 10, 64); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		if retryTime, err := http.ParseTime(val); err == nil {
+			return time.Until(retryTime)
+		}
+	}
+
+	return 0
+}
+
+// withRetry runs the callback and retries it on transient and throttled (429) Azure API errors,
+// throttled requests wait at least the Retry-After duration
+func (p *MetricProber) withRetry(ctx context.Context, callback func() error) (err error) {
+	retryConf := p.Conf.Azure.Retry
+	rateLimitConf := p.Conf.Azure.RateLimit
+
+	attempt, throttledAttempt := 0, 0
+	for {
+		err = callback()
+		if err == nil {
+			return nil
+		}
+
+		var delay time.Duration
+		switch {
+		case isThrottledError(err) && throttledAttempt < rateLimitConf.Retries:
+			delay = retryBackoff(throttledAttempt, rateLimitConf.BackoffBase, retryConf.Jitter)
+			if retryAfter := retryAfterDuration(err); retryAfter > delay {
+				delay = retryAfter
+			}
+			throttledAttempt++
+			countThrottledRetry()
+			p.logger.With(zap.Int("attempt", throttledAttempt)).Debugf("Azure API request throttled, retrying in %s: %v", delay.String(), err)
+		case isTransientError(err) && attempt < retryConf.Count:
+			delay = retryBackoff(attempt, retryConf.Backoff, retryConf.Jitter)
+			attempt++
+			p.logger.With(zap.Int("attempt", attempt)).Debugf("transient Azure API error, retrying in %s: %v", delay.String(), err)
+		default:
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// withServiceDiscoveryRetry runs the resource discovery callback and retries it on transient and throttled (429) Azure API errors
+// (--azure.servicediscovery.retries, independent of the retries of metric requests)
+func (p *MetricProber) withServiceDiscoveryRetry(ctx context.Context, callback func() error) (err error) {
+	conf := p.Conf.Azure.ServiceDiscovery
+
+	for attempt := 0; ; attempt++ {
+		err = callback()
+		if err == nil || attempt >= conf.Retries || !(isTransientError(err) || isThrottledError(err)) {
+			return err
+		}
+
+		delay := retryBackoff(attempt, conf.RetryBackoff, p.Conf.Azure.Retry.Jitter)
+		if retryAfter := retryAfterDuration(err); retryAfter > delay {
+			delay = retryAfter
+		}
+		p.logger.With(zap.Int("attempt", attempt+1)).Debugf("resource discovery failed, retrying in %s: %v", delay.String(), err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
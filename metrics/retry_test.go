@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func TestRetryBackoffJitter(t *testing.T) {
+	base := time.Second
+
+	testCases := []struct {
+		name       string
+		attempt    int
+		jitter     float64
+		minBackoff time.Duration
+		maxBackoff time.Duration
+	}{
+		{"no jitter", 0, 0, time.Second, time.Second},
+		{"no jitter, third attempt", 2, 0, 4 * time.Second, 4 * time.Second},
+		{"half jitter", 1, 0.5, time.Second, 2 * time.Second},
+		{"full jitter", 3, 1, 0, 8 * time.Second},
+		{"negative jitter", 1, -1, 2 * time.Second, 2 * time.Second},
+		{"jitter above 1", 1, 2, 0, 2 * time.Second},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			for i := 0; i < 1000; i++ {
+				backoff := retryBackoff(testCase.attempt, base, testCase.jitter)
+				if backoff < testCase.minBackoff || backoff > testCase.maxBackoff {
+					t.Fatalf("expected backoff between %v and %v, got %v", testCase.minBackoff, testCase.maxBackoff, backoff)
+				}
+			}
+		})
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	testCases := []struct {
+		name          string
+		statusCode    int
+		expectedCalls int
+	}{
+		{"transient error", http.StatusServiceUnavailable, 3},
+		{"request timeout", http.StatusRequestTimeout, 3},
+		{"throttled", http.StatusTooManyRequests, 2},
+		{"non transient error", http.StatusNotFound, 1},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			conf := config.Opts{}
+			conf.Azure.Retry.Count = 2
+			conf.Azure.Retry.Backoff = time.Millisecond
+			conf.Azure.Retry.Jitter = 0.5
+			conf.Azure.RateLimit.Retries = 1
+			conf.Azure.RateLimit.BackoffBase = time.Millisecond
+			prober := newTestProber(conf, nil)
+
+			calls := 0
+			err := prober.withRetry(context.Background(), func() error {
+				calls++
+				return newTestResponseError(testCase.statusCode)
+			})
+			if err == nil || calls != testCase.expectedCalls {
+				t.Errorf("expected error after %v calls, got %v calls (err: %v)", testCase.expectedCalls, calls, err)
+			}
+		})
+	}
+}
@@ -5,16 +5,25 @@ import (
 	"crypto/sha1" // #nosec G505
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resourcegraph/armresourcegraph"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/webdevops/go-common/utils/to"
 	"go.uber.org/zap"
 )
 
 const (
 	ResourceGraphQueryTop = 1000
+
+	PrometheusResourceGraphTruncatedName = "azurerm_resourcegraph_truncated"
+	PrometheusServiceDiscoveryStaleName  = "azurerm_servicediscovery_stale"
+
+	// duration the last successful servicediscovery is kept as fallback for failed servicediscoveries
+	ServiceDiscoveryStaleDuration = 6 * time.Hour
 )
 
 type (
@@ -23,91 +32,166 @@ type (
 	}
 
 	AzureResource struct {
-		ID       string
-		Location string
-		Tags     map[string]string
+		ID          string
+		Location    string
+		Tags        map[string]string
+		CreatedTime *time.Time `json:",omitempty"`
 	}
 )
 
 func (sd *AzureServiceDiscovery) ResourcesClient(subscriptionId string) (*armresources.Client, error) {
-	return armresources.NewClient(subscriptionId, sd.prober.AzureClient.GetCred(), sd.prober.AzureClient.NewArmClientOptions())
+	return armresources.NewClient(subscriptionId, sd.prober.GetCred(), sd.prober.NewServiceDiscoveryArmClientOptions())
+}
+
+func (sd *AzureServiceDiscovery) ResourceGraphClient() (*armresourcegraph.Client, error) {
+	return armresourcegraph.NewClient(sd.prober.GetCred(), sd.prober.NewServiceDiscoveryArmClientOptions())
 }
 
 func (sd *AzureServiceDiscovery) publishTargetList(targetList []MetricProbeTarget) {
 	sd.prober.AddTarget(targetList...)
 }
 
+// isResourceTooYoung checks if the resource was created within the minResourceAge window
+func (sd *AzureServiceDiscovery) isResourceTooYoung(createdTime *time.Time) bool {
+	minResourceAge := sd.prober.settings.MinResourceAge
+	if minResourceAge <= 0 || createdTime == nil || createdTime.IsZero() {
+		return false
+	}
+
+	return time.Since(*createdTime) < minResourceAge
+}
+
 func (sd *AzureServiceDiscovery) fetchResourceList(subscriptionId, filter string) (resourceList []AzureResource, err error) {
+	expand := ""
+	if sd.prober.settings.MinResourceAge > 0 {
+		expand = "createdTime"
+	}
+
 	// nolint:gosec
 	cacheKey := fmt.Sprintf(
 		"%x",
-		sha1.Sum([]byte(fmt.Sprintf("%v:%v", subscriptionId, filter))),
+		sha1.Sum([]byte(fmt.Sprintf("%v:%v:%v", subscriptionId, filter, expand))),
 	)
 
 	// try to fetch info from cache
-	if cachedResourceList, ok := sd.fetchFromCache(cacheKey); !ok {
-		client, err := sd.ResourcesClient(subscriptionId)
+	if cachedResourceList, ok := sd.fetchFromCache(cacheKey); ok {
+		sd.prober.logger.Debugf("using servicediscovery from cache")
+		sd.prober.serviceDiscoveryCache.hit.Store(true)
+		return cachedResourceList, nil
+	}
+
+	err = sd.prober.withServiceDiscoveryRetry(sd.prober.ctx, func() (err error) {
+		resourceList, err = sd.listResources(subscriptionId, filter, expand)
+		return err
+	})
+	if err != nil {
+		// use last successful discovery instead of failing the whole subscription
+		if staleResourceList, ok := sd.loadFromCache(cacheKey + ":stale"); ok {
+			sd.prober.logger.Warnf("servicediscovery failed, using stale servicediscovery from cache: %v", err)
+			sd.publishStaleFallback(subscriptionId)
+			return staleResourceList, nil
+		}
+
+		return resourceList, fmt.Errorf("servicediscovery failed: %w", err)
+	}
+
+	// store to cache (if enabled)
+	sd.saveToCache(cacheKey, resourceList)
+
+	return resourceList, nil
+}
+
+// listResources lists the resources of the subscription (all pages)
+func (sd *AzureServiceDiscovery) listResources(subscriptionId, filter, expand string) (resourceList []AzureResource, err error) {
+	client, err := sd.ResourcesClient(subscriptionId)
+	if err != nil {
+		return resourceList, err
+	}
+
+	opts := armresources.ClientListOptions{
+		Filter: to.StringPtr(filter),
+	}
+	if expand != "" {
+		opts.Expand = to.StringPtr(expand)
+	}
+	pager := client.NewListPager(&opts)
+
+	for pager.More() {
+		startTime := time.Now()
+		result, err := pager.NextPage(sd.prober.ctx)
+		observeApiRequest(ApiOperationListResources, subscriptionId, startTime, err)
 		if err != nil {
-			err = fmt.Errorf("servicediscovery failed: %w", err)
 			return resourceList, err
 		}
 
-		opts := armresources.ClientListOptions{
-			Filter: to.StringPtr(filter),
+		if result.Value == nil {
+			continue
 		}
-		pager := client.NewListPager(&opts)
 
-		for pager.More() {
-			result, err := pager.NextPage(sd.prober.ctx)
-			if err != nil {
-				err = fmt.Errorf("servicediscovery failed: %w", err)
-				return resourceList, err
-			}
+		for _, row := range result.Value {
+			resource := row
 
-			if result.Value == nil {
-				continue
-			}
+			resourceList = append(
+				resourceList,
+				AzureResource{
+					ID:          to.String(resource.ID),
+					Location:    to.String(resource.Location),
+					Tags:        to.StringMap(resource.Tags),
+					CreatedTime: resource.CreatedTime,
+				},
+			)
+		}
+	}
 
-			for _, row := range result.Value {
-				resource := row
+	return resourceList, nil
+}
 
-				resourceList = append(
-					resourceList,
-					AzureResource{
-						ID:   to.String(resource.ID),
-						Tags: to.StringMap(resource.Tags),
-					},
-				)
-			}
-		}
+// publishStaleFallback counts the stale servicediscovery fallback and adds azurerm_servicediscovery_stale to the probe
+func (sd *AzureServiceDiscovery) publishStaleFallback(subscriptionId string) {
+	countServiceDiscoveryStaleFallback(subscriptionId)
 
-		// store to cache (if enabled)
-		sd.saveToCache(cacheKey, resourceList)
-	} else {
-		sd.prober.logger.Debugf("using servicediscovery from cache")
-		resourceList = cachedResourceList
+	sd.prober.metricList.Add(PrometheusServiceDiscoveryStaleName, MetricRow{
+		Labels: prometheus.Labels{
+			"subscriptionID": subscriptionId,
+		},
+		Value: 1,
+	})
+	sd.prober.metricList.SetMetricHelp(PrometheusServiceDiscoveryStaleName, "Resource discovery failed, the last successful (stale) discovery result was used")
+}
+
+func (sd *AzureServiceDiscovery) fetchFromCache(cacheKey string) (resourceList []AzureResource, status bool) {
+	if sd.prober.serviceDiscoveryCache.cache == nil {
+		return
 	}
 
+	resourceList, status = sd.loadFromCache(cacheKey)
+	countCacheRequest(CacheNameAzure, status)
 	return
 }
 
-func (sd *AzureServiceDiscovery) fetchFromCache(cacheKey string) (resourceList []AzureResource, status bool) {
-	contextLogger := sd.prober.logger
+// loadFromCache reads a servicediscovery result from the cache (without counting the cache request)
+func (sd *AzureServiceDiscovery) loadFromCache(cacheKey string) (resourceList []AzureResource, status bool) {
+	status = sd.loadCacheData(cacheKey, &resourceList)
+	return
+}
+
+// loadCacheData reads and parses a json encoded servicediscovery result from the cache
+func (sd *AzureServiceDiscovery) loadCacheData(cacheKey string, result interface{}) bool {
 	cache := sd.prober.serviceDiscoveryCache.cache
+	if cache == nil {
+		return false
+	}
 
-	if cache != nil {
-		if v, ok := cache.Get(cacheKey); ok {
-			if cacheData, ok := v.([]byte); ok {
-				if err := json.Unmarshal(cacheData, &resourceList); err == nil {
-					status = true
-				} else {
-					contextLogger.Debug("unable to parse cached servicediscovery")
-				}
+	if v, ok := cache.Get(cacheKey); ok {
+		if cacheData, ok := v.([]byte); ok {
+			if err := json.Unmarshal(cacheData, result); err == nil {
+				return true
 			}
+			sd.prober.logger.Debug("unable to parse cached servicediscovery")
 		}
 	}
 
-	return
+	return false
 }
 
 func (sd *AzureServiceDiscovery) saveToCache(cacheKey string, resourceList []AzureResource) {
@@ -121,15 +205,35 @@ func (sd *AzureServiceDiscovery) saveToCache(cacheKey string, resourceList []Azu
 		if cacheData, err := json.Marshal(resourceList); err == nil {
 			cache.Set(cacheKey, cacheData, *cacheDuration)
 			contextLogger.Debugf("saved servicediscovery to cache for %s", cacheDuration.String())
+
+			sd.saveStaleToCache(cacheKey, cacheData)
 		}
 	}
 }
 
+// saveStaleToCache keeps the servicediscovery result as fallback if servicediscovery fails after the cache expired
+func (sd *AzureServiceDiscovery) saveStaleToCache(cacheKey string, cacheData []byte) {
+	cache := sd.prober.serviceDiscoveryCache.cache
+	if cache == nil {
+		return
+	}
+
+	staleDuration := ServiceDiscoveryStaleDuration
+	if cacheDuration := sd.prober.serviceDiscoveryCache.cacheDuration; cacheDuration != nil {
+		staleDuration = max(staleDuration, *cacheDuration)
+	}
+	cache.Set(cacheKey+":stale", cacheData, staleDuration)
+}
+
 func (sd *AzureServiceDiscovery) FindSubscriptionResources(subscriptionId, filter string) {
 	var targetList []MetricProbeTarget
 
 	if resourceList, err := sd.fetchResourceList(subscriptionId, filter); err == nil {
 		for _, resource := range resourceList {
+			if sd.isResourceTooYoung(resource.CreatedTime) {
+				continue
+			}
+
 			targetList = append(
 				targetList,
 				MetricProbeTarget{
@@ -137,6 +241,7 @@ func (sd *AzureServiceDiscovery) FindSubscriptionResources(subscriptionId, filte
 					Metrics:      sd.prober.settings.Metrics,
 					Aggregations: sd.prober.settings.Aggregations,
 					Tags:         resource.Tags,
+					Location:     resource.Location,
 				},
 			)
 		}
@@ -153,6 +258,10 @@ func (sd *AzureServiceDiscovery) FindSubscriptionResourcesWithScrapeTags(ctx con
 
 	if resourceList, err := sd.fetchResourceList(subscriptionId, filter); err == nil {
 		for _, resource := range resourceList {
+			if sd.isResourceTooYoung(resource.CreatedTime) {
+				continue
+			}
+
 			if metrics, ok := resource.Tags[metricTagName]; ok && metrics != "" {
 				if aggregations, ok := resource.Tags[aggregationTagName]; ok && aggregations != "" {
 					targetList = append(
@@ -161,6 +270,7 @@ func (sd *AzureServiceDiscovery) FindSubscriptionResourcesWithScrapeTags(ctx con
 							ResourceId:   resource.ID,
 							Metrics:      stringToStringList(metrics, ","),
 							Aggregations: stringToStringList(aggregations, ","),
+							Location:     resource.Location,
 						},
 					)
 
@@ -176,9 +286,7 @@ func (sd *AzureServiceDiscovery) FindSubscriptionResourcesWithScrapeTags(ctx con
 }
 
 func (sd *AzureServiceDiscovery) FindResourceGraph(ctx context.Context, subscriptions []string, resourceType, filter string) error {
-	var targetList []MetricProbeTarget
-
-	client, err := armresourcegraph.NewClient(sd.prober.AzureClient.GetCred(), sd.prober.AzureClient.NewArmClientOptions())
+	client, err := sd.ResourceGraphClient()
 	if err != nil {
 		return err
 	}
@@ -187,12 +295,11 @@ func (sd *AzureServiceDiscovery) FindResourceGraph(ctx context.Context, subscrip
 		filter = "| " + filter
 	}
 
-	queryTemplate := `Resources | where type =~ "%s" %s | project id, tags`
-
 	query := strings.TrimSpace(fmt.Sprintf(
-		queryTemplate,
+		`Resources | where type =~ "%s" %s | project %s`,
 		strings.ReplaceAll(resourceType, "'", "\\'"),
 		filter,
+		sd.resourceGraphProjection(),
 	))
 
 	sd.prober.logger.With(zap.String("query", query)).Debugf("using Kusto query")
@@ -208,11 +315,63 @@ func (sd *AzureServiceDiscovery) FindResourceGraph(ctx context.Context, subscrip
 		Subscriptions: to.SlicePtr(subscriptions),
 	}
 
-	result, err := client.Resources(ctx, queryRequest, nil)
+	fetchPage := func(skipToken *string) (result armresourcegraph.ClientResourcesResponse, err error) {
+		queryRequest.Options.SkipToken = skipToken
+		err = sd.prober.withServiceDiscoveryRetry(ctx, func() error {
+			startTime := time.Now()
+			result, err = client.Resources(ctx, queryRequest, nil)
+			observeApiRequest(ApiOperationResourceGraphQuery, "", startTime, err)
+			return err
+		})
+		return result, err
+	}
+
+	targetList, truncated, err := sd.collectResourceGraphPages(fetchPage)
 	if err != nil {
 		return err
 	}
 
+	if truncated {
+		sd.prober.logger.Warnf("ResourceGraph query returned more than %v resources (--resourcegraph.max-results), remaining resources are skipped", sd.prober.Conf.Azure.ResourceGraph.MaxResults)
+		sd.prober.metricList.Add(PrometheusResourceGraphTruncatedName, MetricRow{
+			Labels: prometheus.Labels{
+				"resourceType": strings.ToLower(resourceType),
+			},
+			Value: 1,
+		})
+		sd.prober.metricList.SetMetricHelp(PrometheusResourceGraphTruncatedName, "ResourceGraph results were truncated by --resourcegraph.max-results")
+	}
+
+	sd.publishTargetList(targetList)
+	return nil
+}
+
+// resourceGraphProjection returns the projected fields of the ResourceGraph query, the location is needed for
+// resource labels, resource info and the metrics batch API (requests are grouped by region)
+func (sd *AzureServiceDiscovery) resourceGraphProjection() string {
+	projection := "id, tags"
+	if sd.prober.Conf.Metrics.ResourceInfo.Enabled {
+		projection += ", name, location, resourceGroup, type, sku"
+	} else if sd.prober.Conf.Metrics.Batch.Enabled || slices.Contains(sd.prober.Conf.Metrics.Labels.Resource, ResourceLabelLocation) {
+		projection += ", location"
+	}
+	if sd.prober.settings.MinResourceAge > 0 {
+		projection += ", timeCreated = properties.timeCreated"
+	}
+	return projection
+}
+
+// collectResourceGraphPages fetches all pages of a ResourceGraph query (fetchPage is called with the skip token
+// of the previous page, nil for the first page) and returns the targets, the result is truncated after
+// --resourcegraph.max-results resources
+func (sd *AzureServiceDiscovery) collectResourceGraphPages(fetchPage func(skipToken *string) (armresourcegraph.ClientResourcesResponse, error)) (targetList []MetricProbeTarget, truncated bool, err error) {
+	result, err := fetchPage(nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	maxResults := sd.prober.Conf.Azure.ResourceGraph.MaxResults
+	resultCount := 0
 	for {
 		if resultList, ok := result.Data.([]interface{}); ok {
 			// check if we got data, otherwise break the for loop
@@ -221,14 +380,23 @@ func (sd *AzureServiceDiscovery) FindResourceGraph(ctx context.Context, subscrip
 			}
 
 			for _, v := range resultList {
-				if resultRow, ok := v.(map[string]interface{}); ok {
-					// check if we got data, otherwise break the for loop
-					if len(resultList) == 0 {
-						break
-					}
+				if maxResults > 0 && resultCount >= maxResults {
+					truncated = true
+					break
+				}
+				resultCount++
 
+				if resultRow, ok := v.(map[string]interface{}); ok {
 					if val, ok := resultRow["id"]; ok && val != "" {
 						if resourceId, ok := val.(string); ok {
+							if sd.isResourceTooYoung(resourceGraphTime(resultRow["timeCreated"])) {
+								continue
+							}
+
+							if sd.prober.Conf.Metrics.ResourceInfo.Enabled {
+								sd.addResourceInfo(resourceId, resultRow)
+							}
+
 							targetList = append(
 								targetList,
 								MetricProbeTarget{
@@ -236,6 +404,7 @@ func (sd *AzureServiceDiscovery) FindResourceGraph(ctx context.Context, subscrip
 									Metrics:      sd.prober.settings.Metrics,
 									Aggregations: sd.prober.settings.Aggregations,
 									Tags:         sd.resourceTagsToStringMap(resultRow["tags"]),
+									Location:     resourceInfoValueToString(resultRow["location"]),
 								},
 							)
 						}
@@ -244,18 +413,117 @@ func (sd *AzureServiceDiscovery) FindResourceGraph(ctx context.Context, subscrip
 			}
 		}
 
-		if result.SkipToken != nil {
-			queryRequest.Options.SkipToken = result.SkipToken
-			result, err = client.Resources(ctx, queryRequest, nil)
+		if result.SkipToken != nil && !truncated {
+			if maxResults > 0 && resultCount >= maxResults {
+				truncated = true
+				break
+			}
+
+			result, err = fetchPage(result.SkipToken)
 			if err != nil {
-				return err
+				return nil, false, err
 			}
 		} else {
 			break
 		}
 	}
 
-	sd.publishTargetList(targetList)
+	return targetList, truncated, nil
+}
+
+// QueryResourceGraph executes the ResourceGraph query for the subscriptions (all pages) with retries on transient errors,
+// if the query still fails the last successful result of the query is used (stale fallback, reported for all subscriptions)
+func (sd *AzureServiceDiscovery) QueryResourceGraph(query string, subscriptions []string) ([]map[string]interface{}, error) {
+	// nolint:gosec
+	cacheKey := fmt.Sprintf(
+		"%x",
+		sha1.Sum([]byte(fmt.Sprintf("resourcegraph:%v:%v", strings.Join(subscriptions, ","), query))),
+	)
+
+	return sd.queryWithStaleFallback(cacheKey, subscriptions, func() ([]map[string]interface{}, error) {
+		return sd.executeResourceGraphQuery(query, subscriptions)
+	})
+}
+
+// queryWithStaleFallback runs the query and keeps the result as fallback for failed queries
+func (sd *AzureServiceDiscovery) queryWithStaleFallback(cacheKey string, subscriptions []string, query func() ([]map[string]interface{}, error)) ([]map[string]interface{}, error) {
+	rows, err := query()
+	if err != nil {
+		var staleRows []map[string]interface{}
+		if sd.loadCacheData(cacheKey+":stale", &staleRows) {
+			sd.prober.logger.Warnf("servicediscovery failed, using stale servicediscovery from cache: %v", err)
+			for _, subscriptionId := range subscriptions {
+				sd.publishStaleFallback(subscriptionId)
+			}
+			return staleRows, nil
+		}
+
+		return nil, fmt.Errorf("servicediscovery failed: %w", err)
+	}
+
+	if cacheData, err := json.Marshal(rows); err == nil {
+		sd.saveStaleToCache(cacheKey, cacheData)
+	}
+
+	return rows, nil
+}
+
+// executeResourceGraphQuery fetches all pages of the ResourceGraph query, every page is retried on transient errors
+func (sd *AzureServiceDiscovery) executeResourceGraphQuery(query string, subscriptions []string) ([]map[string]interface{}, error) {
+	rows := []map[string]interface{}{}
+
+	client, err := sd.ResourceGraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	queryFormat := armresourcegraph.ResultFormatObjectArray
+	queryTop := int32(ResourceGraphQueryTop)
+	queryRequest := armresourcegraph.QueryRequest{
+		Query: to.StringPtr(query),
+		Options: &armresourcegraph.QueryRequestOptions{
+			ResultFormat: &queryFormat,
+			Top:          &queryTop,
+		},
+		Subscriptions: to.SlicePtr(subscriptions),
+	}
+
+	for {
+		var result armresourcegraph.ClientResourcesResponse
+		err := sd.prober.withServiceDiscoveryRetry(sd.prober.ctx, func() (err error) {
+			startTime := time.Now()
+			result, err = client.Resources(sd.prober.ctx, queryRequest, nil)
+			observeApiRequest(ApiOperationResourceGraphQuery, "", startTime, err)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if resultList, ok := result.Data.([]interface{}); ok {
+			for _, v := range resultList {
+				if resultRow, ok := v.(map[string]interface{}); ok {
+					rows = append(rows, resultRow)
+				}
+			}
+		}
+
+		if to.String(result.SkipToken) == "" {
+			break
+		}
+		queryRequest.Options.SkipToken = result.SkipToken
+	}
+
+	return rows, nil
+}
+
+// resourceGraphTime parses a timestamp from a ResourceGraph result row (nil if not available)
+func resourceGraphTime(value interface{}) *time.Time {
+	if val, ok := value.(string); ok && val != "" {
+		if ret, err := time.Parse(time.RFC3339Nano, val); err == nil {
+			return &ret
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,266 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resourcegraph/armresourcegraph"
+	"github.com/patrickmn/go-cache"
+	"github.com/webdevops/go-common/utils/to"
+	"go.uber.org/zap"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func newTestProber(conf config.Opts, settings *RequestMetricSettings) *MetricProber {
+	if settings == nil {
+		settings = &RequestMetricSettings{}
+	}
+	return NewMetricProber(context.Background(), zap.NewNop().Sugar(), httptest.NewRecorder(), settings, conf)
+}
+
+// newResourceGraphPages returns a fetchPage func which serves pages of the given sizes (chained by skip tokens)
+// and counts the fetched pages
+func newResourceGraphPages(t *testing.T, pageSizes ...int) (func(skipToken *string) (armresourcegraph.ClientResourcesResponse, error), *int) {
+	fetched := 0
+	resourceNum := 0
+	return func(skipToken *string) (armresourcegraph.ClientResourcesResponse, error) {
+		expectedSkipToken := ""
+		if fetched > 0 {
+			expectedSkipToken = fmt.Sprintf("page-%d", fetched)
+		}
+		if to.String(skipToken) != expectedSkipToken {
+			t.Fatalf("expected skip token %q, got %q", expectedSkipToken, to.String(skipToken))
+		}
+
+		if fetched >= len(pageSizes) {
+			t.Fatalf("page %d fetched, only %d pages available", fetched+1, len(pageSizes))
+		}
+
+		data := []interface{}{}
+		for i := 0; i < pageSizes[fetched]; i++ {
+			resourceNum++
+			data = append(data, map[string]interface{}{
+				"id":       fmt.Sprintf("/subscriptions/00000000-0000-0000-0000-000000000001/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/sa%d", resourceNum),
+				"location": "westeurope",
+				"tags":     map[string]interface{}{"owner": "team"},
+			})
+		}
+		fetched++
+
+		result := armresourcegraph.ClientResourcesResponse{}
+		result.Data = data
+		if fetched < len(pageSizes) {
+			result.SkipToken = to.StringPtr(fmt.Sprintf("page-%d", fetched))
+		}
+		return result, nil
+	}, &fetched
+}
+
+func TestCollectResourceGraphPagesFetchesAllPages(t *testing.T) {
+	prober := newTestProber(config.Opts{}, nil)
+	fetchPage, fetched := newResourceGraphPages(t, 1000, 1000, 500)
+
+	targetList, truncated, err := prober.ServiceDiscovery.collectResourceGraphPages(fetchPage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *fetched != 3 {
+		t.Errorf("expected 3 fetched pages, got %d", *fetched)
+	}
+	if truncated {
+		t.Error("expected result not to be truncated without --resourcegraph.max-results")
+	}
+	if len(targetList) != 2500 {
+		t.Fatalf("expected 2500 targets, got %d", len(targetList))
+	}
+
+	target := targetList[2499]
+	if target.Location != "westeurope" || target.Tags["owner"] != "team" {
+		t.Errorf("unexpected target: %+v", target)
+	}
+}
+
+func TestCollectResourceGraphPagesMaxResults(t *testing.T) {
+	conf := config.Opts{}
+	conf.Azure.ResourceGraph.MaxResults = 1500
+
+	prober := newTestProber(conf, nil)
+	fetchPage, fetched := newResourceGraphPages(t, 1000, 1000, 1000)
+
+	targetList, truncated, err := prober.ServiceDiscovery.collectResourceGraphPages(fetchPage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *fetched != 2 {
+		t.Errorf("expected 2 fetched pages, got %d", *fetched)
+	}
+	if !truncated {
+		t.Error("expected result to be truncated")
+	}
+	if len(targetList) != 1500 {
+		t.Errorf("expected 1500 targets, got %d", len(targetList))
+	}
+}
+
+func TestCollectResourceGraphPagesMaxResultsAtPageBoundary(t *testing.T) {
+	conf := config.Opts{}
+	conf.Azure.ResourceGraph.MaxResults = 1000
+
+	prober := newTestProber(conf, nil)
+	fetchPage, fetched := newResourceGraphPages(t, 1000, 1000)
+
+	targetList, truncated, err := prober.ServiceDiscovery.collectResourceGraphPages(fetchPage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *fetched != 1 {
+		t.Errorf("expected 1 fetched page, got %d", *fetched)
+	}
+	if !truncated || len(targetList) != 1000 {
+		t.Errorf("expected 1000 targets and truncated result, got %d targets (truncated: %v)", len(targetList), truncated)
+	}
+}
+
+// newTestServiceDiscoveryProber returns a prober with servicediscovery cache and fast servicediscovery retries
+func newTestServiceDiscoveryProber(retries int) *MetricProber {
+	conf := config.Opts{}
+	conf.Azure.ServiceDiscovery.Retries = retries
+	conf.Azure.ServiceDiscovery.RetryBackoff = time.Millisecond
+
+	prober := newTestProber(conf, nil)
+	cacheDuration := 30 * time.Minute
+	prober.EnableServiceDiscoveryCache(cache.New(cacheDuration, cacheDuration), &cacheDuration)
+	return prober
+}
+
+func newTestResponseError(statusCode int) error {
+	return &azcore.ResponseError{StatusCode: statusCode}
+}
+
+func TestServiceDiscoveryRetry(t *testing.T) {
+	prober := newTestServiceDiscoveryProber(2)
+
+	calls := 0
+	err := prober.withServiceDiscoveryRetry(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return newTestResponseError(http.StatusServiceUnavailable)
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("expected success after 3 calls, got %v calls (err: %v)", calls, err)
+	}
+
+	calls = 0
+	err = prober.withServiceDiscoveryRetry(context.Background(), func() error {
+		calls++
+		return newTestResponseError(http.StatusTooManyRequests)
+	})
+	if err == nil || calls != 3 {
+		t.Errorf("expected error after 3 calls, got %v calls (err: %v)", calls, err)
+	}
+
+	calls = 0
+	err = prober.withServiceDiscoveryRetry(context.Background(), func() error {
+		calls++
+		return newTestResponseError(http.StatusNotFound)
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("expected no retry of non transient error, got %v calls (err: %v)", calls, err)
+	}
+}
+
+func TestQueryWithStaleFallback(t *testing.T) {
+	prober := newTestServiceDiscoveryProber(2)
+	subscriptions := []string{"00000000-0000-0000-0000-000000000001", "00000000-0000-0000-0000-000000000002"}
+
+	rows, err := prober.ServiceDiscovery.queryWithStaleFallback("regions", subscriptions, func() ([]map[string]interface{}, error) {
+		return []map[string]interface{}{
+			{"subscriptionId": subscriptions[0], "location": "westeurope"},
+		}, nil
+	})
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("expected 1 row, got %v (err: %v)", rows, err)
+	}
+	if len(prober.metricList.GetMetricList(PrometheusServiceDiscoveryStaleName)) != 0 {
+		t.Error("expected no stale fallback for successful servicediscovery")
+	}
+
+	rows, err = prober.ServiceDiscovery.queryWithStaleFallback("regions", subscriptions, func() ([]map[string]interface{}, error) {
+		return nil, newTestResponseError(http.StatusServiceUnavailable)
+	})
+	if err != nil {
+		t.Fatalf("expected stale fallback, got error: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["subscriptionId"] != subscriptions[0] || rows[0]["location"] != "westeurope" {
+		t.Errorf("expected stale rows, got %v", rows)
+	}
+
+	staleRows := prober.metricList.GetMetricList(PrometheusServiceDiscoveryStaleName)
+	if len(staleRows) != len(subscriptions) {
+		t.Fatalf("expected %v stale fallback series, got %v", len(subscriptions), len(staleRows))
+	}
+	for i, row := range staleRows {
+		if row.Labels["subscriptionID"] != subscriptions[i] || row.Value != 1 {
+			t.Errorf("unexpected stale fallback series: %+v", row)
+		}
+	}
+}
+
+func TestQueryWithStaleFallbackWithoutStaleResult(t *testing.T) {
+	prober := newTestServiceDiscoveryProber(2)
+	queryErr := newTestResponseError(http.StatusServiceUnavailable)
+
+	_, err := prober.ServiceDiscovery.queryWithStaleFallback("regions", []string{"00000000-0000-0000-0000-000000000001"}, func() ([]map[string]interface{}, error) {
+		return nil, queryErr
+	})
+	if !errors.Is(err, queryErr) {
+		t.Errorf("expected servicediscovery error, got %v", err)
+	}
+	if len(prober.metricList.GetMetricList(PrometheusServiceDiscoveryStaleName)) != 0 {
+		t.Error("expected no stale fallback without previous servicediscovery")
+	}
+}
+
+func TestIsResourceTooYoung(t *testing.T) {
+	now := time.Now()
+	createdTime := func(age time.Duration) *time.Time {
+		ret := now.Add(-age)
+		return &ret
+	}
+
+	testCases := []struct {
+		name           string
+		minResourceAge time.Duration
+		createdTime    *time.Time
+		expected       bool
+	}{
+		{"disabled", 0, createdTime(time.Minute), false},
+		{"young resource", time.Hour, createdTime(time.Minute), true},
+		{"old resource", time.Hour, createdTime(2 * time.Hour), false},
+		{"unknown created time", time.Hour, nil, false},
+		{"zero created time", time.Hour, &time.Time{}, false},
+		{"resource graph time", time.Hour, resourceGraphTime(now.Add(-time.Minute).Format(time.RFC3339Nano)), true},
+		{"invalid resource graph time", time.Hour, resourceGraphTime("yesterday"), false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			prober := newTestProber(config.Opts{}, &RequestMetricSettings{MinResourceAge: testCase.minResourceAge})
+			if ret := prober.ServiceDiscovery.isResourceTooYoung(testCase.createdTime); ret != testCase.expected {
+				t.Errorf("expected %v, got %v", testCase.expected, ret)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package metrics
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -16,6 +17,11 @@ const (
 	PrometheusMetricNameDefault = "azurerm_resource_metric"
 )
 
+var (
+	// aggregations supported by Azure Monitor
+	MetricAggregationList = []string{"Average", "Minimum", "Maximum", "Total", "Count"}
+)
+
 type (
 	RequestMetricSettings struct {
 		Name            string
@@ -24,25 +30,57 @@ type (
 		Filter          string
 		Timespan        string
 		Interval        *string
+		IntervalAuto    bool
 		Metrics         []string
 		MetricNamespace string
 		Aggregations    []string
 		Regions         []string
+		TagFilters      []ResourceTagFilter
 
 		// needed for dimension support
 		MetricTop     *int32
 		MetricFilter  string
 		MetricOrderBy string
 
-		ValidateDimensions bool
+		PointSelect       string
+		PointSelectOffset time.Duration
+
+		CompareOffsets []MetricCompareOffset
+
+		ValidateDimensions  bool
+		DimensionTopN       int
+		AutoAdjustTimegrain bool
+
+		// only supported by /probe/metrics/list
+		IncludeDimensions bool
+
+		// collect all available metrics if no metric is requested
+		Autodiscover bool
+
+		// check metric namespace against the namespaces of the resources
+		ValidateMetricNamespace bool
+
+		// validate parameters and return the planned requests instead of metrics
+		DryRun bool
+
+		// servicediscovery
+		MinResourceAge time.Duration
 
 		MetricTemplate string
 		HelpTemplate   string
 
-		DimensionLowercase bool
+		DimensionLowercase    bool
+		DimensionKeyLowercase bool
 
 		// cache
-		Cache *time.Duration
+		Cache     *time.Duration
+		CacheMode string
+	}
+
+	// ResourceTagFilter restricts the queried resources to resources with tag Name set to Value
+	ResourceTagFilter struct {
+		Name  string
+		Value string
 	}
 )
 
@@ -52,7 +90,29 @@ func NewRequestMetricSettingsForAzureResourceApi(r *http.Request, opts config.Op
 		return settings, err
 	}
 
+	if r.URL.Path == config.ProbeMetricsSubscriptionUrl {
+		// param tagFilter (multiple filters are combined with AND)
+		if settings.TagFilters, err = parseTagFilters(r.URL.Query()); err != nil {
+			return settings, err
+		}
+	}
+
 	if r.URL.Path == config.ProbeMetricsResourceUrl {
+		// param autodiscover (only if no metric is requested)
+		if val, err := strconv.ParseBool(paramsGetWithDefault(r.URL.Query(), "autodiscover", "false")); err == nil {
+			settings.Autodiscover = val && len(settings.Metrics) == 0
+		} else {
+			return settings, fmt.Errorf("parameter \"autodiscover\" is not a valid boolean: %w", err)
+		}
+
+		// param dryrun
+		if val, err := strconv.ParseBool(paramsGetWithDefault(r.URL.Query(), "dryrun", "false")); err == nil {
+			settings.DryRun = val
+		} else {
+			return settings, fmt.Errorf("parameter \"dryrun\" is not a valid boolean: %w", err)
+		}
+
+		settings.ValidateMetricNamespace = true
 		return settings, nil
 	} else if settings.ResourceType != "" && settings.Filter != "" {
 		return settings, fmt.Errorf("parameter \"resourceType\" and \"filter\" are mutually exclusive")
@@ -71,7 +131,8 @@ func NewRequestMetricSettingsForAzureResourceApi(r *http.Request, opts config.Op
 func NewRequestMetricSettings(r *http.Request, opts config.Opts) (RequestMetricSettings, error) {
 	ret := RequestMetricSettings{
 		// force lowercasing of dimensions
-		DimensionLowercase: opts.Metrics.Dimensions.Lowercase,
+		DimensionLowercase:    opts.Metrics.Dimensions.Lowercase,
+		DimensionKeyLowercase: opts.Metrics.Dimensions.LowercaseKeys,
 	}
 
 	params := r.URL.Query()
@@ -105,11 +166,35 @@ func NewRequestMetricSettings(r *http.Request, opts config.Opts) (RequestMetricS
 		return ret, err
 	}
 
-	// param timespan
-	ret.Timespan = paramsGetWithDefault(params, "timespan", "PT1M")
+	// param autoAdjustTimegrain
+	if val, err := strconv.ParseBool(paramsGetWithDefault(params, "autoAdjustTimegrain", "true")); err == nil {
+		ret.AutoAdjustTimegrain = val
+	} else {
+		return ret, err
+	}
 
-	// param interval
-	if val := params.Get("interval"); val != "" {
+	// param minResourceAge
+	if val := params.Get("minResourceAge"); val != "" {
+		if duration, err := time.ParseDuration(val); err == nil {
+			ret.MinResourceAge = duration
+		} else {
+			return ret, fmt.Errorf("parameter \"minResourceAge\" is not a valid duration: %w", err)
+		}
+	}
+
+	// param timespan (default --metrics.timespan)
+	ret.Timespan = paramsGetWithDefault(params, "timespan", opts.Metrics.Timespan)
+	if _, ok := timespanLookback(ret.Timespan, time.Now()); !ok {
+		return ret, fmt.Errorf(`parameter "timespan" must be an ISO 8601 duration (eg. PT1H) or start/end, got "%s"`, ret.Timespan)
+	}
+
+	// param interval (--metrics.interval is used as default after --prober.interval.map)
+	if val := params.Get("interval"); strings.EqualFold(val, IntervalAuto) || (val == "" && strings.EqualFold(opts.Metrics.Interval, IntervalAuto)) {
+		ret.IntervalAuto = true
+	} else if val != "" {
+		if _, err := iso8601.FromString(val); err != nil {
+			return ret, fmt.Errorf(`parameter "interval" must be an ISO 8601 duration (eg. PT5M) or "auto", got "%s"`, val)
+		}
 		ret.Interval = &val
 	}
 
@@ -120,31 +205,84 @@ func NewRequestMetricSettings(r *http.Request, opts config.Opts) (RequestMetricS
 		return ret, err
 	}
 
-	// param metricNamespace
-	ret.MetricNamespace = paramsGetWithDefault(params, "metricNamespace", "")
+	// param metricNames (single comma joined list)
+	for _, val := range params["metricNames"] {
+		for _, metricName := range stringToStringList(val, ",") {
+			if metricName == "" {
+				return ret, fmt.Errorf("parameter \"metricNames\" contains an empty metric name")
+			}
+			ret.Metrics = append(ret.Metrics, metricName)
+		}
+	}
+
+	// param metricNamespace (alias namespace)
+	if _, val, err := paramsGetAlias(params, "metricNamespace", "namespace"); err == nil {
+		ret.MetricNamespace = strings.TrimSpace(val)
+	} else {
+		return ret, err
+	}
 
-	// param aggregation
+	// param aggregation (multiple aggregations are fetched with one request)
 	if val, err := paramsGetList(params, "aggregation"); err == nil {
+		for _, aggregation := range val {
+			if !stringListContainsFold(MetricAggregationList, aggregation) {
+				return ret, fmt.Errorf(`parameter "aggregation" contains invalid aggregation "%s", allowed: %s`, aggregation, strings.Join(MetricAggregationList, ", "))
+			}
+		}
 		ret.Aggregations = val
 	} else {
 		return ret, err
 	}
 
-	// param metricTop
-	if val := params.Get("metricTop"); val != "" {
+	// param metricTop (alias top)
+	if paramName, val, err := paramsGetAlias(params, "metricTop", "top"); err != nil {
+		return ret, err
+	} else if val != "" {
 		valInt64, err := strconv.ParseInt(val, 10, 32)
-		if err != nil {
-			return ret, err
+		if err != nil || valInt64 < 1 {
+			return ret, fmt.Errorf(`parameter "%s" must be a positive number, got "%s"`, paramName, val)
 		}
 		valInt32 := int32(valInt64)
 		ret.MetricTop = &valInt32
 	}
 
+	// param dimensionTopN
+	if val := params.Get("dimensionTopN"); val != "" {
+		valInt, err := strconv.Atoi(val)
+		if err != nil || valInt < 1 {
+			return ret, fmt.Errorf("parameter \"dimensionTopN\" must be a positive number")
+		}
+		ret.DimensionTopN = valInt
+	}
+
+	// param pointSelect
+	if val := params.Get("pointSelect"); val != "" {
+		mode, offset, err := parsePointSelect(val, ret.Timespan)
+		if err != nil {
+			return ret, err
+		}
+		ret.PointSelect = mode
+		ret.PointSelectOffset = offset
+	}
+
+	// param compareOffsets
+	if val, err := paramsGetList(params, "compareOffsets"); err == nil {
+		if ret.CompareOffsets, err = parseCompareOffsets(val); err != nil {
+			return ret, err
+		}
+	} else {
+		return ret, err
+	}
+
 	// param metricFilter
 	ret.MetricFilter = paramsGetWithDefault(params, "metricFilter", "")
 
-	// param metricOrderBy
-	ret.MetricOrderBy = paramsGetWithDefault(params, "metricOrderBy", "")
+	// param metricOrderBy (alias orderby)
+	if _, val, err := paramsGetAlias(params, "metricOrderBy", "orderby"); err == nil {
+		ret.MetricOrderBy = strings.TrimSpace(val)
+	} else {
+		return ret, err
+	}
 
 	// param template
 	ret.MetricTemplate = paramsGetWithDefault(params, "template", opts.Metrics.Template)
@@ -152,11 +290,43 @@ func NewRequestMetricSettings(r *http.Request, opts config.Opts) (RequestMetricS
 	// param help
 	ret.HelpTemplate = paramsGetWithDefault(params, "help", opts.Metrics.Help)
 
-	// param cache (timespan as default)
+	if err := ret.parseCacheParams(params, opts); err != nil {
+		return ret, err
+	}
+
+	return ret, nil
+}
+
+// NewRequestMetricSettingsForLogAnalytics parses the settings of a Log Analytics query probe (no subscription required)
+func NewRequestMetricSettingsForLogAnalytics(r *http.Request, opts config.Opts) (RequestMetricSettings, error) {
+	ret := RequestMetricSettings{}
+
+	params := r.URL.Query()
+
+	// param name
+	ret.Name = paramsGetWithDefault(params, "name", PrometheusLogAnalyticsNameDefault)
+
+	// param timespan
+	ret.Timespan = paramsGetWithDefault(params, "timespan", "PT1H")
+	if _, err := iso8601.FromString(ret.Timespan); err != nil {
+		return ret, fmt.Errorf(`parameter "timespan" is not a valid ISO 8601 duration: %w`, err)
+	}
+
+	if err := ret.parseCacheParams(params, opts); err != nil {
+		return ret, err
+	}
+
+	return ret, nil
+}
+
+// parseCacheParams parses the parameters cache (timespan as default) and cacheMode
+func (s *RequestMetricSettings) parseCacheParams(params url.Values, opts config.Opts) error {
+	// param cache ($CACHE_METRICS_TTL or timespan as default)
 	if opts.Prober.Cache {
-		cacheDefaultDuration, err := iso8601.FromString(ret.Timespan)
 		cacheDefaultDurationString := ""
-		if err == nil {
+		if opts.Cache.MetricsTTL > 0 {
+			cacheDefaultDurationString = opts.Cache.MetricsTTL.String()
+		} else if cacheDefaultDuration, err := iso8601.FromString(s.Timespan); err == nil {
 			cacheDefaultDurationString = cacheDefaultDuration.ToDuration().String()
 		}
 
@@ -165,14 +335,45 @@ func NewRequestMetricSettings(r *http.Request, opts config.Opts) (RequestMetricS
 		// only enable caching if value is set
 		if cacheDurationString != "" {
 			if val, err := time.ParseDuration(cacheDurationString); err == nil {
-				ret.Cache = &val
+				s.Cache = &val
 			} else {
-				return ret, err
+				return err
 			}
 		}
 	}
 
-	return ret, nil
+	// param cacheMode
+	s.CacheMode = paramsGetWithDefault(params, "cacheMode", CacheModeCacheFirst)
+	switch s.CacheMode {
+	case CacheModeCacheFirst, CacheModeFresh, CacheModeStaleOnError:
+	default:
+		return fmt.Errorf(`parameter "cacheMode" must be "cache-first", "fresh" or "stale-on-error", got "%s"`, s.CacheMode)
+	}
+
+	return nil
+}
+
+// parseTagFilters parses the tagFilter parameters (eg. `environment=production`)
+func parseTagFilters(params url.Values) (tagFilters []ResourceTagFilter, err error) {
+	tagFilterList, err := paramsGetList(params, "tagFilter")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tagFilter := range tagFilterList {
+		name, value, found := strings.Cut(tagFilter, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf(`parameter "tagFilter" must be in format "tagname=value", got "%s"`, tagFilter)
+		}
+
+		tagFilters = append(tagFilters, ResourceTagFilter{
+			Name:  name,
+			Value: strings.TrimSpace(value),
+		})
+	}
+
+	return tagFilters, nil
 }
 
 func (s *RequestMetricSettings) CacheDuration(requestTime time.Time) (ret *time.Duration) {
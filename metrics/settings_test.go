@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+// newTestRequestMetricSettings parses the settings of a probe request with the query
+// (subscription is always set, timespan defaults to PT1H)
+func newTestRequestMetricSettings(query string, opts config.Opts) (RequestMetricSettings, error) {
+	if opts.Metrics.Timespan == "" {
+		opts.Metrics.Timespan = "PT1H"
+	}
+	r := httptest.NewRequest("GET", config.ProbeMetricsResourceUrl+"?subscription=00000000-0000-0000-0000-000000000001&"+query, nil)
+	return NewRequestMetricSettings(r, opts)
+}
+
+func TestRequestMetricSettingsMetricNames(t *testing.T) {
+	testCases := []struct {
+		query         string
+		expected      []string
+		expectedError string
+	}{
+		{"metricNames=Transactions,Ingress,Egress", []string{"Transactions", "Ingress", "Egress"}, ""},
+		{"metricNames=Transactions,%20Ingress%20", []string{"Transactions", "Ingress"}, ""},
+		{"metric=Availability&metricNames=Transactions,Ingress", []string{"Availability", "Transactions", "Ingress"}, ""},
+		{"metricNames=Transactions&metricNames=Ingress", []string{"Transactions", "Ingress"}, ""},
+		{"metricNames=Transactions,,Ingress", nil, "empty metric name"},
+		{"metricNames=Transactions,", nil, "empty metric name"},
+	}
+
+	for _, testCase := range testCases {
+		settings, err := newTestRequestMetricSettings(testCase.query, config.Opts{})
+		switch {
+		case testCase.expectedError != "":
+			if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+				t.Errorf("%s: expected error %q, got %v", testCase.query, testCase.expectedError, err)
+			}
+		case err != nil:
+			t.Errorf("%s: expected no error, got %v", testCase.query, err)
+		case !reflect.DeepEqual(settings.Metrics, testCase.expected):
+			t.Errorf("%s: expected metrics %v, got %v", testCase.query, testCase.expected, settings.Metrics)
+		}
+	}
+}
+
+func TestRequestMetricSettingsMinResourceAge(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected time.Duration
+		valid    bool
+	}{
+		{"", 0, true},
+		{"minResourceAge=15m", 15 * time.Minute, true},
+		{"minResourceAge=2h", 2 * time.Hour, true},
+		{"minResourceAge=PT15M", 0, false},
+	}
+
+	for _, testCase := range testCases {
+		settings, err := newTestRequestMetricSettings(testCase.query, config.Opts{})
+		if (err == nil) != testCase.valid {
+			t.Errorf("%s: expected valid=%v, got error %v", testCase.query, testCase.valid, err)
+		} else if settings.MinResourceAge != testCase.expected {
+			t.Errorf("%s: expected minResourceAge %v, got %v", testCase.query, testCase.expected, settings.MinResourceAge)
+		}
+	}
+}
+
+func TestRequestMetricSettingsCacheMode(t *testing.T) {
+	testCases := []struct {
+		query         string
+		expected      string
+		expectedError string
+	}{
+		{"", CacheModeCacheFirst, ""},
+		{"cacheMode=cache-first", CacheModeCacheFirst, ""},
+		{"cacheMode=fresh", CacheModeFresh, ""},
+		{"cacheMode=stale-on-error", CacheModeStaleOnError, ""},
+		{"cacheMode=stale", "", `parameter "cacheMode" must be`},
+	}
+
+	for _, testCase := range testCases {
+		settings, err := newTestRequestMetricSettings(testCase.query, config.Opts{})
+		if testCase.expectedError != "" {
+			if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+				t.Errorf("%s: expected error %q, got %v", testCase.query, testCase.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.query, err)
+		}
+
+		if settings.CacheMode != testCase.expected {
+			t.Errorf("%s: expected cache mode %q, got %q", testCase.query, testCase.expected, settings.CacheMode)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// how long the series of the last probe are remembered
+	StaleSeriesCacheDuration = 15 * time.Minute
+)
+
+var (
+	// staleMarker is the Prometheus stale marker (StaleNaN of github.com/prometheus/prometheus/model/value)
+	staleMarker = math.Float64frombits(0x7ff0000000000002)
+)
+
+type (
+	staleSeriesEntry struct {
+		Help   map[string]string
+		Series map[string]map[string]prometheus.Labels
+	}
+)
+
+func (p *MetricProber) EnableStaleSeries(cache Cache, cacheKey string) {
+	p.staleSeries.cache = cache
+	p.staleSeries.cacheKey = cacheKey
+}
+
+// Failed returns true if at least one Azure request of the probe has failed
+func (p *MetricProber) Failed() bool {
+	return p.failedRequests.Load() > 0
+}
+
+// markTargetFailed marks the series of the target as stale if they are missing
+func (p *MetricProber) markTargetFailed(resourceId string) {
+	p.staleSeries.lock.Lock()
+	defer p.staleSeries.lock.Unlock()
+
+	if p.staleSeries.failedTargets == nil {
+		p.staleSeries.failedTargets = map[string]bool{}
+	}
+	p.staleSeries.failedTargets[strings.ToLower(resourceId)] = true
+}
+
+// markSubscriptionsFailed marks the series of the subscriptions as stale if they are missing
+func (p *MetricProber) markSubscriptionsFailed(subscriptionIds ...string) {
+	p.staleSeries.lock.Lock()
+	defer p.staleSeries.lock.Unlock()
+
+	if p.staleSeries.failedSubscriptions == nil {
+		p.staleSeries.failedSubscriptions = map[string]bool{}
+	}
+	for _, subscriptionId := range subscriptionIds {
+		p.staleSeries.failedSubscriptions[strings.ToLower(subscriptionId)] = true
+	}
+}
+
+// isFailedSeries checks if the series belongs to a failed target or subscription
+func (p *MetricProber) isFailedSeries(labels prometheus.Labels) bool {
+	p.staleSeries.lock.Lock()
+	defer p.staleSeries.lock.Unlock()
+
+	return p.staleSeries.failedTargets[strings.ToLower(labels["resourceID"])] ||
+		p.staleSeries.failedSubscriptions[strings.ToLower(labels["subscriptionID"])]
+}
+
+// applyStaleSeries remembers the series of the probe, the series of failed targets (and subscriptions) of the
+// last probes which are missing now are published with the Prometheus stale marker so they don't keep their last value
+func (p *MetricProber) applyStaleSeries() {
+	if p.staleSeries.cache == nil {
+		return
+	}
+
+	entry := staleSeriesEntry{
+		Help:   map[string]string{},
+		Series: map[string]map[string]prometheus.Labels{},
+	}
+	for _, metricName := range p.metricList.GetMetricNames() {
+		entry.Help[metricName] = p.metricList.GetMetricHelp(metricName)
+		entry.Series[metricName] = map[string]prometheus.Labels{}
+		for _, row := range p.metricList.GetMetricList(metricName) {
+			entry.Series[metricName][metricLabelsKey(row.Labels)] = row.Labels
+		}
+	}
+
+	if p.Failed() {
+		if val, ok := p.staleSeries.cache.Get(p.staleSeries.cacheKey); ok {
+			previousEntry := val.(*staleSeriesEntry)
+
+			for metricName, seriesList := range previousEntry.Series {
+				if _, exists := entry.Series[metricName]; !exists {
+					entry.Help[metricName] = previousEntry.Help[metricName]
+					entry.Series[metricName] = map[string]prometheus.Labels{}
+				}
+
+				staleCount := 0
+				for seriesKey, labels := range seriesList {
+					if _, exists := entry.Series[metricName][seriesKey]; exists || !p.isFailedSeries(labels) {
+						continue
+					}
+
+					// series of failed targets are remembered until the target was fetched successfully again
+					entry.Series[metricName][seriesKey] = labels
+					p.metricList.Add(metricName, MetricRow{Labels: labels, Value: staleMarker})
+					staleCount++
+				}
+
+				if staleCount > 0 {
+					if _, exists := p.metricList.Help[metricName]; !exists {
+						p.metricList.SetMetricHelp(metricName, previousEntry.Help[metricName])
+					}
+					p.logger.Debugf("publishing %v missing series of failed targets of %s as stale", staleCount, metricName)
+				}
+			}
+		}
+	}
+
+	p.staleSeries.cache.Set(p.staleSeries.cacheKey, &entry, StaleSeriesCacheDuration)
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func TestApplyStaleSeries(t *testing.T) {
+	staleCache := cache.New(time.Hour, time.Hour)
+
+	newStaleProber := func(resourceIds ...string) *MetricProber {
+		prober := newTestProber(config.Opts{}, nil)
+		prober.EnableStaleSeries(staleCache, "probe")
+		for _, resourceId := range resourceIds {
+			prober.metricList.Add("azurerm_resource_metric", MetricRow{
+				Labels: prometheus.Labels{"resourceID": resourceId, "subscriptionID": "s1"},
+				Value:  1,
+			})
+		}
+		prober.metricList.SetMetricHelp("azurerm_resource_metric", "Azure monitor insight metric")
+		return prober
+	}
+
+	testCases := []struct {
+		name          string
+		resourceIds   []string
+		failedTargets []string
+		// stale marked resources
+		expectedStale []string
+	}{
+		{"successful probe", []string{"r1", "r2", "r3"}, nil, nil},
+		// r3 was removed (not failed)
+		{"failed target", []string{"r2"}, []string{"R1"}, []string{"r1"}},
+		// series of failed targets are remembered until the target was fetched successfully
+		{"still failed target", []string{"r2"}, []string{"r1"}, []string{"r1"}},
+		{"recovered target", []string{"r1", "r2"}, nil, nil},
+		{"failed target after recovery", []string{}, []string{"r2"}, []string{"r2"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			prober := newStaleProber(testCase.resourceIds...)
+			for _, resourceId := range testCase.failedTargets {
+				prober.markTargetFailed(resourceId)
+				prober.failedRequests.Add(1)
+			}
+
+			prober.applyStaleSeries()
+
+			staleList := []string{}
+			for _, row := range prober.metricList.GetMetricList("azurerm_resource_metric") {
+				if math.IsNaN(row.Value) {
+					if math.Float64bits(row.Value) != math.Float64bits(staleMarker) {
+						t.Errorf("expected stale marker, got NaN %x", math.Float64bits(row.Value))
+					}
+					staleList = append(staleList, row.Labels["resourceID"])
+				}
+			}
+
+			if len(staleList) != len(testCase.expectedStale) {
+				t.Fatalf("expected stale series %v, got %v", testCase.expectedStale, staleList)
+			}
+			for i, resourceId := range testCase.expectedStale {
+				if staleList[i] != resourceId {
+					t.Errorf("expected stale series %v, got %v", testCase.expectedStale, staleList)
+				}
+			}
+			if len(staleList) > 0 && prober.metricList.GetMetricHelp("azurerm_resource_metric") == "" {
+				t.Error("expected help of stale series")
+			}
+		})
+	}
+}
+
+func TestApplyStaleSeriesFailedSubscription(t *testing.T) {
+	staleCache := cache.New(time.Hour, time.Hour)
+
+	prober := newTestProber(config.Opts{}, nil)
+	prober.EnableStaleSeries(staleCache, "probe")
+	prober.metricList.Add("azurerm_resource_metric", MetricRow{Labels: prometheus.Labels{"resourceID": "r1", "subscriptionID": "s1"}, Value: 1})
+	prober.metricList.Add("azurerm_resource_metric", MetricRow{Labels: prometheus.Labels{"resourceID": "r2", "subscriptionID": "s2"}, Value: 1})
+	prober.applyStaleSeries()
+
+	prober = newTestProber(config.Opts{}, nil)
+	prober.EnableStaleSeries(staleCache, "probe")
+	prober.markSubscriptionsFailed("S1")
+	prober.failedRequests.Add(1)
+	prober.applyStaleSeries()
+
+	rows := prober.metricList.GetMetricList("azurerm_resource_metric")
+	if len(rows) != 1 || rows[0].Labels["subscriptionID"] != "s1" || !math.IsNaN(rows[0].Value) {
+		t.Errorf("expected stale series of failed subscription, got %v", rows)
+	}
+}
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armsubscriptions"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/utils/to"
+)
+
+const (
+	SubscriptionTagLabelPrefix = "subscription_tag_"
+)
+
+// SubscriptionTagLabelName returns the label name of a subscription tag (eg. Cost-Center -> subscription_tag_cost_center)
+func SubscriptionTagLabelName(tagName string) string {
+	return SanitizeLabelName(SubscriptionTagLabelPrefix + strings.ToLower(tagName))
+}
+
+// addSubscriptionTagLabels adds the tags of the subscription set by --metrics.label.subscription-tags as labels,
+// missing tags (or unknown subscriptions) are added as empty labels to keep the label set of all series identical
+func (p *MetricProber) addSubscriptionTagLabels(labels prometheus.Labels, subscription *armsubscriptions.Subscription) prometheus.Labels {
+	for _, tagName := range p.Conf.Metrics.Labels.SubscriptionTags {
+		tagValue := ""
+		if subscription != nil {
+			for subscriptionTagName, subscriptionTagValue := range subscription.Tags {
+				// Azure tag names are case insensitive
+				if strings.EqualFold(subscriptionTagName, tagName) {
+					tagValue = to.String(subscriptionTagValue)
+					break
+				}
+			}
+		}
+		labels[SubscriptionTagLabelName(tagName)] = tagValue
+	}
+
+	return labels
+}
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armsubscriptions"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/azuresdk/armclient"
+	"github.com/webdevops/go-common/utils/to"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func newTestSubscription(tags map[string]*string) *armsubscriptions.Subscription {
+	return &armsubscriptions.Subscription{
+		SubscriptionID: to.StringPtr("00000000-0000-0000-0000-000000000001"),
+		DisplayName:    to.StringPtr("production"),
+		Tags:           tags,
+	}
+}
+
+func TestAddSubscriptionTagLabels(t *testing.T) {
+	testCases := []struct {
+		name         string
+		subscription *armsubscriptions.Subscription
+		expected     prometheus.Labels
+	}{
+		{
+			name:         "tags",
+			subscription: newTestSubscription(map[string]*string{"Cost-Center": to.StringPtr("1234"), "environment": to.StringPtr("prod"), "owner": to.StringPtr("team")}),
+			expected:     prometheus.Labels{"subscription_tag_cost_center": "1234", "subscription_tag_environment": "prod"},
+		},
+		{
+			name:         "missing tag",
+			subscription: newTestSubscription(map[string]*string{"environment": to.StringPtr("prod")}),
+			expected:     prometheus.Labels{"subscription_tag_cost_center": "", "subscription_tag_environment": "prod"},
+		},
+		{
+			name:         "subscription without tags",
+			subscription: newTestSubscription(nil),
+			expected:     prometheus.Labels{"subscription_tag_cost_center": "", "subscription_tag_environment": ""},
+		},
+		{
+			name:         "unknown subscription",
+			subscription: nil,
+			expected:     prometheus.Labels{"subscription_tag_cost_center": "", "subscription_tag_environment": ""},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			conf := config.Opts{}
+			// tag names are case insensitive
+			conf.Metrics.Labels.SubscriptionTags = []string{"cost-center", "Environment"}
+			prober := newTestProber(conf, nil)
+
+			labels := prober.addSubscriptionTagLabels(prometheus.Labels{"resourceID": "r1"}, testCase.subscription)
+
+			if len(labels) != len(testCase.expected)+1 {
+				t.Errorf("expected labels %v, got %v", testCase.expected, labels)
+			}
+			for labelName, expectedValue := range testCase.expected {
+				if value, exists := labels[labelName]; !exists || value != expectedValue {
+					t.Errorf("%s: expected %q, got %q", labelName, expectedValue, value)
+				}
+			}
+		})
+	}
+}
+
+func TestSubscriptionTagLabelsOnSeries(t *testing.T) {
+	conf := config.Opts{}
+	conf.Metrics.Labels.SubscriptionTags = []string{"costCenter"}
+	prober := newTestProber(conf, &RequestMetricSettings{Name: "azurerm_resource_metric", Timespan: "PT1H"})
+	prober.AzureResourceTagManager = &armclient.ResourceTagManager{}
+
+	timestamp := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	result := AzureInsightSubscriptionMetricsResult{
+		AzureInsightBaseMetricsResult: AzureInsightBaseMetricsResult{prober: prober},
+		subscription:                  newTestSubscription(map[string]*string{"costCenter": to.StringPtr("1234")}),
+		interval:                      to.StringPtr("PT1M"),
+		Result: &armmonitor.MetricsClientListAtSubscriptionScopeResponse{
+			SubscriptionScopeMetricResponse: armmonitor.SubscriptionScopeMetricResponse{
+				Value: []*armmonitor.SubscriptionScopeMetric{{
+					Name: &armmonitor.LocalizableString{Value: to.StringPtr("Transactions")},
+					Timeseries: []*armmonitor.TimeSeriesElement{{
+						Data: []*armmonitor.MetricValue{{TimeStamp: &timestamp, Total: to.Float64Ptr(5)}},
+					}},
+				}},
+			},
+		},
+	}
+
+	channel := make(chan PrometheusMetricResult, 10)
+	result.SendMetricToChannel(channel)
+	close(channel)
+
+	series := 0
+	for metric := range channel {
+		series++
+		if value := metric.Labels["subscription_tag_costcenter"]; value != "1234" {
+			t.Errorf("expected subscription_tag_costcenter %q, got %q", "1234", value)
+		}
+	}
+	if series != 1 {
+		t.Errorf("expected 1 series, got %v", series)
+	}
+}
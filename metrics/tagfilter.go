@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// number of resource ids per metric filter (request url length limitation)
+	AzureMetricApiMaxResourceIdFilter = 20
+)
+
+// discoverTaggedResources finds the resources of the resource type matching all tag filters using ResourceGraph,
+// returns the regions and the resource ids (by subscription and region) of the matching resources
+func (p *MetricProber) discoverTaggedResources() (map[string][]string, map[string]map[string][]string, error) {
+	regions := map[string][]string{}
+	resourceIds := map[string]map[string][]string{}
+	for _, subscriptionId := range p.settings.Subscriptions {
+		regions[subscriptionId] = []string{}
+		resourceIds[subscriptionId] = map[string][]string{}
+	}
+
+	query := fmt.Sprintf(`Resources | where type =~ %s`, kqlString(p.settings.ResourceType))
+	for _, tagFilter := range p.settings.TagFilters {
+		query += fmt.Sprintf(` | where tags[%s] =~ %s`, kqlString(tagFilter.Name), kqlString(tagFilter.Value))
+	}
+	if len(p.settings.Regions) >= 1 {
+		regionList := []string{}
+		for _, region := range p.settings.Regions {
+			regionList = append(regionList, kqlString(region))
+		}
+		query += fmt.Sprintf(` | where location in~ (%s)`, strings.Join(regionList, ", "))
+	}
+	query += ` | project id, subscriptionId, location`
+
+	results, err := p.ServiceDiscovery.QueryResourceGraph(query, p.settings.Subscriptions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, row := range results {
+		resourceId, _ := row["id"].(string)
+		subscriptionId, _ := row["subscriptionId"].(string)
+		location, _ := row["location"].(string)
+		if resourceId == "" || subscriptionId == "" {
+			continue
+		}
+
+		if _, exists := resourceIds[subscriptionId]; !exists {
+			resourceIds[subscriptionId] = map[string][]string{}
+		}
+		if _, exists := resourceIds[subscriptionId][location]; !exists {
+			regions[subscriptionId] = append(regions[subscriptionId], location)
+		}
+		resourceIds[subscriptionId][location] = append(resourceIds[subscriptionId][location], resourceId)
+	}
+
+	return regions, resourceIds, nil
+}
+
+// resourceIdFilters builds the metric filters for the resource ids (in chunks of AzureMetricApiMaxResourceIdFilter)
+func resourceIdFilters(resourceIds []string) (filters []string) {
+	for i := 0; i < len(resourceIds); i += AzureMetricApiMaxResourceIdFilter {
+		end := i + AzureMetricApiMaxResourceIdFilter
+		if end > len(resourceIds) {
+			end = len(resourceIds)
+		}
+
+		filterList := []string{}
+		for _, resourceId := range resourceIds[i:end] {
+			filterList = append(filterList, fmt.Sprintf(`Microsoft.ResourceId eq '%s'`, strings.ReplaceAll(resourceId, "'", "''")))
+		}
+		filters = append(filters, strings.Join(filterList, " or "))
+	}
+	return
+}
+
+// kqlString returns the value as quoted Kusto string literal
+func kqlString(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"strings"
+	"unicode"
+)
+
+type (
+	templateTransformFunc func(string) string
+)
+
+var (
+	templateTransforms = map[string]templateTransformFunc{
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+		"snake": templateTransformSnakeCase,
+		"camel": templateTransformCamelCase,
+	}
+)
+
+// parseTemplatePlaceholder splits a template placeholder (eg. "{metric|snake}") into field name and transforms
+func parseTemplatePlaceholder(placeholder string) (fieldName string, transforms []string) {
+	parts := strings.Split(strings.Trim(placeholder, "{}"), "|")
+	fieldName = strings.TrimSpace(parts[0])
+	for _, transform := range parts[1:] {
+		transforms = append(transforms, strings.ToLower(strings.TrimSpace(transform)))
+	}
+	return
+}
+
+// lowercaseTemplateLiterals lowercases the template except its placeholders (field names of labels are case-sensitive)
+func lowercaseTemplateLiterals(template string) string {
+	ret := strings.Builder{}
+	last := 0
+	for _, loc := range metricNamePlaceholders.FindAllStringIndex(template, -1) {
+		ret.WriteString(strings.ToLower(template[last:loc[0]]))
+		ret.WriteString(template[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	ret.WriteString(strings.ToLower(template[last:]))
+	return ret.String()
+}
+
+// applyTemplateTransforms applies the transform functions in order, unknown functions are ignored
+func applyTemplateTransforms(value string, transforms []string) string {
+	for _, transform := range transforms {
+		if transformFunc, exists := templateTransforms[transform]; exists {
+			value = transformFunc(value)
+		}
+	}
+	return value
+}
+
+// splitTemplateWords splits a value into words by separators and case changes (eg. "CPUCreditsConsumed" = "CPU", "Credits", "Consumed")
+func splitTemplateWords(value string) (words []string) {
+	for _, field := range strings.FieldsFunc(value, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		runes := []rune(field)
+		start := 0
+		for i := 1; i < len(runes); i++ {
+			prev, cur := runes[i-1], runes[i]
+			switch {
+			case unicode.IsLower(prev) && unicode.IsUpper(cur):
+				// "serviceApi" -> "service", "Api"
+			case unicode.IsUpper(prev) && unicode.IsUpper(cur) && i+1 < len(runes) && unicode.IsLower(runes[i+1]):
+				// "CPUCredits" -> "CPU", "Credits"
+			default:
+				continue
+			}
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+		words = append(words, string(runes[start:]))
+	}
+	return
+}
+
+func templateTransformSnakeCase(value string) string {
+	words := splitTemplateWords(value)
+	for i, word := range words {
+		words[i] = strings.ToLower(word)
+	}
+	return strings.Join(words, "_")
+}
+
+func templateTransformCamelCase(value string) string {
+	words := splitTemplateWords(value)
+	for i, word := range words {
+		word = strings.ToLower(word)
+		if i > 0 {
+			runes := []rune(word)
+			runes[0] = unicode.ToUpper(runes[0])
+			word = string(runes)
+		}
+		words[i] = word
+	}
+	return strings.Join(words, "")
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func TestApplyTemplateTransforms(t *testing.T) {
+	testCases := []struct {
+		transforms []string
+		expected   string
+	}{
+		{[]string{"lower"}, "cpu credits consumed"},
+		{[]string{"upper"}, "CPU CREDITS CONSUMED"},
+		{[]string{"snake"}, "cpu_credits_consumed"},
+		{[]string{"camel"}, "cpuCreditsConsumed"},
+		{[]string{"snake", "upper"}, "CPU_CREDITS_CONSUMED"},
+		{[]string{"unknown"}, "CPU Credits Consumed"},
+	}
+
+	for _, testCase := range testCases {
+		if ret := applyTemplateTransforms("CPU Credits Consumed", testCase.transforms); ret != testCase.expected {
+			t.Errorf("%v: expected %q, got %q", testCase.transforms, testCase.expected, ret)
+		}
+	}
+}
+
+// transformed placeholders keep their case in metric names, everything else is lowercased
+func TestBuildMetricNameTransforms(t *testing.T) {
+	testCases := []struct {
+		template string
+		expected string
+	}{
+		{"azure_{metric}", "azure_cpu_credits_consumed"},
+		{"azure_{metric|lower}", "azure_cpu_credits_consumed"},
+		{"azure_{metric|upper}", "azure_CPU_CREDITS_CONSUMED"},
+		{"azure_{metric|snake}", "azure_cpu_credits_consumed"},
+		{"azure_{metric|camel}", "azure_cpuCreditsConsumed"},
+		{"Azure_{metric|camel}_{aggregation}", "azure_cpuCreditsConsumed_average"},
+	}
+
+	for _, testCase := range testCases {
+		prober := newTestProber(config.Opts{}, &RequestMetricSettings{Name: "azurerm_resource_metric", MetricTemplate: testCase.template})
+		result := AzureInsightBaseMetricsResult{prober: prober}
+
+		metric := result.buildMetric(prometheus.Labels{"metric": "CPU Credits Consumed", "aggregation": "Average"}, 1)
+		if metric.Name != testCase.expected {
+			t.Errorf("%s: expected metric name %q, got %q", testCase.template, testCase.expected, metric.Name)
+		}
+	}
+}
@@ -1,14 +1,28 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	stringsCommon "github.com/webdevops/go-common/strings"
 	"go.uber.org/zap"
+
+	"github.com/webdevops/azure-metrics-exporter/metrics"
+)
+
+const (
+	// failed probes respond with an HTTP error status (default)
+	ProbeFailureResponseStatus = "status"
+	// failed probes respond with 200 and azure_metrics_probe_success=0 (like blackbox_exporter)
+	ProbeFailureResponseMetrics = "metrics"
 )
 
 func buildContextLoggerFromRequest(r *http.Request) *zap.SugaredLogger {
@@ -31,6 +45,11 @@ func getPrometheusTimeout(r *http.Request, defaultTimeout float64) (timeout floa
 		if err != nil {
 			return
 		}
+
+		// finish before Prometheus gives up on the scrape (--probe.timeout-buffer)
+		if buffer := Opts.Prober.TimeoutBuffer.Seconds(); timeout > buffer {
+			timeout -= buffer
+		}
 	}
 	if timeout == 0 {
 		timeout = defaultTimeout
@@ -65,3 +84,33 @@ func paramsGetListRequired(params url.Values, name string) (list []string, err e
 
 	return
 }
+
+// probeErrorStatusCode returns the response status for a failed probe (504 if the probe timed out)
+func probeErrorStatusCode(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadRequest
+}
+
+// writeProbeFailure responds to a probe which failed before metrics were collected (eg. invalid parameters),
+// with --prober.failure-response=metrics (Prometheus format only) with 200, azure_metrics_probe_success=0 and
+// azurerm_probe_error (reason bad_request for 400 and 403, otherwise the classified error), otherwise with the HTTP error status
+func writeProbeFailure(w http.ResponseWriter, r *http.Request, format string, startTime time.Time, err error, statusCode int) {
+	if Opts.Prober.FailureResponse != ProbeFailureResponseMetrics || format != ResponseFormatPrometheus {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	reason := metrics.ClassifyProbeError(err)
+	if statusCode == http.StatusBadRequest || statusCode == http.StatusForbidden {
+		reason = metrics.ProbeErrorReasonBadRequest
+	}
+
+	registry := prometheus.NewRegistry()
+	prober := metrics.NewMetricProber(r.Context(), buildContextLoggerFromRequest(r), w, &metrics.RequestMetricSettings{}, Opts)
+	prober.SetPrometheusRegistry(registry)
+	prober.PublishProbeFailureReason(reason)
+	prober.PublishProbeStatus(startTime)
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestWriteProbeFailure(t *testing.T) {
+	logger = zap.NewNop().Sugar()
+	defer func(failureResponse string) { Opts.Prober.FailureResponse = failureResponse }(Opts.Prober.FailureResponse)
+
+	testCases := []struct {
+		name            string
+		failureResponse string
+		format          string
+		statusCode      int
+		expectedStatus  int
+		expectedBody    []string
+	}{
+		{
+			name:            "metrics",
+			failureResponse: ProbeFailureResponseMetrics,
+			format:          ResponseFormatPrometheus,
+			statusCode:      http.StatusBadRequest,
+			expectedStatus:  http.StatusOK,
+			expectedBody:    []string{"azure_metrics_probe_success 0", `azurerm_probe_error{reason="bad_request"} 1`},
+		},
+		{
+			name:            "metrics with other format",
+			failureResponse: ProbeFailureResponseMetrics,
+			format:          ResponseFormatJson,
+			statusCode:      http.StatusBadRequest,
+			expectedStatus:  http.StatusBadRequest,
+			expectedBody:    []string{"invalid parameter"},
+		},
+		{
+			name:            "status",
+			failureResponse: ProbeFailureResponseStatus,
+			format:          ResponseFormatPrometheus,
+			statusCode:      http.StatusBadRequest,
+			expectedStatus:  http.StatusBadRequest,
+			expectedBody:    []string{"invalid parameter"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			Opts.Prober.FailureResponse = testCase.failureResponse
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/probe/metrics", nil)
+			writeProbeFailure(w, r, testCase.format, time.Now(), errors.New("invalid parameter"), testCase.statusCode)
+
+			if w.Code != testCase.expectedStatus {
+				t.Errorf("expected status %v, got %v", testCase.expectedStatus, w.Code)
+			}
+			for _, expected := range testCase.expectedBody {
+				if !strings.Contains(w.Body.String(), expected) {
+					t.Errorf("expected %q in response, got:\n%s", expected, w.Body.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/sha1" // #nosec G505
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+var (
+	// parameters which don't change the result of a probe and are not part of the cache key
+	probeCacheKeyIgnoredParams = map[string]bool{
+		"cacheMode": true,
+	}
+
+	// parameters with case-insensitive values
+	probeCacheKeyCaseInsensitiveParams = map[string]bool{
+		"aggregation":  true,
+		"subscription": true,
+	}
+
+	// list parameters (comma lists or repeated parameters) where order and duplicates don't change the result
+	probeCacheKeyListParams = map[string]bool{
+		"metric":       true,
+		"aggregation":  true,
+		"subscription": true,
+		"target":       true,
+	}
+)
+
+// probeCacheKey builds the cache key of a probe from its canonicalized parameters,
+// so semantically-equal probes (eg. different parameter order) share cache entries
+func probeCacheKey(prefix string, r *http.Request) string {
+	return fmt.Sprintf("%s:%x", prefix, sha1.Sum([]byte(r.URL.Path+"?"+canonicalProbeParams(r.URL.Query())))) // #nosec G401
+}
+
+// canonicalProbeParams returns the parameters sorted by name with trimmed comma lists,
+// case-insensitive values are lowercased and list parameters are merged, deduplicated and sorted
+func canonicalProbeParams(params url.Values) string {
+	canonical := url.Values{}
+	for name, valueList := range params {
+		if probeCacheKeyIgnoredParams[name] {
+			continue
+		}
+
+		if probeCacheKeyListParams[name] {
+			itemList := []string{}
+			for _, value := range valueList {
+				for _, item := range strings.Split(value, ",") {
+					if item = canonicalProbeParamValue(name, item); item != "" {
+						itemList = append(itemList, item)
+					}
+				}
+			}
+			slices.Sort(itemList)
+			canonical.Set(name, strings.Join(slices.Compact(itemList), ","))
+			continue
+		}
+
+		for _, value := range valueList {
+			itemList := strings.Split(value, ",")
+			for i, item := range itemList {
+				itemList[i] = canonicalProbeParamValue(name, item)
+			}
+			canonical.Add(name, strings.Join(itemList, ","))
+		}
+	}
+
+	// url.Values.Encode sorts by parameter name, the order of the values of other parameters is kept
+	return canonical.Encode()
+}
+
+// canonicalProbeParamValue trims the value and lowercases case-insensitive values
+func canonicalProbeParamValue(name, value string) string {
+	value = strings.TrimSpace(value)
+	if probeCacheKeyCaseInsensitiveParams[name] {
+		value = strings.ToLower(value)
+	}
+	return value
+}
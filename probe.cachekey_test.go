@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProbeCacheKey(t *testing.T) {
+	testCases := []struct {
+		name     string
+		url      string
+		otherUrl string
+		equal    bool
+	}{
+		{
+			name:     "parameter order",
+			url:      "/probe/metrics/resource?metric=A&aggregation=Average",
+			otherUrl: "/probe/metrics/resource?aggregation=Average&metric=A",
+			equal:    true,
+		},
+		{
+			name:     "whitespace in comma lists",
+			url:      "/probe/metrics/resource?metric=A,B",
+			otherUrl: "/probe/metrics/resource?metric=A,%20B",
+			equal:    true,
+		},
+		{
+			name:     "order of comma lists",
+			url:      "/probe/metrics/resource?metric=A,B&aggregation=average,total",
+			otherUrl: "/probe/metrics/resource?metric=B,A&aggregation=total,average",
+			equal:    true,
+		},
+		{
+			name:     "comma lists and repeated parameters",
+			url:      "/probe/metrics/resource?target=/subscriptions/xxx/r1,/subscriptions/xxx/r2",
+			otherUrl: "/probe/metrics/resource?target=/subscriptions/xxx/r2&target=/subscriptions/xxx/r1",
+			equal:    true,
+		},
+		{
+			name:     "duplicates",
+			url:      "/probe/metrics/resource?metric=A,B",
+			otherUrl: "/probe/metrics/resource?metric=A,B,A",
+			equal:    true,
+		},
+		{
+			name:     "case of aggregation",
+			url:      "/probe/metrics/resource?aggregation=Average",
+			otherUrl: "/probe/metrics/resource?aggregation=average",
+			equal:    true,
+		},
+		{
+			name:     "case of subscription",
+			url:      "/probe/metrics/resource?subscription=ABCDEF00-0000-0000-0000-000000000001",
+			otherUrl: "/probe/metrics/resource?subscription=abcdef00-0000-0000-0000-000000000001",
+			equal:    true,
+		},
+		{
+			name:     "cacheMode",
+			url:      "/probe/metrics/resource?metric=A&cacheMode=refresh",
+			otherUrl: "/probe/metrics/resource?metric=A",
+			equal:    true,
+		},
+		{
+			name:     "different metrics",
+			url:      "/probe/metrics/resource?metric=A",
+			otherUrl: "/probe/metrics/resource?metric=A,B",
+			equal:    false,
+		},
+		{
+			name:     "case of metric filter",
+			url:      "/probe/metrics/resource?filter=Name%20eq%20'A'",
+			otherUrl: "/probe/metrics/resource?filter=name%20eq%20'a'",
+			equal:    false,
+		},
+		{
+			name:     "different endpoint",
+			url:      "/probe/metrics/resource?metric=A",
+			otherUrl: "/probe/metrics/list?metric=A",
+			equal:    false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			key := probeCacheKey("resource", httptest.NewRequest("GET", testCase.url, nil))
+			otherKey := probeCacheKey("resource", httptest.NewRequest("GET", testCase.otherUrl, nil))
+
+			if (key == otherKey) != testCase.equal {
+				t.Errorf("expected equal cache keys %v for %s and %s", testCase.equal, testCase.url, testCase.otherUrl)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+// probeDefaultParamsList returns the configured default parameters per probe handler
+func probeDefaultParamsList() map[string]config.ProbeDefaultParams {
+	return map[string]config.ProbeDefaultParams{
+		config.ProbeMetricsSubscriptionUrl:  config.ProbeDefaultParams(Opts.Prober.Defaults.Subscription),
+		config.ProbeMetricsResourceUrl:      config.ProbeDefaultParams(Opts.Prober.Defaults.Resource),
+		config.ProbeMetricsListUrl:          config.ProbeDefaultParams(Opts.Prober.Defaults.List),
+		config.ProbeMetricsScrapeUrl:        config.ProbeDefaultParams(Opts.Prober.Defaults.Scrape),
+		config.ProbeMetricsResourceGraphUrl: config.ProbeDefaultParams(Opts.Prober.Defaults.ResourceGraph),
+	}
+}
+
+// applyProbeDefaultParams sets the default parameters of the handler for parameters which are not set by the request,
+// returns the applied defaults (name=value)
+func applyProbeDefaultParams(r *http.Request, handlerUrl string) (applied []string) {
+	defaults, exists := probeDefaultParamsList()[handlerUrl]
+	if !exists {
+		return
+	}
+
+	params := r.URL.Query()
+	setDefault := func(name string, values ...string) {
+		if len(values) == 0 || values[0] == "" || params.Has(name) {
+			return
+		}
+		params[name] = values
+		applied = append(applied, fmt.Sprintf("%s=%s", name, strings.Join(values, ",")))
+	}
+
+	setDefault("aggregation", defaults.Aggregation...)
+	setDefault("interval", defaults.Interval)
+	setDefault("timespan", defaults.Timespan)
+
+	if len(applied) >= 1 {
+		r.URL.RawQuery = params.Encode()
+	}
+
+	return
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func TestApplyProbeDefaultParams(t *testing.T) {
+	defer func(opts config.Opts) { Opts = opts }(Opts)
+	Opts.Prober.Defaults.Resource.Aggregation = []string{"average", "maximum"}
+	Opts.Prober.Defaults.Resource.Interval = "PT5M"
+	Opts.Prober.Defaults.Resource.Timespan = "PT1H"
+	Opts.Prober.Defaults.List.Interval = "PT15M"
+
+	testCases := []struct {
+		name            string
+		handlerUrl      string
+		query           string
+		expected        map[string][]string
+		expectedApplied []string
+	}{
+		{
+			name:            "defaults",
+			handlerUrl:      config.ProbeMetricsResourceUrl,
+			query:           "target=r1",
+			expected:        map[string][]string{"aggregation": {"average", "maximum"}, "interval": {"PT5M"}, "timespan": {"PT1H"}},
+			expectedApplied: []string{"aggregation=average,maximum", "interval=PT5M", "timespan=PT1H"},
+		},
+		{
+			name:            "url params override defaults",
+			handlerUrl:      config.ProbeMetricsResourceUrl,
+			query:           "target=r1&aggregation=total&interval=PT1M",
+			expected:        map[string][]string{"aggregation": {"total"}, "interval": {"PT1M"}, "timespan": {"PT1H"}},
+			expectedApplied: []string{"timespan=PT1H"},
+		},
+		{
+			name:       "empty url param overrides default",
+			handlerUrl: config.ProbeMetricsResourceUrl,
+			query:      "target=r1&aggregation=&interval=PT1M&timespan=PT6H",
+			expected:   map[string][]string{"aggregation": {""}, "interval": {"PT1M"}, "timespan": {"PT6H"}},
+		},
+		{
+			name:            "defaults of handler",
+			handlerUrl:      config.ProbeMetricsListUrl,
+			query:           "target=r1",
+			expected:        map[string][]string{"interval": {"PT15M"}},
+			expectedApplied: []string{"interval=PT15M"},
+		},
+		{
+			name:       "handler without defaults",
+			handlerUrl: config.ProbeMetricsSubscriptionUrl,
+			query:      "target=r1",
+			expected:   map[string][]string{},
+		},
+		{
+			name:       "unknown handler",
+			handlerUrl: "/probe/unknown",
+			query:      "target=r1",
+			expected:   map[string][]string{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", testCase.handlerUrl+"?"+testCase.query, nil)
+			applied := applyProbeDefaultParams(r, testCase.handlerUrl)
+
+			if !reflect.DeepEqual(applied, testCase.expectedApplied) {
+				t.Errorf("expected applied defaults %v, got %v", testCase.expectedApplied, applied)
+			}
+
+			params := r.URL.Query()
+			if target := params.Get("target"); target != "r1" {
+				t.Errorf("expected unchanged target, got %q", target)
+			}
+			for _, name := range []string{"aggregation", "interval", "timespan"} {
+				if value, expected := params[name], testCase.expected[name]; strings.Join(value, ",") != strings.Join(expected, ",") || len(value) != len(expected) {
+					t.Errorf("%s: expected %v, got %v", name, expected, value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	ResponseFormatPrometheus = "prometheus"
+	ResponseFormatInflux     = "influx"
+	ResponseFormatJson       = "json"
+)
+
+var (
+	// media types of the Accept header which select a response format
+	// (text/plain only with version parameter, as sent by Prometheus for the text exposition format)
+	responseFormatAcceptTypes = map[string]string{
+		"application/openmetrics-text": ResponseFormatPrometheus,
+		"text/plain":                   ResponseFormatPrometheus,
+	}
+)
+
+// negotiateResponseFormat returns the response format of the request:
+// explicit format parameter > recognized Accept header > configured default
+func negotiateResponseFormat(r *http.Request, defaultFormat string) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+
+	for _, acceptType := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(acceptType))
+		if err != nil {
+			continue
+		}
+
+		if mediaType == "text/plain" && params["version"] == "" {
+			continue
+		}
+
+		if format, exists := responseFormatAcceptTypes[mediaType]; exists {
+			return format
+		}
+	}
+
+	if defaultFormat != "" {
+		return defaultFormat
+	}
+
+	return ResponseFormatPrometheus
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// precedence: explicit format parameter > recognized Accept header > configured default
+func TestNegotiateResponseFormat(t *testing.T) {
+	testCases := []struct {
+		name          string
+		query         string
+		accept        string
+		defaultFormat string
+		expected      string
+	}{
+		{"param", "format=json", "", ResponseFormatInflux, ResponseFormatJson},
+		{"param over Accept header", "format=influx", "application/openmetrics-text; version=1.0.0", ResponseFormatJson, ResponseFormatInflux},
+		{"Accept header over default", "", "application/openmetrics-text; version=1.0.0,text/plain;version=0.0.4;q=0.5", ResponseFormatJson, ResponseFormatPrometheus},
+		{"Prometheus text Accept header", "", "text/plain; version=0.0.4; charset=utf-8", ResponseFormatJson, ResponseFormatPrometheus},
+		{"unrecognized Accept header", "", "text/html,*/*", ResponseFormatJson, ResponseFormatJson},
+		{"text/plain without version", "", "text/plain", ResponseFormatJson, ResponseFormatJson},
+		{"invalid Accept header", "", ";;;", ResponseFormatInflux, ResponseFormatInflux},
+		{"default", "", "", ResponseFormatJson, ResponseFormatJson},
+		{"no default", "", "", "", ResponseFormatPrometheus},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/probe/metrics/resource?"+testCase.query, nil)
+			if testCase.accept != "" {
+				r.Header.Set("Accept", testCase.accept)
+			}
+
+			if format := negotiateResponseFormat(r, testCase.defaultFormat); format != testCase.expected {
+				t.Errorf("expected format %q, got %q", testCase.expected, format)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+	"github.com/webdevops/azure-metrics-exporter/metrics"
+
+	"go.uber.org/zap"
+)
+
+func probeActivityLogHandler(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var timeoutSeconds float64
+
+	startTime := time.Now()
+	contextLogger := buildContextLoggerFromRequest(r)
+	registry := prometheus.NewRegistry()
+
+	// If a timeout is configured via the Prometheus header, add it to the request.
+	timeoutSeconds, err = getPrometheusTimeout(r, config.ProbeActivityLogTimeoutDefault)
+	if err != nil {
+		contextLogger.Warnln(err)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, fmt.Errorf("failed to parse timeout from Prometheus header: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := newProbeContext(r, timeoutSeconds)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	var settings metrics.RequestMetricSettings
+	if settings, err = metrics.NewRequestMetricSettings(r, Opts); err != nil {
+		contextLogger.Warnln(err)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, err, http.StatusBadRequest)
+		return
+	}
+
+	windowString := r.URL.Query().Get("window")
+	if windowString == "" {
+		windowString = "1h"
+	}
+
+	window, err := time.ParseDuration(windowString)
+	if err != nil || window <= 0 || window > metrics.ActivityLogMaxWindow {
+		err = fmt.Errorf(`parameter "window" must be a duration between 0 and %s`, metrics.ActivityLogMaxWindow.String())
+		contextLogger.Warnln(err)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, err, http.StatusBadRequest)
+		return
+	}
+
+	resourceIds, err := paramsGetList(r.URL.Query(), "target")
+	if err != nil {
+		contextLogger.Warnln(err)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, err, http.StatusBadRequest)
+		return
+	}
+
+	prober := metrics.NewMetricProber(ctx, contextLogger, w, &settings, Opts)
+	prober.SetUserAgent(userAgent())
+	prober.SetAzureClient(AzureClient)
+	prober.SetPrometheusRegistry(registry)
+	if settings.Cache != nil {
+		cacheKey := probeCacheKey("activitylog", r)
+		prober.EnableMetricsCache(metricsCache, cacheKey, settings.CacheDuration(startTime))
+	}
+
+	if !prober.FetchFromCache() {
+		prober.RegisterSubscriptionCollectFinishCallback(func(subscriptionId string) {
+			// global stats counter
+			prometheusCollectTime.With(prometheus.Labels{
+				"subscriptionID": subscriptionId,
+				"handler":        config.ProbeActivityLogUrl,
+				"filter":         "",
+			}).Observe(time.Since(startTime).Seconds())
+		})
+
+		prober.RunActivityLog(window, resourceIds)
+	} else {
+		w.Header().Add("X-metrics-cached", "true")
+		for _, subscriptionId := range settings.Subscriptions {
+			prometheusMetricRequests.With(prometheus.Labels{
+				"subscriptionID": subscriptionId,
+				"handler":        config.ProbeActivityLogUrl,
+				"filter":         "",
+				"result":         "cached",
+			}).Inc()
+		}
+	}
+
+	prober.PublishProbeStatus(startTime)
+	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	h.ServeHTTP(w, r)
+
+	latency := time.Since(startTime)
+	contextLogger.With(
+		zap.String("method", r.Method),
+		zap.Int("status", http.StatusOK),
+		zap.String("latency", latency.String()),
+	).Debug("Request handled for /probe/activitylog")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+	"github.com/webdevops/azure-metrics-exporter/metrics"
+
+	"go.uber.org/zap"
+)
+
+func probeDiagnosticSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var timeoutSeconds float64
+
+	startTime := time.Now()
+	contextLogger := buildContextLoggerFromRequest(r)
+	registry := prometheus.NewRegistry()
+
+	// If a timeout is configured via the Prometheus header, add it to the request.
+	timeoutSeconds, err = getPrometheusTimeout(r, config.ProbeDiagnosticSettingsTimeoutDefault)
+	if err != nil {
+		contextLogger.Warnln(err)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, fmt.Errorf("failed to parse timeout from Prometheus header: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := newProbeContext(r, timeoutSeconds)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	var settings metrics.RequestMetricSettings
+	if settings, err = metrics.NewRequestMetricSettingsForAzureResourceApi(r, Opts); err != nil {
+		contextLogger.Warnln(err)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, err, http.StatusBadRequest)
+		return
+	}
+
+	if _, err = paramsGetListRequired(r.URL.Query(), "subscription"); err != nil {
+		contextLogger.Warnln(err)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, err, http.StatusBadRequest)
+		return
+	}
+
+	prober := metrics.NewMetricProber(ctx, contextLogger, w, &settings, Opts)
+	prober.SetUserAgent(userAgent())
+	prober.SetAzureClient(AzureClient)
+	prober.SetPrometheusRegistry(registry)
+	if settings.Cache != nil {
+		cacheKey := probeCacheKey("diagnosticsettings", r)
+		prober.EnableMetricsCache(metricsCache, cacheKey, settings.CacheDuration(startTime))
+	}
+
+	if Opts.Azure.ServiceDiscovery.CacheDuration.Seconds() > 0 {
+		prober.EnableServiceDiscoveryCache(azureCache, Opts.Azure.ServiceDiscovery.CacheDuration)
+	}
+
+	if !prober.FetchFromCache() {
+		for _, subscription := range settings.Subscriptions {
+			prober.ServiceDiscovery.FindSubscriptionResources(subscription, settings.Filter)
+		}
+
+		prober.RegisterSubscriptionCollectFinishCallback(func(subscriptionId string) {
+			// global stats counter
+			prometheusCollectTime.With(prometheus.Labels{
+				"subscriptionID": subscriptionId,
+				"handler":        config.ProbeDiagnosticSettingsUrl,
+				"filter":         settings.Filter,
+			}).Observe(time.Since(startTime).Seconds())
+		})
+
+		prober.RegisterRequestResultCallback(probeRequestResultCallback(r, config.ProbeDiagnosticSettingsUrl, settings.Filter))
+
+		prober.RunDiagnosticSettings()
+	} else {
+		w.Header().Add("X-metrics-cached", "true")
+		for _, subscriptionId := range settings.Subscriptions {
+			prometheusMetricRequests.With(prometheus.Labels{
+				"subscriptionID": subscriptionId,
+				"handler":        config.ProbeDiagnosticSettingsUrl,
+				"filter":         settings.Filter,
+				"result":         "cached",
+			}).Inc()
+		}
+	}
+
+	prober.PublishProbeStatus(startTime)
+	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	h.ServeHTTP(w, r)
+
+	latency := time.Since(startTime)
+	contextLogger.With(
+		zap.String("method", r.Method),
+		zap.Int("status", http.StatusOK),
+		zap.String("latency", latency.String()),
+	).Debug("Request handled for /probe/diagnosticsettings")
+}
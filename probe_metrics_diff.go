@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+	"github.com/webdevops/azure-metrics-exporter/metrics"
+
+	"go.uber.org/zap"
+)
+
+type (
+	probeMetricsDiffResult struct {
+		ResourceID string   `json:"resourceID"`
+		Available  []string `json:"available"`
+		Missing    []string `json:"missing"`
+		New        []string `json:"new"`
+	}
+)
+
+func probeMetricsDiffHandler(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var timeoutSeconds float64
+
+	startTime := time.Now()
+	contextLogger := buildContextLoggerFromRequest(r)
+
+	// If a timeout is configured via the Prometheus header, add it to the request.
+	timeoutSeconds, err = getPrometheusTimeout(r, config.ProbeMetricsDiffTimeoutDefault)
+	if err != nil {
+		contextLogger.Warnln(err)
+		http.Error(w, fmt.Sprintf("failed to parse timeout from Prometheus header: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := newProbeContext(r, timeoutSeconds)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	resourceId, err := paramsGetRequired(r.URL.Query(), "target")
+	if err != nil {
+		contextLogger.Warnln(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	expectedMetrics, err := paramsGetListRequired(r.URL.Query(), "metric")
+	if err != nil {
+		contextLogger.Warnln(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	settings := metrics.RequestMetricSettings{
+		MetricNamespace: r.URL.Query().Get("metricNamespace"),
+	}
+
+	prober := metrics.NewMetricProber(ctx, contextLogger, w, &settings, Opts)
+	prober.SetUserAgent(userAgent())
+	prober.SetAzureClient(AzureClient)
+
+	if Opts.Azure.ServiceDiscovery.CacheDuration.Seconds() > 0 {
+		prober.EnableServiceDiscoveryCache(azureCache, Opts.Azure.ServiceDiscovery.CacheDuration)
+	}
+
+	if Opts.Cache.DefinitionsTTL > 0 {
+		prober.EnableMetricDefinitionsCache(definitionsCache, Opts.Cache.DefinitionsTTL)
+	}
+
+	definitionList, err := prober.FetchMetricDefinitions(resourceId)
+	if err != nil {
+		contextLogger.Errorln(err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	result := diffMetricDefinitions(resourceId, expectedMetrics, definitionList)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		contextLogger.Error(err)
+	}
+
+	latency := time.Since(startTime)
+	contextLogger.With(
+		zap.String("method", r.Method),
+		zap.Int("status", http.StatusOK),
+		zap.String("latency", latency.String()),
+	).Debug("Request handled for /probe/metrics/diff")
+}
+
+// diffMetricDefinitions compares the expected metrics with the metric definitions of a resource
+func diffMetricDefinitions(resourceId string, expectedMetrics []string, definitionList []metrics.MetricDefinition) probeMetricsDiffResult {
+	result := probeMetricsDiffResult{
+		ResourceID: resourceId,
+		Available:  []string{},
+		Missing:    []string{},
+		New:        []string{},
+	}
+
+	availableMetrics := map[string]string{}
+	for _, definition := range definitionList {
+		availableMetrics[strings.ToLower(definition.Name)] = definition.Name
+	}
+
+	// expected metrics are matched case insensitive, duplicates are only reported once
+	matchedMetrics := map[string]bool{}
+	for _, metricName := range expectedMetrics {
+		metricName = strings.TrimSpace(metricName)
+		metricKey := strings.ToLower(metricName)
+		if matchedMetrics[metricKey] {
+			continue
+		}
+		matchedMetrics[metricKey] = true
+
+		if name, exists := availableMetrics[metricKey]; exists {
+			result.Available = append(result.Available, name)
+		} else {
+			result.Missing = append(result.Missing, metricName)
+		}
+	}
+
+	for metricKey, name := range availableMetrics {
+		if !matchedMetrics[metricKey] {
+			result.New = append(result.New, name)
+		}
+	}
+	sort.Strings(result.New)
+
+	return result
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/webdevops/azure-metrics-exporter/metrics"
+)
+
+func TestDiffMetricDefinitions(t *testing.T) {
+	definitionList := []metrics.MetricDefinition{
+		{Name: "Transactions"},
+		{Name: "Ingress"},
+		{Name: "Egress"},
+		{Name: "Availability"},
+	}
+
+	testCases := []struct {
+		name              string
+		expected          []string
+		expectedAvailable []string
+		expectedMissing   []string
+		expectedNew       []string
+	}{
+		{
+			name:              "all available",
+			expected:          []string{"Transactions", "Ingress", "Egress", "Availability"},
+			expectedAvailable: []string{"Transactions", "Ingress", "Egress", "Availability"},
+			expectedMissing:   []string{},
+			expectedNew:       []string{},
+		},
+		{
+			name:              "missing and new metrics",
+			expected:          []string{"Transactions", "UsedCapacity"},
+			expectedAvailable: []string{"Transactions"},
+			expectedMissing:   []string{"UsedCapacity"},
+			expectedNew:       []string{"Availability", "Egress", "Ingress"},
+		},
+		{
+			name:              "case insensitive",
+			expected:          []string{" transactions", "INGRESS", "Egress", "availability "},
+			expectedAvailable: []string{"Transactions", "Ingress", "Egress", "Availability"},
+			expectedMissing:   []string{},
+			expectedNew:       []string{},
+		},
+		{
+			name:              "duplicates reported once",
+			expected:          []string{"Transactions", "transactions", "UsedCapacity", "usedcapacity"},
+			expectedAvailable: []string{"Transactions"},
+			expectedMissing:   []string{"UsedCapacity"},
+			expectedNew:       []string{"Availability", "Egress", "Ingress"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			result := diffMetricDefinitions("r1", testCase.expected, definitionList)
+
+			if !reflect.DeepEqual(result.Available, testCase.expectedAvailable) {
+				t.Errorf("expected available metrics %v, got %v", testCase.expectedAvailable, result.Available)
+			}
+			if !reflect.DeepEqual(result.Missing, testCase.expectedMissing) {
+				t.Errorf("expected missing metrics %v, got %v", testCase.expectedMissing, result.Missing)
+			}
+			if !reflect.DeepEqual(result.New, testCase.expectedNew) {
+				t.Errorf("expected new metrics %v, got %v", testCase.expectedNew, result.New)
+			}
+		})
+	}
+}
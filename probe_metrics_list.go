@@ -1,10 +1,10 @@
 package main
 
 import (
-	"context"
-	"crypto/sha1" // #nosec G505
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -21,48 +21,71 @@ func probeMetricsListHandler(w http.ResponseWriter, r *http.Request) {
 	var timeoutSeconds float64
 
 	startTime := time.Now()
+	defaultParams := applyProbeDefaultParams(r, config.ProbeMetricsListUrl)
 	contextLogger := buildContextLoggerFromRequest(r)
+	if len(defaultParams) >= 1 {
+		contextLogger.Debugf("using default parameters: %s", strings.Join(defaultParams, "&"))
+	}
 	registry := prometheus.NewRegistry()
 
 	// If a timeout is configured via the Prometheus header, add it to the request.
 	timeoutSeconds, err = getPrometheusTimeout(r, config.ProbeMetricsListTimeoutDefault)
 	if err != nil {
 		contextLogger.Warnln(err)
-		http.Error(w, fmt.Sprintf("failed to parse timeout from Prometheus header: %s", err), http.StatusBadRequest)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, fmt.Errorf("failed to parse timeout from Prometheus header: %w", err), http.StatusBadRequest)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSeconds*float64(time.Second)))
+	ctx, cancel := newProbeContext(r, timeoutSeconds)
 	defer cancel()
 	r = r.WithContext(ctx)
 
 	var settings metrics.RequestMetricSettings
 	if settings, err = metrics.NewRequestMetricSettingsForAzureResourceApi(r, Opts); err != nil {
 		contextLogger.Warnln(err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, err, http.StatusBadRequest)
 		return
 	}
 
 	if _, err = paramsGetListRequired(r.URL.Query(), "subscription"); err != nil {
 		contextLogger.Warnln(err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, err, http.StatusBadRequest)
 		return
 	}
 
+	// param includeDimensions (only supported by the list handler)
+	if val := r.URL.Query().Get("includeDimensions"); val != "" {
+		if settings.IncludeDimensions, err = strconv.ParseBool(val); err != nil {
+			err = fmt.Errorf(`invalid value for parameter "includeDimensions": %w`, err)
+			contextLogger.Warnln(err)
+			writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, err, http.StatusBadRequest)
+			return
+		}
+	}
+
 	prober := metrics.NewMetricProber(ctx, contextLogger, w, &settings, Opts)
-	prober.SetUserAgent(UserAgent + gitTag)
+	prober.SetUserAgent(userAgent())
 	prober.SetAzureClient(AzureClient)
-	prober.SetAzureResourceTagManager(AzureResourceTagManager)
+	prober.SetAzureResourceTagManager(currentResourceTagManager())
 	prober.SetPrometheusRegistry(registry)
 	if settings.Cache != nil {
-		cacheKey := fmt.Sprintf("list:%x", sha1.Sum([]byte(r.URL.String()))) // #nosec G401
+		cacheKey := probeCacheKey("list", r)
 		prober.EnableMetricsCache(metricsCache, cacheKey, settings.CacheDuration(startTime))
 	}
 
+	if Opts.Prober.EmitStaleOnFailure {
+		staleKey := probeCacheKey("list", r)
+		prober.EnableStaleSeries(staleSeriesCache, staleKey)
+	}
+
 	if Opts.Azure.ServiceDiscovery.CacheDuration.Seconds() > 0 {
 		prober.EnableServiceDiscoveryCache(azureCache, Opts.Azure.ServiceDiscovery.CacheDuration)
 	}
 
+	if Opts.Cache.DefinitionsTTL > 0 {
+		prober.EnableMetricDefinitionsCache(definitionsCache, Opts.Cache.DefinitionsTTL)
+	}
+
 	if !prober.FetchFromCache() {
 		for _, subscription := range settings.Subscriptions {
 			prober.ServiceDiscovery.FindSubscriptionResources(subscription, settings.Filter)
@@ -77,7 +100,16 @@ func probeMetricsListHandler(w http.ResponseWriter, r *http.Request) {
 			}).Observe(time.Since(startTime).Seconds())
 		})
 
-		prober.Run()
+		prober.RegisterRequestResultCallback(probeRequestResultCallback(r, config.ProbeMetricsListUrl, settings.Filter))
+
+		if err := prober.Run(); err != nil {
+			contextLogger.Warnln(err)
+			if Opts.Prober.FailureResponse != ProbeFailureResponseMetrics {
+				http.Error(w, err.Error(), probeErrorStatusCode(err))
+				return
+			}
+			prober.PublishProbeFailure(err)
+		}
 	} else {
 		w.Header().Add("X-metrics-cached", "true")
 		for _, subscriptionId := range settings.Subscriptions {
@@ -90,6 +122,7 @@ func probeMetricsListHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	prober.PublishProbeStatus(startTime)
 	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
 	h.ServeHTTP(w, r)
 
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+	"github.com/webdevops/azure-metrics-exporter/metrics"
+
+	"go.uber.org/zap"
+)
+
+func probeMetricsLogAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var timeoutSeconds float64
+
+	startTime := time.Now()
+	contextLogger := buildContextLoggerFromRequest(r)
+	registry := prometheus.NewRegistry()
+
+	// If a timeout is configured via the Prometheus header, add it to the request.
+	timeoutSeconds, err = getPrometheusTimeout(r, config.ProbeMetricsLogAnalyticsTimeoutDefault)
+	if err != nil {
+		contextLogger.Warnln(err)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, fmt.Errorf("failed to parse timeout from Prometheus header: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := newProbeContext(r, timeoutSeconds)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	var settings metrics.RequestMetricSettings
+	if settings, err = metrics.NewRequestMetricSettingsForLogAnalytics(r, Opts); err != nil {
+		contextLogger.Warnln(err)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, err, http.StatusBadRequest)
+		return
+	}
+
+	workspace, err := paramsGetRequired(r.URL.Query(), "workspace")
+	if err != nil {
+		contextLogger.Warnln(err)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, err, http.StatusBadRequest)
+		return
+	}
+
+	if !isLogAnalyticsWorkspaceAllowed(workspace) {
+		err := fmt.Errorf(`workspace "%s" is not allowed, allow it with --probe.loganalytics.workspace`, workspace)
+		contextLogger.Warnln(err)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, err, http.StatusForbidden)
+		return
+	}
+
+	query, err := paramsGetRequired(r.URL.Query(), "query")
+	if err != nil {
+		contextLogger.Warnln(err)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, err, http.StatusBadRequest)
+		return
+	}
+
+	prober := metrics.NewMetricProber(ctx, contextLogger, w, &settings, Opts)
+	prober.SetUserAgent(userAgent())
+	prober.SetAzureClient(AzureClient)
+	prober.SetPrometheusRegistry(registry)
+	if settings.Cache != nil {
+		cacheKey := probeCacheKey("loganalytics", r)
+		prober.EnableMetricsCache(metricsCache, cacheKey, settings.CacheDuration(startTime))
+	}
+
+	if Opts.Azure.ServiceDiscovery.CacheDuration.Seconds() > 0 {
+		prober.EnableServiceDiscoveryCache(azureCache, Opts.Azure.ServiceDiscovery.CacheDuration)
+	}
+
+	if !prober.FetchFromCache() {
+		prober.RegisterRequestResultCallback(probeRequestResultCallback(r, config.ProbeMetricsLogAnalyticsUrl, ""))
+
+		if err := prober.RunLogAnalyticsQuery(workspace, query); err != nil {
+			contextLogger.Warnln(err)
+			if Opts.Prober.FailureResponse != ProbeFailureResponseMetrics {
+				http.Error(w, err.Error(), probeErrorStatusCode(err))
+				return
+			}
+			prober.PublishProbeFailure(err)
+		}
+
+		prometheusCollectTime.With(prometheus.Labels{
+			"subscriptionID": "",
+			"handler":        config.ProbeMetricsLogAnalyticsUrl,
+			"filter":         "",
+		}).Observe(time.Since(startTime).Seconds())
+	} else {
+		w.Header().Add("X-metrics-cached", "true")
+		prometheusMetricRequests.With(prometheus.Labels{
+			"subscriptionID": "",
+			"handler":        config.ProbeMetricsLogAnalyticsUrl,
+			"filter":         "",
+			"result":         "cached",
+		}).Inc()
+	}
+
+	prober.PublishProbeStatus(startTime)
+	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	h.ServeHTTP(w, r)
+
+	latency := time.Since(startTime)
+	contextLogger.With(
+		zap.String("method", r.Method),
+		zap.Int("status", http.StatusOK),
+		zap.String("latency", latency.String()),
+	).Debug("Request handled for /probe/metrics/loganalytics")
+}
+
+// isLogAnalyticsWorkspaceAllowed checks the workspace against the allowed workspaces (--probe.loganalytics.workspace),
+// workspaces are compared case-insensitive as passed (workspace id or resource id)
+func isLogAnalyticsWorkspaceAllowed(workspace string) bool {
+	for _, allowedWorkspace := range Opts.Prober.LogAnalytics.Workspaces {
+		if strings.EqualFold(strings.TrimSpace(allowedWorkspace), workspace) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func TestIsLogAnalyticsWorkspaceAllowed(t *testing.T) {
+	defer func(opts config.Opts) { Opts = opts }(Opts)
+
+	testCases := []struct {
+		name       string
+		workspaces []string
+		workspace  string
+		expected   bool
+	}{
+		{"disabled", nil, "00000000-0000-0000-0000-000000000001", false},
+		{"allowed", []string{"00000000-0000-0000-0000-000000000001"}, "00000000-0000-0000-0000-000000000001", true},
+		{"case-insensitive", []string{"/subscriptions/xxx/resourceGroups/rg/providers/Microsoft.OperationalInsights/workspaces/ws"}, "/subscriptions/xxx/resourcegroups/rg/providers/microsoft.operationalinsights/workspaces/ws", true},
+		{"other workspace", []string{"00000000-0000-0000-0000-000000000001"}, "00000000-0000-0000-0000-000000000002", false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			Opts.Prober.LogAnalytics.Workspaces = testCase.workspaces
+			if ret := isLogAnalyticsWorkspaceAllowed(testCase.workspace); ret != testCase.expected {
+				t.Errorf("expected %v, got %v", testCase.expected, ret)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"go.uber.org/zap"
+
+	"github.com/webdevops/azure-metrics-exporter/metrics"
+)
+
+var (
+	debugRawRedactRegexp = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+)
+
+const (
+	debugRawRedactValue = "00000000-0000-0000-0000-000000000000"
+)
+
+// writeRawMetricsResponse writes the raw Azure Monitor responses as pretty printed JSON
+func writeRawMetricsResponse(w http.ResponseWriter, responseList []metrics.RawMetricsResponse, contextLogger *zap.SugaredLogger) {
+	if responseList == nil {
+		responseList = []metrics.RawMetricsResponse{}
+	}
+
+	content, err := json.MarshalIndent(responseList, "", "  ")
+	if err != nil {
+		contextLogger.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// redact ids (subscriptions, tenants, ...)
+	if Opts.Server.Debug.RawRedact {
+		content = debugRawRedactRegexp.ReplaceAll(content, []byte(debugRawRedactValue))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(content); err != nil {
+		contextLogger.Error(err)
+	}
+}
+
+// writeDryRunResponse writes the dry-run diagnostic as pretty printed JSON (status 400 if a parameter is invalid)
+func writeDryRunResponse(w http.ResponseWriter, result metrics.DryRunResult, contextLogger *zap.SugaredLogger) {
+	content, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		contextLogger.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	statusCode := http.StatusOK
+	if !result.Valid {
+		contextLogger.Warnf(`dry-run: parameter "%s" is invalid: %s`, result.Parameter, result.Error)
+		statusCode = http.StatusBadRequest
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if _, err := w.Write(content); err != nil {
+		contextLogger.Error(err)
+	}
+}
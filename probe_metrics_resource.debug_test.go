@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+	"github.com/webdevops/azure-metrics-exporter/metrics"
+)
+
+func TestWriteRawMetricsResponse(t *testing.T) {
+	defer func(opts config.Opts) { Opts = opts }(Opts)
+
+	resourceId := "/subscriptions/12345678-90ab-cdef-1234-567890abcdef/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/sa1"
+	responseList := []metrics.RawMetricsResponse{
+		{ResourceID: resourceId, Metrics: []string{"Transactions"}, StatusCode: 200, Response: json.RawMessage(`{"value": []}`)},
+	}
+
+	testCases := []struct {
+		name         string
+		redact       bool
+		responseList []metrics.RawMetricsResponse
+		expected     string
+		notExpected  string
+	}{
+		{"no responses", false, nil, "[]", ""},
+		{"response", false, responseList, "12345678-90ab-cdef-1234-567890abcdef", ""},
+		{"redacted", true, responseList, "/subscriptions/00000000-0000-0000-0000-000000000000/", "12345678-90ab-cdef-1234-567890abcdef"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			Opts.Server.Debug.RawRedact = testCase.redact
+
+			w := httptest.NewRecorder()
+			writeRawMetricsResponse(w, testCase.responseList, zap.NewNop().Sugar())
+
+			if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("expected json content type, got %q", contentType)
+			}
+			if !json.Valid(w.Body.Bytes()) {
+				t.Errorf("expected valid json, got %s", w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), testCase.expected) {
+				t.Errorf("expected %q in response, got %s", testCase.expected, w.Body.String())
+			}
+			if testCase.notExpected != "" && strings.Contains(w.Body.String(), testCase.notExpected) {
+				t.Errorf("expected %q to be redacted, got %s", testCase.notExpected, w.Body.String())
+			}
+		})
+	}
+}
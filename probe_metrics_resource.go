@@ -1,10 +1,9 @@
 package main
 
 import (
-	"context"
-	"crypto/sha1" // #nosec G505
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -21,44 +20,103 @@ func probeMetricsResourceHandler(w http.ResponseWriter, r *http.Request) {
 	var timeoutSeconds float64
 
 	startTime := time.Now()
+
+	// parameters might be passed via POST body (eg. long target lists)
+	if err = mergeRequestBodyParams(w, r); err != nil {
+		buildContextLoggerFromRequest(r).Warnln(err)
+		writeProbeFailure(w, r, negotiateResponseFormat(r, Opts.Prober.Format.Resource), startTime, err, http.StatusBadRequest)
+		return
+	}
+
+	defaultParams := applyProbeDefaultParams(r, config.ProbeMetricsResourceUrl)
 	contextLogger := buildContextLoggerFromRequest(r)
+	if len(defaultParams) >= 1 {
+		contextLogger.Debugf("using default parameters: %s", strings.Join(defaultParams, "&"))
+	}
 	registry := prometheus.NewRegistry()
 
+	format := negotiateResponseFormat(r, Opts.Prober.Format.Resource)
+	switch format {
+	case ResponseFormatPrometheus, ResponseFormatInflux, ResponseFormatJson:
+	default:
+		err := fmt.Errorf(`parameter "format" must be "prometheus", "influx" or "json", got "%s"`, format)
+		contextLogger.Warnln(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// If a timeout is configured via the Prometheus header, add it to the request.
 	timeoutSeconds, err = getPrometheusTimeout(r, config.ProbeMetricsResourceTimeoutDefault)
 	if err != nil {
 		contextLogger.Warnln(err)
-		http.Error(w, fmt.Sprintf("failed to parse timeout from Prometheus header: %s", err), http.StatusBadRequest)
+		writeProbeFailure(w, r, format, startTime, fmt.Errorf("failed to parse timeout from Prometheus header: %w", err), http.StatusBadRequest)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSeconds*float64(time.Second)))
+	ctx, cancel := newProbeContext(r, timeoutSeconds)
 	defer cancel()
 	r = r.WithContext(ctx)
 
 	var settings metrics.RequestMetricSettings
 	if settings, err = metrics.NewRequestMetricSettingsForAzureResourceApi(r, Opts); err != nil {
 		contextLogger.Warnln(err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProbeFailure(w, r, format, startTime, err, http.StatusBadRequest)
 		return
 	}
 
 	if _, err = paramsGetListRequired(r.URL.Query(), "subscription"); err != nil {
 		contextLogger.Warnln(err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProbeFailure(w, r, format, startTime, err, http.StatusBadRequest)
+		return
+	}
+
+	if settings.Autodiscover && !Opts.Prober.Autodiscover.Enabled {
+		err := fmt.Errorf(`parameter "autodiscover=true" is disabled, enable it with --probe.autodiscover.enabled`)
+		contextLogger.Warnln(err)
+		writeProbeFailure(w, r, format, startTime, err, http.StatusForbidden)
+		return
+	}
+
+	debugMode := r.URL.Query().Get("debug")
+	switch debugMode {
+	case "":
+	case "raw":
+		if !Opts.Server.Debug.Raw {
+			err := fmt.Errorf(`parameter "debug=raw" is disabled, enable it with --server.debug.raw`)
+			contextLogger.Warnln(err)
+			writeProbeFailure(w, r, format, startTime, err, http.StatusForbidden)
+			return
+		}
+	default:
+		err := fmt.Errorf(`parameter "debug" must be "raw", got "%s"`, debugMode)
+		contextLogger.Warnln(err)
+		writeProbeFailure(w, r, format, startTime, err, http.StatusBadRequest)
 		return
 	}
 
 	prober := metrics.NewMetricProber(ctx, contextLogger, w, &settings, Opts)
-	prober.SetUserAgent(UserAgent + gitTag)
+	prober.SetUserAgent(userAgent())
 	prober.SetAzureClient(AzureClient)
-	prober.SetAzureResourceTagManager(AzureResourceTagManager)
+	prober.SetAzureResourceTagManager(currentResourceTagManager())
 	prober.SetPrometheusRegistry(registry)
 	if settings.Cache != nil {
-		cacheKey := fmt.Sprintf("resource:%x", sha1.Sum([]byte(r.URL.String()))) // #nosec G401
+		cacheKey := probeCacheKey("resource", r)
 		prober.EnableMetricsCache(metricsCache, cacheKey, settings.CacheDuration(startTime))
 	}
 
+	if Opts.Prober.EmitStaleOnFailure {
+		staleKey := probeCacheKey("resource", r)
+		prober.EnableStaleSeries(staleSeriesCache, staleKey)
+	}
+
+	if Opts.Azure.ServiceDiscovery.CacheDuration.Seconds() > 0 {
+		prober.EnableServiceDiscoveryCache(azureCache, Opts.Azure.ServiceDiscovery.CacheDuration)
+	}
+
+	if Opts.Cache.DefinitionsTTL > 0 {
+		prober.EnableMetricDefinitionsCache(definitionsCache, Opts.Cache.DefinitionsTTL)
+	}
+
 	if resourceList, err := paramsGetListRequired(r.URL.Query(), "target"); err == nil {
 		targetList := []metrics.MetricProbeTarget{}
 		for _, resourceId := range resourceList {
@@ -71,10 +129,20 @@ func probeMetricsResourceHandler(w http.ResponseWriter, r *http.Request) {
 				},
 			)
 		}
+		if settings.DryRun {
+			writeDryRunResponse(w, prober.DryRun(targetList), contextLogger)
+			return
+		}
 		prober.AddTarget(targetList...)
 	} else {
 		contextLogger.Errorln(err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProbeFailure(w, r, format, startTime, err, http.StatusBadRequest)
+		return
+	}
+
+	if debugMode == "raw" {
+		// raw Azure responses are never cached
+		writeRawMetricsResponse(w, prober.RunRaw(), contextLogger)
 		return
 	}
 
@@ -83,26 +151,49 @@ func probeMetricsResourceHandler(w http.ResponseWriter, r *http.Request) {
 			// global stats counter
 			prometheusCollectTime.With(prometheus.Labels{
 				"subscriptionID": subscriptionId,
-				"handler":        config.ProbeMetricsListUrl,
+				"handler":        config.ProbeMetricsResourceUrl,
 				"filter":         settings.Filter,
 			}).Observe(time.Since(startTime).Seconds())
 		})
 
-		prober.Run()
+		prober.RegisterRequestResultCallback(probeRequestResultCallback(r, config.ProbeMetricsResourceUrl, settings.Filter))
+
+		if err := prober.Run(); err != nil {
+			contextLogger.Warnln(err)
+			if Opts.Prober.FailureResponse != ProbeFailureResponseMetrics || format != ResponseFormatPrometheus {
+				http.Error(w, err.Error(), probeErrorStatusCode(err))
+				return
+			}
+			prober.PublishProbeFailure(err)
+		}
 	} else {
 		w.Header().Add("X-metrics-cached", "true")
 		for _, subscriptionId := range settings.Subscriptions {
 			prometheusMetricRequests.With(prometheus.Labels{
 				"subscriptionID": subscriptionId,
-				"handler":        config.ProbeMetricsListUrl,
+				"handler":        config.ProbeMetricsResourceUrl,
 				"filter":         settings.Filter,
 				"result":         "cached",
 			}).Inc()
 		}
 	}
 
-	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
-	h.ServeHTTP(w, r)
+	switch format {
+	case ResponseFormatInflux:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := prober.GetMetricList().WriteInfluxLineProtocol(w, startTime); err != nil {
+			contextLogger.Error(err)
+		}
+	case ResponseFormatJson:
+		w.Header().Set("Content-Type", "application/json")
+		if err := prober.GetMetricList().WriteJson(w); err != nil {
+			contextLogger.Error(err)
+		}
+	default:
+		prober.PublishProbeStatus(startTime)
+		h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+		h.ServeHTTP(w, r)
+	}
 
 	latency := time.Since(startTime)
 	contextLogger.With(
@@ -2,9 +2,9 @@ package main
 
 import (
 	"context"
-	"crypto/sha1" // #nosec G505
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -21,85 +21,114 @@ func probeMetricsResourceGraphHandler(w http.ResponseWriter, r *http.Request) {
 	var timeoutSeconds float64
 
 	startTime := time.Now()
+	defaultParams := applyProbeDefaultParams(r, config.ProbeMetricsResourceGraphUrl)
 	contextLogger := buildContextLoggerFromRequest(r)
+	if len(defaultParams) >= 1 {
+		contextLogger.Debugf("using default parameters: %s", strings.Join(defaultParams, "&"))
+	}
 	registry := prometheus.NewRegistry()
 
 	// If a timeout is configured via the Prometheus header, add it to the request.
 	timeoutSeconds, err = getPrometheusTimeout(r, config.ProbeMetricsResourceGraphTimeoutDefault)
 	if err != nil {
 		contextLogger.Warnln(err)
-		http.Error(w, fmt.Sprintf("failed to parse timeout from Prometheus header: %s", err), http.StatusBadRequest)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, fmt.Errorf("failed to parse timeout from Prometheus header: %w", err), http.StatusBadRequest)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSeconds*float64(time.Second)))
+	ctx, cancel := newProbeContext(r, timeoutSeconds)
 	defer cancel()
 	r = r.WithContext(ctx)
 
 	var settings metrics.RequestMetricSettings
 	if settings, err = metrics.NewRequestMetricSettings(r, Opts); err != nil {
 		contextLogger.Warnln(err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, err, http.StatusBadRequest)
 		return
 	}
 
 	if _, err = paramsGetListRequired(r.URL.Query(), "subscription"); err != nil {
 		contextLogger.Warnln(err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, err, http.StatusBadRequest)
 		return
 	}
 
 	resourceType, err := paramsGetRequired(r.URL.Query(), "resourceType")
 	if err != nil {
 		contextLogger.Warnln(err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, err, http.StatusBadRequest)
 		return
 	}
 
 	prober := metrics.NewMetricProber(ctx, contextLogger, w, &settings, Opts)
-	prober.SetUserAgent(UserAgent + gitTag)
+	prober.SetUserAgent(userAgent())
 	prober.SetAzureClient(AzureClient)
-	prober.SetAzureResourceTagManager(AzureResourceTagManager)
+	prober.SetAzureResourceTagManager(currentResourceTagManager())
 	prober.SetPrometheusRegistry(registry)
 	if settings.Cache != nil {
-		cacheKey := fmt.Sprintf("scrape:%x", sha1.Sum([]byte(r.URL.String()))) // #nosec G401
+		cacheKey := probeCacheKey("scrape", r)
 		prober.EnableMetricsCache(metricsCache, cacheKey, settings.CacheDuration(startTime))
 	}
 
+	if Opts.Prober.EmitStaleOnFailure {
+		staleKey := probeCacheKey("resourcegraph", r)
+		prober.EnableStaleSeries(staleSeriesCache, staleKey)
+	}
+
 	if Opts.Azure.ServiceDiscovery.CacheDuration.Seconds() > 0 {
 		prober.EnableServiceDiscoveryCache(azureCache, Opts.Azure.ServiceDiscovery.CacheDuration)
 	}
 
+	if Opts.Cache.DefinitionsTTL > 0 {
+		prober.EnableMetricDefinitionsCache(definitionsCache, Opts.Cache.DefinitionsTTL)
+	}
+
 	if !prober.FetchFromCache() {
-		err := prober.ServiceDiscovery.FindResourceGraph(ctx, settings.Subscriptions, resourceType, settings.Filter)
+		graphCtx, graphCancel := resourceGraphContext(ctx, Opts.Azure.ResourceGraph.Timeout)
+		err := prober.ServiceDiscovery.FindResourceGraph(graphCtx, settings.Subscriptions, resourceType, settings.Filter)
+		graphCancel()
 		if err != nil {
 			contextLogger.Errorln(err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+			if Opts.Prober.FailureResponse != ProbeFailureResponseMetrics {
+				http.Error(w, err.Error(), probeErrorStatusCode(err))
+				return
+			}
+			// without discovered resources there is nothing to collect
+			prober.PublishProbeFailureReason(metrics.ClassifyGraphError(err))
+		} else {
+			prober.RegisterSubscriptionCollectFinishCallback(func(subscriptionId string) {
+				// global stats counter
+				prometheusCollectTime.With(prometheus.Labels{
+					"subscriptionID": subscriptionId,
+					"handler":        config.ProbeMetricsResourceGraphUrl,
+					"filter":         settings.Filter,
+				}).Observe(time.Since(startTime).Seconds())
+			})
+
+			prober.RegisterRequestResultCallback(probeRequestResultCallback(r, config.ProbeMetricsResourceGraphUrl, settings.Filter))
+
+			if err := prober.Run(); err != nil {
+				contextLogger.Warnln(err)
+				if Opts.Prober.FailureResponse != ProbeFailureResponseMetrics {
+					http.Error(w, err.Error(), probeErrorStatusCode(err))
+					return
+				}
+				prober.PublishProbeFailure(err)
+			}
 		}
-
-		prober.RegisterSubscriptionCollectFinishCallback(func(subscriptionId string) {
-			// global stats counter
-			prometheusCollectTime.With(prometheus.Labels{
-				"subscriptionID": subscriptionId,
-				"handler":        config.ProbeMetricsListUrl,
-				"filter":         settings.Filter,
-			}).Observe(time.Since(startTime).Seconds())
-		})
-
-		prober.Run()
 	} else {
 		w.Header().Add("X-metrics-cached", "true")
 		for _, subscriptionId := range settings.Subscriptions {
 			prometheusMetricRequests.With(prometheus.Labels{
 				"subscriptionID": subscriptionId,
-				"handler":        config.ProbeMetricsListUrl,
+				"handler":        config.ProbeMetricsResourceGraphUrl,
 				"filter":         settings.Filter,
 				"result":         "cached",
 			}).Inc()
 		}
 	}
 
+	prober.PublishProbeStatus(startTime)
 	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
 	h.ServeHTTP(w, r)
 
@@ -110,3 +139,12 @@ func probeMetricsResourceGraphHandler(w http.ResponseWriter, r *http.Request) {
 		zap.String("latency", latency.String()),
 	).Debug("Request handled for /probe/metrics/resourcegraph")
 }
+
+// resourceGraphContext returns the context for the ResourceGraph query with its own timeout (--azure.resourcegraph.timeout),
+// the request deadline is still the upper bound
+func resourceGraphContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
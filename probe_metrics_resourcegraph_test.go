@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestResourceGraphContextTimeout(t *testing.T) {
+	testCases := []struct {
+		name            string
+		requestTimeout  time.Duration
+		graphTimeout    time.Duration
+		expectedTimeout time.Duration
+	}{
+		{"graph timeout", 60 * time.Second, 10 * time.Second, 10 * time.Second},
+		{"request deadline as upper bound", 5 * time.Second, 10 * time.Second, 5 * time.Second},
+		{"without graph timeout", 60 * time.Second, 0, 60 * time.Second},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			requestCtx, requestCancel := context.WithTimeout(context.Background(), testCase.requestTimeout)
+			defer requestCancel()
+
+			graphCtx, graphCancel := resourceGraphContext(requestCtx, testCase.graphTimeout)
+			defer graphCancel()
+
+			deadline, ok := graphCtx.Deadline()
+			if !ok {
+				t.Fatal("expected deadline for ResourceGraph query")
+			}
+
+			if timeout := time.Until(deadline); timeout > testCase.expectedTimeout || timeout < testCase.expectedTimeout-time.Second {
+				t.Errorf("expected timeout of %v, got %v", testCase.expectedTimeout, timeout)
+			}
+		})
+	}
+}
+
+func TestResourceGraphContextExpires(t *testing.T) {
+	graphCtx, graphCancel := resourceGraphContext(context.Background(), time.Millisecond)
+	defer graphCancel()
+
+	select {
+	case <-graphCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected ResourceGraph context to expire after the graph timeout")
+	}
+
+	if probeErrorStatusCode(graphCtx.Err()) != http.StatusGatewayTimeout {
+		t.Errorf("expected status 504 for expired ResourceGraph query, got %v", probeErrorStatusCode(graphCtx.Err()))
+	}
+}
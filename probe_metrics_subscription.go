@@ -1,10 +1,9 @@
 package main
 
 import (
-	"context"
-	"crypto/sha1" // #nosec G505
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -21,67 +20,105 @@ func probeMetricsSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
 	var timeoutSeconds float64
 
 	startTime := time.Now()
+
+	// parameters might be passed via POST body (eg. long target lists)
+	if err = mergeRequestBodyParams(w, r); err != nil {
+		buildContextLoggerFromRequest(r).Warnln(err)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, err, http.StatusBadRequest)
+		return
+	}
+
+	defaultParams := applyProbeDefaultParams(r, config.ProbeMetricsSubscriptionUrl)
 	contextLogger := buildContextLoggerFromRequest(r)
+	if len(defaultParams) >= 1 {
+		contextLogger.Debugf("using default parameters: %s", strings.Join(defaultParams, "&"))
+	}
 	registry := prometheus.NewRegistry()
 
 	// If a timeout is configured via the Prometheus header, add it to the request.
 	timeoutSeconds, err = getPrometheusTimeout(r, config.ProbeMetricsSubscriptionTimeoutDefault)
 	if err != nil {
 		contextLogger.Warn(err)
-		http.Error(w, fmt.Sprintf("failed to parse timeout from Prometheus header: %s", err), http.StatusBadRequest)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, fmt.Errorf("failed to parse timeout from Prometheus header: %w", err), http.StatusBadRequest)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSeconds*float64(time.Second)))
+	ctx, cancel := newProbeContext(r, timeoutSeconds)
 	defer cancel()
 	r = r.WithContext(ctx)
 
 	var settings metrics.RequestMetricSettings
 	if settings, err = metrics.NewRequestMetricSettingsForAzureResourceApi(r, Opts); err != nil {
 		contextLogger.Warnln(err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, err, http.StatusBadRequest)
+		return
+	}
+
+	if len(settings.CompareOffsets) >= 1 {
+		err := fmt.Errorf(`parameter "compareOffsets" is not supported by %s`, config.ProbeMetricsSubscriptionUrl)
+		contextLogger.Warnln(err)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, err, http.StatusBadRequest)
 		return
 	}
 
 	if _, err = paramsGetListRequired(r.URL.Query(), "subscription"); err != nil {
 		contextLogger.Warnln(err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProbeFailure(w, r, ResponseFormatPrometheus, startTime, err, http.StatusBadRequest)
 		return
 	}
 
 	prober := metrics.NewMetricProber(ctx, contextLogger, w, &settings, Opts)
-	prober.SetUserAgent(UserAgent + gitTag)
+	prober.SetUserAgent(userAgent())
 	prober.SetAzureClient(AzureClient)
-	prober.SetAzureResourceTagManager(AzureResourceTagManager)
+	prober.SetAzureResourceTagManager(currentResourceTagManager())
 	prober.SetPrometheusRegistry(registry)
 	if settings.Cache != nil {
-		cacheKey := fmt.Sprintf("list:%x", sha1.Sum([]byte(r.URL.String()))) // #nosec G401
+		cacheKey := probeCacheKey("list", r)
 		prober.EnableMetricsCache(metricsCache, cacheKey, settings.CacheDuration(startTime))
 	}
 
+	if Opts.Prober.EmitStaleOnFailure {
+		staleKey := probeCacheKey("subscription", r)
+		prober.EnableStaleSeries(staleSeriesCache, staleKey)
+	}
+
+	if Opts.Azure.ServiceDiscovery.CacheDuration.Seconds() > 0 {
+		prober.EnableServiceDiscoveryCache(azureCache, Opts.Azure.ServiceDiscovery.CacheDuration)
+	}
+
 	if !prober.FetchFromCache() {
 		prober.RegisterSubscriptionCollectFinishCallback(func(subscriptionId string) {
 			// global stats counter
 			prometheusCollectTime.With(prometheus.Labels{
 				"subscriptionID": subscriptionId,
-				"handler":        config.ProbeMetricsListUrl,
+				"handler":        config.ProbeMetricsSubscriptionUrl,
 				"filter":         settings.Filter,
 			}).Observe(time.Since(startTime).Seconds())
 		})
 
-		prober.RunOnSubscriptionScope()
+		prober.RegisterRequestResultCallback(probeRequestResultCallback(r, config.ProbeMetricsSubscriptionUrl, settings.Filter))
+
+		if err := prober.RunOnSubscriptionScope(); err != nil {
+			contextLogger.Warnln(err)
+			if Opts.Prober.FailureResponse != ProbeFailureResponseMetrics {
+				http.Error(w, err.Error(), probeErrorStatusCode(err))
+				return
+			}
+			prober.PublishProbeFailure(err)
+		}
 	} else {
 		w.Header().Add("X-metrics-cached", "true")
 		for _, subscriptionId := range settings.Subscriptions {
 			prometheusMetricRequests.With(prometheus.Labels{
 				"subscriptionID": subscriptionId,
-				"handler":        config.ProbeMetricsListUrl,
+				"handler":        config.ProbeMetricsSubscriptionUrl,
 				"filter":         settings.Filter,
 				"result":         "cached",
 			}).Inc()
 		}
 	}
 
+	prober.PublishProbeStatus(startTime)
 	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
 	h.ServeHTTP(w, r)
 
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+)
+
+const (
+	// requestBodyMaxSize limits the size of POST bodies with probe parameters
+	requestBodyMaxSize = 1 << 20
+)
+
+// mergeRequestBodyParams merges the parameters of a POST body (JSON object or form) into the query of the request,
+// so all parameters can be read from r.URL.Query(); requests with other methods are not modified
+func mergeRequestBodyParams(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return nil
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, requestBodyMaxSize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return fmt.Errorf("request body exceeds %d bytes", maxBytesErr.Limit)
+		}
+		return fmt.Errorf("unable to read request body: %w", err)
+	}
+
+	bodyParams := url.Values{}
+	if len(body) >= 1 {
+		contentType := "application/x-www-form-urlencoded"
+		if val := r.Header.Get("Content-Type"); val != "" {
+			if contentType, _, err = mime.ParseMediaType(val); err != nil {
+				return fmt.Errorf("invalid Content-Type header: %w", err)
+			}
+		}
+
+		switch contentType {
+		case "application/json":
+			if bodyParams, err = parseJsonBodyParams(body); err != nil {
+				return err
+			}
+		case "application/x-www-form-urlencoded":
+			if bodyParams, err = url.ParseQuery(string(body)); err != nil {
+				return fmt.Errorf("unable to parse form body: %w", err)
+			}
+		default:
+			return fmt.Errorf(`unsupported Content-Type "%s", expected "application/json" or "application/x-www-form-urlencoded"`, contentType)
+		}
+	}
+
+	params := r.URL.Query()
+	for name, values := range bodyParams {
+		params[name] = append(params[name], values...)
+	}
+	r.URL.RawQuery = params.Encode()
+
+	return nil
+}
+
+// parseJsonBodyParams parses a JSON object with string or string list values (eg. {"subscription": "xxx", "target": ["a", "b"]})
+func parseJsonBodyParams(body []byte) (url.Values, error) {
+	ret := url.Values{}
+
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(body, &data); err != nil {
+		return ret, fmt.Errorf("unable to parse JSON body, expected object with string or string list values: %w", err)
+	}
+
+	for name, rawValue := range data {
+		if string(rawValue) == "null" {
+			continue
+		}
+
+		var value string
+		if err := json.Unmarshal(rawValue, &value); err == nil {
+			ret.Add(name, value)
+			continue
+		}
+
+		var valueList []string
+		if err := json.Unmarshal(rawValue, &valueList); err == nil {
+			ret[name] = append(ret[name], valueList...)
+			continue
+		}
+
+		return ret, fmt.Errorf(`parameter "%s" in JSON body must be a string or a list of strings`, name)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeRequestBodyParams(t *testing.T) {
+	testCases := []struct {
+		name          string
+		method        string
+		query         string
+		contentType   string
+		body          string
+		expected      url.Values
+		expectedError string
+	}{
+		{
+			name:     "GET",
+			method:   http.MethodGet,
+			query:    "subscription=xxx&target=a",
+			body:     "target=b",
+			expected: url.Values{"subscription": {"xxx"}, "target": {"a"}},
+		},
+		{
+			name:        "JSON",
+			method:      http.MethodPost,
+			contentType: "application/json; charset=utf-8",
+			body:        `{"subscription": "xxx", "target": ["a", "b"], "filter": null}`,
+			expected:    url.Values{"subscription": {"xxx"}, "target": {"a", "b"}},
+		},
+		{
+			name:        "JSON merged with query",
+			method:      http.MethodPost,
+			query:       "subscription=xxx&target=a",
+			contentType: "application/json",
+			body:        `{"target": "b"}`,
+			expected:    url.Values{"subscription": {"xxx"}, "target": {"a", "b"}},
+		},
+		{
+			name:        "form",
+			method:      http.MethodPost,
+			contentType: "application/x-www-form-urlencoded",
+			body:        "subscription=xxx&target=a&target=b",
+			expected:    url.Values{"subscription": {"xxx"}, "target": {"a", "b"}},
+		},
+		{
+			name:     "form without Content-Type",
+			method:   http.MethodPost,
+			body:     "subscription=xxx",
+			expected: url.Values{"subscription": {"xxx"}},
+		},
+		{
+			name:     "empty body",
+			method:   http.MethodPost,
+			query:    "subscription=xxx",
+			expected: url.Values{"subscription": {"xxx"}},
+		},
+		{
+			name:          "malformed JSON",
+			method:        http.MethodPost,
+			contentType:   "application/json",
+			body:          `{"subscription": "xxx"`,
+			expectedError: "unable to parse JSON body",
+		},
+		{
+			name:          "JSON array",
+			method:        http.MethodPost,
+			contentType:   "application/json",
+			body:          `["xxx"]`,
+			expectedError: "unable to parse JSON body",
+		},
+		{
+			name:          "JSON number value",
+			method:        http.MethodPost,
+			contentType:   "application/json",
+			body:          `{"subscription": 1}`,
+			expectedError: `parameter "subscription" in JSON body must be a string or a list of strings`,
+		},
+		{
+			name:          "malformed form",
+			method:        http.MethodPost,
+			contentType:   "application/x-www-form-urlencoded",
+			body:          "subscription=%zz",
+			expectedError: "unable to parse form body",
+		},
+		{
+			name:          "unsupported Content-Type",
+			method:        http.MethodPost,
+			contentType:   "text/plain",
+			body:          "subscription=xxx",
+			expectedError: `unsupported Content-Type "text/plain"`,
+		},
+		{
+			name:          "too large",
+			method:        http.MethodPost,
+			contentType:   "application/x-www-form-urlencoded",
+			body:          "target=" + strings.Repeat("a", requestBodyMaxSize),
+			expectedError: "request body exceeds",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			r := httptest.NewRequest(testCase.method, "/probe/metrics?"+testCase.query, strings.NewReader(testCase.body))
+			if testCase.contentType != "" {
+				r.Header.Set("Content-Type", testCase.contentType)
+			}
+
+			err := mergeRequestBodyParams(httptest.NewRecorder(), r)
+			if testCase.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+					t.Errorf("expected error %q, got %v", testCase.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if params := r.URL.Query(); !reflect.DeepEqual(params, testCase.expected) {
+				t.Errorf("expected %v, got %v", testCase.expected, params)
+			}
+		})
+	}
+}
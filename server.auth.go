@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+var (
+	prometheusHttpAuthFailed prometheus.Counter
+)
+
+// authEnabled checks if bearer token or basic auth is configured
+func authEnabled() bool {
+	return Opts.Server.Auth.BearerToken != "" || Opts.Server.Auth.BasicUser != ""
+}
+
+// isAuthRequiredRequest checks if the request must be authenticated
+// (health checks are always public, exporter metrics depend on --server.auth.protect-metrics)
+func isAuthRequiredRequest(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/healthz", "/readyz":
+		return false
+	case config.MetricsUrl:
+		return Opts.Server.Auth.ProtectMetrics
+	}
+
+	return true
+}
+
+// authMiddleware validates the Authorization header (bearer token or basic auth), failed requests are rejected with 401
+func authMiddleware(next http.Handler) http.Handler {
+	if !authEnabled() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isAuthRequiredRequest(r) && !isAuthorizedRequest(r) {
+			buildContextLoggerFromRequest(r).Warn("rejecting request, authentication failed")
+			prometheusHttpAuthFailed.Inc()
+
+			if Opts.Server.Auth.BasicUser != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="azure-metrics-exporter", charset="UTF-8"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isAuthorizedRequest checks the Authorization header against the configured credentials (constant-time comparison)
+func isAuthorizedRequest(r *http.Request) bool {
+	if token := Opts.Server.Auth.BearerToken; token != "" {
+		header := r.Header.Get("Authorization")
+		if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+			if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(header[7:])), []byte(token)) == 1 {
+				return true
+			}
+		}
+	}
+
+	if user := Opts.Server.Auth.BasicUser; user != "" {
+		if requestUser, requestPassword, ok := r.BasicAuth(); ok {
+			userMatch := subtle.ConstantTimeCompare([]byte(requestUser), []byte(user))
+			passwordMatch := subtle.ConstantTimeCompare([]byte(requestPassword), []byte(Opts.Server.Auth.BasicPassword))
+			if userMatch&passwordMatch == 1 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	ContentEncodingGzip = "gzip"
+	ContentEncodingZstd = "zstd"
+)
+
+type (
+	// compressionResponseWriter buffers the response until the threshold is reached and compresses it afterwards,
+	// smaller responses are sent uncompressed
+	compressionResponseWriter struct {
+		w         http.ResponseWriter
+		encoding  string
+		threshold int
+
+		statusCode int
+		buf        bytes.Buffer
+		encoder    io.WriteCloser
+		started    bool
+	}
+)
+
+// compressionMiddleware compresses probe responses (gzip or zstd, negotiated by Accept-Encoding)
+// if they are larger than threshold bytes (negative threshold = disabled)
+func compressionMiddleware(next http.Handler, threshold int) http.Handler {
+	if threshold < 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/probe/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		encoding := negotiateContentEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// compression is done here (promhttp would compress regardless of the threshold)
+		r = r.Clone(r.Context())
+		r.Header.Del("Accept-Encoding")
+
+		cw := &compressionResponseWriter{
+			w:          w,
+			encoding:   encoding,
+			threshold:  threshold,
+			statusCode: http.StatusOK,
+		}
+		defer func() {
+			if err := cw.Close(); err != nil {
+				buildContextLoggerFromRequest(r).Warnf("unable to compress response: %v", err)
+			}
+		}()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateContentEncoding returns the preferred supported encoding (zstd before gzip) of the Accept-Encoding header
+func negotiateContentEncoding(acceptEncoding string) string {
+	offered := map[string]bool{}
+	for _, value := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(value, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		// encodings with q=0 are not acceptable
+		if q, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if val, err := strconv.ParseFloat(q, 64); err == nil && val <= 0 {
+				continue
+			}
+		}
+		offered[name] = true
+	}
+
+	switch {
+	case offered[ContentEncodingZstd]:
+		return ContentEncodingZstd
+	case offered[ContentEncodingGzip]:
+		return ContentEncodingGzip
+	default:
+		return ""
+	}
+}
+
+func (c *compressionResponseWriter) Header() http.Header {
+	return c.w.Header()
+}
+
+func (c *compressionResponseWriter) WriteHeader(statusCode int) {
+	if !c.started {
+		c.statusCode = statusCode
+	}
+}
+
+func (c *compressionResponseWriter) Write(data []byte) (int, error) {
+	switch {
+	case c.encoder != nil:
+		return c.encoder.Write(data)
+	case c.started:
+		return c.w.Write(data)
+	}
+
+	c.buf.Write(data)
+	if c.buf.Len() >= c.threshold {
+		if err := c.startCompression(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// startCompression sends the header and the buffered response through the encoder,
+// responses already encoded by the handler are passed through
+func (c *compressionResponseWriter) startCompression() error {
+	c.started = true
+
+	header := c.w.Header()
+	if header.Get("Content-Encoding") != "" {
+		c.w.WriteHeader(c.statusCode)
+		_, err := c.buf.WriteTo(c.w)
+		return err
+	}
+
+	header.Set("Content-Encoding", c.encoding)
+	header.Add("Vary", "Accept-Encoding")
+	header.Del("Content-Length")
+	c.w.WriteHeader(c.statusCode)
+
+	switch c.encoding {
+	case ContentEncodingZstd:
+		encoder, err := zstd.NewWriter(c.w, zstd.WithEncoderLevel(zstd.SpeedFastest))
+		if err != nil {
+			return err
+		}
+		c.encoder = encoder
+	default:
+		c.encoder = gzip.NewWriter(c.w)
+	}
+
+	_, err := c.buf.WriteTo(c.encoder)
+	return err
+}
+
+// Close finishes the compressed response or sends the buffered response uncompressed (below threshold)
+func (c *compressionResponseWriter) Close() error {
+	if c.encoder != nil {
+		return c.encoder.Close()
+	}
+
+	if !c.started {
+		c.started = true
+		c.w.WriteHeader(c.statusCode)
+		_, err := c.buf.WriteTo(c.w)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"go.uber.org/zap"
+)
+
+func TestNegotiateContentEncoding(t *testing.T) {
+	testCases := []struct {
+		name           string
+		acceptEncoding string
+		expected       string
+	}{
+		{"empty", "", ""},
+		{"gzip", "gzip", ContentEncodingGzip},
+		{"zstd", "zstd", ContentEncodingZstd},
+		{"zstd preferred", "gzip, deflate, zstd", ContentEncodingZstd},
+		{"case insensitive", " GZip ", ContentEncodingGzip},
+		{"quality", "gzip;q=0.5, zstd;q=0.1", ContentEncodingZstd},
+		{"zstd not acceptable", "zstd;q=0, gzip", ContentEncodingGzip},
+		{"not acceptable", "gzip;q=0.0", ""},
+		{"invalid quality", "gzip;q=abc", ContentEncodingGzip},
+		{"unsupported", "deflate, br", ""},
+		{"identity", "identity", ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if encoding := negotiateContentEncoding(testCase.acceptEncoding); encoding != testCase.expected {
+				t.Errorf("expected %q, got %q", testCase.expected, encoding)
+			}
+		})
+	}
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	logger = zap.NewNop().Sugar()
+
+	body := strings.Repeat("azurerm_resource_metric 1\n", 100)
+
+	testCases := []struct {
+		name             string
+		url              string
+		acceptEncoding   string
+		threshold        int
+		expectedEncoding string
+	}{
+		{"gzip", "/probe/metrics", "gzip", 100, ContentEncodingGzip},
+		{"zstd", "/probe/metrics", "gzip, zstd", 100, ContentEncodingZstd},
+		{"below threshold", "/probe/metrics", "gzip", len(body) + 1, ""},
+		{"without threshold", "/probe/metrics", "gzip", 0, ContentEncodingGzip},
+		{"not accepted", "/probe/metrics", "", 100, ""},
+		{"other handler", "/metrics", "gzip", 100, ""},
+		{"disabled", "/probe/metrics", "gzip", -1, ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			handler := compressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// compression is not done twice by the handler
+				if strings.HasPrefix(r.URL.Path, "/probe/") && testCase.threshold >= 0 && r.Header.Get("Accept-Encoding") != "" {
+					t.Errorf("expected Accept-Encoding to be removed, got %v", r.Header.Get("Accept-Encoding"))
+				}
+				w.WriteHeader(http.StatusAccepted)
+				for _, line := range strings.SplitAfter(body, "\n") {
+					_, _ = w.Write([]byte(line))
+				}
+			}), testCase.threshold)
+
+			r := httptest.NewRequest("GET", testCase.url, nil)
+			if testCase.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", testCase.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != http.StatusAccepted {
+				t.Errorf("expected status %v, got %v", http.StatusAccepted, w.Code)
+			}
+			if encoding := w.Header().Get("Content-Encoding"); encoding != testCase.expectedEncoding {
+				t.Errorf("expected Content-Encoding %q, got %q", testCase.expectedEncoding, encoding)
+			}
+
+			var reader io.Reader = w.Body
+			switch testCase.expectedEncoding {
+			case ContentEncodingGzip:
+				gzipReader, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				reader = gzipReader
+			case ContentEncodingZstd:
+				zstdReader, err := zstd.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer zstdReader.Close()
+				reader = zstdReader
+			}
+
+			content, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(content, []byte(body)) {
+				t.Errorf("expected body of %v bytes, got %v bytes", len(body), len(content))
+			}
+		})
+	}
+}
+
+// responses already encoded by the handler are passed through
+func TestCompressionMiddlewareEncodedResponse(t *testing.T) {
+	logger = zap.NewNop().Sugar()
+
+	handler := compressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "br")
+		_, _ = w.Write([]byte("encoded"))
+	}), 0)
+
+	r := httptest.NewRequest("GET", "/probe/metrics", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if encoding := w.Header().Get("Content-Encoding"); encoding != "br" {
+		t.Errorf("expected Content-Encoding br, got %v", encoding)
+	}
+	if w.Body.String() != "encoded" {
+		t.Errorf("expected unchanged body, got %v", w.Body.String())
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type (
+	// probeProgress tracks the progress of a probe for the deadline response
+	probeProgress struct {
+		startTime        time.Time
+		requestsFinished atomic.Int64
+
+		// ctx is the parent context of the probe, cancelled when the deadline response was sent
+		ctx context.Context
+	}
+
+	probeProgressContextKey struct{}
+
+	// deadlineResponseWriter passes the response through until the deadline response was sent,
+	// afterwards all writes of the handler are discarded
+	deadlineResponseWriter struct {
+		w      http.ResponseWriter
+		header http.Header
+
+		lock        sync.Mutex
+		wroteHeader bool
+		timedOut    bool
+	}
+
+	deadlineResponse struct {
+		Error            string `json:"error"`
+		Elapsed          string `json:"elapsed"`
+		RequestsFinished int64  `json:"requestsFinished"`
+	}
+)
+
+// probeProgressFromRequest returns the probe progress of the request (nil if not tracked)
+func probeProgressFromRequest(r *http.Request) *probeProgress {
+	if progress, ok := r.Context().Value(probeProgressContextKey{}).(*probeProgress); ok {
+		return progress
+	}
+	return nil
+}
+
+// newProbeContext returns the context of a probe with the (Prometheus) timeout, the probe isn't cancelled if the
+// client disconnects but if writeDeadlineMiddleware has already responded with 504
+func newProbeContext(r *http.Request, timeoutSeconds float64) (context.Context, context.CancelFunc) {
+	parent := context.Background()
+	if progress := probeProgressFromRequest(r); progress != nil {
+		parent = progress.ctx
+	}
+	return context.WithTimeout(parent, time.Duration(timeoutSeconds*float64(time.Second)))
+}
+
+// probeRequestResultCallback returns the request result callback of a probe handler which tracks the probe progress
+// and the global request stats
+func probeRequestResultCallback(r *http.Request, handler, filter string) func(subscriptionId, result string) {
+	progress := probeProgressFromRequest(r)
+	return func(subscriptionId, result string) {
+		progress.RequestFinished()
+
+		// global stats counter
+		prometheusMetricRequests.With(prometheus.Labels{
+			"subscriptionID": subscriptionId,
+			"handler":        handler,
+			"filter":         filter,
+			"result":         result,
+		}).Inc()
+	}
+}
+
+// RequestFinished counts a finished Azure request of the probe
+func (p *probeProgress) RequestFinished() {
+	if p != nil {
+		p.requestsFinished.Add(1)
+	}
+}
+
+func (d *deadlineResponseWriter) Header() http.Header {
+	return d.header
+}
+
+func (d *deadlineResponseWriter) WriteHeader(statusCode int) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.timedOut || d.wroteHeader {
+		return
+	}
+	d.writeHeader(statusCode)
+}
+
+func (d *deadlineResponseWriter) Write(data []byte) (int, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	if !d.wroteHeader {
+		d.writeHeader(http.StatusOK)
+	}
+	return d.w.Write(data)
+}
+
+func (d *deadlineResponseWriter) writeHeader(statusCode int) {
+	for name, values := range d.header {
+		d.w.Header()[name] = values
+	}
+	d.wroteHeader = true
+	d.w.WriteHeader(statusCode)
+}
+
+// timeout sends the deadline response if the handler hasn't started the response yet
+func (d *deadlineResponseWriter) timeout(response deadlineResponse) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.wroteHeader {
+		return false
+	}
+	d.timedOut = true
+
+	d.w.Header().Set("Content-Type", "application/json")
+	d.w.WriteHeader(http.StatusGatewayTimeout)
+	_ = json.NewEncoder(d.w).Encode(response)
+	return true
+}
+
+// writeDeadlineMiddleware responds with 504 (including the progress of the probe) if a probe is still running
+// shortly before the server write timeout is reached, instead of an aborted response
+func writeDeadlineMiddleware(next http.Handler, writeTimeout, margin time.Duration) http.Handler {
+	deadline := writeTimeout - margin
+	if writeTimeout <= 0 || margin <= 0 || deadline <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/probe/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		probeCtx, probeCancel := context.WithCancel(context.Background())
+		defer probeCancel()
+
+		progress := &probeProgress{startTime: time.Now()}
+		progress.ctx = context.WithValue(probeCtx, probeProgressContextKey{}, progress)
+		r = r.WithContext(context.WithValue(r.Context(), probeProgressContextKey{}, progress))
+
+		dw := &deadlineResponseWriter{w: w, header: http.Header{}}
+
+		finished := make(chan struct{})
+		panicChan := make(chan any, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicChan <- p
+				}
+			}()
+			next.ServeHTTP(dw, r)
+			close(finished)
+		}()
+
+		timer := time.NewTimer(deadline)
+		defer timer.Stop()
+
+		select {
+		case <-finished:
+		case p := <-panicChan:
+			panic(p)
+		case <-timer.C:
+			response := deadlineResponse{
+				Error: fmt.Sprintf(
+					"probe did not finish within the server write timeout (%v), the probe is too expensive: narrow the query (eg. fewer targets, metrics or dimensions)",
+					writeTimeout,
+				),
+				Elapsed:          time.Since(progress.startTime).Round(time.Millisecond).String(),
+				RequestsFinished: progress.requestsFinished.Load(),
+			}
+
+			if dw.timeout(response) {
+				// stop the probe, its response is discarded anyway
+				probeCancel()
+
+				buildContextLoggerFromRequest(r).With(
+					"elapsed", response.Elapsed,
+					"requestsFinished", response.RequestsFinished,
+				).Warn("probe exceeded server write timeout, responded with 504")
+				return
+			}
+
+			// response already started, wait for handler
+			select {
+			case <-finished:
+			case p := <-panicChan:
+				panic(p)
+			}
+		}
+	})
+}
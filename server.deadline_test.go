@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestWriteDeadlineMiddleware(t *testing.T) {
+	logger = zap.NewNop().Sugar()
+
+	testCases := []struct {
+		name              string
+		url               string
+		writeTimeout      time.Duration
+		probeDuration     time.Duration
+		startResponse     bool
+		expectedStatus    int
+		expectedCancelled bool
+	}{
+		{"fast probe", "/probe/metrics", 300 * time.Millisecond, 0, false, http.StatusOK, false},
+		{"slow probe", "/probe/metrics", 300 * time.Millisecond, 5 * time.Second, false, http.StatusGatewayTimeout, true},
+		{"slow probe with started response", "/probe/metrics", 300 * time.Millisecond, 300 * time.Millisecond, true, http.StatusOK, false},
+		{"slow other handler", "/metrics", 300 * time.Millisecond, 300 * time.Millisecond, false, http.StatusOK, false},
+		{"disabled", "/probe/metrics", 0, 300 * time.Millisecond, false, http.StatusOK, false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			cancelled := make(chan bool, 1)
+			handler := writeDeadlineMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				progress := probeProgressFromRequest(r)
+				progress.RequestFinished()
+				progress.RequestFinished()
+
+				if testCase.startResponse {
+					w.WriteHeader(http.StatusOK)
+				}
+
+				ctx, cancel := newProbeContext(r, 10)
+				defer cancel()
+				select {
+				case <-ctx.Done():
+					cancelled <- true
+					return
+				case <-time.After(testCase.probeDuration):
+					cancelled <- false
+				}
+
+				_, _ = w.Write([]byte("ok"))
+			}), testCase.writeTimeout, 200*time.Millisecond)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, testCase.url, nil))
+
+			if w.Code != testCase.expectedStatus {
+				t.Errorf("expected status %v, got %v", testCase.expectedStatus, w.Code)
+			}
+
+			// probe is stopped after the deadline response
+			select {
+			case ret := <-cancelled:
+				if ret != testCase.expectedCancelled {
+					t.Errorf("expected probe cancelled %v, got %v", testCase.expectedCancelled, ret)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("expected probe to finish")
+			}
+
+			if testCase.expectedStatus != http.StatusGatewayTimeout {
+				if body := w.Body.String(); body != "ok" {
+					t.Errorf("expected response of the probe, got %q", body)
+				}
+				return
+			}
+
+			response := deadlineResponse{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Error == "" || response.Elapsed == "" {
+				t.Errorf("expected error and elapsed time, got %v", response)
+			}
+			if response.RequestsFinished != 2 {
+				t.Errorf("expected 2 finished requests, got %v", response.RequestsFinished)
+			}
+		})
+	}
+}
+
+// writes of the handler after the deadline response are discarded
+func TestDeadlineResponseWriterTimedOut(t *testing.T) {
+	w := httptest.NewRecorder()
+	dw := &deadlineResponseWriter{w: w, header: http.Header{}}
+
+	if !dw.timeout(deadlineResponse{Error: "timeout"}) {
+		t.Fatal("expected deadline response")
+	}
+
+	dw.Header().Set("Content-Type", "text/plain")
+	dw.WriteHeader(http.StatusOK)
+	if _, err := dw.Write([]byte("ok")); !errors.Is(err, http.ErrHandlerTimeout) {
+		t.Errorf("expected %v, got %v", http.ErrHandlerTimeout, err)
+	}
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected status %v, got %v", http.StatusGatewayTimeout, w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("expected Content-Type application/json, got %q", contentType)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+	"github.com/webdevops/azure-metrics-exporter/metrics"
+)
+
+const (
+	ProbeRejectReasonQueueFull        = "queue_full"
+	ProbeRejectReasonCircuitOpen      = "circuit_open"
+	ProbeRejectReasonRateLimited      = "rate_limited"
+	ProbeRejectReasonConcurrencyLimit = "concurrency_limit"
+)
+
+var (
+	prometheusHttpRequestsInflight prometheus.Gauge
+
+	probeRejectReasons = []string{
+		ProbeRejectReasonQueueFull,
+		ProbeRejectReasonCircuitOpen,
+		ProbeRejectReasonRateLimited,
+		ProbeRejectReasonConcurrencyLimit,
+	}
+)
+
+func initServerMetrics() {
+	prometheusHttpRequestsInflight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "azurerm_http_requests_inflight",
+			Help: "Number of HTTP requests currently handled by the exporter",
+		},
+	)
+	prometheus.MustRegister(prometheusHttpRequestsInflight)
+
+	prometheusHttpAuthFailed = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "azurerm_http_auth_failed_total",
+			Help: "Number of HTTP requests rejected because of failed authentication",
+		},
+	)
+	prometheus.MustRegister(prometheusHttpAuthFailed)
+
+	prometheus.MustRegister(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "azurerm_stats_inflight_requests",
+			Help: "Number of Azure API requests currently holding a slot of the global concurrency limit",
+		},
+		func() float64 {
+			return float64(metrics.AzureRequestSemaphore.Inflight())
+		},
+	))
+
+	prometheus.MustRegister(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "azurerm_connection_breaker_open",
+			Help: "Azure connection breaker state (1 = open, probes are rejected because Azure is unreachable)",
+		},
+		func() float64 {
+			if metrics.AzureConnectionBreaker.IsOpen() {
+				return 1
+			}
+			return 0
+		},
+	))
+}
+
+// isLimitedRequest checks if the request is subject to the request limit
+// (health checks and exporter metrics must be available even when the exporter is busy)
+func isLimitedRequest(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/healthz", "/readyz", config.MetricsUrl:
+		return false
+	}
+
+	return !strings.HasPrefix(r.URL.Path, "/debug/pprof/")
+}
+
+// setRetryAfterHeader sets the Retry-After header (seconds, at least one second) for shed requests
+func setRetryAfterHeader(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+}
+
+// concurrencyLimitMiddleware limits the number of concurrent handled requests, excess requests are rejected with 503
+func concurrencyLimitMiddleware(next http.Handler, maxConcurrentRequests int) http.Handler {
+	var slots chan struct{}
+	if maxConcurrentRequests > 0 {
+		slots = make(chan struct{}, maxConcurrentRequests)
+	}
+
+	// moving average of the duration of limited requests (nanoseconds), used to estimate when a slot gets free
+	var avgDuration atomic.Int64
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slots != nil && isLimitedRequest(r) {
+			select {
+			case slots <- struct{}{}:
+				startTime := time.Now()
+				defer func() {
+					<-slots
+					duration := time.Since(startTime).Nanoseconds()
+					if avg := avgDuration.Load(); avg > 0 {
+						duration = (avg*9 + duration) / 10
+					}
+					avgDuration.Store(duration)
+				}()
+			default:
+				buildContextLoggerFromRequest(r).Warnf("rejecting request, too many concurrent requests (limit %v)", maxConcurrentRequests)
+				prometheusProbeRejected.WithLabelValues(ProbeRejectReasonConcurrencyLimit).Inc()
+				setRetryAfterHeader(w, time.Duration(avgDuration.Load()))
+				http.Error(w, "too many concurrent requests", http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		prometheusHttpRequestsInflight.Inc()
+		defer prometheusHttpRequestsInflight.Dec()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// connectionBreakerMiddleware rejects probes with 503 while Azure is unreachable (see --azure.connection-breaker.threshold)
+func connectionBreakerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/probe/") {
+			if allowed, cooldown := metrics.AzureConnectionBreaker.Allow(); !allowed {
+				buildContextLoggerFromRequest(r).Warn("rejecting request, Azure is unreachable (connection breaker open)")
+				prometheusProbeRejected.WithLabelValues(ProbeRejectReasonCircuitOpen).Inc()
+				setRetryAfterHeader(w, cooldown)
+				http.Error(w, "Azure is unreachable, connection breaker open", http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
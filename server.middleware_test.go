@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/webdevops/go-common/azuresdk/armclient"
+	"go.uber.org/zap"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+	"github.com/webdevops/azure-metrics-exporter/metrics"
+)
+
+type testAzureTransport func(r *http.Request) (*http.Response, error)
+
+func (transport testAzureTransport) Do(r *http.Request) (*http.Response, error) {
+	return transport(r)
+}
+
+// initTestServerMetrics creates the server metrics without registering them
+func initTestServerMetrics() {
+	logger = zap.NewNop().Sugar()
+	prometheusHttpRequestsInflight = prometheus.NewGauge(prometheus.GaugeOpts{Name: "azurerm_http_requests_inflight"})
+	prometheusProbeRejected = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "azurerm_probe_rejected_total"}, []string{"reason"})
+}
+
+// sendTestAzureRequest sends an Azure request with the policies of the probes (global concurrency, connection breaker)
+// to transport
+func sendTestAzureRequest(t *testing.T, ctx context.Context, transport testAzureTransport) error {
+	t.Helper()
+
+	azureClient, err := armclient.NewArmClientWithCloudName("AzurePublicCloud", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientOpts := metrics.NewArmClientOptions(azureClient, Opts)
+	clientOpts.Transport = transport
+
+	req, err := runtime.NewRequest(ctx, http.MethodGet, "https://management.azure.com/subscriptions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = runtime.NewPipeline("test", "v0.0.0", runtime.PipelineOptions{}, &clientOpts.ClientOptions).Do(req)
+	return err
+}
+
+func TestProbeRejected(t *testing.T) {
+	defer func(opts config.Opts) { Opts = opts }(Opts)
+	defer metrics.ConfigureConnectionBreaker(0, 0)
+	defer metrics.ConfigureAzureRequestConcurrency(0, nil)
+
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	okTransport := testAzureTransport(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody, Request: r}, nil
+	})
+
+	testCases := []struct {
+		reason string
+		// reject sends requests until one is rejected
+		reject func(t *testing.T)
+	}{
+		{
+			reason: ProbeRejectReasonQueueFull,
+			reject: func(t *testing.T) {
+				Opts.Prober.ConcurrencyGlobal = 1
+				initAzureRequestLimits()
+
+				started, release := make(chan struct{}), make(chan struct{})
+				go func() {
+					_ = sendTestAzureRequest(t, context.Background(), func(r *http.Request) (*http.Response, error) {
+						close(started)
+						<-release
+						return okTransport(r)
+					})
+				}()
+				<-started
+				defer close(release)
+
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				defer cancel()
+				if err := sendTestAzureRequest(t, ctx, okTransport); err == nil {
+					t.Error("expected request without free slot to fail")
+				}
+			},
+		},
+		{
+			reason: ProbeRejectReasonCircuitOpen,
+			reject: func(t *testing.T) {
+				Opts.Azure.ConnectionBreaker.Threshold = 1
+				Opts.Azure.ConnectionBreaker.Cooldown = time.Minute
+				initAzureRequestLimits()
+
+				_ = sendTestAzureRequest(t, context.Background(), func(r *http.Request) (*http.Response, error) {
+					return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+				})
+				// a response from Azure closes the breaker again
+				defer func() { _ = sendTestAzureRequest(t, context.Background(), okTransport) }()
+
+				w := httptest.NewRecorder()
+				connectionBreakerMiddleware(okHandler).ServeHTTP(w, httptest.NewRequest(http.MethodGet, config.ProbeMetricsResourceUrl, nil))
+				if w.Code != http.StatusServiceUnavailable {
+					t.Errorf("expected status %v, got %v", http.StatusServiceUnavailable, w.Code)
+				}
+			},
+		},
+		{
+			reason: ProbeRejectReasonRateLimited,
+			reject: func(t *testing.T) {
+				handler := rateLimitMiddleware(okHandler, 1, 1, RateLimitKeyRemoteAddr)
+				for _, expectedStatus := range []int{http.StatusOK, http.StatusTooManyRequests} {
+					w := httptest.NewRecorder()
+					handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, config.ProbeMetricsResourceUrl, nil))
+					if w.Code != expectedStatus {
+						t.Errorf("expected status %v, got %v", expectedStatus, w.Code)
+					}
+				}
+			},
+		},
+		{
+			reason: ProbeRejectReasonConcurrencyLimit,
+			reject: func(t *testing.T) {
+				started, release := make(chan struct{}), make(chan struct{})
+				handler := concurrencyLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Query().Get("block") != "" {
+						close(started)
+						<-release
+					}
+				}), 1)
+
+				go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, config.ProbeMetricsResourceUrl+"?block=1", nil))
+				<-started
+				defer close(release)
+
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, config.ProbeMetricsResourceUrl, nil))
+				if w.Code != http.StatusServiceUnavailable {
+					t.Errorf("expected status %v, got %v", http.StatusServiceUnavailable, w.Code)
+				}
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.reason, func(t *testing.T) {
+			initTestServerMetrics()
+			testCase.reject(t)
+
+			for _, reason := range probeRejectReasons {
+				expected := 0.0
+				if reason == testCase.reason {
+					expected = 1
+				}
+				if value := testutil.ToFloat64(prometheusProbeRejected.WithLabelValues(reason)); value != expected {
+					t.Errorf("%s: expected %v rejections, got %v", reason, expected, value)
+				}
+			}
+		})
+	}
+
+	if metrics.AzureConnectionBreaker.IsOpen() {
+		t.Error("expected closed connection breaker")
+	}
+}
+
+func TestConcurrencyLimitMiddleware(t *testing.T) {
+	initTestServerMetrics()
+
+	// requests to /probe/block are blocked until release is closed
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := concurrencyLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/probe/block" {
+			started <- struct{}{}
+			<-release
+		}
+	}), 2)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/probe/block", nil))
+		}()
+		<-started
+	}
+
+	if inflight := testutil.ToFloat64(prometheusHttpRequestsInflight); inflight != 2 {
+		t.Errorf("expected 2 inflight requests, got %v", inflight)
+	}
+
+	testCases := []struct {
+		url            string
+		expectedStatus int
+	}{
+		{config.ProbeMetricsResourceUrl, http.StatusServiceUnavailable},
+		{config.ProbeMetricsListUrl, http.StatusServiceUnavailable},
+		{"/healthz", http.StatusOK},
+		{"/readyz", http.StatusOK},
+		{config.MetricsUrl, http.StatusOK},
+		{"/debug/pprof/heap", http.StatusOK},
+	}
+
+	for _, testCase := range testCases {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", testCase.url, nil))
+		if w.Code != testCase.expectedStatus {
+			t.Errorf("%s: expected status %v, got %v", testCase.url, testCase.expectedStatus, w.Code)
+		}
+		if w.Code == http.StatusServiceUnavailable && w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: expected Retry-After header", testCase.url)
+		}
+	}
+
+	close(release)
+	wg.Wait()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", config.ProbeMetricsResourceUrl, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %v after requests finished, got %v", http.StatusOK, w.Code)
+	}
+	if inflight := testutil.ToFloat64(prometheusHttpRequestsInflight); inflight != 0 {
+		t.Errorf("expected no inflight requests, got %v", inflight)
+	}
+}
+
+func TestConcurrencyLimitMiddlewareDisabled(t *testing.T) {
+	initTestServerMetrics()
+
+	handler := concurrencyLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), 0)
+	for i := 0; i < 10; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", config.ProbeMetricsResourceUrl, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %v without limit, got %v", http.StatusOK, w.Code)
+		}
+	}
+}
+
+func TestSetRetryAfterHeader(t *testing.T) {
+	testCases := []struct {
+		retryAfter time.Duration
+		expected   string
+	}{
+		{0, "1"},
+		{-time.Second, "1"},
+		{100 * time.Millisecond, "1"},
+		{time.Second, "1"},
+		{1500 * time.Millisecond, "2"},
+		{90 * time.Second, "90"},
+	}
+
+	for _, testCase := range testCases {
+		w := httptest.NewRecorder()
+		setRetryAfterHeader(w, testCase.retryAfter)
+		if value := w.Header().Get("Retry-After"); value != testCase.expected {
+			t.Errorf("%v: expected Retry-After %q, got %q", testCase.retryAfter, testCase.expected, value)
+		}
+	}
+}
+
+// shed responses have a Retry-After header based on the breaker cooldown or the estimated recovery
+func TestShedResponseRetryAfter(t *testing.T) {
+	defer func(opts config.Opts) { Opts = opts }(Opts)
+	defer metrics.ConfigureConnectionBreaker(0, 0)
+	initTestServerMetrics()
+
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	testCases := []struct {
+		name               string
+		handler            func(t *testing.T) http.Handler
+		expectedStatus     int
+		expectedRetryAfter string
+	}{
+		{
+			name: "circuit open",
+			handler: func(t *testing.T) http.Handler {
+				Opts.Azure.ConnectionBreaker.Threshold = 1
+				Opts.Azure.ConnectionBreaker.Cooldown = 90 * time.Second
+				initAzureRequestLimits()
+				_ = sendTestAzureRequest(t, context.Background(), func(r *http.Request) (*http.Response, error) {
+					return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+				})
+				return connectionBreakerMiddleware(okHandler)
+			},
+			expectedStatus:     http.StatusServiceUnavailable,
+			expectedRetryAfter: "90",
+		},
+		{
+			name: "rate limited",
+			handler: func(t *testing.T) http.Handler {
+				handler := rateLimitMiddleware(okHandler, 0.5, 1, RateLimitKeyRemoteAddr)
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, config.ProbeMetricsResourceUrl, nil))
+				return handler
+			},
+			expectedStatus:     http.StatusTooManyRequests,
+			expectedRetryAfter: "2",
+		},
+		{
+			name: "concurrency limit",
+			handler: func(t *testing.T) http.Handler {
+				started, release := make(chan struct{}), make(chan struct{})
+				handler := concurrencyLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Query().Get("block") != "" {
+						close(started)
+						<-release
+					}
+				}), 1)
+				go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, config.ProbeMetricsResourceUrl+"?block=1", nil))
+				<-started
+				t.Cleanup(func() { close(release) })
+				return handler
+			},
+			expectedStatus:     http.StatusServiceUnavailable,
+			expectedRetryAfter: "1",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			testCase.handler(t).ServeHTTP(w, httptest.NewRequest(http.MethodGet, config.ProbeMetricsResourceUrl, nil))
+
+			if w.Code != testCase.expectedStatus {
+				t.Errorf("expected status %v, got %v", testCase.expectedStatus, w.Code)
+			}
+			if value := w.Header().Get("Retry-After"); value != testCase.expectedRetryAfter {
+				t.Errorf("expected Retry-After %q, got %q", testCase.expectedRetryAfter, value)
+			}
+		})
+	}
+
+	// a response from Azure closes the breaker again
+	_ = sendTestAzureRequest(t, context.Background(), func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody, Request: r}, nil
+	})
+	if metrics.AzureConnectionBreaker.IsOpen() {
+		t.Error("expected closed connection breaker")
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RateLimitKeyRemoteAddr   = "remote-addr"
+	RateLimitKeySubscription = "subscription"
+
+	// idle buckets are removed after this duration (they are full again anyway)
+	rateLimitCleanupInterval = 1 * time.Minute
+)
+
+type (
+	// rateLimiter is a token bucket rate limiter with one bucket per client key
+	rateLimiter struct {
+		rate  float64
+		burst float64
+
+		lock        sync.Mutex
+		buckets     map[string]*rateLimitBucket
+		lastCleanup time.Time
+	}
+
+	rateLimitBucket struct {
+		tokens float64
+		last   time.Time
+	}
+)
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:        rate,
+		burst:       float64(burst),
+		buckets:     map[string]*rateLimitBucket{},
+		lastCleanup: time.Now(),
+	}
+}
+
+// Allow takes one token of the bucket of the key, if no token is available the duration
+// until the next token is available is returned
+func (l *rateLimiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.cleanup(now)
+
+	bucket, exists := l.buckets[key]
+	if !exists {
+		bucket = &rateLimitBucket{tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+}
+
+// cleanup removes the buckets which are refilled completely
+func (l *rateLimiter) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < rateLimitCleanupInterval {
+		return
+	}
+	l.lastCleanup = now
+
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// rateLimitKey returns the client key of the request: the remote address or the requested subscriptions
+// (requests without subscription parameter are limited by remote address)
+func rateLimitKey(r *http.Request, keyType string) string {
+	if keyType == RateLimitKeySubscription {
+		if subscriptionList, _ := paramsGetList(r.URL.Query(), "subscription"); len(subscriptionList) >= 1 {
+			for i, subscriptionId := range subscriptionList {
+				subscriptionList[i] = strings.ToLower(strings.TrimSpace(subscriptionId))
+			}
+			slices.Sort(subscriptionList)
+			return "subscription:" + strings.Join(subscriptionList, ",")
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// rateLimitMiddleware limits the probe rate per client (--server.ratelimit.rps and --server.ratelimit.burst),
+// excess probes are rejected with 429
+func rateLimitMiddleware(next http.Handler, rate float64, burst int, keyType string) http.Handler {
+	if rate <= 0 {
+		return next
+	}
+
+	limiter := newRateLimiter(rate, burst)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/probe/") {
+			key := rateLimitKey(r, keyType)
+			if allowed, retryAfter := limiter.Allow(key, time.Now()); !allowed {
+				buildContextLoggerFromRequest(r).Warnf("rejecting request, rate limit of %v requests per second exceeded for %s", rate, key)
+				prometheusProbeRejected.WithLabelValues(ProbeRejectReasonRateLimited).Inc()
+				setRetryAfterHeader(w, retryAfter)
+				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
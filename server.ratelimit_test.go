@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	type request struct {
+		key        string
+		elapsed    time.Duration
+		allowed    bool
+		retryAfter time.Duration
+	}
+
+	testCases := []struct {
+		name     string
+		rate     float64
+		burst    int
+		requests []request
+	}{
+		{
+			name:  "burst",
+			rate:  1,
+			burst: 3,
+			requests: []request{
+				{"a", 0, true, 0},
+				{"a", 0, true, 0},
+				{"a", 0, true, 0},
+				{"a", 0, false, time.Second},
+			},
+		},
+		{
+			name:  "refill",
+			rate:  2,
+			burst: 1,
+			requests: []request{
+				{"a", 0, true, 0},
+				{"a", 250 * time.Millisecond, false, 250 * time.Millisecond},
+				{"a", 500 * time.Millisecond, true, 0},
+			},
+		},
+		{
+			name:  "refill is capped by burst",
+			rate:  1,
+			burst: 2,
+			requests: []request{
+				{"a", 0, true, 0},
+				{"a", 0, true, 0},
+				{"a", time.Hour, true, 0},
+				{"a", time.Hour, true, 0},
+				{"a", time.Hour, false, time.Second},
+			},
+		},
+		{
+			name:  "slow rate",
+			rate:  0.5,
+			burst: 1,
+			requests: []request{
+				{"a", 0, true, 0},
+				{"a", 0, false, 2 * time.Second},
+			},
+		},
+		{
+			name:  "buckets per key",
+			rate:  1,
+			burst: 1,
+			requests: []request{
+				{"a", 0, true, 0},
+				{"a", 0, false, time.Second},
+				{"b", 0, true, 0},
+				{"b", 0, false, time.Second},
+			},
+		},
+		{
+			name:  "cleanup of refilled buckets",
+			rate:  1,
+			burst: 1,
+			requests: []request{
+				{"a", 0, true, 0},
+				{"b", 2 * time.Minute, true, 0},
+				{"a", 2 * time.Minute, true, 0},
+				{"a", 2 * time.Minute, false, time.Second},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			limiter := newRateLimiter(testCase.rate, testCase.burst)
+			for i, request := range testCase.requests {
+				allowed, retryAfter := limiter.Allow(request.key, start.Add(request.elapsed))
+				if allowed != request.allowed {
+					t.Errorf("request %d: expected allowed %v, got %v", i, request.allowed, allowed)
+				}
+				if retryAfter != request.retryAfter {
+					t.Errorf("request %d: expected retry after %v, got %v", i, request.retryAfter, retryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterCleanup(t *testing.T) {
+	start := time.Now()
+	limiter := newRateLimiter(0.01, 1)
+
+	// cleanup runs once per interval
+	limiter.Allow("a", start)
+	limiter.Allow("b", start.Add(30*time.Second))
+	if len(limiter.buckets) != 2 {
+		t.Errorf("expected 2 buckets, got %v", len(limiter.buckets))
+	}
+
+	// buckets which are not refilled yet are kept
+	limiter.Allow("c", start.Add(101*time.Second))
+	if _, exists := limiter.buckets["a"]; exists {
+		t.Error("expected refilled bucket to be removed")
+	}
+	if _, exists := limiter.buckets["b"]; !exists {
+		t.Error("expected bucket which is not refilled to be kept")
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	testCases := []struct {
+		name       string
+		url        string
+		remoteAddr string
+		keyType    string
+		expected   string
+	}{
+		{"remote address", "/probe/metrics?subscription=A", "192.0.2.1:1234", RateLimitKeyRemoteAddr, "addr:192.0.2.1"},
+		{"remote address without port", "/probe/metrics", "192.0.2.1", RateLimitKeyRemoteAddr, "addr:192.0.2.1"},
+		{"ipv6 remote address", "/probe/metrics", "[2001:db8::1]:1234", RateLimitKeyRemoteAddr, "addr:2001:db8::1"},
+		{"subscription", "/probe/metrics?subscription=A", "192.0.2.1:1234", RateLimitKeySubscription, "subscription:a"},
+		{"subscription list", "/probe/metrics?subscription=B,%20a&subscription=C", "192.0.2.1:1234", RateLimitKeySubscription, "subscription:a,b,c"},
+		{"without subscription", "/probe/metrics", "192.0.2.1:1234", RateLimitKeySubscription, "addr:192.0.2.1"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", testCase.url, nil)
+			r.RemoteAddr = testCase.remoteAddr
+			if key := rateLimitKey(r, testCase.keyType); key != testCase.expected {
+				t.Errorf("expected %v, got %v", testCase.expected, key)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armsubscriptions"
+	"github.com/webdevops/go-common/azuresdk/armclient"
+)
+
+const (
+	// result of the readiness checks is cached to not query Azure on every /readyz request
+	readyCheckCacheDuration      = 30 * time.Second
+	readyCheckAzureCacheDuration = 10 * time.Second
+	readyCheckTimeout            = 10 * time.Second
+)
+
+type (
+	// readyCheck caches the result of a readiness check
+	readyCheck struct {
+		lock      sync.Mutex
+		lastCheck time.Time
+		err       error
+	}
+)
+
+var (
+	readyResourceGraphCheck readyCheck
+	readyAzureCheck         readyCheck
+)
+
+// run executes the check if the cached result is older than cacheDuration
+func (c *readyCheck) run(cacheDuration time.Duration, check func(ctx context.Context) error) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if time.Since(c.lastCheck) < cacheDuration {
+		return c.err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), readyCheckTimeout)
+	defer cancel()
+
+	c.err = check(ctx)
+	if c.err != nil {
+		logger.Warn(c.err)
+	}
+	c.lastCheck = time.Now()
+
+	return c.err
+}
+
+// checkReadyResourceGraph checks if ResourceGraph is reachable with a trivial query (result cached for readyCheckCacheDuration)
+func checkReadyResourceGraph() error {
+	return readyResourceGraphCheck.run(readyCheckCacheDuration, func(ctx context.Context) error {
+		if _, err := AzureClient.ExecuteResourceGraphQuery(ctx, "Resources | take 1 | project id", armclient.ResourceGraphOptions{}); err != nil {
+			return fmt.Errorf("resourcegraph not available: %w", err)
+		}
+		return nil
+	})
+}
+
+// checkReadyAzure checks if ARM is reachable and the credentials are valid by fetching the first page of the subscription list
+// (result cached for readyCheckAzureCacheDuration)
+func checkReadyAzure() error {
+	return readyAzureCheck.run(readyCheckAzureCacheDuration, func(ctx context.Context) error {
+		client, err := armsubscriptions.NewClient(AzureClient.GetCred(), AzureClient.NewArmClientOptions())
+		if err != nil {
+			return fmt.Errorf("azure not available: %w", err)
+		}
+
+		pager := client.NewListPager(nil)
+		if _, err := pager.NextPage(ctx); err != nil {
+			return fmt.Errorf("azure not available: %w", err)
+		}
+		return nil
+	})
+}
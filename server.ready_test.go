@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/fake"
+	"github.com/webdevops/go-common/azuresdk/armclient"
+	"go.uber.org/zap"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+)
+
+func TestReadyCheckCache(t *testing.T) {
+	logger = zap.NewNop().Sugar()
+
+	check := readyCheck{}
+	calls := 0
+	checkErr := errors.New("not available")
+	run := func(cacheDuration time.Duration) error {
+		return check.run(cacheDuration, func(ctx context.Context) error {
+			calls++
+			if _, ok := ctx.Deadline(); !ok {
+				t.Error("expected timeout for readiness check")
+			}
+			return checkErr
+		})
+	}
+
+	testCases := []struct {
+		name          string
+		cacheDuration time.Duration
+		expectedCalls int
+	}{
+		{"first check", time.Minute, 1},
+		{"cached", time.Minute, 1},
+		{"expired", 0, 2},
+	}
+
+	for _, testCase := range testCases {
+		if err := run(testCase.cacheDuration); !errors.Is(err, checkErr) {
+			t.Errorf("%s: expected %v, got %v", testCase.name, checkErr, err)
+		}
+		if calls != testCase.expectedCalls {
+			t.Errorf("%s: expected %v checks, got %v", testCase.name, testCase.expectedCalls, calls)
+		}
+	}
+}
+
+func TestReadyzResourceGraph(t *testing.T) {
+	logger = zap.NewNop().Sugar()
+	defer func(opts config.Opts) { Opts = opts }(Opts)
+	defer func(client *armclient.ArmClient) { AzureClient = client }(AzureClient)
+	defer func() { readyResourceGraphCheck = readyCheck{} }()
+
+	// Azure requests fail without network access as no token is available
+	var err error
+	AzureClient, err = armclient.NewArmClientWithCloudName("AzurePublicCloud", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred := &fake.TokenCredential{}
+	cred.SetError(errors.New("no token available"))
+	setArmClientCredential(AzureClient, cred)
+
+	testCases := []struct {
+		name           string
+		checkGraph     bool
+		cachedResult   bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"check disabled", false, false, http.StatusOK, "Ok"},
+		{"graph unavailable", true, false, http.StatusServiceUnavailable, "resourcegraph not available"},
+		{"graph available (cached)", true, true, http.StatusOK, "Ok"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			Opts.Server.Ready.CheckResourceGraph = testCase.checkGraph
+			readyResourceGraphCheck = readyCheck{}
+			if testCase.cachedResult {
+				readyResourceGraphCheck.lastCheck = time.Now()
+			}
+
+			w := httptest.NewRecorder()
+			newServeMux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if w.Code != testCase.expectedStatus {
+				t.Errorf("expected status %v, got %v", testCase.expectedStatus, w.Code)
+			}
+			if body := w.Body.String(); !strings.Contains(body, testCase.expectedBody) {
+				t.Errorf("expected body %q, got %q", testCase.expectedBody, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	shutdownServers struct {
+		lock sync.Mutex
+		list []*http.Server
+	}
+)
+
+// registerShutdownServer adds a server which is shut down gracefully on SIGTERM/SIGINT
+func registerShutdownServer(srv *http.Server) {
+	shutdownServers.lock.Lock()
+	defer shutdownServers.lock.Unlock()
+	shutdownServers.list = append(shutdownServers.list, srv)
+}
+
+// waitForShutdownSignal blocks until SIGTERM/SIGINT is received and shuts down all registered servers,
+// in-flight requests can finish within the shutdown timeout
+func waitForShutdownSignal(timeout time.Duration) {
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-signalCh
+	signal.Stop(signalCh)
+
+	logger.Infof("received %v, shutting down http servers (timeout %v)", sig, timeout.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	shutdownServers.lock.Lock()
+	defer shutdownServers.lock.Unlock()
+
+	wg := sync.WaitGroup{}
+	for _, srv := range shutdownServers.list {
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				logger.Warnf("http server on %s didn't shut down gracefully: %v", srv.Addr, err)
+				return
+			}
+			logger.Infof("http server on %s stopped", srv.Addr)
+		}(srv)
+	}
+	wg.Wait()
+
+	logger.Info("shutdown finished")
+}
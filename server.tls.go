@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// interval for checking the certificate files for changes
+	tlsCertReloadInterval = 30 * time.Second
+)
+
+type (
+	// tlsCertReloader serves the certificate from cert/key files and reloads it when the files change
+	tlsCertReloader struct {
+		certFile string
+		keyFile  string
+
+		lock    sync.RWMutex
+		cert    *tls.Certificate
+		modTime time.Time
+	}
+)
+
+// newTlsCertReloader loads the certificate and starts watching the files for changes
+func newTlsCertReloader(certFile, keyFile string) (*tlsCertReloader, error) {
+	reloader := &tlsCertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		ticker := time.NewTicker(tlsCertReloadInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if !reloader.filesChanged() {
+				continue
+			}
+
+			if err := reloader.reload(); err != nil {
+				logger.Errorf("unable to reload tls certificate (keeping current certificate): %v", err)
+				continue
+			}
+			logger.Infof("reloaded tls certificate from %v", certFile)
+		}
+	}()
+
+	return reloader, nil
+}
+
+// GetCertificate returns the current certificate (tls.Config.GetCertificate callback)
+func (r *tlsCertReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.cert, nil
+}
+
+func (r *tlsCertReloader) reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load tls certificate: %w", err)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+
+	return nil
+}
+
+// filesChanged checks if cert or key file were modified since the last (successful) load
+func (r *tlsCertReloader) filesChanged() bool {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		logger.Warnf("unable to check tls certificate files: %v", err)
+		return false
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return !modTime.Equal(r.modTime)
+}
+
+func (r *tlsCertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return latest, fmt.Errorf("unable to read tls file: %w", err)
+		}
+
+		if stat.ModTime().After(latest) {
+			latest = stat.ModTime()
+		}
+	}
+	return latest, nil
+}
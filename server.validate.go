@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+	"github.com/webdevops/azure-metrics-exporter/metrics"
+)
+
+type (
+	validateRequest struct {
+		Urls []string `json:"urls"`
+	}
+
+	validateResponse struct {
+		Valid   bool                  `json:"valid"`
+		Results []validateProbeResult `json:"results"`
+	}
+
+	validateProbeResult struct {
+		Url         string `json:"url"`
+		Valid       bool   `json:"valid"`
+		Parameter   string `json:"parameter,omitempty"`
+		ApiRequests int    `json:"apiRequests,omitempty"`
+		Error       string `json:"error,omitempty"`
+	}
+)
+
+// validateHandler runs a list of probe urls (eg. of a scrape config) as dry run and reports per url if the probe is valid,
+// responds with 422 if at least one probe is invalid
+func validateHandler(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	contextLogger := buildContextLoggerFromRequest(r)
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed, use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, requestBodyMaxSize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			err = fmt.Errorf("request body exceeds %d bytes", maxBytesErr.Limit)
+		}
+		contextLogger.Warnln(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var request validateRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		err = fmt.Errorf(`unable to parse request body, expected {"urls": ["/probe/..."]}: %w`, err)
+		contextLogger.Warnln(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(request.Urls) == 0 {
+		err := fmt.Errorf(`parameter "urls" is missing`)
+		contextLogger.Warnln(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(request.Urls) > Opts.Server.Validate.MaxUrls {
+		err := fmt.Errorf(`parameter "urls" exceeds the maximum of %d urls (--server.validate.max-urls)`, Opts.Server.Validate.MaxUrls)
+		contextLogger.Warnln(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := validateResponse{Valid: true}
+	for _, probeUrl := range request.Urls {
+		result := validateProbeUrl(r, probeUrl)
+		response.Valid = response.Valid && result.Valid
+		response.Results = append(response.Results, result)
+	}
+
+	status := http.StatusOK
+	if !response.Valid {
+		status = http.StatusUnprocessableEntity
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		contextLogger.Error(err)
+	}
+
+	latency := time.Since(startTime)
+	contextLogger.With(
+		zap.String("method", r.Method),
+		zap.Int("status", status),
+		zap.String("latency", latency.String()),
+	).Debug("Request handled for /validate")
+}
+
+// validateProbeUrl runs the probe of the url (only path and query are used) as dry run (dryrun=true),
+// the request is sent through the server middlewares (auth, rate and concurrency limits) with the credentials of the validate request
+func validateProbeUrl(r *http.Request, probeUrl string) validateProbeResult {
+	result := validateProbeResult{Url: probeUrl}
+
+	parsedUrl, err := url.Parse(probeUrl)
+	if err != nil {
+		result.Error = fmt.Sprintf("invalid url: %v", err)
+		return result
+	}
+
+	if !strings.HasPrefix(parsedUrl.Path, "/probe/") {
+		result.Error = fmt.Sprintf(`invalid url: path "%s" is not a probe endpoint`, parsedUrl.Path)
+		return result
+	}
+
+	// only probes with dry run support can be validated, other probes would fetch metrics from Azure
+	if parsedUrl.Path != config.ProbeMetricsResourceUrl {
+		result.Error = fmt.Sprintf(`invalid url: path "%s" doesn't support dryrun, only %s can be validated`, parsedUrl.Path, config.ProbeMetricsResourceUrl)
+		return result
+	}
+
+	query := parsedUrl.Query()
+	query.Set("dryrun", "true")
+	parsedUrl.RawQuery = query.Encode()
+
+	ctx, cancel := context.WithTimeout(r.Context(), Opts.Server.Validate.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsedUrl.RequestURI(), nil)
+	if err != nil {
+		result.Error = fmt.Sprintf("invalid url: %v", err)
+		return result
+	}
+	req.RemoteAddr = r.RemoteAddr
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", strconv.FormatFloat(Opts.Server.Validate.Timeout.Seconds(), 'f', -1, 64))
+
+	recorder := httptest.NewRecorder()
+	httpHandler.ServeHTTP(recorder, req)
+
+	var dryRunResult metrics.DryRunResult
+	if err := json.Unmarshal(recorder.Body.Bytes(), &dryRunResult); err != nil {
+		// rejected before the dry run (eg. invalid parameters, rate limit or timeout)
+		result.Error = fmt.Sprintf("status %v: %s", recorder.Code, strings.TrimSpace(recorder.Body.String()))
+		return result
+	}
+
+	if !dryRunResult.Valid {
+		result.Parameter = dryRunResult.Parameter
+		result.Error = dryRunResult.Error
+		return result
+	}
+
+	result.Valid = true
+	result.ApiRequests = dryRunResult.ApiRequests
+	return result
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/webdevops/azure-metrics-exporter/config"
+	"github.com/webdevops/azure-metrics-exporter/metrics"
+)
+
+// newTestValidateHandler returns a probe handler answering dry runs: targets ending with "valid" are valid,
+// targets ending with "missing" have an unavailable metric, probes without dryrun or timeout fail the test
+func newTestValidateHandler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("dryrun") != "true" {
+			t.Errorf("expected probe sent as dry run, got %s", r.URL.String())
+		}
+		if _, ok := r.Context().Deadline(); !ok {
+			t.Error("expected timeout for probe")
+		}
+
+		result := metrics.DryRunResult{}
+		switch target := r.URL.Query().Get("target"); {
+		case strings.HasSuffix(target, "valid"):
+			result.Valid = true
+			result.ApiRequests = 1
+		case strings.HasSuffix(target, "missing"):
+			result.Parameter = "metric"
+			result.Error = `metric "foo" is not available`
+		default:
+			http.Error(w, `parameter "target" is missing`, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(result)
+	})
+}
+
+func TestValidateHandler(t *testing.T) {
+	logger = zap.NewNop().Sugar()
+	defer func(opts config.Opts) { Opts = opts }(Opts)
+	Opts.Server.Validate.MaxUrls = 3
+	Opts.Server.Validate.Timeout = 5 * time.Second
+
+	defer func(handler http.Handler) { httpHandler = handler }(httpHandler)
+	httpHandler = newTestValidateHandler(t)
+
+	testCases := []struct {
+		name           string
+		urls           []string
+		expectedStatus int
+		expectedValid  []bool
+		expectedError  string
+	}{
+		{
+			name:           "valid",
+			urls:           []string{"/probe/metrics/resource?subscription=xxx&target=/subscriptions/xxx/valid&metric=foo"},
+			expectedStatus: http.StatusOK,
+			expectedValid:  []bool{true},
+		},
+		{
+			name: "invalid",
+			urls: []string{
+				"/probe/metrics/resource?subscription=xxx&target=/subscriptions/xxx/valid",
+				"/probe/metrics/resource?subscription=xxx&target=/subscriptions/xxx/missing&metric=foo",
+				"/probe/metrics/resource?subscription=xxx",
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedValid:  []bool{true, false, false},
+		},
+		{
+			name:           "no probe endpoint",
+			urls:           []string{"/metrics"},
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedValid:  []bool{false},
+		},
+		{
+			name:           "probe endpoint without dry run",
+			urls:           []string{"/probe/metrics/resourcegraph?subscription=xxx&resourceType=foo"},
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedValid:  []bool{false},
+		},
+		{
+			name:           "too many urls",
+			urls:           []string{"/probe/metrics/resource", "/probe/metrics/resource", "/probe/metrics/resource", "/probe/metrics/resource"},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "exceeds the maximum of 3 urls",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			body, _ := json.Marshal(validateRequest{Urls: testCase.urls})
+			w := httptest.NewRecorder()
+			validateHandler(w, httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(string(body))))
+
+			if w.Code != testCase.expectedStatus {
+				t.Fatalf("expected status %v, got %v: %s", testCase.expectedStatus, w.Code, w.Body.String())
+			}
+
+			if testCase.expectedError != "" {
+				if !strings.Contains(w.Body.String(), testCase.expectedError) {
+					t.Errorf("expected error %q, got %q", testCase.expectedError, w.Body.String())
+				}
+				return
+			}
+
+			var response validateResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if len(response.Results) != len(testCase.expectedValid) {
+				t.Fatalf("expected %v results, got %v", len(testCase.expectedValid), len(response.Results))
+			}
+			for i, result := range response.Results {
+				if result.Valid != testCase.expectedValid[i] {
+					t.Errorf("%s: expected valid=%v, got %+v", result.Url, testCase.expectedValid[i], result)
+				}
+				if !result.Valid && result.Error == "" {
+					t.Errorf("%s: expected error for invalid probe", result.Url)
+				}
+			}
+		})
+	}
+}
+
+// probes of /validate must pass the middlewares of the server with the credentials of the validate request
+func TestValidateHandlerAuth(t *testing.T) {
+	logger = zap.NewNop().Sugar()
+	defer func(opts config.Opts) { Opts = opts }(Opts)
+	Opts.Server.Auth.BearerToken = "secret"
+	Opts.Server.Validate.Timeout = 5 * time.Second
+	Opts.Server.Validate.MaxUrls = 1
+
+	defer func(handler http.Handler) { httpHandler = handler }(httpHandler)
+	httpHandler = authMiddleware(newTestValidateHandler(t))
+
+	body := `{"urls": ["/probe/metrics/resource?subscription=xxx&target=/subscriptions/xxx/valid"]}`
+	r := httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer secret")
+
+	w := httptest.NewRecorder()
+	validateHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected probe authorized with the credentials of the validate request, got %v: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/webdevops/azure-metrics-exporter/metrics"
+)
+
+// runStartupProbe runs one probe against the exporter endpoints and exits if it fails or produces no series
+func runStartupProbe(url string) {
+	logger.Infof("running startup probe %s", url)
+
+	seriesCount, err := runInternalProbe(newServeMux(), url)
+	if err != nil {
+		logger.Fatalf("startup probe failed: %v", err)
+	}
+
+	logger.Infof("startup probe successful: %v series", seriesCount)
+}
+
+// runInternalProbe runs one probe against the handler and returns the number of series,
+// an error is returned if the probe fails, reports errors or produces no series
+func runInternalProbe(handler http.Handler, url string) (int, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("invalid url: %w", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		return 0, fmt.Errorf("status %v: %s", recorder.Code, strings.TrimSpace(recorder.Body.String()))
+	}
+
+	var parser expfmt.TextParser
+	metricFamilies, err := parser.TextToMetricFamilies(recorder.Body)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse response: %w", err)
+	}
+
+	if metricFamily, exists := metricFamilies[metrics.PrometheusProbeErrorName]; exists {
+		reasons := []string{}
+		for _, metric := range metricFamily.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				reasons = append(reasons, label.GetValue())
+			}
+		}
+		return 0, fmt.Errorf("probe reported errors (reason: %s)", strings.Join(reasons, ", "))
+	}
+
+	if metricFamily, exists := metricFamilies[metrics.PrometheusProbeSuccessName]; exists {
+		for _, metric := range metricFamily.GetMetric() {
+			if metric.GetGauge().GetValue() == 0 {
+				return 0, fmt.Errorf("probe failed (%s is 0)", metrics.PrometheusProbeSuccessName)
+			}
+		}
+	}
+
+	seriesCount := 0
+	for name, metricFamily := range metricFamilies {
+		// probe status metrics are always returned
+		switch name {
+		case metrics.PrometheusProbeCacheHitName, metrics.PrometheusProbeSuccessName, metrics.PrometheusProbeDurationName:
+			continue
+		}
+		seriesCount += len(metricFamily.GetMetric())
+	}
+
+	if seriesCount == 0 {
+		return 0, fmt.Errorf("probe didn't produce any series (check permissions and probe parameters)")
+	}
+
+	return seriesCount, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRunInternalProbe(t *testing.T) {
+	testCases := []struct {
+		name           string
+		statusCode     int
+		body           string
+		expectedSeries int
+		expectedError  string
+	}{
+		{
+			name:       "series",
+			statusCode: http.StatusOK,
+			body: `# TYPE azure_metrics_probe_success gauge
+azure_metrics_probe_success 1
+# TYPE azure_metrics_probe_duration_seconds gauge
+azure_metrics_probe_duration_seconds 1.5
+# TYPE azurerm_resource_metric gauge
+azurerm_resource_metric{resourceID="r1",aggregation="total"} 1
+azurerm_resource_metric{resourceID="r2",aggregation="total"} 2
+`,
+			expectedSeries: 2,
+		},
+		{
+			name:          "no series",
+			statusCode:    http.StatusOK,
+			body:          "# TYPE azure_metrics_probe_success gauge\nazure_metrics_probe_success 1\n# TYPE azurerm_probe_cache_hit gauge\nazurerm_probe_cache_hit{status=\"miss\"} 0\n",
+			expectedError: "didn't produce any series",
+		},
+		{
+			name:          "failed probe",
+			statusCode:    http.StatusOK,
+			body:          "# TYPE azure_metrics_probe_success gauge\nazure_metrics_probe_success 0\nazurerm_resource_metric{resourceID=\"r1\"} 1\n",
+			expectedError: "probe failed",
+		},
+		{
+			name:          "probe errors",
+			statusCode:    http.StatusOK,
+			body:          "azurerm_probe_error{reason=\"forbidden\"} 1\nazurerm_resource_metric{resourceID=\"r1\"} 1\n",
+			expectedError: "reason: forbidden",
+		},
+		{
+			name:          "error status",
+			statusCode:    http.StatusBadRequest,
+			body:          "parameter \"subscription\" is missing\n",
+			expectedError: "status 400: parameter \"subscription\" is missing",
+		},
+		{
+			name:          "invalid response",
+			statusCode:    http.StatusOK,
+			body:          "{\"value\": []}",
+			expectedError: "unable to parse response",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(testCase.statusCode)
+				_, _ = w.Write([]byte(testCase.body))
+			})
+
+			seriesCount, err := runInternalProbe(handler, "/probe/metrics/resource?subscription=xxx")
+			switch {
+			case testCase.expectedError != "":
+				if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+					t.Errorf("expected error %q, got %v", testCase.expectedError, err)
+				}
+			case err != nil:
+				t.Errorf("expected no error, got %v", err)
+			case seriesCount != testCase.expectedSeries:
+				t.Errorf("expected %v series, got %v", testCase.expectedSeries, seriesCount)
+			}
+		})
+	}
+}